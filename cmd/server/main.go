@@ -18,7 +18,12 @@ import (
 
 	"pos-mojosoft-so-service/internal/config"
 	"pos-mojosoft-so-service/internal/handlers"
+	"pos-mojosoft-so-service/internal/inventory"
+	"pos-mojosoft-so-service/internal/jobs"
 	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/notify"
+	"pos-mojosoft-so-service/internal/services"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
@@ -38,6 +43,11 @@ func main() {
 		logrus.Fatal("Failed to initialize tenant database connections:", err)
 	}
 
+	// Watch the tenant registry so tenants can be added or removed without a redeploy
+	if err := tenantDBManager.StartRegistryWatcher(); err != nil {
+		logrus.Fatal("Failed to start tenant registry watcher:", err)
+	}
+
 	// Ensure all tenant connections are closed on shutdown
 	defer func() {
 		if err := tenantDBManager.Close(); err != nil {
@@ -48,35 +58,91 @@ func main() {
 	// Initialize JWT utility
 	jwtUtil := utils.NewJWTUtil(&cfg.JWT)
 
-	// Get a sample tenant DB for health check (use first tenant)
+	// Get a sample tenant DB for health check (use first tenant).
+	// Request handlers resolve their tenant DB per request via middleware.GetTenantDB.
 	var healthCheckDB *gorm.DB
 	if len(cfg.TenantCodes) > 0 {
 		healthCheckDB, _ = tenantDBManager.GetTenantDB(cfg.TenantCodes[0])
 	}
 
+	// Initialize services
+	salesOrderStateMachine := services.NewSalesOrderStateMachine()
+	salesOrderPricing := services.NewSalesOrderPricing()
+	salesOrderLines := services.NewSalesOrderLines()
+	documentNumbering := services.NewDocumentNumbering(cfg.DocNumbering)
+	customerStatements := services.NewCustomerStatements(salesOrderStateMachine)
+	sessionRedemption := services.NewSessionRedemption(salesOrderStateMachine)
+	packageExpiry := services.NewPackageExpiry(salesOrderStateMachine)
+	treatmentWorkflow := services.NewTreatmentWorkflow()
+	staffCommissions := services.NewStaffCommissions(salesOrderStateMachine)
+	receiptAllocation := services.NewReceiptAllocation(salesOrderStateMachine)
+	arAging := services.NewARAging(salesOrderStateMachine)
+	appointmentScheduler := services.NewAppointmentScheduler(salesOrderStateMachine, models.AppointmentHours{
+		OpensAt:     cfg.Appointments.OpensAt,
+		ClosesAt:    cfg.Appointments.ClosesAt,
+		SlotMinutes: cfg.Appointments.SlotMinutes,
+	})
+
+	// Initialize the notifier reminders are delivered through
+	notifier, err := notify.New(cfg.Notifier)
+	if err != nil {
+		logrus.Fatal("Failed to initialize notifier:", err)
+	}
+	treatmentReminders := services.NewTreatmentReminders(salesOrderStateMachine, notifier, cfg.Reminders)
+
+	// Initialize the inventory port treatment stock movements are relayed to
+	inventoryPort, err := inventory.New(cfg.Inventory)
+	if err != nil {
+		logrus.Fatal("Failed to initialize inventory port:", err)
+	}
+	consumableStock := services.NewConsumableStock(inventoryPort, cfg.Inventory)
+
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler(healthCheckDB)
-	salesOrderStatusHandler := handlers.NewSalesOrderStatusHandler(healthCheckDB)
-	salesOrderHandler := handlers.NewSalesOrderHandler(healthCheckDB)
-	salesOrderServiceHandler := handlers.NewSalesOrderServiceHandler(healthCheckDB)
-	salesOrderDetailHandler := handlers.NewSalesOrderDetailHandler(healthCheckDB)
-	remindedHandler := handlers.NewRemindedHandler(healthCheckDB)
-	arReceiptHandler := handlers.NewARReceiptHandler(healthCheckDB)
-	arReceiptDetailHandler := handlers.NewARReceiptDetailHandler(healthCheckDB)
-	treatmentHandler := handlers.NewTreatmentHandler(healthCheckDB)
-	treatmentDetailHandler := handlers.NewTreatmentDetailHandler(healthCheckDB)
-	summaryByTransactionTypeHandler := handlers.NewSummaryByTransactionTypeHandler(healthCheckDB)
-	summaryByPaymentMethodHandler := handlers.NewSummaryByPaymentMethodHandler(healthCheckDB)
-	summaryByTransactionTypeAndPaymentMethodHandler := handlers.NewSummaryByTransactionTypeAndPaymentMethodHandler(healthCheckDB)
-	bookkeepingHandler := handlers.NewBookkeepingHandler(healthCheckDB)
-	bookkeepingDetailHandler := handlers.NewBookkeepingDetailHandler(healthCheckDB)
-	bookkeepingStatusHandler := handlers.NewBookkeepingStatusHandler(healthCheckDB)
-	bookTransactionTypeHandler := handlers.NewBookTransactionTypeHandler(healthCheckDB)
-	bookTransactionCategoryHandler := handlers.NewBookTransactionCategoryHandler(healthCheckDB)
-	paymentMethodHandler := handlers.NewPaymentMethodHandler(healthCheckDB)
+	salesOrderStatusHandler := handlers.NewSalesOrderStatusHandler()
+	salesOrderHandler := handlers.NewSalesOrderHandler(salesOrderStateMachine, salesOrderPricing, salesOrderLines, documentNumbering, packageExpiry)
+	salesOrderServiceHandler := handlers.NewSalesOrderServiceHandler()
+	salesOrderDetailHandler := handlers.NewSalesOrderDetailHandler(salesOrderStateMachine, salesOrderPricing, salesOrderLines)
+	remindedHandler := handlers.NewRemindedHandler()
+	arReceiptHandler := handlers.NewARReceiptHandler(documentNumbering, receiptAllocation)
+	arReceiptDetailHandler := handlers.NewARReceiptDetailHandler(receiptAllocation)
+	treatmentHandler := handlers.NewTreatmentHandler(documentNumbering, sessionRedemption, consumableStock, treatmentWorkflow)
+	treatmentDetailHandler := handlers.NewTreatmentDetailHandler()
+	summaryByTransactionTypeHandler := handlers.NewSummaryByTransactionTypeHandler()
+	summaryByPaymentMethodHandler := handlers.NewSummaryByPaymentMethodHandler()
+	summaryByTransactionTypeAndPaymentMethodHandler := handlers.NewSummaryByTransactionTypeAndPaymentMethodHandler()
+	bookkeepingHandler := handlers.NewBookkeepingHandler()
+	bookkeepingDetailHandler := handlers.NewBookkeepingDetailHandler()
+	bookkeepingStatusHandler := handlers.NewBookkeepingStatusHandler()
+	bookTransactionTypeHandler := handlers.NewBookTransactionTypeHandler()
+	bookTransactionCategoryHandler := handlers.NewBookTransactionCategoryHandler()
+	paymentMethodHandler := handlers.NewPaymentMethodHandler()
+	tenantHandler := handlers.NewTenantHandler(tenantDBManager)
+	permissionHandler := handlers.NewPermissionHandler()
+	customerHandler := handlers.NewCustomerHandler(customerStatements)
+	packageValidityHandler := handlers.NewPackageValidityHandler()
+	reportHandler := handlers.NewReportHandler(packageExpiry, arAging)
+	appointmentHandler := handlers.NewAppointmentHandler(appointmentScheduler)
+	reminderTemplateHandler := handlers.NewReminderTemplateHandler()
+	reminderHandler := handlers.NewReminderHandler(treatmentReminders)
+	unitConversionHandler := handlers.NewUnitConversionHandler()
+	stockMovementHandler := handlers.NewStockMovementHandler(consumableStock)
+	commissionRuleHandler := handlers.NewCommissionRuleHandler()
+	commissionHandler := handlers.NewCommissionHandler(staffCommissions)
 
 	// Setup Gin router
-	router := setupRouter(cfg, jwtUtil, healthHandler, salesOrderStatusHandler, salesOrderHandler, salesOrderServiceHandler, salesOrderDetailHandler, remindedHandler, arReceiptHandler, arReceiptDetailHandler, treatmentHandler, treatmentDetailHandler, summaryByTransactionTypeHandler, summaryByPaymentMethodHandler, summaryByTransactionTypeAndPaymentMethodHandler, bookkeepingHandler, bookkeepingDetailHandler, bookkeepingStatusHandler, bookTransactionTypeHandler, bookTransactionCategoryHandler, paymentMethodHandler)
+	router := setupRouter(cfg, jwtUtil, healthHandler, salesOrderStatusHandler, salesOrderHandler, salesOrderServiceHandler, salesOrderDetailHandler, remindedHandler, arReceiptHandler, arReceiptDetailHandler, treatmentHandler, treatmentDetailHandler, summaryByTransactionTypeHandler, summaryByPaymentMethodHandler, summaryByTransactionTypeAndPaymentMethodHandler, bookkeepingHandler, bookkeepingDetailHandler, bookkeepingStatusHandler, bookTransactionTypeHandler, bookTransactionCategoryHandler, paymentMethodHandler, tenantHandler, permissionHandler, customerHandler, packageValidityHandler, reportHandler, appointmentHandler, reminderTemplateHandler, reminderHandler, unitConversionHandler, stockMovementHandler, commissionRuleHandler, commissionHandler)
+
+	// Start background jobs
+	packageForfeitureJob := jobs.NewPackageForfeitureJob(cfg.Jobs, tenantDBManager, packageExpiry)
+	packageForfeitureJob.Start()
+	defer packageForfeitureJob.Stop()
+	treatmentReminderJob := jobs.NewTreatmentReminderJob(cfg.Jobs, tenantDBManager, treatmentReminders)
+	treatmentReminderJob.Start()
+	defer treatmentReminderJob.Stop()
+	stockRelayJob := jobs.NewStockRelayJob(cfg.Jobs, tenantDBManager, consumableStock)
+	stockRelayJob.Start()
+	defer stockRelayJob.Stop()
 
 	// Create HTTP server
 	server := &http.Server{
@@ -172,6 +238,18 @@ func setupRouter(
 	bookTransactionTypeHandler *handlers.BookTransactionTypeHandler,
 	bookTransactionCategoryHandler *handlers.BookTransactionCategoryHandler,
 	paymentMethodHandler *handlers.PaymentMethodHandler,
+	tenantHandler *handlers.TenantHandler,
+	permissionHandler *handlers.PermissionHandler,
+	customerHandler *handlers.CustomerHandler,
+	packageValidityHandler *handlers.PackageValidityHandler,
+	reportHandler *handlers.ReportHandler,
+	appointmentHandler *handlers.AppointmentHandler,
+	reminderTemplateHandler *handlers.ReminderTemplateHandler,
+	reminderHandler *handlers.ReminderHandler,
+	unitConversionHandler *handlers.UnitConversionHandler,
+	stockMovementHandler *handlers.StockMovementHandler,
+	commissionRuleHandler *handlers.CommissionRuleHandler,
+	commissionHandler *handlers.CommissionHandler,
 ) *gin.Engine {
 	// Set Gin mode
 	if cfg.Logging.Level == "debug" {
@@ -192,206 +270,324 @@ func setupRouter(
 	// Health check endpoint (no auth required)
 	router.GET("/health", healthHandler.Check)
 
+	// Tenant registry admin endpoints (platform JWT required, no tenant header)
+	admin := router.Group("/so/admin")
+	admin.Use(middleware.AuthMiddleware(jwtUtil), middleware.RequirePlatform(), middleware.RequirePermission(middleware.PermissionTenantManage))
+	{
+		admin.GET("/tenants", tenantHandler.GetAll)
+		admin.POST("/tenants/refresh", tenantHandler.Refresh)
+	}
+
 	// Apply TenantMiddleware to all /so/api routes
 	api := router.Group("/so/api")
 	api.Use(middleware.TenantMiddleware())
 	{
+		// Permission catalogue (JWT required)
+		api.GET("/permissions", middleware.AuthMiddleware(jwtUtil), permissionHandler.GetAll)
+
 		// Sales Order Status endpoints (JWT required)
 		statusGroup := api.Group("/sales-order-status")
 		statusGroup.Use(middleware.AuthMiddleware(jwtUtil))
 		{
-			statusGroup.GET("", salesOrderStatusHandler.GetAll)
-			statusGroup.GET("/:id", salesOrderStatusHandler.GetByID)
+			statusGroup.GET("", middleware.RequirePermission(middleware.PermissionSORead), salesOrderStatusHandler.GetAll)
+			statusGroup.GET("/:id", middleware.RequirePermission(middleware.PermissionSORead), salesOrderStatusHandler.GetByID)
 		}
 
-		// Sales Order CRUD endpoints (JWT required)
+		// Sales Order CRUD endpoints (JWT required, location scoped)
 		salesOrders := api.Group("/sales-orders")
-		salesOrders.Use(middleware.AuthMiddleware(jwtUtil))
+		salesOrders.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			salesOrders.GET("", salesOrderHandler.GetAll)
-			salesOrders.GET("/:id", salesOrderHandler.GetByID)
-			salesOrders.POST("", salesOrderHandler.Create)
-			salesOrders.PUT("/:id", salesOrderHandler.Update)
-			salesOrders.DELETE("/:id", salesOrderHandler.Delete)
+			salesOrders.GET("", middleware.RequirePermission(middleware.PermissionSORead), salesOrderHandler.GetAll)
+			salesOrders.GET("/:id", middleware.RequirePermission(middleware.PermissionSORead), salesOrderHandler.GetByID)
+			salesOrders.POST("", middleware.RequirePermission(middleware.PermissionSOCreate), salesOrderHandler.Create)
+			salesOrders.PUT("/:id", middleware.RequirePermission(middleware.PermissionSOUpdate), salesOrderHandler.Update)
+			salesOrders.DELETE("/:id", middleware.RequirePermission(middleware.PermissionSOVoid), salesOrderHandler.Delete)
+			salesOrders.PATCH("/:id/post", middleware.RequirePermission(middleware.PermissionSOPost), salesOrderHandler.Post)
+			salesOrders.PATCH("/:id/void", middleware.RequirePermission(middleware.PermissionSOVoid), salesOrderHandler.Void)
+			salesOrders.PATCH("/:id/reopen", middleware.RequirePermission(middleware.PermissionSOPost), salesOrderHandler.Reopen)
 		}
 
-		// Sales Order Service CRUD endpoints (JWT required)
+		// Sales Order Service CRUD endpoints (JWT required, location scoped)
 		salesOrderServices := api.Group("/sales-order-services")
-		salesOrderServices.Use(middleware.AuthMiddleware(jwtUtil))
+		salesOrderServices.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			salesOrderServices.GET("", salesOrderServiceHandler.GetAll)
-			salesOrderServices.GET("/:id", salesOrderServiceHandler.GetByID)
-			salesOrderServices.POST("", salesOrderServiceHandler.Create)
-			salesOrderServices.PUT("/:id", salesOrderServiceHandler.Update)
-			salesOrderServices.DELETE("/:id", salesOrderServiceHandler.Delete)
-			salesOrderServices.PATCH("/:id/mark-treated", salesOrderServiceHandler.MarkAsTreated)
+			salesOrderServices.GET("", middleware.RequirePermission(middleware.PermissionSORead), salesOrderServiceHandler.GetAll)
+			salesOrderServices.GET("/:id", middleware.RequirePermission(middleware.PermissionSORead), salesOrderServiceHandler.GetByID)
+			salesOrderServices.POST("", middleware.RequirePermission(middleware.PermissionSOCreate), salesOrderServiceHandler.Create)
+			salesOrderServices.PUT("/:id", middleware.RequirePermission(middleware.PermissionSOUpdate), salesOrderServiceHandler.Update)
+			salesOrderServices.DELETE("/:id", middleware.RequirePermission(middleware.PermissionSOVoid), salesOrderServiceHandler.Delete)
+			salesOrderServices.PATCH("/:id/mark-treated", middleware.RequirePermission(middleware.PermissionTreatmentUpdate), salesOrderServiceHandler.MarkAsTreated)
 		}
 
-		// Sales Order Detail CRUD endpoints (JWT required)
+		// Sales Order Detail CRUD endpoints (JWT required, location scoped)
 		salesOrderDetails := api.Group("/sales-order-details")
-		salesOrderDetails.Use(middleware.AuthMiddleware(jwtUtil))
+		salesOrderDetails.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			salesOrderDetails.GET("", salesOrderDetailHandler.GetAll)
-			salesOrderDetails.GET("/:id", salesOrderDetailHandler.GetByID)
-			salesOrderDetails.GET("/by-sales-order/:sales_order_id", salesOrderDetailHandler.GetBySalesOrderID)
-			salesOrderDetails.POST("", salesOrderDetailHandler.Create)
-			salesOrderDetails.PUT("/:id", salesOrderDetailHandler.Update)
-			salesOrderDetails.DELETE("/:id", salesOrderDetailHandler.Delete)
+			salesOrderDetails.GET("", middleware.RequirePermission(middleware.PermissionSORead), salesOrderDetailHandler.GetAll)
+			salesOrderDetails.GET("/:id", middleware.RequirePermission(middleware.PermissionSORead), salesOrderDetailHandler.GetByID)
+			salesOrderDetails.GET("/by-sales-order/:sales_order_id", middleware.RequirePermission(middleware.PermissionSORead), salesOrderDetailHandler.GetBySalesOrderID)
+			salesOrderDetails.POST("", middleware.RequirePermission(middleware.PermissionSOCreate), salesOrderDetailHandler.Create)
+			salesOrderDetails.PUT("/:id", middleware.RequirePermission(middleware.PermissionSOUpdate), salesOrderDetailHandler.Update)
+			salesOrderDetails.DELETE("/:id", middleware.RequirePermission(middleware.PermissionSOVoid), salesOrderDetailHandler.Delete)
 		}
 
 		// Reminded endpoints (JWT required, read-only)
 		reminded := api.Group("/reminded")
 		reminded.Use(middleware.AuthMiddleware(jwtUtil))
 		{
-			reminded.GET("", remindedHandler.GetAll)
-			reminded.GET("/:id", remindedHandler.GetByID)
+			reminded.GET("", middleware.RequirePermission(middleware.PermissionSORead), remindedHandler.GetAll)
+			reminded.GET("/:id", middleware.RequirePermission(middleware.PermissionSORead), remindedHandler.GetByID)
 		}
 
-		// AR Receipt CRUD endpoints (JWT required)
+		// AR Receipt CRUD endpoints (JWT required, location scoped)
 		arReceipts := api.Group("/ar-receipts")
-		arReceipts.Use(middleware.AuthMiddleware(jwtUtil))
+		arReceipts.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			arReceipts.GET("", arReceiptHandler.GetAll)
-			arReceipts.GET("/:id", arReceiptHandler.GetByID)
-			arReceipts.POST("", arReceiptHandler.Create)
-			arReceipts.PUT("/:id", arReceiptHandler.Update)
-			arReceipts.DELETE("/:id", arReceiptHandler.Delete)
+			arReceipts.GET("", middleware.RequirePermission(middleware.PermissionARRead), arReceiptHandler.GetAll)
+			arReceipts.GET("/:id", middleware.RequirePermission(middleware.PermissionARRead), arReceiptHandler.GetByID)
+			arReceipts.POST("", middleware.RequirePermission(middleware.PermissionARCreate), arReceiptHandler.Create)
+			arReceipts.PUT("/:id", middleware.RequirePermission(middleware.PermissionARUpdate), arReceiptHandler.Update)
+			arReceipts.DELETE("/:id", middleware.RequirePermission(middleware.PermissionARVoid), arReceiptHandler.Delete)
+			arReceipts.POST("/:id/allocate", middleware.RequirePermission(middleware.PermissionARUpdate), arReceiptHandler.Allocate)
 		}
 
-		// AR Receipt Detail CRUD endpoints (JWT required)
+		// AR Receipt Detail CRUD endpoints (JWT required, location scoped)
 		arReceiptDetails := api.Group("/ar-receipt-details")
-		arReceiptDetails.Use(middleware.AuthMiddleware(jwtUtil))
+		arReceiptDetails.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			arReceiptDetails.GET("", arReceiptDetailHandler.GetAll)
-			arReceiptDetails.GET("/:id", arReceiptDetailHandler.GetByID)
-			arReceiptDetails.GET("/by-ar-receipt/:ar_receipt_id", arReceiptDetailHandler.GetByARReceiptID)
-			arReceiptDetails.POST("", arReceiptDetailHandler.Create)
-			arReceiptDetails.PUT("/:id", arReceiptDetailHandler.Update)
-			arReceiptDetails.DELETE("/:id", arReceiptDetailHandler.Delete)
+			arReceiptDetails.GET("", middleware.RequirePermission(middleware.PermissionARRead), arReceiptDetailHandler.GetAll)
+			arReceiptDetails.GET("/:id", middleware.RequirePermission(middleware.PermissionARRead), arReceiptDetailHandler.GetByID)
+			arReceiptDetails.GET("/by-ar-receipt/:ar_receipt_id", middleware.RequirePermission(middleware.PermissionARRead), arReceiptDetailHandler.GetByARReceiptID)
+			arReceiptDetails.POST("", middleware.RequirePermission(middleware.PermissionARCreate), arReceiptDetailHandler.Create)
+			arReceiptDetails.PUT("/:id", middleware.RequirePermission(middleware.PermissionARUpdate), arReceiptDetailHandler.Update)
+			arReceiptDetails.DELETE("/:id", middleware.RequirePermission(middleware.PermissionARVoid), arReceiptDetailHandler.Delete)
 		}
 
-		// Treatment CRUD endpoints (JWT required)
+		// Treatment CRUD endpoints (JWT required, location scoped)
 		treatments := api.Group("/treatments")
-		treatments.Use(middleware.AuthMiddleware(jwtUtil))
+		treatments.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
+		{
+			treatments.GET("", middleware.RequirePermission(middleware.PermissionTreatmentRead), treatmentHandler.GetAll)
+			treatments.GET("/:id", middleware.RequirePermission(middleware.PermissionTreatmentRead), treatmentHandler.GetByID)
+			treatments.POST("", middleware.RequirePermission(middleware.PermissionTreatmentCreate), treatmentHandler.Create)
+			treatments.PUT("/:id", middleware.RequirePermission(middleware.PermissionTreatmentUpdate), treatmentHandler.Update)
+			treatments.DELETE("/:id", middleware.RequirePermission(middleware.PermissionTreatmentVoid), treatmentHandler.Delete)
+			treatments.PATCH("/:id/start", middleware.RequirePermission(middleware.PermissionTreatmentUpdate), treatmentHandler.Start)
+			treatments.PATCH("/:id/complete", middleware.RequirePermission(middleware.PermissionTreatmentUpdate), treatmentHandler.Complete)
+			treatments.PATCH("/:id/sign-off", middleware.RequirePermission(middleware.PermissionTreatmentSignOff), treatmentHandler.SignOff)
+			treatments.GET("/:id/corrections", middleware.RequirePermission(middleware.PermissionTreatmentRead), treatmentHandler.GetCorrections)
+			treatments.POST("/:id/corrections", middleware.RequirePermission(middleware.PermissionTreatmentCorrect), treatmentHandler.Correct)
+		}
+
+		// Customer statement endpoints (JWT required, location scoped)
+		customers := api.Group("/customers")
+		customers.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
+		{
+			customers.GET("/:customer_id/statement", middleware.RequirePermission(middleware.PermissionSORead), middleware.RequirePermission(middleware.PermissionARRead), customerHandler.GetStatement)
+			customers.GET("/:customer_id/packages", middleware.RequirePermission(middleware.PermissionSORead), customerHandler.GetPackages)
+		}
+
+		// Report endpoints (JWT required, location scoped)
+		reports := api.Group("/reports")
+		reports.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
+		{
+			reports.GET("/expired-packages", middleware.RequirePermission(middleware.PermissionSORead), reportHandler.GetExpiredPackages)
+			reports.GET("/ar-aging", middleware.RequirePermission(middleware.PermissionSORead), middleware.RequirePermission(middleware.PermissionARRead), reportHandler.GetARAging)
+		}
+
+		// Appointment endpoints (JWT required, location scoped)
+		appointments := api.Group("/appointments")
+		appointments.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			treatments.GET("", treatmentHandler.GetAll)
-			treatments.GET("/:id", treatmentHandler.GetByID)
-			treatments.POST("", treatmentHandler.Create)
-			treatments.PUT("/:id", treatmentHandler.Update)
-			treatments.DELETE("/:id", treatmentHandler.Delete)
+			appointments.GET("", middleware.RequirePermission(middleware.PermissionAppointmentRead), appointmentHandler.GetAll)
+			appointments.GET("/day", middleware.RequirePermission(middleware.PermissionAppointmentRead), appointmentHandler.GetDay)
+			appointments.GET("/availability", middleware.RequirePermission(middleware.PermissionAppointmentRead), appointmentHandler.GetAvailability)
+			appointments.GET("/hours/:location_id", middleware.RequirePermission(middleware.PermissionAppointmentRead), appointmentHandler.GetHours)
+			appointments.PUT("/hours/:location_id", middleware.RequirePermission(middleware.PermissionMasterManage), appointmentHandler.SetHours)
+			appointments.GET("/:id", middleware.RequirePermission(middleware.PermissionAppointmentRead), appointmentHandler.GetByID)
+			appointments.POST("", middleware.RequirePermission(middleware.PermissionAppointmentCreate), appointmentHandler.Create)
+			appointments.PATCH("/:id/reschedule", middleware.RequirePermission(middleware.PermissionAppointmentUpdate), appointmentHandler.Reschedule)
+			appointments.PATCH("/:id/cancel", middleware.RequirePermission(middleware.PermissionAppointmentCancel), appointmentHandler.Cancel)
 		}
 
-		// Treatment Detail CRUD endpoints (JWT required)
+		// Treatment Detail CRUD endpoints (JWT required, location scoped)
 		treatmentDetails := api.Group("/treatment-details")
-		treatmentDetails.Use(middleware.AuthMiddleware(jwtUtil))
+		treatmentDetails.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			treatmentDetails.GET("", treatmentDetailHandler.GetAll)
-			treatmentDetails.GET("/:id", treatmentDetailHandler.GetByID)
-			treatmentDetails.GET("/by-treatment/:treatment_id", treatmentDetailHandler.GetByTreatmentID)
-			treatmentDetails.POST("", treatmentDetailHandler.Create)
-			treatmentDetails.PUT("/:id", treatmentDetailHandler.Update)
-			treatmentDetails.DELETE("/:id", treatmentDetailHandler.Delete)
+			treatmentDetails.GET("", middleware.RequirePermission(middleware.PermissionTreatmentRead), treatmentDetailHandler.GetAll)
+			treatmentDetails.GET("/:id", middleware.RequirePermission(middleware.PermissionTreatmentRead), treatmentDetailHandler.GetByID)
+			treatmentDetails.GET("/by-treatment/:treatment_id", middleware.RequirePermission(middleware.PermissionTreatmentRead), treatmentDetailHandler.GetByTreatmentID)
+			treatmentDetails.POST("", middleware.RequirePermission(middleware.PermissionTreatmentCreate), treatmentDetailHandler.Create)
+			treatmentDetails.PUT("/:id", middleware.RequirePermission(middleware.PermissionTreatmentUpdate), treatmentDetailHandler.Update)
+			treatmentDetails.DELETE("/:id", middleware.RequirePermission(middleware.PermissionTreatmentVoid), treatmentDetailHandler.Delete)
 		}
 
-		// Summary By Transaction Type CRUD endpoints (JWT required)
+		// Summary By Transaction Type CRUD endpoints (JWT required, location scoped)
 		summaryByTransactionType := api.Group("/summary-by-transaction-type")
-		summaryByTransactionType.Use(middleware.AuthMiddleware(jwtUtil))
+		summaryByTransactionType.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			summaryByTransactionType.GET("", summaryByTransactionTypeHandler.GetAll)
-			summaryByTransactionType.GET("/:id", summaryByTransactionTypeHandler.GetByID)
-			summaryByTransactionType.GET("/by-bookkeeping/:bookkeeping_id", summaryByTransactionTypeHandler.GetByBookkeepingID)
-			summaryByTransactionType.POST("", summaryByTransactionTypeHandler.Create)
-			summaryByTransactionType.PUT("/:id", summaryByTransactionTypeHandler.Update)
-			summaryByTransactionType.DELETE("/:id", summaryByTransactionTypeHandler.Delete)
+			summaryByTransactionType.GET("", middleware.RequirePermission(middleware.PermissionBookRead), summaryByTransactionTypeHandler.GetAll)
+			summaryByTransactionType.GET("/:id", middleware.RequirePermission(middleware.PermissionBookRead), summaryByTransactionTypeHandler.GetByID)
+			summaryByTransactionType.GET("/by-bookkeeping/:bookkeeping_id", middleware.RequirePermission(middleware.PermissionBookRead), summaryByTransactionTypeHandler.GetByBookkeepingID)
+			summaryByTransactionType.POST("", middleware.RequirePermission(middleware.PermissionBookCreate), summaryByTransactionTypeHandler.Create)
+			summaryByTransactionType.PUT("/:id", middleware.RequirePermission(middleware.PermissionBookUpdate), summaryByTransactionTypeHandler.Update)
+			summaryByTransactionType.DELETE("/:id", middleware.RequirePermission(middleware.PermissionBookDelete), summaryByTransactionTypeHandler.Delete)
 		}
 
-		// Summary By Payment Method CRUD endpoints (JWT required)
+		// Summary By Payment Method CRUD endpoints (JWT required, location scoped)
 		summaryByPaymentMethod := api.Group("/summary-by-payment-method")
-		summaryByPaymentMethod.Use(middleware.AuthMiddleware(jwtUtil))
+		summaryByPaymentMethod.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			summaryByPaymentMethod.GET("", summaryByPaymentMethodHandler.GetAll)
-			summaryByPaymentMethod.GET("/:id", summaryByPaymentMethodHandler.GetByID)
-			summaryByPaymentMethod.GET("/by-bookkeeping/:bookkeeping_id", summaryByPaymentMethodHandler.GetByBookkeepingID)
-			summaryByPaymentMethod.POST("", summaryByPaymentMethodHandler.Create)
-			summaryByPaymentMethod.PUT("/:id", summaryByPaymentMethodHandler.Update)
-			summaryByPaymentMethod.DELETE("/:id", summaryByPaymentMethodHandler.Delete)
+			summaryByPaymentMethod.GET("", middleware.RequirePermission(middleware.PermissionBookRead), summaryByPaymentMethodHandler.GetAll)
+			summaryByPaymentMethod.GET("/:id", middleware.RequirePermission(middleware.PermissionBookRead), summaryByPaymentMethodHandler.GetByID)
+			summaryByPaymentMethod.GET("/by-bookkeeping/:bookkeeping_id", middleware.RequirePermission(middleware.PermissionBookRead), summaryByPaymentMethodHandler.GetByBookkeepingID)
+			summaryByPaymentMethod.POST("", middleware.RequirePermission(middleware.PermissionBookCreate), summaryByPaymentMethodHandler.Create)
+			summaryByPaymentMethod.PUT("/:id", middleware.RequirePermission(middleware.PermissionBookUpdate), summaryByPaymentMethodHandler.Update)
+			summaryByPaymentMethod.DELETE("/:id", middleware.RequirePermission(middleware.PermissionBookDelete), summaryByPaymentMethodHandler.Delete)
 		}
 
-		// Summary By Transaction Type And Payment Method CRUD endpoints (JWT required)
+		// Summary By Transaction Type And Payment Method CRUD endpoints (JWT required, location scoped)
 		summaryByTransactionTypeAndPaymentMethod := api.Group("/summary-by-transaction-type-and-payment-method")
-		summaryByTransactionTypeAndPaymentMethod.Use(middleware.AuthMiddleware(jwtUtil))
+		summaryByTransactionTypeAndPaymentMethod.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			summaryByTransactionTypeAndPaymentMethod.GET("", summaryByTransactionTypeAndPaymentMethodHandler.GetAll)
-			summaryByTransactionTypeAndPaymentMethod.GET("/:id", summaryByTransactionTypeAndPaymentMethodHandler.GetByID)
-			summaryByTransactionTypeAndPaymentMethod.GET("/by-bookkeeping/:bookkeeping_id", summaryByTransactionTypeAndPaymentMethodHandler.GetByBookkeepingID)
-			summaryByTransactionTypeAndPaymentMethod.POST("", summaryByTransactionTypeAndPaymentMethodHandler.Create)
-			summaryByTransactionTypeAndPaymentMethod.PUT("/:id", summaryByTransactionTypeAndPaymentMethodHandler.Update)
-			summaryByTransactionTypeAndPaymentMethod.DELETE("/:id", summaryByTransactionTypeAndPaymentMethodHandler.Delete)
+			summaryByTransactionTypeAndPaymentMethod.GET("", middleware.RequirePermission(middleware.PermissionBookRead), summaryByTransactionTypeAndPaymentMethodHandler.GetAll)
+			summaryByTransactionTypeAndPaymentMethod.GET("/:id", middleware.RequirePermission(middleware.PermissionBookRead), summaryByTransactionTypeAndPaymentMethodHandler.GetByID)
+			summaryByTransactionTypeAndPaymentMethod.GET("/by-bookkeeping/:bookkeeping_id", middleware.RequirePermission(middleware.PermissionBookRead), summaryByTransactionTypeAndPaymentMethodHandler.GetByBookkeepingID)
+			summaryByTransactionTypeAndPaymentMethod.POST("", middleware.RequirePermission(middleware.PermissionBookCreate), summaryByTransactionTypeAndPaymentMethodHandler.Create)
+			summaryByTransactionTypeAndPaymentMethod.PUT("/:id", middleware.RequirePermission(middleware.PermissionBookUpdate), summaryByTransactionTypeAndPaymentMethodHandler.Update)
+			summaryByTransactionTypeAndPaymentMethod.DELETE("/:id", middleware.RequirePermission(middleware.PermissionBookDelete), summaryByTransactionTypeAndPaymentMethodHandler.Delete)
 		}
 
-		// Bookkeeping CRUD endpoints (JWT required)
+		// Bookkeeping CRUD endpoints (JWT required, location scoped)
 		bookkeeping := api.Group("/bookkeeping")
-		bookkeeping.Use(middleware.AuthMiddleware(jwtUtil))
+		bookkeeping.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			bookkeeping.GET("", bookkeepingHandler.GetAll)
-			bookkeeping.GET("/:id", bookkeepingHandler.GetByID)
-			bookkeeping.GET("/by-location/:location_id", bookkeepingHandler.GetByLocationID)
-			bookkeeping.POST("", bookkeepingHandler.Create)
-			bookkeeping.PUT("/:id", bookkeepingHandler.Update)
-			bookkeeping.DELETE("/:id", bookkeepingHandler.Delete)
+			bookkeeping.GET("", middleware.RequirePermission(middleware.PermissionBookRead), bookkeepingHandler.GetAll)
+			bookkeeping.GET("/:id", middleware.RequirePermission(middleware.PermissionBookRead), bookkeepingHandler.GetByID)
+			bookkeeping.GET("/by-location/:location_id", middleware.RequirePermission(middleware.PermissionBookRead), bookkeepingHandler.GetByLocationID)
+			bookkeeping.POST("", middleware.RequirePermission(middleware.PermissionBookCreate), bookkeepingHandler.Create)
+			bookkeeping.PUT("/:id", middleware.RequirePermission(middleware.PermissionBookUpdate), bookkeepingHandler.Update)
+			bookkeeping.DELETE("/:id", middleware.RequirePermission(middleware.PermissionBookDelete), bookkeepingHandler.Delete)
+			bookkeeping.PATCH("/:id/close", middleware.RequirePermission(middleware.PermissionBookClose), bookkeepingHandler.Close)
 		}
 
-		// Bookkeeping Detail CRUD endpoints (JWT required)
+		// Bookkeeping Detail CRUD endpoints (JWT required, location scoped)
 		bookkeepingDetail := api.Group("/bookkeeping-detail")
-		bookkeepingDetail.Use(middleware.AuthMiddleware(jwtUtil))
+		bookkeepingDetail.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
 		{
-			bookkeepingDetail.GET("", bookkeepingDetailHandler.GetAll)
-			bookkeepingDetail.GET("/:id", bookkeepingDetailHandler.GetByID)
-			bookkeepingDetail.GET("/by-bookkeeping/:bookkeeping_id", bookkeepingDetailHandler.GetByBookkeepingID)
-			bookkeepingDetail.POST("", bookkeepingDetailHandler.Create)
-			bookkeepingDetail.PUT("/:id", bookkeepingDetailHandler.Update)
-			bookkeepingDetail.DELETE("/:id", bookkeepingDetailHandler.Delete)
+			bookkeepingDetail.GET("", middleware.RequirePermission(middleware.PermissionBookRead), bookkeepingDetailHandler.GetAll)
+			bookkeepingDetail.GET("/:id", middleware.RequirePermission(middleware.PermissionBookRead), bookkeepingDetailHandler.GetByID)
+			bookkeepingDetail.GET("/by-bookkeeping/:bookkeeping_id", middleware.RequirePermission(middleware.PermissionBookRead), bookkeepingDetailHandler.GetByBookkeepingID)
+			bookkeepingDetail.POST("", middleware.RequirePermission(middleware.PermissionBookCreate), bookkeepingDetailHandler.Create)
+			bookkeepingDetail.PUT("/:id", middleware.RequirePermission(middleware.PermissionBookUpdate), bookkeepingDetailHandler.Update)
+			bookkeepingDetail.DELETE("/:id", middleware.RequirePermission(middleware.PermissionBookDelete), bookkeepingDetailHandler.Delete)
 		}
 
 		// Bookkeeping Status READ-ONLY endpoints (JWT required)
 		bookkeepingStatus := api.Group("/bookkeeping-status")
 		bookkeepingStatus.Use(middleware.AuthMiddleware(jwtUtil))
 		{
-			bookkeepingStatus.GET("", bookkeepingStatusHandler.GetAll)
-			bookkeepingStatus.GET("/:id", bookkeepingStatusHandler.GetByID)
+			bookkeepingStatus.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), bookkeepingStatusHandler.GetAll)
+			bookkeepingStatus.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), bookkeepingStatusHandler.GetByID)
 		}
 
 		// Book Transaction Type CRUD endpoints (JWT required)
 		bookTransactionType := api.Group("/book-transaction-type")
 		bookTransactionType.Use(middleware.AuthMiddleware(jwtUtil))
 		{
-			bookTransactionType.GET("", bookTransactionTypeHandler.GetAll)
-			bookTransactionType.GET("/:id", bookTransactionTypeHandler.GetByID)
-			bookTransactionType.POST("", bookTransactionTypeHandler.Create)
-			bookTransactionType.PUT("/:id", bookTransactionTypeHandler.Update)
-			bookTransactionType.DELETE("/:id", bookTransactionTypeHandler.Delete)
+			bookTransactionType.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), bookTransactionTypeHandler.GetAll)
+			bookTransactionType.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), bookTransactionTypeHandler.GetByID)
+			bookTransactionType.POST("", middleware.RequirePermission(middleware.PermissionMasterManage), bookTransactionTypeHandler.Create)
+			bookTransactionType.PUT("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), bookTransactionTypeHandler.Update)
+			bookTransactionType.DELETE("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), bookTransactionTypeHandler.Delete)
 		}
 
 		// Book Transaction Category CRUD endpoints (JWT required)
 		bookTransactionCategory := api.Group("/book-transaction-category")
 		bookTransactionCategory.Use(middleware.AuthMiddleware(jwtUtil))
 		{
-			bookTransactionCategory.GET("", bookTransactionCategoryHandler.GetAll)
-			bookTransactionCategory.GET("/:id", bookTransactionCategoryHandler.GetByID)
-			bookTransactionCategory.POST("", bookTransactionCategoryHandler.Create)
-			bookTransactionCategory.PUT("/:id", bookTransactionCategoryHandler.Update)
-			bookTransactionCategory.DELETE("/:id", bookTransactionCategoryHandler.Delete)
+			bookTransactionCategory.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), bookTransactionCategoryHandler.GetAll)
+			bookTransactionCategory.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), bookTransactionCategoryHandler.GetByID)
+			bookTransactionCategory.POST("", middleware.RequirePermission(middleware.PermissionMasterManage), bookTransactionCategoryHandler.Create)
+			bookTransactionCategory.PUT("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), bookTransactionCategoryHandler.Update)
+			bookTransactionCategory.DELETE("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), bookTransactionCategoryHandler.Delete)
 		}
 
 		// Payment Method CRUD endpoints (JWT required)
 		paymentMethod := api.Group("/payment-method")
 		paymentMethod.Use(middleware.AuthMiddleware(jwtUtil))
 		{
-			paymentMethod.GET("", paymentMethodHandler.GetAll)
-			paymentMethod.GET("/:id", paymentMethodHandler.GetByID)
-			paymentMethod.POST("", paymentMethodHandler.Create)
-			paymentMethod.PUT("/:id", paymentMethodHandler.Update)
-			paymentMethod.DELETE("/:id", paymentMethodHandler.Delete)
+			paymentMethod.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), paymentMethodHandler.GetAll)
+			paymentMethod.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), paymentMethodHandler.GetByID)
+			paymentMethod.POST("", middleware.RequirePermission(middleware.PermissionMasterManage), paymentMethodHandler.Create)
+			paymentMethod.PUT("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), paymentMethodHandler.Update)
+			paymentMethod.DELETE("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), paymentMethodHandler.Delete)
+		}
+
+		// Package Validity CRUD endpoints (JWT required)
+		packageValidities := api.Group("/package-validities")
+		packageValidities.Use(middleware.AuthMiddleware(jwtUtil))
+		{
+			packageValidities.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), packageValidityHandler.GetAll)
+			packageValidities.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), packageValidityHandler.GetByID)
+			packageValidities.POST("", middleware.RequirePermission(middleware.PermissionMasterManage), packageValidityHandler.Create)
+			packageValidities.PUT("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), packageValidityHandler.Update)
+			packageValidities.DELETE("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), packageValidityHandler.Delete)
+		}
+
+		// Reminder Template CRUD endpoints (JWT required)
+		reminderTemplates := api.Group("/reminder-templates")
+		reminderTemplates.Use(middleware.AuthMiddleware(jwtUtil))
+		{
+			reminderTemplates.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), reminderTemplateHandler.GetAll)
+			reminderTemplates.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), reminderTemplateHandler.GetByID)
+			reminderTemplates.POST("", middleware.RequirePermission(middleware.PermissionMasterManage), reminderTemplateHandler.Create)
+			reminderTemplates.PUT("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), reminderTemplateHandler.Update)
+			reminderTemplates.DELETE("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), reminderTemplateHandler.Delete)
+		}
+
+		// Reminder endpoints (JWT required)
+		reminders := api.Group("/reminders")
+		reminders.Use(middleware.AuthMiddleware(jwtUtil))
+		{
+			reminders.POST("/run", middleware.RequirePermission(middleware.PermissionMasterManage), reminderHandler.Run)
+		}
+
+		// Unit Conversion CRUD endpoints (JWT required)
+		unitConversions := api.Group("/unit-conversions")
+		unitConversions.Use(middleware.AuthMiddleware(jwtUtil))
+		{
+			unitConversions.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), unitConversionHandler.GetAll)
+			unitConversions.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), unitConversionHandler.GetByID)
+			unitConversions.POST("", middleware.RequirePermission(middleware.PermissionMasterManage), unitConversionHandler.Create)
+			unitConversions.PUT("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), unitConversionHandler.Update)
+			unitConversions.DELETE("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), unitConversionHandler.Delete)
+		}
+
+		// Stock Movement endpoints (JWT required, location scoped)
+		stockMovements := api.Group("/stock-movements")
+		stockMovements.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
+		{
+			stockMovements.GET("", middleware.RequirePermission(middleware.PermissionTreatmentRead), stockMovementHandler.GetAll)
+			stockMovements.POST("/relay", middleware.RequirePermission(middleware.PermissionMasterManage), stockMovementHandler.Relay)
+		}
+
+		// Commission Rule CRUD endpoints (JWT required)
+		commissionRules := api.Group("/commission-rules")
+		commissionRules.Use(middleware.AuthMiddleware(jwtUtil))
+		{
+			commissionRules.GET("", middleware.RequirePermission(middleware.PermissionMasterRead), commissionRuleHandler.GetAll)
+			commissionRules.GET("/:id", middleware.RequirePermission(middleware.PermissionMasterRead), commissionRuleHandler.GetByID)
+			commissionRules.POST("", middleware.RequirePermission(middleware.PermissionMasterManage), commissionRuleHandler.Create)
+			commissionRules.PUT("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), commissionRuleHandler.Update)
+			commissionRules.DELETE("/:id", middleware.RequirePermission(middleware.PermissionMasterManage), commissionRuleHandler.Delete)
+		}
+
+		// Commission endpoints (JWT required, location scoped)
+		commissions := api.Group("/commissions")
+		commissions.Use(middleware.AuthMiddleware(jwtUtil), middleware.LocationMiddleware())
+		{
+			commissions.GET("", middleware.RequirePermission(middleware.PermissionCommissionRead), commissionHandler.GetCommissions)
 		}
 	}
 
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/handlers"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+// testTenant is registered with a connection to a closed port: requests get
+// past TenantMiddleware and fail only once a handler queries the database
+const testTenant = "alana"
+
+// newTestConfig returns the configuration the test router is built with
+func newTestConfig() *config.Config {
+	return &config.Config{
+		JWT:       config.JWTConfig{Secret: "test-secret", AccessTokenTTL: time.Hour, Issuer: "test"},
+		Logging:   config.LoggingConfig{Level: "error"},
+		RateLimit: config.RateLimitConfig{RequestsPerMinute: 1000000, BurstSize: 1000000},
+		CORS: config.CORSConfig{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Origin", "Content-Type", "Authorization"},
+		},
+		DocNumbering: config.DocNumberingConfig{
+			SalesOrderFormat: "SO/{location}/{year}/{seq:6}",
+			TreatmentFormat:  "TR/{location}/{year}/{seq:6}",
+			ARReceiptFormat:  "AR/{location}/{year}/{seq:6}",
+		},
+		Appointments: config.AppointmentConfig{OpensAt: "09:00", ClosesAt: "21:00", SlotMinutes: 30},
+	}
+}
+
+// newTestRouter builds the production router with every handler wired the
+// way main wires them
+func newTestRouter(t *testing.T, cfg *config.Config) (*gin.Engine, *utils.JWTUtil) {
+	t.Helper()
+	logrus.SetOutput(io.Discard)
+
+	manager := config.GetTenantDBManager()
+	if err := manager.InitializeTenantConnections(cfg); err != nil {
+		t.Fatalf("initialize tenants: %v", err)
+	}
+
+	jwtUtil := utils.NewJWTUtil(&cfg.JWT)
+
+	states := services.NewSalesOrderStateMachine()
+	numbering := services.NewDocumentNumbering(cfg.DocNumbering)
+	packageExpiry := services.NewPackageExpiry(states)
+	receiptAllocation := services.NewReceiptAllocation(states)
+	consumableStock := services.NewConsumableStock(nil, cfg.Inventory)
+	scheduler := services.NewAppointmentScheduler(states, models.AppointmentHours{
+		OpensAt:     cfg.Appointments.OpensAt,
+		ClosesAt:    cfg.Appointments.ClosesAt,
+		SlotMinutes: cfg.Appointments.SlotMinutes,
+	})
+
+	router := setupRouter(cfg, jwtUtil,
+		handlers.NewHealthHandler(nil),
+		handlers.NewSalesOrderStatusHandler(),
+		handlers.NewSalesOrderHandler(states, services.NewSalesOrderPricing(), services.NewSalesOrderLines(), numbering, packageExpiry),
+		handlers.NewSalesOrderServiceHandler(),
+		handlers.NewSalesOrderDetailHandler(states, services.NewSalesOrderPricing(), services.NewSalesOrderLines()),
+		handlers.NewRemindedHandler(),
+		handlers.NewARReceiptHandler(numbering, receiptAllocation),
+		handlers.NewARReceiptDetailHandler(receiptAllocation),
+		handlers.NewTreatmentHandler(numbering, services.NewSessionRedemption(states), consumableStock, services.NewTreatmentWorkflow()),
+		handlers.NewTreatmentDetailHandler(),
+		handlers.NewSummaryByTransactionTypeHandler(),
+		handlers.NewSummaryByPaymentMethodHandler(),
+		handlers.NewSummaryByTransactionTypeAndPaymentMethodHandler(),
+		handlers.NewBookkeepingHandler(),
+		handlers.NewBookkeepingDetailHandler(),
+		handlers.NewBookkeepingStatusHandler(),
+		handlers.NewBookTransactionTypeHandler(),
+		handlers.NewBookTransactionCategoryHandler(),
+		handlers.NewPaymentMethodHandler(),
+		handlers.NewTenantHandler(manager),
+		handlers.NewPermissionHandler(),
+		handlers.NewCustomerHandler(services.NewCustomerStatements(states)),
+		handlers.NewPackageValidityHandler(),
+		handlers.NewReportHandler(packageExpiry, services.NewARAging(states)),
+		handlers.NewAppointmentHandler(scheduler),
+		handlers.NewReminderTemplateHandler(),
+		handlers.NewReminderHandler(services.NewTreatmentReminders(states, nil, cfg.Reminders)),
+		handlers.NewUnitConversionHandler(),
+		handlers.NewStockMovementHandler(consumableStock),
+		handlers.NewCommissionRuleHandler(),
+		handlers.NewCommissionHandler(services.NewStaffCommissions(states)),
+	)
+	return router, jwtUtil
+}
+
+// registerUnreachableTenant registers testTenant with a connection that
+// refuses every query
+func registerUnreachableTenant(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open unreachable tenant db: %v", err)
+	}
+	config.GetTenantDBManager().Register(testTenant, db)
+}
+
+// token returns a bearer token for testTenant with the given permissions
+func token(t *testing.T, jwtUtil *utils.JWTUtil, permissions ...string) string {
+	t.Helper()
+	return tenantToken(t, jwtUtil, testTenant, permissions...)
+}
+
+// tenantToken returns a bearer token for tenantCode with the given permissions
+func tenantToken(t *testing.T, jwtUtil *utils.JWTUtil, tenantCode string, permissions ...string) string {
+	t.Helper()
+	locationID := 1
+	accessToken, _, err := jwtUtil.GenerateAccessToken(1, "tester", 1, tenantCode, permissions, &locationID)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return "Bearer " + accessToken
+}
+
+// platformToken returns a bearer token for a platform operator with the
+// given permissions
+func platformToken(t *testing.T, jwtUtil *utils.JWTUtil, permissions ...string) string {
+	t.Helper()
+	accessToken, _, err := jwtUtil.GeneratePlatformAccessToken(1, "operator", permissions)
+	if err != nil {
+		t.Fatalf("generate platform token: %v", err)
+	}
+	return "Bearer " + accessToken
+}
+
+// routePath fills the route's parameters with a placeholder value
+func routePath(path string) string {
+	return routePathWith(path, "1")
+}
+
+// routePathWith fills the route's parameters with value
+func routePathWith(path, value string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = value
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// serve sends a request without a body and returns the status and message
+func serve(router *gin.Engine, method, path string, headers map[string]string) (int, string) {
+	request := httptest.NewRequest(method, path, nil)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	var body struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Message == "" {
+		return w.Code, body.Error
+	}
+	return w.Code, body.Message
+}
+
+// probeDriver is a database/sql driver whose connections never open. Each
+// attempt is counted under the data source name, which the probe tenants set
+// to their tenant code, so a test can tell which tenant's DB a handler used.
+type probeDriver struct {
+	mu    sync.Mutex
+	opens map[string]int
+}
+
+var tenantProbe = &probeDriver{opens: make(map[string]int)}
+
+func init() {
+	sql.Register("tenant-probe", tenantProbe)
+}
+
+func (d *probeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	d.opens[name]++
+	d.mu.Unlock()
+	return nil, errors.New("tenant probe: " + name)
+}
+
+// take returns the connection attempts per tenant since the last call
+func (d *probeDriver) take() map[string]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	opens := d.opens
+	d.opens = make(map[string]int)
+	return opens
+}
+
+// registerProbeTenant registers tenantCode with a connection through
+// tenantProbe
+func registerProbeTenant(t *testing.T, tenantCode string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DriverName: "tenant-probe", DSN: tenantCode}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open probe tenant db: %v", err)
+	}
+	// No idle connections, so every query opens one and is counted
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("probe tenant sql db: %v", err)
+	}
+	sqlDB.SetMaxIdleConns(0)
+	config.GetTenantDBManager().Register(tenantCode, db)
+}
+
+// unqueriedGETs are GET routes that answer without a database query when
+// called without query parameters
+var unqueriedGETs = map[string]bool{
+	"/so/api/permissions":               true,
+	"/so/api/appointments/day":          true,
+	"/so/api/appointments/availability": true,
+	"/so/api/commissions":               true,
+}
+
+func TestAPIRoutesResolveTenantDB(t *testing.T) {
+	router, jwtUtil := newTestRouter(t, newTestConfig())
+	tenants := []string{testTenant, "glowup"}
+	for _, tenantCode := range tenants {
+		registerProbeTenant(t, tenantCode)
+	}
+	t.Cleanup(func() { registerUnreachableTenant(t) })
+
+	var checked, queried int
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, "/so/api/") {
+			continue
+		}
+		checked++
+		path := routePath(route.Path)
+
+		status, message := serve(router, route.Method, path, nil)
+		if status != http.StatusBadRequest || !strings.Contains(message, "X-Tenant-Code") {
+			t.Errorf("%s %s without tenant: got %d %q, want TenantMiddleware to reject it", route.Method, route.Path, status, message)
+		}
+
+		status, message = serve(router, route.Method, path, map[string]string{middleware.TenantCodeHeader: "unknown"})
+		if status != http.StatusBadRequest || message != "invalid tenant code" {
+			t.Errorf("%s %s with unknown tenant: got %d %q, want TenantMiddleware to reject it", route.Method, route.Path, status, message)
+		}
+
+		// Ids are integers or uuids depending on the resource, so each route
+		// is called with both to get past its id parsing
+		tenantProbe.take()
+		for _, tenantCode := range tenants {
+			opens := make(map[string]int)
+			for _, id := range []string{"1", "00000000-0000-0000-0000-000000000001"} {
+				status, message = serve(router, route.Method, routePathWith(route.Path, id), map[string]string{
+					middleware.TenantCodeHeader: tenantCode,
+					"Authorization":             tenantToken(t, jwtUtil, tenantCode, allPermissions()...),
+				})
+				if message == "Database connection not found" {
+					t.Errorf("%s %s: handler found no tenant DB in context (status %d)", route.Method, route.Path, status)
+				}
+				for used, count := range tenantProbe.take() {
+					opens[used] += count
+				}
+			}
+
+			for used := range opens {
+				if used != tenantCode {
+					t.Errorf("%s %s for %s: queried %s's database", route.Method, route.Path, tenantCode, used)
+				}
+			}
+			if route.Method == http.MethodGet && !unqueriedGETs[route.Path] && opens[tenantCode] == 0 {
+				t.Errorf("%s %s for %s: never queried the tenant database", route.Method, route.Path, tenantCode)
+			}
+			if opens[tenantCode] > 0 {
+				queried++
+			}
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no /so/api routes registered")
+	}
+	if queried == 0 {
+		t.Fatal("no /so/api route reached a tenant database")
+	}
+}
+
+// allPermissions returns every code in the permission catalogue
+func allPermissions() []string {
+	codes := make([]string, 0, len(middleware.PermissionCatalogue))
+	for _, permission := range middleware.PermissionCatalogue {
+		codes = append(codes, permission.Code)
+	}
+	return codes
+}
+
+func TestPermissionCatalogue(t *testing.T) {
+	seen := make(map[string]bool)
+	for _, permission := range middleware.PermissionCatalogue {
+		if permission.Code == "" || permission.Group == "" || permission.Description == "" {
+			t.Errorf("incomplete catalogue entry %+v", permission)
+		}
+		if seen[permission.Code] {
+			t.Errorf("duplicate permission %q", permission.Code)
+		}
+		seen[permission.Code] = true
+	}
+
+	// Every permission a route requires must be in the catalogue so it can
+	// be granted from the user service
+	for _, code := range []string{
+		middleware.PermissionSORead, middleware.PermissionSOCreate, middleware.PermissionSOUpdate,
+		middleware.PermissionSOPost, middleware.PermissionSOVoid,
+		middleware.PermissionARRead, middleware.PermissionARCreate, middleware.PermissionARUpdate, middleware.PermissionARVoid,
+		middleware.PermissionTreatmentRead, middleware.PermissionTreatmentCreate, middleware.PermissionTreatmentUpdate,
+		middleware.PermissionTreatmentVoid, middleware.PermissionTreatmentSignOff, middleware.PermissionTreatmentCorrect,
+		middleware.PermissionAppointmentRead, middleware.PermissionAppointmentCreate,
+		middleware.PermissionAppointmentUpdate, middleware.PermissionAppointmentCancel,
+		middleware.PermissionCommissionRead,
+		middleware.PermissionBookRead, middleware.PermissionBookCreate, middleware.PermissionBookUpdate, middleware.PermissionBookDelete,
+		middleware.PermissionBookClose,
+		middleware.PermissionMasterRead, middleware.PermissionMasterManage,
+		middleware.PermissionAllLocations, middleware.PermissionCrossTenant, middleware.PermissionTenantManage,
+	} {
+		if !seen[code] {
+			t.Errorf("permission %q is not in the catalogue", code)
+		}
+	}
+}
+
+func TestRoutesRequirePermission(t *testing.T) {
+	router, jwtUtil := newTestRouter(t, newTestConfig())
+	registerUnreachableTenant(t)
+	nothing := token(t, jwtUtil, middleware.PermissionAllLocations)
+	platformNothing := platformToken(t, jwtUtil)
+
+	for _, route := range router.Routes() {
+		if route.Path == "/health" || route.Path == "/so/api/permissions" {
+			continue
+		}
+		headers := map[string]string{
+			middleware.TenantCodeHeader: testTenant,
+			"Authorization":             nothing,
+		}
+		if strings.HasPrefix(route.Path, "/so/admin/") {
+			headers = map[string]string{"Authorization": platformNothing}
+		}
+		status, message := serve(router, route.Method, routePath(route.Path), headers)
+		if status != http.StatusForbidden || message != "Insufficient permissions" {
+			t.Errorf("%s %s without permissions: got %d %q, want 403", route.Method, route.Path, status, message)
+		}
+	}
+}
+
+// testRoles are typical role grants; the user service owns the real ones
+var testRoles = map[string][]string{
+	"front_desk": {
+		middleware.PermissionSORead, middleware.PermissionSOCreate, middleware.PermissionSOUpdate,
+		middleware.PermissionARRead, middleware.PermissionARCreate,
+		middleware.PermissionAppointmentRead, middleware.PermissionAppointmentCreate,
+		middleware.PermissionAppointmentUpdate, middleware.PermissionAppointmentCancel,
+	},
+	"clinician": {
+		middleware.PermissionTreatmentRead, middleware.PermissionTreatmentCreate,
+		middleware.PermissionTreatmentUpdate, middleware.PermissionTreatmentSignOff,
+		middleware.PermissionAppointmentRead,
+	},
+	"accountant": {
+		middleware.PermissionSORead,
+		middleware.PermissionARRead, middleware.PermissionARCreate, middleware.PermissionARUpdate, middleware.PermissionARVoid,
+		middleware.PermissionBookRead, middleware.PermissionBookCreate, middleware.PermissionBookUpdate, middleware.PermissionBookDelete,
+		middleware.PermissionCommissionRead,
+	},
+	"finance_manager": {
+		middleware.PermissionBookRead, middleware.PermissionBookUpdate, middleware.PermissionBookClose,
+	},
+	// admin is a platform operator and gets a platform token
+	"admin": {middleware.PermissionTenantManage},
+}
+
+func TestRoutePermissionsByRole(t *testing.T) {
+	router, jwtUtil := newTestRouter(t, newTestConfig())
+	registerUnreachableTenant(t)
+
+	tests := []struct {
+		role    string
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"front_desk", "GET", "/so/api/sales-orders", true},
+		{"front_desk", "POST", "/so/api/sales-orders", true},
+		{"front_desk", "PATCH", "/so/api/sales-orders/1/post", false},
+		{"front_desk", "PATCH", "/so/api/sales-orders/1/void", false},
+		{"front_desk", "POST", "/so/api/ar-receipts", true},
+		{"front_desk", "DELETE", "/so/api/ar-receipts/1", false},
+		{"front_desk", "PATCH", "/so/api/appointments/1/cancel", true},
+		{"front_desk", "PATCH", "/so/api/treatments/1/sign-off", false},
+		{"front_desk", "GET", "/so/api/bookkeeping", false},
+		{"front_desk", "GET", "/so/api/commissions", false},
+		{"front_desk", "GET", "/so/api/customers/1/statement", true},
+		{"front_desk", "GET", "/so/admin/tenants", false},
+
+		{"clinician", "GET", "/so/api/treatments", true},
+		{"clinician", "PATCH", "/so/api/treatments/1/sign-off", true},
+		{"clinician", "POST", "/so/api/treatments/1/corrections", false},
+		{"clinician", "DELETE", "/so/api/treatments/1", false},
+		{"clinician", "PATCH", "/so/api/sales-order-services/1/mark-treated", true},
+		{"clinician", "GET", "/so/api/appointments/day", true},
+		{"clinician", "POST", "/so/api/appointments", false},
+		{"clinician", "GET", "/so/api/sales-orders", false},
+		{"clinician", "GET", "/so/api/stock-movements", true},
+		{"clinician", "POST", "/so/api/stock-movements/relay", false},
+
+		{"accountant", "GET", "/so/api/reports/ar-aging", true},
+		{"accountant", "POST", "/so/api/ar-receipts/1/allocate", true},
+		{"accountant", "DELETE", "/so/api/bookkeeping/1", true},
+		{"accountant", "GET", "/so/api/commissions", true},
+		{"accountant", "POST", "/so/api/sales-orders", false},
+		{"accountant", "POST", "/so/api/commission-rules", false},
+		{"accountant", "GET", "/so/api/payment-method", false},
+		{"accountant", "PATCH", "/so/api/bookkeeping/1/close", false},
+
+		{"finance_manager", "PATCH", "/so/api/bookkeeping/1/close", true},
+		{"finance_manager", "PUT", "/so/api/bookkeeping/1", true},
+		{"finance_manager", "DELETE", "/so/api/bookkeeping/1", false},
+
+		{"admin", "GET", "/so/admin/tenants", true},
+		{"admin", "POST", "/so/admin/tenants/refresh", true},
+		{"admin", "GET", "/so/api/sales-orders", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+" "+tt.method+" "+tt.path, func(t *testing.T) {
+			permissions := append([]string{middleware.PermissionAllLocations}, testRoles[tt.role]...)
+			bearer := token(t, jwtUtil, permissions...)
+			if tt.role == "admin" {
+				bearer = platformToken(t, jwtUtil, permissions...)
+			}
+			status, message := serve(router, tt.method, tt.path, map[string]string{
+				middleware.TenantCodeHeader: testTenant,
+				"Authorization":             bearer,
+			})
+			if status == http.StatusUnauthorized {
+				t.Fatalf("got 401 %q", message)
+			}
+			denied := status == http.StatusForbidden
+			if denied == tt.allowed {
+				t.Errorf("allowed = %v, want %v (got %d %q)", !denied, tt.allowed, status, message)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesRequirePlatformToken(t *testing.T) {
+	router, jwtUtil := newTestRouter(t, newTestConfig())
+	registerUnreachableTenant(t)
+
+	tests := []struct {
+		name    string
+		bearer  string
+		tenant  string
+		status  int
+		message string
+	}{
+		{"tenant admin", token(t, jwtUtil, middleware.PermissionTenantManage), "", http.StatusForbidden, "Platform token required"},
+		{"tenant admin with tenant header", token(t, jwtUtil, middleware.PermissionTenantManage), testTenant, http.StatusForbidden, "Platform token required"},
+		{"tenant admin with cross-tenant access", token(t, jwtUtil, allPermissions()...), "", http.StatusForbidden, "Platform token required"},
+		{"platform operator without tenant.manage", platformToken(t, jwtUtil, middleware.PermissionSORead), "", http.StatusForbidden, "Insufficient permissions"},
+		{"platform operator", platformToken(t, jwtUtil, middleware.PermissionTenantManage), "", http.StatusOK, "Tenants retrieved successfully"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"Authorization": tt.bearer}
+			if tt.tenant != "" {
+				headers[middleware.TenantCodeHeader] = tt.tenant
+			}
+			status, message := serve(router, "GET", "/so/admin/tenants", headers)
+			if status != tt.status || message != tt.message {
+				t.Errorf("got %d %q, want %d %q", status, message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestTenantHeaderMustMatchToken(t *testing.T) {
+	router, jwtUtil := newTestRouter(t, newTestConfig())
+	registerUnreachableTenant(t)
+	permissions := []string{middleware.PermissionAllLocations, middleware.PermissionSORead}
+
+	tests := []struct {
+		name    string
+		bearer  string
+		allowed bool
+	}{
+		{"same tenant", token(t, jwtUtil, permissions...), true},
+		{"other tenant", tenantToken(t, jwtUtil, "clinic", permissions...), false},
+		{"other tenant with cross-tenant access", tenantToken(t, jwtUtil, "clinic", append(permissions, middleware.PermissionCrossTenant)...), true},
+		{"platform operator", platformToken(t, jwtUtil, permissions...), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, message := serve(router, "GET", "/so/api/sales-orders", map[string]string{
+				middleware.TenantCodeHeader: testTenant,
+				"Authorization":             tt.bearer,
+			})
+			rejected := status == http.StatusForbidden && message == "Token is not valid for this tenant"
+			if rejected == tt.allowed {
+				t.Errorf("allowed = %v, want %v (got %d %q)", !rejected, tt.allowed, status, message)
+			}
+		})
+	}
+}
+
+// locationScopedGroups are the route groups that run LocationMiddleware
+var locationScopedGroups = []string{
+	"/so/api/sales-orders", "/so/api/sales-order-services", "/so/api/sales-order-details",
+	"/so/api/ar-receipts", "/so/api/ar-receipt-details",
+	"/so/api/treatments", "/so/api/treatment-details",
+	"/so/api/customers", "/so/api/reports", "/so/api/appointments",
+	"/so/api/bookkeeping", "/so/api/bookkeeping-detail",
+	"/so/api/summary-by-transaction-type", "/so/api/summary-by-payment-method",
+	"/so/api/summary-by-transaction-type-and-payment-method",
+	"/so/api/stock-movements", "/so/api/commissions",
+}
+
+func TestLocationScopedRoutes(t *testing.T) {
+	router, jwtUtil := newTestRouter(t, newTestConfig())
+	registerUnreachableTenant(t)
+
+	// A scoped token without a location is refused by LocationMiddleware
+	accessToken, _, err := jwtUtil.GenerateAccessToken(1, "tester", 1, testTenant, allPermissionsExcept(middleware.PermissionAllLocations), nil)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	var checked int
+	for _, route := range router.Routes() {
+		if !inLocationScopedGroup(route.Path) {
+			continue
+		}
+		checked++
+		status, message := serve(router, route.Method, routePath(route.Path), map[string]string{
+			middleware.TenantCodeHeader: testTenant,
+			"Authorization":             "Bearer " + accessToken,
+		})
+		if status != http.StatusForbidden || message != "Token is not bound to a location" {
+			t.Errorf("%s %s: got %d %q, want LocationMiddleware to refuse it", route.Method, route.Path, status, message)
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no location scoped routes registered")
+	}
+}
+
+func inLocationScopedGroup(path string) bool {
+	for _, group := range locationScopedGroups {
+		if path == group || strings.HasPrefix(path, group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// allPermissionsExcept returns the permission catalogue without the given code
+func allPermissionsExcept(code string) []string {
+	var codes []string
+	for _, permission := range allPermissions() {
+		if permission != code {
+			codes = append(codes, permission)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// newDatabaseConfig returns the test configuration pointed at the database in
+// TEST_DB_*, skipping the test when none is set. TEST_TENANT_CODES lists two
+// tenant schemas with every migration applied; the tests add rows to them
+// and remove those rows again.
+func newDatabaseConfig(t *testing.T) *config.Config {
+	t.Helper()
+	host := os.Getenv("TEST_DB_HOST")
+	if host == "" {
+		t.Skip("TEST_DB_HOST is not set")
+	}
+	tenantCodes := strings.Split(os.Getenv("TEST_TENANT_CODES"), ",")
+	if len(tenantCodes) != 2 || tenantCodes[0] == "" || tenantCodes[1] == "" {
+		t.Fatal("TEST_TENANT_CODES must list two tenant schemas, e.g. tenant_a,tenant_b")
+	}
+
+	cfg := newTestConfig()
+	cfg.TenantCodes = tenantCodes
+	cfg.Database = config.DatabaseConfig{
+		Host:         host,
+		Port:         envOr("TEST_DB_PORT", "5432"),
+		User:         envOr("TEST_DB_USER", "postgres"),
+		Password:     os.Getenv("TEST_DB_PASSWORD"),
+		DBName:       envOr("TEST_DB_NAME", "postgres"),
+		SSLMode:      envOr("TEST_DB_SSLMODE", "disable"),
+		TimeZone:     "UTC",
+		MaxOpenConns: 5,
+		MaxIdleConns: 1,
+	}
+	return cfg
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// sendJSON sends body as JSON and decodes the response's data into out
+func sendJSON(t *testing.T, router *gin.Engine, method, path, tenantCode, bearer string, body, out interface{}) int {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("encode request: %v", err)
+		}
+	}
+	request := httptest.NewRequest(method, path, &payload)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(middleware.TenantCodeHeader, tenantCode)
+	request.Header.Set("Authorization", bearer)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+
+	if out != nil && w.Code < http.StatusBadRequest {
+		response := struct {
+			Data json.RawMessage `json:"data"`
+		}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode %s %s: %v", method, path, err)
+		}
+		if err := json.Unmarshal(response.Data, out); err != nil {
+			t.Fatalf("decode %s %s data: %v", method, path, err)
+		}
+	}
+	if w.Code >= http.StatusBadRequest {
+		t.Logf("%s %s: %d %s", method, path, w.Code, w.Body.String())
+	}
+	return w.Code
+}
+
+// createTestOrder creates a draft order through the API and removes it, with
+// its lines, when the test ends
+func createTestOrder(t *testing.T, router *gin.Engine, tenantCode, bearer string, body map[string]interface{}) models.SalesOrder {
+	t.Helper()
+	var order models.SalesOrder
+	if status := sendJSON(t, router, http.MethodPost, "/so/api/sales-orders", tenantCode, bearer, body, &order); status != http.StatusCreated {
+		t.Fatalf("create order in %s: got %d, want 201", tenantCode, status)
+	}
+
+	t.Cleanup(func() {
+		db, err := config.GetTenantDBManager().GetTenantDB(tenantCode)
+		if err != nil {
+			t.Errorf("cleanup %s: %v", tenantCode, err)
+			return
+		}
+		db.Unscoped().Where("salesorder_id = ?", order.ID).Delete(&models.SalesOrderService{})
+		db.Unscoped().Where("salesorder_id = ?", order.ID).Delete(&models.SalesOrderDetail{})
+		db.Unscoped().Where("id = ?", order.ID).Delete(&models.SalesOrder{})
+	})
+	return order
+}
+
+func TestTenantIsolation(t *testing.T) {
+	cfg := newDatabaseConfig(t)
+	router, jwtUtil := newTestRouter(t, cfg)
+
+	// A customer id no real order uses, so the lists below only hold test orders
+	customerID := int(time.Now().UnixNano()%1000000000) + 1000000000
+	orders := make(map[string]uuid.UUID)
+	bearers := make(map[string]string)
+	for _, tenantCode := range cfg.TenantCodes {
+		bearers[tenantCode] = tenantToken(t, jwtUtil, tenantCode, middleware.PermissionAllLocations,
+			middleware.PermissionSORead, middleware.PermissionSOCreate)
+		order := createTestOrder(t, router, tenantCode, bearers[tenantCode], map[string]interface{}{
+			"location_id": 1,
+			"customer_id": customerID,
+			"note":        "tenant isolation test " + tenantCode,
+		})
+		orders[tenantCode] = order.ID
+	}
+
+	for _, tenantCode := range cfg.TenantCodes {
+		var listed []models.SalesOrder
+		path := fmt.Sprintf("/so/api/sales-orders?customer_id=%d", customerID)
+		if status := sendJSON(t, router, http.MethodGet, path, tenantCode, bearers[tenantCode], nil, &listed); status != http.StatusOK {
+			t.Fatalf("list in %s: got %d, want 200", tenantCode, status)
+		}
+		if len(listed) != 1 || listed[0].ID != orders[tenantCode] {
+			t.Errorf("list in %s: got %d orders, want only %s", tenantCode, len(listed), orders[tenantCode])
+		}
+
+		for owner, id := range orders {
+			want := http.StatusNotFound
+			if owner == tenantCode {
+				want = http.StatusOK
+			}
+			if status := sendJSON(t, router, http.MethodGet, "/so/api/sales-orders/"+id.String(), tenantCode, bearers[tenantCode], nil, nil); status != want {
+				t.Errorf("GET %s's order from %s: got %d, want %d", owner, tenantCode, status, want)
+			}
+		}
+	}
+}
+
+func TestSalesOrderLinesReadBack(t *testing.T) {
+	cfg := newDatabaseConfig(t)
+	router, jwtUtil := newTestRouter(t, cfg)
+	tenantCode := cfg.TenantCodes[0]
+	bearer := tenantToken(t, jwtUtil, tenantCode, middleware.PermissionAllLocations, middleware.PermissionSORead, middleware.PermissionSOCreate)
+
+	created := createTestOrder(t, router, tenantCode, bearer, map[string]interface{}{
+		"location_id": 1,
+		"customer_id": 1,
+		"note":        "sales order lines read-back test",
+		"details": []map[string]interface{}{
+			{"item_id": 10, "item_name": "Facial package", "quantity": 2, "price": "150000.00"},
+			{"item_id": 11, "item_name": "Serum", "quantity": 1, "price": "80000.00"},
+		},
+		"services": []map[string]interface{}{
+			{"detail_index": 0, "service_id": 20, "service_name": "Facial"},
+			{"detail_index": 1, "service_id": 21, "service_name": "Serum application"},
+		},
+	})
+
+	var order models.SalesOrder
+	if status := sendJSON(t, router, http.MethodGet, "/so/api/sales-orders/"+created.ID.String(), tenantCode, bearer, nil, &order); status != http.StatusOK {
+		t.Fatalf("get order: got %d, want 200", status)
+	}
+	if order.TotalAmount == nil || order.TotalAmount.String() != "380000.00" {
+		t.Errorf("total_amount = %v, want 380000.00", order.TotalAmount)
+	}
+	if len(order.Details) != 2 || len(order.Services) != 2 {
+		t.Fatalf("read back %d details and %d services, want 2 and 2", len(order.Details), len(order.Services))
+	}
+
+	detailIDs := make(map[string]int)
+	for _, detail := range order.Details {
+		if detail.SalesOrderID == nil || *detail.SalesOrderID != order.ID {
+			t.Errorf("detail %d sales_order_id = %v, want %s", detail.ID, detail.SalesOrderID, order.ID)
+		}
+		detailIDs[*detail.ItemName] = detail.ID
+	}
+	wantDetail := map[string]string{"Facial": "Facial package", "Serum application": "Serum"}
+	for _, service := range order.Services {
+		if service.SalesOrderID == nil || *service.SalesOrderID != order.ID {
+			t.Errorf("service %d sales_order_id = %v, want %s", service.ID, service.SalesOrderID, order.ID)
+		}
+		want := detailIDs[wantDetail[*service.ServiceName]]
+		if service.SalesOrderDetailID == nil || *service.SalesOrderDetailID != want {
+			t.Errorf("service %q sales_order_detail_id = %v, want %d", *service.ServiceName, service.SalesOrderDetailID, want)
+		}
+	}
+}
+
+func TestServicesKeepDetailLinkOnUpdate(t *testing.T) {
+	cfg := newDatabaseConfig(t)
+	router, jwtUtil := newTestRouter(t, cfg)
+	tenantCode := cfg.TenantCodes[0]
+	bearer := tenantToken(t, jwtUtil, tenantCode, middleware.PermissionAllLocations,
+		middleware.PermissionSORead, middleware.PermissionSOCreate, middleware.PermissionSOUpdate)
+
+	created := createTestOrder(t, router, tenantCode, bearer, map[string]interface{}{
+		"location_id": 1,
+		"customer_id": 1,
+		"note":        "service link update test",
+		"details": []map[string]interface{}{
+			{"item_id": 10, "item_name": "Facial package", "quantity": 2, "price": "150000.00"},
+		},
+		"services": []map[string]interface{}{
+			{"detail_index": 0, "service_id": 20, "service_name": "Facial"},
+		},
+	})
+	var order models.SalesOrder
+	if status := sendJSON(t, router, http.MethodGet, "/so/api/sales-orders/"+created.ID.String(), tenantCode, bearer, nil, &order); status != http.StatusOK {
+		t.Fatalf("get order: got %d, want 200", status)
+	}
+	if len(order.Details) != 1 || len(order.Services) != 1 {
+		t.Fatalf("read back %d details and %d services, want 1 and 1", len(order.Details), len(order.Services))
+	}
+	detailID, serviceID := order.Details[0].ID, order.Services[0].ID
+
+	// Renaming the service without a detail_index keeps its link
+	path := "/so/api/sales-orders/" + order.ID.String()
+	status := sendJSON(t, router, http.MethodPut, path, tenantCode, bearer, map[string]interface{}{
+		"location_id": 1,
+		"customer_id": 1,
+		"services": []map[string]interface{}{
+			{"id": serviceID, "service_id": 20, "service_name": "Facial deluxe"},
+		},
+	}, nil)
+	if status != http.StatusOK {
+		t.Fatalf("rename service: got %d, want 200", status)
+	}
+	if status := sendJSON(t, router, http.MethodGet, path, tenantCode, bearer, nil, &order); status != http.StatusOK {
+		t.Fatalf("get order: got %d, want 200", status)
+	}
+	if len(order.Services) != 1 || order.Services[0].SalesOrderDetailID == nil || *order.Services[0].SalesOrderDetailID != detailID {
+		t.Fatalf("service after rename = %+v, want it linked to detail %d", order.Services, detailID)
+	}
+
+	// Replacing the detail the service is kept on needs a new detail_index
+	status = sendJSON(t, router, http.MethodPut, path, tenantCode, bearer, map[string]interface{}{
+		"location_id": 1,
+		"customer_id": 1,
+		"details": []map[string]interface{}{
+			{"item_id": 11, "item_name": "Serum", "quantity": 1, "price": "80000.00"},
+		},
+		"services": []map[string]interface{}{
+			{"id": serviceID, "service_id": 20, "service_name": "Facial deluxe"},
+		},
+	}, nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("remove linked detail without relinking: got %d, want 400", status)
+	}
+}
@@ -11,24 +11,36 @@ import (
 )
 
 type Config struct {
-	Database    DatabaseConfig
-	JWT         JWTConfig
-	Server      ServerConfig
-	CORS        CORSConfig
-	Logging     LoggingConfig
-	RateLimit   RateLimitConfig
-	OTP         OTPConfig
-	TenantCodes []string
+	Database       DatabaseConfig
+	JWT            JWTConfig
+	Server         ServerConfig
+	CORS           CORSConfig
+	Logging        LoggingConfig
+	RateLimit      RateLimitConfig
+	OTP            OTPConfig
+	TenantCodes    []string
+	TenantRegistry TenantRegistryConfig
+	DocNumbering   DocNumberingConfig
+	Jobs           JobsConfig
+	Appointments   AppointmentConfig
+	Reminders      ReminderConfig
+	Notifier       NotifierConfig
+	Inventory      InventoryConfig
+	// TenantDatabases holds per-tenant connection specs keyed by normalized
+	// tenant code. Tenants without an entry use the shared Database block.
+	TenantDatabases map[string]DatabaseConfig
 }
 
 type DatabaseConfig struct {
-	Host     string
-	Port     string
-	User     string
-	Password string
-	DBName   string
-	SSLMode  string
-	TimeZone string
+	Host         string
+	Port         string
+	User         string
+	Password     string
+	DBName       string
+	SSLMode      string
+	TimeZone     string
+	MaxOpenConns int
+	MaxIdleConns int
 }
 
 type JWTConfig struct {
@@ -66,6 +78,70 @@ type OTPConfig struct {
 	ExpiryMinutes int
 }
 
+// TenantRegistryConfig configures the optional tenant registry control table.
+// When Table is empty only the static TENANT_CODES list is used.
+type TenantRegistryConfig struct {
+	Table        string
+	PollInterval time.Duration
+}
+
+// DocNumberingConfig holds the default document number formats. A tenant can
+// override a format through its document_format table.
+type DocNumberingConfig struct {
+	SalesOrderFormat string
+	TreatmentFormat  string
+	ARReceiptFormat  string
+}
+
+// JobsConfig holds the intervals of the background jobs run for every
+// tenant. A zero interval disables the job.
+type JobsConfig struct {
+	PackageForfeitureInterval time.Duration
+	ReminderInterval          time.Duration
+	StockRelayInterval        time.Duration
+}
+
+// AppointmentConfig holds the opening hours and slot length of locations
+// without their own appointment_hours row. Times are HH:MM in the tenant's
+// timezone.
+type AppointmentConfig struct {
+	OpensAt     string
+	ClosesAt    string
+	SlotMinutes int
+}
+
+// ReminderConfig holds when treatment reminders are due. Services scheduled
+// within LeadDays are reminded once per schedule date; packages with unused
+// sessions are reminded every PackageIntervalDays. A failed reminder is
+// retried until MaxAttempts.
+type ReminderConfig struct {
+	LeadDays            int
+	PackageIntervalDays int
+	MaxAttempts         int
+}
+
+// NotifierConfig selects how reminders are delivered: "file" appends them
+// to FilePath as JSON lines and "http" posts them to URL
+type NotifierConfig struct {
+	Driver   string
+	FilePath string
+	URL      string
+	Token    string
+	Timeout  time.Duration
+}
+
+// InventoryConfig selects where treatment stock movements are delivered:
+// "file" appends them to FilePath as JSON lines and "http" posts them to
+// URL. BatchSize caps the movements relayed per tenant and run.
+type InventoryConfig struct {
+	Driver    string
+	FilePath  string
+	URL       string
+	Token     string
+	Timeout   time.Duration
+	BatchSize int
+}
+
 func LoadConfig() (*Config, error) {
 	if err := godotenv.Load(); err != nil {
 		logrus.Warn("No .env file found, using environment variables")
@@ -73,13 +149,15 @@ func LoadConfig() (*Config, error) {
 
 	config := &Config{
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", ""),
-			DBName:   getEnv("DB_NAME", "pine_energy_db"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
-			TimeZone: getEnv("DB_TIMEZONE", "UTC"),
+			Host:         getEnv("DB_HOST", "localhost"),
+			Port:         getEnv("DB_PORT", "5432"),
+			User:         getEnv("DB_USER", "postgres"),
+			Password:     getEnv("DB_PASSWORD", ""),
+			DBName:       getEnv("DB_NAME", "pine_energy_db"),
+			SSLMode:      getEnv("DB_SSLMODE", "disable"),
+			TimeZone:     getEnv("DB_TIMEZONE", "UTC"),
+			MaxOpenConns: getIntEnv("DB_MAX_OPEN_CONNS", 100),
+			MaxIdleConns: getIntEnv("DB_MAX_IDLE_CONNS", 10),
 		},
 		JWT: JWTConfig{
 			Secret:          getEnv("JWT_SECRET", "your-super-secret-jwt-key"),
@@ -95,7 +173,7 @@ func LoadConfig() (*Config, error) {
 		},
 		CORS: CORSConfig{
 			AllowedOrigins: strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "*"), ","),
-			AllowedMethods: strings.Split(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,OPTIONS"), ","),
+			AllowedMethods: strings.Split(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS"), ","),
 			AllowedHeaders: strings.Split(getEnv("CORS_ALLOWED_HEADERS", "Origin,Content-Type,Accept,Authorization"), ","),
 		},
 		Logging: LoggingConfig{
@@ -111,11 +189,61 @@ func LoadConfig() (*Config, error) {
 			ExpiryMinutes: getIntEnv("OTP_EXPIRY_MINUTES", 10),
 		},
 		TenantCodes: getTenantCodes("TENANT_CODES", []string{"alana"}),
+		TenantRegistry: TenantRegistryConfig{
+			Table:        getEnv("TENANT_REGISTRY_TABLE", ""),
+			PollInterval: getDurationEnv("TENANT_REGISTRY_POLL_INTERVAL", time.Minute),
+		},
+		DocNumbering: DocNumberingConfig{
+			SalesOrderFormat: getEnv("DOC_NUMBER_FORMAT_SALES_ORDER", "SO/{location}/{year}/{seq:6}"),
+			TreatmentFormat:  getEnv("DOC_NUMBER_FORMAT_TREATMENT", "TR/{location}/{year}/{seq:6}"),
+			ARReceiptFormat:  getEnv("DOC_NUMBER_FORMAT_AR_RECEIPT", "AR/{location}/{year}/{seq:6}"),
+		},
+		Jobs: JobsConfig{
+			PackageForfeitureInterval: getDurationEnv("PACKAGE_FORFEITURE_INTERVAL", time.Hour),
+			ReminderInterval:          getDurationEnv("REMINDER_INTERVAL", 15*time.Minute),
+			StockRelayInterval:        getDurationEnv("INVENTORY_RELAY_INTERVAL", time.Minute),
+		},
+		Appointments: AppointmentConfig{
+			OpensAt:     getEnv("APPOINTMENT_OPENS_AT", "09:00"),
+			ClosesAt:    getEnv("APPOINTMENT_CLOSES_AT", "21:00"),
+			SlotMinutes: getIntEnv("APPOINTMENT_SLOT_MINUTES", 30),
+		},
+		Reminders: ReminderConfig{
+			LeadDays:            getIntEnv("REMINDER_LEAD_DAYS", 1),
+			PackageIntervalDays: getIntEnv("REMINDER_PACKAGE_INTERVAL_DAYS", 30),
+			MaxAttempts:         getIntEnv("REMINDER_MAX_ATTEMPTS", 3),
+		},
+		Notifier: NotifierConfig{
+			Driver:   getEnv("NOTIFIER_DRIVER", "file"),
+			FilePath: getEnv("NOTIFIER_FILE_PATH", "./logs/notifications.jsonl"),
+			URL:      getEnv("NOTIFIER_URL", ""),
+			Token:    getEnv("NOTIFIER_TOKEN", ""),
+			Timeout:  getDurationEnv("NOTIFIER_TIMEOUT", 10*time.Second),
+		},
+		Inventory: InventoryConfig{
+			Driver:    getEnv("INVENTORY_DRIVER", "file"),
+			FilePath:  getEnv("INVENTORY_FILE_PATH", "./logs/stock_movements.jsonl"),
+			URL:       getEnv("INVENTORY_URL", ""),
+			Token:     getEnv("INVENTORY_TOKEN", ""),
+			Timeout:   getDurationEnv("INVENTORY_TIMEOUT", 10*time.Second),
+			BatchSize: getIntEnv("INVENTORY_RELAY_BATCH_SIZE", 100),
+		},
 	}
 
+	config.TenantDatabases = getTenantDatabases(config.Database)
+
 	return config, nil
 }
 
+// DatabaseFor returns the connection spec for a tenant, falling back to the
+// shared database when the tenant has no dedicated configuration
+func (c *Config) DatabaseFor(tenantCode string) DatabaseConfig {
+	if dbConfig, exists := c.TenantDatabases[tenantEnvKey(tenantCode)]; exists {
+		return dbConfig
+	}
+	return c.Database
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -152,3 +280,65 @@ func getTenantCodes(key string, defaultValue []string) []string {
 	}
 	return defaultValue
 }
+
+// getTenantDatabases collects TENANT_<CODE>_DB_* overrides from the environment.
+// Each tenant starts from the shared database config so only the differing
+// fields need to be set, e.g. TENANT_PINE_DB_HOST=pine-db.internal.
+func getTenantDatabases(shared DatabaseConfig) map[string]DatabaseConfig {
+	overrides := make(map[string]map[string]string)
+	for _, env := range os.Environ() {
+		key, value, found := strings.Cut(env, "=")
+		if !found || value == "" || !strings.HasPrefix(key, "TENANT_") {
+			continue
+		}
+		code, field, found := strings.Cut(strings.TrimPrefix(key, "TENANT_"), "_DB_")
+		if !found || code == "" {
+			continue
+		}
+		if overrides[code] == nil {
+			overrides[code] = make(map[string]string)
+		}
+		overrides[code][field] = value
+	}
+
+	databases := make(map[string]DatabaseConfig, len(overrides))
+	for code, fields := range overrides {
+		dbConfig := shared
+		for field, value := range fields {
+			switch field {
+			case "HOST":
+				dbConfig.Host = value
+			case "PORT":
+				dbConfig.Port = value
+			case "USER":
+				dbConfig.User = value
+			case "PASSWORD":
+				dbConfig.Password = value
+			case "NAME":
+				dbConfig.DBName = value
+			case "SSLMODE":
+				dbConfig.SSLMode = value
+			case "TIMEZONE":
+				dbConfig.TimeZone = value
+			case "MAX_OPEN_CONNS":
+				if intValue, err := strconv.Atoi(value); err == nil {
+					dbConfig.MaxOpenConns = intValue
+				}
+			case "MAX_IDLE_CONNS":
+				if intValue, err := strconv.Atoi(value); err == nil {
+					dbConfig.MaxIdleConns = intValue
+				}
+			default:
+				logrus.Warnf("Ignoring unknown tenant database setting TENANT_%s_DB_%s", code, field)
+			}
+		}
+		databases[code] = dbConfig
+	}
+
+	return databases
+}
+
+// tenantEnvKey normalizes a tenant code to the form used in environment variable names
+func tenantEnvKey(tenantCode string) string {
+	return strings.ToUpper(strings.ReplaceAll(tenantCode, "-", "_"))
+}
@@ -49,8 +49,8 @@ func initDatabaseWithConfig(dbConfig DatabaseConfig, logLevel string) (*gorm.DB,
 		return nil, fmt.Errorf("failed to get database instance: %w", err)
 	}
 
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
+	sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	return db, nil
@@ -68,7 +68,7 @@ func AutoMigrate(db *gorm.DB) error {
 }
 
 // connectToDatabase is a shared function to connect to database with DSN
-func connectToDatabase(dsn string) (*gorm.DB, error) {
+func connectToDatabase(dsn string, dbConfig DatabaseConfig) (*gorm.DB, error) {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Warn),
 	})
@@ -83,8 +83,8 @@ func connectToDatabase(dsn string) (*gorm.DB, error) {
 	}
 
 	// Connection pool settings
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
+	sqlDB.SetMaxIdleConns(dbConfig.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(dbConfig.MaxOpenConns)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	return db, nil
@@ -1,19 +1,79 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 	"gorm.io/gorm"
 )
 
+// Registry sources reported for each tenant
+const (
+	TenantSourceEnv      = "env"
+	TenantSourceRegistry = "registry"
+)
+
+// ErrRegistryNotConfigured is returned when the registry is refreshed but no
+// registry table is configured or the manager has been closed
+var ErrRegistryNotConfigured = errors.New("tenant registry is not configured")
+
+// tenantCodePattern is what a tenant code may look like. Codes become the
+// connection's search_path, so nothing else may reach the DSN.
+var tenantCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,63}$`)
+
+// ValidTenantCode reports whether code is a well-formed tenant code
+func ValidTenantCode(code string) bool {
+	return tenantCodePattern.MatchString(code)
+}
+
 // TenantDBManager manages database connections for multiple tenants
 type TenantDBManager struct {
-	connections map[string]*gorm.DB
+	cfg         *Config
+	registry    map[string]string
+	connections map[string]*tenantPool
+	connecting  singleflight.Group
+	registryDB  *gorm.DB
+	timeZones   map[string]*time.Location
+	stop        chan struct{}
 	mu          sync.RWMutex
 }
 
+// tenantPool is a tenant's connection pool and the callers using it. A pool
+// whose tenant leaves the registry is closed once its users are done.
+type tenantPool struct {
+	db    *gorm.DB
+	users sync.WaitGroup
+}
+
+// drain waits for the pool's users and then closes it
+func (p *tenantPool) drain(tenantCode string) {
+	p.users.Wait()
+	if err := closeTenantDB(p.db); err != nil {
+		logrus.Errorf("Failed to close DB connection for tenant %s: %v", tenantCode, err)
+	}
+}
+
+// TenantInfo describes a registered tenant and its connection state
+type TenantInfo struct {
+	Code      string `json:"code"`
+	Source    string `json:"source"`
+	Host      string `json:"host"`
+	Dedicated bool   `json:"dedicated"`
+	Connected bool   `json:"connected"`
+}
+
+// tenantRegistryRow maps a row of the tenant registry control table
+type tenantRegistryRow struct {
+	Code   string `gorm:"column:code"`
+	Active bool   `gorm:"column:active"`
+}
+
 var (
 	tenantDBManager *TenantDBManager
 	once            sync.Once
@@ -22,48 +82,267 @@ var (
 // GetTenantDBManager returns singleton instance of TenantDBManager
 func GetTenantDBManager() *TenantDBManager {
 	once.Do(func() {
-		tenantDBManager = &TenantDBManager{
-			connections: make(map[string]*gorm.DB),
-		}
+		tenantDBManager = newTenantDBManager()
 	})
 	return tenantDBManager
 }
 
+func newTenantDBManager() *TenantDBManager {
+	return &TenantDBManager{
+		registry:    make(map[string]string),
+		connections: make(map[string]*tenantPool),
+		timeZones:   make(map[string]*time.Location),
+	}
+}
+
 // InitializeTenantConnections creates database connections for all tenants
 func (m *TenantDBManager) InitializeTenantConnections(cfg *Config) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.cfg = cfg
+
 	logrus.Infof("Initializing database connections for %d tenants: %v", len(cfg.TenantCodes), cfg.TenantCodes)
 
 	for _, tenantCode := range cfg.TenantCodes {
-		schemaName := fmt.Sprintf("%s", tenantCode)
-
-		// Create connection with specific search_path
-		db, err := initTenantDB(cfg, schemaName)
+		if !ValidTenantCode(tenantCode) {
+			return fmt.Errorf("invalid tenant code %q", tenantCode)
+		}
+		db, err := initTenantDB(cfg, tenantCode)
 		if err != nil {
 			return fmt.Errorf("failed to initialize DB for tenant %s: %w", tenantCode, err)
 		}
 
-		m.connections[tenantCode] = db
-		logrus.Infof("✓ Tenant '%s' connected to schema '%s'", tenantCode, schemaName)
+		m.registry[tenantCode] = TenantSourceEnv
+		m.connections[tenantCode] = &tenantPool{db: db}
+		logrus.Infof("✓ Tenant '%s' connected to schema '%s' on %s", tenantCode, tenantCode, cfg.DatabaseFor(tenantCode).Host)
 	}
 
 	logrus.Infof("All tenant database connections initialized successfully")
 	return nil
 }
 
-// GetTenantDB returns the database connection for a specific tenant
+// Register adds a tenant with a connection the caller has already opened,
+// such as a test database, instead of one built from the configuration
+func (m *TenantDBManager) Register(tenantCode string, db *gorm.DB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.registry[tenantCode] = TenantSourceEnv
+	m.connections[tenantCode] = &tenantPool{db: db}
+}
+
+// StartRegistryWatcher polls the tenant registry table and applies changes.
+// It is a no-op when no registry table is configured.
+func (m *TenantDBManager) StartRegistryWatcher() error {
+	if m.cfg == nil || m.cfg.TenantRegistry.Table == "" {
+		return nil
+	}
+
+	registryDB, err := InitDatabase(m.cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to tenant registry: %w", err)
+	}
+
+	stop := make(chan struct{})
+	m.mu.Lock()
+	m.registryDB = registryDB
+	m.stop = stop
+	m.mu.Unlock()
+
+	if err := m.RefreshRegistry(); err != nil {
+		return err
+	}
+
+	go m.watchRegistry(m.cfg.TenantRegistry.PollInterval, stop)
+
+	logrus.Infof("Watching tenant registry '%s' every %s", m.cfg.TenantRegistry.Table, m.cfg.TenantRegistry.PollInterval)
+	return nil
+}
+
+// watchRegistry refreshes the registry every interval until stop is closed.
+// stop is passed in rather than read from m, which Close clears.
+func (m *TenantDBManager) watchRegistry(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := m.RefreshRegistry(); err != nil {
+				logrus.Errorf("Failed to refresh tenant registry: %v", err)
+			}
+		}
+	}
+}
+
+// RefreshRegistry reloads the active tenant codes from the registry table.
+// New tenants are registered and connected lazily on first use; tenants that
+// are no longer active are removed and their connections drained.
+func (m *TenantDBManager) RefreshRegistry() error {
+	m.mu.RLock()
+	registryDB := m.registryDB
+	m.mu.RUnlock()
+
+	if registryDB == nil {
+		return ErrRegistryNotConfigured
+	}
+
+	var rows []tenantRegistryRow
+	if err := registryDB.Table(m.cfg.TenantRegistry.Table).Where("active = ?", true).Find(&rows).Error; err != nil {
+		return fmt.Errorf("failed to read tenant registry: %w", err)
+	}
+
+	codes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if !ValidTenantCode(row.Code) {
+			logrus.Errorf("Ignoring tenant registry entry with invalid code %q", row.Code)
+			continue
+		}
+		codes = append(codes, row.Code)
+	}
+
+	m.applyRegistry(codes)
+	return nil
+}
+
+// applyRegistry reconciles registry-sourced tenants with the given codes.
+// Tenants configured through TENANT_CODES are never removed.
+func (m *TenantDBManager) applyRegistry(codes []string) {
+	active := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		active[code] = true
+	}
+
+	removed := make(map[string]*tenantPool)
+
+	m.mu.Lock()
+	for _, code := range codes {
+		if _, exists := m.registry[code]; !exists {
+			m.registry[code] = TenantSourceRegistry
+			logrus.Infof("+ Tenant '%s' added from registry", code)
+		}
+	}
+	for code, source := range m.registry {
+		if source != TenantSourceRegistry || active[code] {
+			continue
+		}
+		delete(m.registry, code)
+		if pool, connected := m.connections[code]; connected {
+			delete(m.connections, code)
+			removed[code] = pool
+		}
+		logrus.Infof("- Tenant '%s' removed from registry", code)
+	}
+	m.mu.Unlock()
+
+	// Requests and jobs that acquired a removed pool keep it until they
+	// release it; it drains outside the lock without blocking other tenants.
+	for code, pool := range removed {
+		go pool.drain(code)
+	}
+}
+
+// GetTenantDB returns the database connection for a specific tenant,
+// opening it on first use for tenants added through the registry. The pool
+// is closed once the tenant leaves the registry; callers that use it for
+// the length of a request or job run use AcquireTenantDB instead.
 func (m *TenantDBManager) GetTenantDB(tenantCode string) (*gorm.DB, error) {
+	pool, err := m.pool(tenantCode, false)
+	if err != nil {
+		return nil, err
+	}
+	return pool.db, nil
+}
+
+// AcquireTenantDB returns the tenant's database connection like GetTenantDB
+// and keeps its pool open until release is called, even if the tenant is
+// removed from the registry meanwhile
+func (m *TenantDBManager) AcquireTenantDB(tenantCode string) (db *gorm.DB, release func(), err error) {
+	pool, err := m.pool(tenantCode, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	var released sync.Once
+	return pool.db, func() { released.Do(pool.users.Done) }, nil
+}
+
+// pool returns the pool of a registered tenant, connecting it on first use.
+// With acquire set, the pool is marked in use while the lock is held, so it
+// cannot be drained before the caller releases it.
+func (m *TenantDBManager) pool(tenantCode string, acquire bool) (*tenantPool, error) {
+	for {
+		m.mu.RLock()
+		pool, connected := m.connections[tenantCode]
+		_, registered := m.registry[tenantCode]
+		if connected && acquire {
+			pool.users.Add(1)
+		}
+		m.mu.RUnlock()
+
+		if connected {
+			return pool, nil
+		}
+		if !registered {
+			return nil, fmt.Errorf("tenant '%s' not found. Available tenants: %v", tenantCode, m.GetAvailableTenants())
+		}
+
+		// Concurrent first requests for a tenant share one connection attempt
+		if _, err, _ := m.connecting.Do(tenantCode, func() (interface{}, error) {
+			return nil, m.connect(tenantCode)
+		}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// connect opens the pool of a registered tenant without holding the lock, so
+// a slow or unreachable tenant does not block the others or the registry
+// watcher, and then stores it unless the tenant was removed meanwhile
+func (m *TenantDBManager) connect(tenantCode string) error {
+	db, err := initTenantDB(m.cfg, tenantCode)
+	if err != nil {
+		return fmt.Errorf("failed to initialize DB for tenant %s: %w", tenantCode, err)
+	}
+
+	m.mu.Lock()
+	_, registered := m.registry[tenantCode]
+	_, connected := m.connections[tenantCode]
+	if registered && !connected {
+		m.connections[tenantCode] = &tenantPool{db: db}
+	}
+	m.mu.Unlock()
+
+	if !registered || connected {
+		return closeTenantDB(db)
+	}
+	logrus.Infof("✓ Tenant '%s' connected to schema '%s' on %s", tenantCode, tenantCode, m.cfg.DatabaseFor(tenantCode).Host)
+	return nil
+}
+
+// TimeZone returns the tenant's business timezone, taken from its database
+// TimeZone setting. Unknown zones fall back to UTC.
+func (m *TenantDBManager) TimeZone(tenantCode string) *time.Location {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	location, cached := m.timeZones[tenantCode]
+	m.mu.RUnlock()
+	if cached {
+		return location
+	}
 
-	db, exists := m.connections[tenantCode]
-	if !exists {
-		return nil, fmt.Errorf("tenant '%s' not found. Available tenants: %v", tenantCode, m.GetAvailableTenants())
+	name := m.cfg.DatabaseFor(tenantCode).TimeZone
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		logrus.Errorf("Invalid timezone %q for tenant %s, using UTC: %v", name, tenantCode, err)
+		location = time.UTC
 	}
 
-	return db, nil
+	m.mu.Lock()
+	m.timeZones[tenantCode] = location
+	m.mu.Unlock()
+	return location
 }
 
 // GetAvailableTenants returns list of available tenant codes
@@ -71,10 +350,34 @@ func (m *TenantDBManager) GetAvailableTenants() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	tenants := make([]string, 0, len(m.connections))
-	for tenantCode := range m.connections {
+	tenants := make([]string, 0, len(m.registry))
+	for tenantCode := range m.registry {
 		tenants = append(tenants, tenantCode)
 	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// ListTenants returns the current registry with connection state
+func (m *TenantDBManager) ListTenants() []TenantInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenants := make([]TenantInfo, 0, len(m.registry))
+	for tenantCode, source := range m.registry {
+		_, connected := m.connections[tenantCode]
+		_, dedicated := m.cfg.TenantDatabases[tenantEnvKey(tenantCode)]
+		tenants = append(tenants, TenantInfo{
+			Code:      tenantCode,
+			Source:    source,
+			Host:      m.cfg.DatabaseFor(tenantCode).Host,
+			Dedicated: dedicated,
+			Connected: connected,
+		})
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].Code < tenants[j].Code
+	})
 	return tenants
 }
 
@@ -83,37 +386,57 @@ func (m *TenantDBManager) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	for tenantCode, db := range m.connections {
-		sqlDB, err := db.DB()
-		if err != nil {
-			logrus.Errorf("Failed to get DB instance for tenant %s: %v", tenantCode, err)
-			continue
-		}
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
 
-		if err := sqlDB.Close(); err != nil {
+	for tenantCode, pool := range m.connections {
+		if err := closeTenantDB(pool.db); err != nil {
 			logrus.Errorf("Failed to close DB connection for tenant %s: %v", tenantCode, err)
 		} else {
 			logrus.Infof("✓ Closed connection for tenant '%s'", tenantCode)
 		}
 	}
 
+	if m.registryDB != nil {
+		if err := closeTenantDB(m.registryDB); err != nil {
+			logrus.Errorf("Failed to close tenant registry connection: %v", err)
+		}
+		m.registryDB = nil
+	}
+
 	return nil
 }
 
-// initTenantDB creates a database connection with specific search_path
+// closeTenantDB closes the underlying connection pool of a tenant
+func closeTenantDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// initTenantDB creates a database connection with specific search_path.
+// Models declare unqualified table names, so every query issued on this
+// connection resolves against the tenant's own schema. The host, credentials
+// and pool size come from the tenant's own spec when one is configured.
 func initTenantDB(cfg *Config, schemaName string) (*gorm.DB, error) {
+	dbConfig := cfg.DatabaseFor(schemaName)
+
 	// Create DSN with search_path
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s search_path=%s",
-		cfg.Database.Host,
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.DBName,
-		cfg.Database.Port,
-		cfg.Database.SSLMode,
-		cfg.Database.TimeZone,
+		dbConfig.Host,
+		dbConfig.User,
+		dbConfig.Password,
+		dbConfig.DBName,
+		dbConfig.Port,
+		dbConfig.SSLMode,
+		dbConfig.TimeZone,
 		schemaName,
 	)
 
-	return connectToDatabase(dsn)
+	return connectToDatabase(dsn, dbConfig)
 }
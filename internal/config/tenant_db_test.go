@@ -0,0 +1,204 @@
+package config
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// unreachableDB returns a connection that refuses every query
+func unreachableDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test dbname=test sslmode=disable connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open unreachable db: %v", err)
+	}
+	return db
+}
+
+// closed reports whether the pool of db has been closed
+func closed(t *testing.T, db *gorm.DB) bool {
+	t.Helper()
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	err = sqlDB.Ping()
+	return err != nil && strings.Contains(err.Error(), "database is closed")
+}
+
+// silentListener accepts connections and never answers, so a connection
+// attempt to it hangs until the listener is closed
+func silentListener(t *testing.T) (port string, accepted *int32, stop func()) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	var count int32
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&count, 1)
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	_, port, _ = net.SplitHostPort(listener.Addr().String())
+	return port, &count, func() {
+		listener.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+}
+
+func TestValidTenantCode(t *testing.T) {
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"alana", true},
+		{"clinic_02", true},
+		{"north-branch", true},
+		{"", false},
+		{"alana sslmode=disable", false},
+		{"alana,public", false},
+		{"alana'", false},
+		{`alana\`, false},
+		{"alana;drop", false},
+		{strings.Repeat("a", 63), true},
+		{strings.Repeat("a", 64), false},
+	}
+	for _, tt := range tests {
+		if got := ValidTenantCode(tt.code); got != tt.valid {
+			t.Errorf("ValidTenantCode(%q) = %v, want %v", tt.code, got, tt.valid)
+		}
+	}
+}
+
+func TestRemovedTenantPoolClosesAfterRelease(t *testing.T) {
+	m := newTenantDBManager()
+	db := unreachableDB(t)
+	m.registry["gone"] = TenantSourceRegistry
+	m.connections["gone"] = &tenantPool{db: db}
+
+	acquired, release, err := m.AcquireTenantDB("gone")
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if acquired != db {
+		t.Fatal("acquire returned another connection")
+	}
+
+	m.applyRegistry(nil)
+	if _, err := m.GetTenantDB("gone"); err == nil {
+		t.Fatal("removed tenant still resolves")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if closed(t, db) {
+		t.Fatal("pool closed while a request still holds it")
+	}
+
+	release()
+	release() // releasing twice is harmless
+	deadline := time.Now().Add(2 * time.Second)
+	for !closed(t, db) {
+		if time.Now().After(deadline) {
+			t.Fatal("pool not closed after release")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEnvTenantsSurviveRegistryRefresh(t *testing.T) {
+	m := newTenantDBManager()
+	m.Register("alana", unreachableDB(t))
+
+	m.applyRegistry([]string{"clinic"})
+	m.applyRegistry(nil)
+
+	if got := m.GetAvailableTenants(); len(got) != 1 || got[0] != "alana" {
+		t.Fatalf("tenants = %v, want [alana]", got)
+	}
+}
+
+func TestSlowTenantDoesNotBlockOthers(t *testing.T) {
+	port, accepted, stop := silentListener(t)
+	defer stop()
+
+	m := newTenantDBManager()
+	m.cfg = &Config{Database: DatabaseConfig{
+		Host: "127.0.0.1", Port: port, User: "test", DBName: "test", SSLMode: "disable", TimeZone: "UTC",
+	}}
+	m.Register("alana", unreachableDB(t))
+	m.applyRegistry([]string{"slow"})
+
+	// Two first requests for the slow tenant share one connection attempt
+	var wg sync.WaitGroup
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.GetTenantDB("slow")
+			errs <- err
+		}()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(accepted) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("slow tenant never dialled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Other tenants and the registry stay available meanwhile
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := m.GetTenantDB("alana"); err != nil {
+			t.Errorf("alana: %v", err)
+		}
+		m.applyRegistry([]string{"slow", "other"})
+		m.ListTenants()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lookups blocked while a tenant was connecting")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(accepted); got != 1 {
+		t.Fatalf("slow tenant dialled %d times, want 1", got)
+	}
+
+	stop()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err == nil {
+			t.Fatal("connecting to a silent server succeeded")
+		}
+	}
+}
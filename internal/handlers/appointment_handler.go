@@ -0,0 +1,701 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type AppointmentHandler struct {
+	scheduler *services.AppointmentScheduler
+}
+
+func NewAppointmentHandler(scheduler *services.AppointmentScheduler) *AppointmentHandler {
+	return &AppointmentHandler{scheduler: scheduler}
+}
+
+// appointmentListSpec is what GET /appointments sorts by. The date filters
+// are applied on the tenant's calendar days by the handler.
+var appointmentListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"starts_at":  "starts_at",
+	},
+	DefaultSort: "starts_at",
+	Search:      []string{"note", "cancelreason"},
+}
+
+// CreateAppointmentRequest represents the request body for booking an
+// appointment. Date and start time are in the tenant's timezone.
+type CreateAppointmentRequest struct {
+	LocationID          *int    `json:"location_id"`
+	CustomerID          *int    `json:"customer_id"`
+	SalesOrderServiceID *int    `json:"sales_order_service_id"`
+	RoomID              *int    `json:"room_id"`
+	DoctorID            *int    `json:"doctor_id"`
+	NurseID             *int    `json:"nurse_id"`
+	BeauticianID        *int    `json:"beautician_id"`
+	Date                *string `json:"date" binding:"required"`
+	StartTime           *string `json:"start_time" binding:"required"`
+	DurationMinutes     int     `json:"duration_minutes" binding:"required"`
+	Note                *string `json:"note"`
+}
+
+// RescheduleAppointmentRequest represents the request body for moving an
+// appointment. Omitted room and staff are kept, and the duration defaults to
+// the current one.
+type RescheduleAppointmentRequest struct {
+	Date            *string `json:"date" binding:"required"`
+	StartTime       *string `json:"start_time" binding:"required"`
+	DurationMinutes int     `json:"duration_minutes"`
+	RoomID          *int    `json:"room_id"`
+	DoctorID        *int    `json:"doctor_id"`
+	NurseID         *int    `json:"nurse_id"`
+	BeauticianID    *int    `json:"beautician_id"`
+	Note            *string `json:"note"`
+}
+
+// CancelAppointmentRequest represents the request body for cancelling an appointment
+type CancelAppointmentRequest struct {
+	Reason *string `json:"reason"`
+}
+
+// AppointmentHoursRequest represents the request body for setting the
+// opening hours of a location
+type AppointmentHoursRequest struct {
+	OpensAt     string `json:"opens_at" binding:"required"`
+	ClosesAt    string `json:"closes_at" binding:"required"`
+	SlotMinutes int    `json:"slot_minutes" binding:"required"`
+}
+
+// GetAll retrieves all appointments with optional filters
+// @Summary Get all appointments
+// @Description Get list of appointments with optional pagination and filters
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, starts_at)"
+// @Param search query string false "Search note and cancel reason (case-insensitive substring)"
+// @Param status query string false "Filter by status (booked, cancelled)"
+// @Param location_id query int false "Filter by location ID"
+// @Param customer_id query int false "Filter by customer ID"
+// @Param sales_order_service_id query int false "Filter by sales order service ID"
+// @Param room_id query int false "Filter by room ID"
+// @Param doctor_id query int false "Filter by doctor ID"
+// @Param nurse_id query int false "Filter by nurse ID"
+// @Param beautician_id query int false "Filter by beautician ID"
+// @Param date_from query string false "Starting on or after (YYYY-MM-DD)"
+// @Param date_to query string false "Starting on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments [get]
+func (h *AppointmentHandler) GetAll(c *gin.Context) {
+	var appointments []models.Appointment
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse pagination, sorting and filters
+	timeZone := middleware.GetTenantTimeZone(c)
+	list, ok := utils.ParseListQuery(c, timeZone, appointmentListSpec)
+	if !ok {
+		return
+	}
+	dates := utils.NewDateParser(timeZone)
+	from, to := dates.Range(c, "date")
+	if dates.Failed(c) {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.Appointment{}).Scopes(middleware.LocationScope(c, "location_id"))
+
+	// Apply filters
+	for param, column := range map[string]string{
+		"status":                 "status",
+		"location_id":            "location_id",
+		"customer_id":            "customer_id",
+		"sales_order_service_id": "salesorderservice_id",
+		"room_id":                "room_id",
+		"doctor_id":              "doctor_id",
+		"nurse_id":               "nurse_id",
+		"beautician_id":          "beautician_id",
+	} {
+		if value := c.Query(param); value != "" {
+			query = query.Where(column+" = ?", value)
+		}
+	}
+	if from != nil {
+		query = query.Where("starts_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("starts_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	// Execute query
+	meta, err := list.Find(query, &appointments)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve appointments", nil)
+		return
+	}
+
+	utils.PaginatedResponse(c, http.StatusOK, "Appointments retrieved successfully", appointments, meta)
+}
+
+// GetByID retrieves a single appointment by ID
+// @Summary Get appointment by ID
+// @Description Get a single appointment by its ID
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param id path string true "Appointment ID (UUID)"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments/{id} [get]
+func (h *AppointmentHandler) GetByID(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid appointment ID", nil)
+		return
+	}
+
+	var appointment models.Appointment
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Query appointment by ID
+	if err := tenantDB.Scopes(middleware.LocationScope(c, "location_id")).
+		First(&appointment, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Appointment not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve appointment", nil)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Appointment retrieved successfully", appointment)
+}
+
+// Create books an appointment
+// @Summary Book an appointment
+// @Description Book a room and staff for a customer, optionally for a sold service. The time must lie on whole slots within the location's opening hours and must not overlap another booked appointment of the same room, doctor, nurse, beautician or customer.
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param request body CreateAppointmentRequest true "Appointment data"
+// @Success 201 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments [post]
+func (h *AppointmentHandler) Create(c *gin.Context) {
+	var req CreateAppointmentRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Scoped users may only book for their own location
+	locationID, ok := middleware.ResolveLocationID(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
+	}
+	if locationID == nil {
+		utils.ValidationErrorResponse(c, []models.ErrorDetail{{Field: "location_id", Message: "Location is required"}})
+		return
+	}
+
+	// Parse the start in the tenant's timezone
+	timeZone := middleware.GetTenantTimeZone(c)
+	startsAt, ok := parseAppointmentStart(c, timeZone, req.Date, req.StartTime)
+	if !ok {
+		return
+	}
+
+	appointment := models.Appointment{
+		LocationID:          *locationID,
+		CustomerID:          req.CustomerID,
+		SalesOrderServiceID: req.SalesOrderServiceID,
+		RoomID:              req.RoomID,
+		DoctorID:            req.DoctorID,
+		NurseID:             req.NurseID,
+		BeauticianID:        req.BeauticianID,
+		StartsAt:            *startsAt,
+		EndsAt:              startsAt.Add(time.Duration(req.DurationMinutes) * time.Minute),
+		Note:                req.Note,
+	}
+
+	if err := tenantDB.Transaction(func(tx *gorm.DB) error {
+		return h.scheduler.Book(tx, &appointment, userIDInt64, timeZone)
+	}); err != nil {
+		h.serviceError(c, err, "Failed to book appointment")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Appointment booked successfully", appointment)
+}
+
+// Reschedule moves an appointment
+// @Summary Reschedule an appointment
+// @Description Move a booked appointment to another time, and optionally to another room or staff. The new time is checked like a new booking, ignoring the appointment itself.
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param id path string true "Appointment ID (UUID)"
+// @Param request body RescheduleAppointmentRequest true "New time"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments/{id}/reschedule [patch]
+func (h *AppointmentHandler) Reschedule(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid appointment ID", nil)
+		return
+	}
+
+	var req RescheduleAppointmentRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Parse the new start in the tenant's timezone
+	timeZone := middleware.GetTenantTimeZone(c)
+	startsAt, ok := parseAppointmentStart(c, timeZone, req.Date, req.StartTime)
+	if !ok {
+		return
+	}
+
+	var appointment *models.Appointment
+	if err := tenantDB.Transaction(func(tx *gorm.DB) error {
+		duration := time.Duration(req.DurationMinutes) * time.Minute
+		if duration == 0 {
+			var current models.Appointment
+			if err := tx.Scopes(middleware.LocationScope(c, "location_id")).
+				First(&current, "id = ?", id).Error; err != nil {
+				if err == gorm.ErrRecordNotFound {
+					return services.ErrAppointmentNotFound
+				}
+				return err
+			}
+			duration = current.EndsAt.Sub(current.StartsAt)
+		}
+
+		change := services.AppointmentChange{
+			StartsAt:     *startsAt,
+			EndsAt:       startsAt.Add(duration),
+			RoomID:       req.RoomID,
+			DoctorID:     req.DoctorID,
+			NurseID:      req.NurseID,
+			BeauticianID: req.BeauticianID,
+			Note:         req.Note,
+		}
+		var err error
+		appointment, err = h.scheduler.Reschedule(tx, id, change, userIDInt64, timeZone, middleware.LocationScope(c, "location_id"))
+		return err
+	}); err != nil {
+		h.serviceError(c, err, "Failed to reschedule appointment")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Appointment rescheduled successfully", appointment)
+}
+
+// Cancel cancels an appointment
+// @Summary Cancel an appointment
+// @Description Cancel a booked appointment, freeing its slot. The appointment is kept with its reason and the schedule date of its service is cleared.
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param id path string true "Appointment ID (UUID)"
+// @Param request body CancelAppointmentRequest false "Cancellation reason"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments/{id}/cancel [patch]
+func (h *AppointmentHandler) Cancel(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid appointment ID", nil)
+		return
+	}
+
+	// The reason is optional, so an empty body is accepted
+	var req CancelAppointmentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	var appointment *models.Appointment
+	if err := tenantDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		appointment, err = h.scheduler.Cancel(tx, id, req.Reason, userIDInt64, middleware.LocationScope(c, "location_id"))
+		return err
+	}); err != nil {
+		h.serviceError(c, err, "Failed to cancel appointment")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Appointment cancelled successfully", appointment)
+}
+
+// GetDay retrieves the day view of a location
+// @Summary Get the appointment day view
+// @Description Get a location's opening hours and appointments of a day in start order, with service names and invoice numbers, for the front desk
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param date query string false "Day (YYYY-MM-DD), defaults to today"
+// @Param location_id query int false "Location ID, defaults to the caller's location"
+// @Param include_cancelled query bool false "Include cancelled appointments"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments/day [get]
+func (h *AppointmentHandler) GetDay(c *gin.Context) {
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	timeZone := middleware.GetTenantTimeZone(c)
+	date, locationID, ok := parseAppointmentDay(c, timeZone)
+	if !ok {
+		return
+	}
+
+	day, err := h.scheduler.Day(tenantDB, locationID, date, timeZone, c.Query("include_cancelled") == "true")
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve appointment day", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Appointment day retrieved successfully", day)
+}
+
+// GetAvailability lists the free slots of a day
+// @Summary Get available slots
+// @Description Get the slots of a location's day and whether the given room and staff are all free for the duration from each
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param date query string false "Day (YYYY-MM-DD), defaults to today"
+// @Param location_id query int false "Location ID, defaults to the caller's location"
+// @Param duration_minutes query int false "Duration, defaults to one slot"
+// @Param room_id query int false "Room ID"
+// @Param doctor_id query int false "Doctor ID"
+// @Param nurse_id query int false "Nurse ID"
+// @Param beautician_id query int false "Beautician ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments/availability [get]
+func (h *AppointmentHandler) GetAvailability(c *gin.Context) {
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	timeZone := middleware.GetTenantTimeZone(c)
+	date, locationID, ok := parseAppointmentDay(c, timeZone)
+	if !ok {
+		return
+	}
+
+	var errs []models.ErrorDetail
+	queryInt := func(name string) *int {
+		value := c.Query(name)
+		if value == "" {
+			return nil
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, models.ErrorDetail{Field: name, Message: "Must be an integer"})
+			return nil
+		}
+		return &parsed
+	}
+	query := services.AvailabilityQuery{
+		LocationID:   locationID,
+		Date:         date,
+		RoomID:       queryInt("room_id"),
+		DoctorID:     queryInt("doctor_id"),
+		NurseID:      queryInt("nurse_id"),
+		BeauticianID: queryInt("beautician_id"),
+	}
+	if duration := queryInt("duration_minutes"); duration != nil {
+		query.Duration = time.Duration(*duration) * time.Minute
+	}
+	if len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	slots, err := h.scheduler.Availability(tenantDB, query, timeZone)
+	if err != nil {
+		h.serviceError(c, err, "Failed to retrieve available slots")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Available slots retrieved successfully", slots)
+}
+
+// GetHours retrieves the opening hours of a location
+// @Summary Get appointment hours
+// @Description Get the opening hours and slot length of a location, or the configured defaults when it has none
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param location_id path int true "Location ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments/hours/{location_id} [get]
+func (h *AppointmentHandler) GetHours(c *gin.Context) {
+	locationID, ok := appointmentHoursLocation(c)
+	if !ok {
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	hours, err := h.scheduler.Hours(tenantDB, locationID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve appointment hours", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Appointment hours retrieved successfully", hours)
+}
+
+// SetHours sets the opening hours of a location
+// @Summary Set appointment hours
+// @Description Set the opening hours and slot length of a location. Existing appointments are kept.
+// @Tags Appointment
+// @Accept json
+// @Produce json
+// @Param location_id path int true "Location ID"
+// @Param request body AppointmentHoursRequest true "Opening hours"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/appointments/hours/{location_id} [put]
+func (h *AppointmentHandler) SetHours(c *gin.Context) {
+	locationID, ok := appointmentHoursLocation(c)
+	if !ok {
+		return
+	}
+
+	var req AppointmentHoursRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	hours := models.AppointmentHours{
+		LocationID:  locationID,
+		OpensAt:     req.OpensAt,
+		ClosesAt:    req.ClosesAt,
+		SlotMinutes: req.SlotMinutes,
+	}
+	if errs := services.ValidateHours(&hours); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	now := time.Now()
+	hours.UpdatedBy = &userIDInt64
+	hours.UpdatedAt = &now
+	if err := tenantDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "location_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"opens_at", "closes_at", "slotminutes", "updated_by", "updated_at"}),
+	}).Create(&hours).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save appointment hours", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Appointment hours saved successfully", hours)
+}
+
+// serviceError maps an appointment scheduler error onto a response
+func (h *AppointmentHandler) serviceError(c *gin.Context, err error, message string) {
+	var validationErrs services.ValidationErrors
+	var conflictErr *services.ConflictError
+	var appointmentErr *services.AppointmentError
+	switch {
+	case errors.As(err, &validationErrs):
+		utils.ValidationErrorResponse(c, validationErrs)
+	case errors.Is(err, services.ErrAppointmentNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Appointment not found", nil)
+	case errors.As(err, &conflictErr):
+		utils.ErrorResponse(c, http.StatusConflict, "Time slot is already booked", conflictErr.Conflicts)
+	case errors.As(err, &appointmentErr):
+		utils.ErrorResponse(c, http.StatusConflict, appointmentErr.Error(), nil)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err.Error())
+	}
+}
+
+// parseAppointmentStart combines a date and HH:MM start time in the tenant's
+// timezone, writing a validation response when either is invalid
+func parseAppointmentStart(c *gin.Context, timeZone *time.Location, date, startTime *string) (*time.Time, bool) {
+	dates := utils.NewDateParser(timeZone)
+	day := dates.Optional("date", date)
+	startsAt := dates.At("start_time", day, startTime)
+	if dates.Failed(c) {
+		return nil, false
+	}
+	return startsAt, true
+}
+
+// parseAppointmentDay reads the date and location_id query parameters of the
+// day view and availability. The date defaults to today and the location to
+// the caller's own.
+func parseAppointmentDay(c *gin.Context, timeZone *time.Location) (time.Time, int, bool) {
+	dates := utils.NewDateParser(timeZone)
+	date := dates.Query(c, "date")
+	if dates.Failed(c) {
+		return time.Time{}, 0, false
+	}
+	if date == nil {
+		today := utils.Today(timeZone)
+		date = &today
+	}
+
+	var requested *int
+	if value := c.Query("location_id"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			utils.ValidationErrorResponse(c, []models.ErrorDetail{{Field: "location_id", Message: "Location must be an integer"}})
+			return time.Time{}, 0, false
+		}
+		requested = &parsed
+	}
+	locationID, ok := middleware.ResolveLocationID(c, requested)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return time.Time{}, 0, false
+	}
+	if locationID == nil {
+		utils.ValidationErrorResponse(c, []models.ErrorDetail{{Field: "location_id", Message: "Location is required"}})
+		return time.Time{}, 0, false
+	}
+	return *date, *locationID, true
+}
+
+// appointmentHoursLocation reads the location_id path parameter, which a
+// scoped caller may only set to their own location
+func appointmentHoursLocation(c *gin.Context) (int, bool) {
+	requested, err := strconv.Atoi(c.Param("location_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid location ID", nil)
+		return 0, false
+	}
+	if _, ok := middleware.ResolveLocationID(c, &requested); !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return 0, false
+	}
+	return requested, true
+}
@@ -5,24 +5,38 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
 type ARReceiptDetailHandler struct {
-	db *gorm.DB
+	allocation *services.ReceiptAllocation
 }
 
-func NewARReceiptDetailHandler(db *gorm.DB) *ARReceiptDetailHandler {
-	return &ARReceiptDetailHandler{db: db}
+func NewARReceiptDetailHandler(allocation *services.ReceiptAllocation) *ARReceiptDetailHandler {
+	return &ARReceiptDetailHandler{allocation: allocation}
 }
 
-// CreateARReceiptDetailRequest represents the request body for creating an AR receipt detail
+// arReceiptDetailListSpec is what GET /ar-receipt-details sorts by
+var arReceiptDetailListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at":     "created_at",
+		"receipt_amount": "receiptamount",
+	},
+	DefaultSort: "id",
+}
+
+// CreateARReceiptDetailRequest represents the request body for creating an
+// AR receipt detail, which allocates part of the receipt to a sales order
 type CreateARReceiptDetailRequest struct {
-	ARReceiptID   *int     `json:"ar_receipt_id" binding:"required"`
-	SalesOrderID  *int     `json:"sales_order_id"`
-	ReceiptAmount *float64 `json:"receipt_amount"`
+	ARReceiptID   *uuid.UUID    `json:"ar_receipt_id" binding:"required"`
+	SalesOrderID  *uuid.UUID    `json:"sales_order_id" binding:"required"`
+	ReceiptAmount *models.Money `json:"receipt_amount" binding:"required"`
 }
 
 // GetAll retrieves all AR receipt details with optional filters
@@ -31,40 +45,61 @@ type CreateARReceiptDetailRequest struct {
 // @Tags ARReceiptDetail
 // @Accept json
 // @Produce json
-// @Param ar_receipt_id query int false "Filter by AR receipt ID"
-// @Param sales_order_id query int false "Filter by sales order ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, receipt_amount)"
+// @Param ar_receipt_id query string false "Filter by AR receipt ID (UUID)"
+// @Param sales_order_id query string false "Filter by sales order ID (UUID)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/ar-receipt-details [get]
 func (h *ARReceiptDetailHandler) GetAll(c *gin.Context) {
 	var details []models.ARReceiptDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), arReceiptDetailListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
-	query := tenantDB.Model(&models.ARReceiptDetail{})
+	query := tenantDB.Model(&models.ARReceiptDetail{}).Scopes(arReceiptDetailScope(c))
 
 	// Apply filters
 	if arReceiptID := c.Query("ar_receipt_id"); arReceiptID != "" {
-		query = query.Where("arreceipt_id = ?", arReceiptID)
+		id, err := uuid.Parse(arReceiptID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid AR receipt ID", nil)
+			return
+		}
+		query = query.Where("arreceipt_id = ?", id)
 	}
 	if salesOrderID := c.Query("sales_order_id"); salesOrderID != "" {
-		query = query.Where("salesorder_id = ?", salesOrderID)
+		id, err := uuid.Parse(salesOrderID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sales order ID", nil)
+			return
+		}
+		query = query.Where("salesorder_id = ?", id)
 	}
 
 	// Execute query
-	if err := query.Find(&details).Error; err != nil {
+	meta, err := list.Find(query, &details)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve AR receipt details", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "AR receipt details retrieved successfully", details)
+	utils.PaginatedResponse(c, http.StatusOK, "AR receipt details retrieved successfully", details, meta)
 }
 
 // GetByID retrieves a single AR receipt detail by ID
@@ -90,15 +125,14 @@ func (h *ARReceiptDetailHandler) GetByID(c *gin.Context) {
 	var detail models.ARReceiptDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query AR receipt detail by ID
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	if err := tenantDB.Scopes(arReceiptDetailScope(c)).First(&detail, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "AR receipt detail not found", nil)
 			return
@@ -116,14 +150,14 @@ func (h *ARReceiptDetailHandler) GetByID(c *gin.Context) {
 // @Tags ARReceiptDetail
 // @Accept json
 // @Produce json
-// @Param ar_receipt_id path int true "AR Receipt ID"
+// @Param ar_receipt_id path string true "AR Receipt ID (UUID)"
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/ar-receipt-details/by-ar-receipt/{ar_receipt_id} [get]
 func (h *ARReceiptDetailHandler) GetByARReceiptID(c *gin.Context) {
 	// Parse AR receipt ID from URL parameter
-	arReceiptID, err := strconv.Atoi(c.Param("ar_receipt_id"))
+	arReceiptID, err := uuid.Parse(c.Param("ar_receipt_id"))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid AR receipt ID", nil)
 		return
@@ -132,15 +166,14 @@ func (h *ARReceiptDetailHandler) GetByARReceiptID(c *gin.Context) {
 	var details []models.ARReceiptDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query details by AR receipt ID
-	if err := tenantDB.Where("arreceipt_id = ?", arReceiptID).Find(&details).Error; err != nil {
+	if err := tenantDB.Scopes(arReceiptDetailScope(c)).Where("arreceipt_id = ?", arReceiptID).Find(&details).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve AR receipt details", nil)
 		return
 	}
@@ -150,13 +183,15 @@ func (h *ARReceiptDetailHandler) GetByARReceiptID(c *gin.Context) {
 
 // Create creates a new AR receipt detail
 // @Summary Create a new AR receipt detail
-// @Description Create a new AR receipt detail
+// @Description Allocate part of an AR receipt to a posted sales order. The amount must not exceed the order's outstanding balance or the receipt's unallocated amount; the order is updated in the same transaction.
 // @Tags ARReceiptDetail
 // @Accept json
 // @Produce json
 // @Param request body CreateARReceiptDetailRequest true "AR Receipt Detail data"
 // @Success 201 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/ar-receipt-details [post]
 func (h *ARReceiptDetailHandler) Create(c *gin.Context) {
@@ -169,28 +204,28 @@ func (h *ARReceiptDetailHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Create AR receipt detail
-	detail := models.ARReceiptDetail{
-		ARReceiptID:   req.ARReceiptID,
-		SalesOrderID:  req.SalesOrderID,
-		ReceiptAmount: req.ReceiptAmount,
-		CreatedBy:     &userIDInt64,
-	}
-
-	// Create the detail
-	if err := tenantDB.Create(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create AR receipt detail", err.Error())
+	// Allocate through the receipt so the order's balance follows
+	var detail models.ARReceiptDetail
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		created, err := h.allocate(tx, c, &req, userIDInt64)
+		if err != nil {
+			return err
+		}
+		detail = *created
+		return nil
+	})
+	if err != nil {
+		allocationError(c, err, "Failed to create AR receipt detail")
 		return
 	}
 
@@ -199,7 +234,7 @@ func (h *ARReceiptDetailHandler) Create(c *gin.Context) {
 
 // Update updates an existing AR receipt detail
 // @Summary Update AR receipt detail
-// @Description Update an existing AR receipt detail by ID
+// @Description Reallocate an AR receipt detail by ID: the allocation is reversed and deleted and a new one is made from the request in the same transaction. The response is the new detail.
 // @Tags ARReceiptDetail
 // @Accept json
 // @Produce json
@@ -208,6 +243,7 @@ func (h *ARReceiptDetailHandler) Create(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/ar-receipt-details/{id} [put]
 func (h *ARReceiptDetailHandler) Update(c *gin.Context) {
@@ -227,37 +263,35 @@ func (h *ARReceiptDetailHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Check if AR receipt detail exists
+	// Reverse the allocation and make the new one in one transaction
 	var detail models.ARReceiptDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		if err := h.release(tx, c, id, userIDInt64); err != nil {
+			return err
+		}
+		created, err := h.allocate(tx, c, &req, userIDInt64)
+		if err != nil {
+			return err
+		}
+		detail = *created
+		return nil
+	})
+	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "AR receipt detail not found", nil)
 			return
 		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve AR receipt detail", nil)
-		return
-	}
-
-	// Update fields
-	detail.ARReceiptID = req.ARReceiptID
-	detail.SalesOrderID = req.SalesOrderID
-	detail.ReceiptAmount = req.ReceiptAmount
-	detail.UpdatedBy = &userIDInt64
-
-	// Save updates
-	if err := tenantDB.Save(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update AR receipt detail", err.Error())
+		allocationError(c, err, "Failed to update AR receipt detail")
 		return
 	}
 
@@ -266,7 +300,7 @@ func (h *ARReceiptDetailHandler) Update(c *gin.Context) {
 
 // Delete soft deletes an AR receipt detail
 // @Summary Delete AR receipt detail
-// @Description Soft delete an AR receipt detail by ID
+// @Description Soft delete an AR receipt detail by ID, reversing its allocation: the sales order gets its outstanding balance back and a paid order returns to posted
 // @Tags ARReceiptDetail
 // @Accept json
 // @Produce json
@@ -285,40 +319,69 @@ func (h *ARReceiptDetailHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Check if AR receipt detail exists
-	var detail models.ARReceiptDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	// Reverse the allocation and soft delete in one transaction
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		return h.release(tx, c, id, userIDInt64)
+	})
+	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "AR receipt detail not found", nil)
 			return
 		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve AR receipt detail", nil)
+		allocationError(c, err, "Failed to delete AR receipt detail")
 		return
 	}
 
-	// Set deleted_by before soft delete
-	detail.DeletedBy = &userIDInt64
-	if err := tenantDB.Save(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
-		return
-	}
+	utils.SuccessResponse(c, http.StatusOK, "AR receipt detail deleted successfully", nil)
+}
 
-	// Soft delete
-	if err := tenantDB.Delete(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete AR receipt detail", err.Error())
-		return
+// arReceiptDetailScope limits allocations to those of receipts at the caller's location
+func arReceiptDetailScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationScope(c, "ar_receipt_detail.arreceipt_id", "ar_receipt", "lacation_id")
+}
+
+// allocate locks the request's receipt and allocates the requested amount
+// of it to the sales order inside tx; a receipt outside the caller's location
+// is services.ErrReceiptNotFound
+func (h *ARReceiptDetailHandler) allocate(tx *gorm.DB, c *gin.Context, req *CreateARReceiptDetailRequest, userID int64) (*models.ARReceiptDetail, error) {
+	receipt, err := h.allocation.LockReceipt(tx, *req.ARReceiptID, middleware.LocationScope(c, "lacation_id"))
+	if err != nil {
+		return nil, err
+	}
+	today := utils.Today(middleware.GetTenantTimeZone(c))
+	details, err := h.allocation.Allocate(tx, receipt, []services.Allocation{{
+		SalesOrderID: *req.SalesOrderID,
+		Amount:       *req.ReceiptAmount,
+	}}, userID, today, middleware.LocationScope(c, "location_id"))
+	if err != nil {
+		return nil, err
 	}
+	return &details[0], nil
+}
 
-	utils.SuccessResponse(c, http.StatusOK, "AR receipt detail deleted successfully", nil)
+// release locks the detail and its receipt and reverses the allocation
+// inside tx; a missing detail, or one of a receipt outside the caller's
+// location, is gorm.ErrRecordNotFound
+func (h *ARReceiptDetailHandler) release(tx *gorm.DB, c *gin.Context, id int, userID int64) error {
+	var detail models.ARReceiptDetail
+	if err := tx.Scopes(arReceiptDetailScope(c)).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&detail, id).Error; err != nil {
+		return err
+	}
+	if detail.ARReceiptID != nil {
+		if _, err := h.allocation.LockReceipt(tx, *detail.ARReceiptID, middleware.LocationScope(c, "lacation_id")); err != nil {
+			return err
+		}
+	}
+	return h.allocation.Release(tx, &detail, userID, utils.Today(middleware.GetTenantTimeZone(c)))
 }
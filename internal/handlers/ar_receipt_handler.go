@@ -1,40 +1,98 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
 type ARReceiptHandler struct {
-	db *gorm.DB
+	numbering  *services.DocumentNumbering
+	allocation *services.ReceiptAllocation
 }
 
-func NewARReceiptHandler(db *gorm.DB) *ARReceiptHandler {
-	return &ARReceiptHandler{db: db}
+func NewARReceiptHandler(numbering *services.DocumentNumbering, allocation *services.ReceiptAllocation) *ARReceiptHandler {
+	return &ARReceiptHandler{numbering: numbering, allocation: allocation}
 }
 
-// CreateARReceiptRequest represents the request body for creating an AR receipt
+// arReceiptListSpec is what GET /ar-receipts sorts, searches and filters by
+var arReceiptListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at":   "created_at",
+		"doc_date":     "docdate",
+		"inv_number":   "invnumber",
+		"posted_date":  "posteddate",
+		"total_amount": "totalamounth",
+	},
+	DefaultSort: "-doc_date",
+	Search:      []string{"invnumber", "note"},
+	DateRanges: map[string]string{
+		"doc_date":    "docdate",
+		"posted_date": "posteddate",
+	},
+}
+
+// CreateARReceiptRequest represents the request body for creating an AR
+// receipt. Details allocate the receipt to sales orders; auto_allocate
+// allocates it to the customer's oldest unpaid orders instead. Both are
+// ignored on update.
 type CreateARReceiptRequest struct {
-	LocationID      *int                               `json:"location_id"`
-	CustomerID      *int                               `json:"customer_id" binding:"required"`
-	PaymentMethodID *int                               `json:"payment_method_id"`
-	DocNumber       *int                               `json:"doc_number"`
-	DocDate         *string                            `json:"doc_date"`
-	PostedDate      *string                            `json:"posted_date"`
-	TotalAmount     *float64                           `json:"total_amount"`
-	Note            *string                            `json:"note"`
-	StatusID        *int                               `json:"status_id"`
+	LocationID      *int                           `json:"location_id"`
+	CustomerID      *int                           `json:"customer_id" binding:"required"`
+	PaymentMethodID *int                           `json:"payment_method_id"`
+	DocDate         *string                        `json:"doc_date"`
+	PostedDate      *string                        `json:"posted_date"`
+	TotalAmount     *models.Money                  `json:"total_amount"`
+	Note            *string                        `json:"note"`
+	StatusID        *int                           `json:"status_id"`
 	Details         []ARReceiptDetailNestedRequest `json:"details"`
+	AutoAllocate    bool                           `json:"auto_allocate"`
 }
 
 type ARReceiptDetailNestedRequest struct {
-	SalesOrderID  *int     `json:"sales_order_id"`
-	ReceiptAmount *float64 `json:"receipt_amount"`
+	SalesOrderID  *uuid.UUID    `json:"sales_order_id"`
+	ReceiptAmount *models.Money `json:"receipt_amount"`
+}
+
+// AllocateARReceiptRequest represents the request body for allocating an
+// existing AR receipt: either details or auto_allocate
+type AllocateARReceiptRequest struct {
+	Details      []ARReceiptDetailNestedRequest `json:"details"`
+	AutoAllocate bool                           `json:"auto_allocate"`
+}
+
+// allocations converts nested details into allocations; missing fields are
+// left zero for the allocation service to reject
+func allocations(details []ARReceiptDetailNestedRequest) []services.Allocation {
+	result := make([]services.Allocation, 0, len(details))
+	for _, detail := range details {
+		var allocation services.Allocation
+		if detail.SalesOrderID != nil {
+			allocation.SalesOrderID = *detail.SalesOrderID
+		}
+		if detail.ReceiptAmount != nil {
+			allocation.Amount = *detail.ReceiptAmount
+		}
+		result = append(result, allocation)
+	}
+	return result
+}
+
+// checkAllocationMode reports a validation error when both details and
+// auto_allocate are given
+func checkAllocationMode(c *gin.Context, details []ARReceiptDetailNestedRequest, autoAllocate bool) bool {
+	if len(details) > 0 && autoAllocate {
+		utils.ValidationErrorResponse(c, []models.ErrorDetail{{Field: "auto_allocate", Message: "Send either details or auto_allocate, not both"}})
+		return false
+	}
+	return true
 }
 
 // GetAll retrieves all AR receipts with optional filters
@@ -44,25 +102,39 @@ type ARReceiptDetailNestedRequest struct {
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number" default(1)
-// @Param limit query int false "Items per page" default(10)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, doc_date, inv_number, posted_date, total_amount)"
+// @Param search query string false "Search document number and note (case-insensitive substring)"
 // @Param customer_id query int false "Filter by customer ID"
 // @Param status_id query int false "Filter by status ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Param inv_number query string false "Search by document number, e.g. AR/JKT/2026"
+// @Param doc_date_from query string false "Document date on or after (YYYY-MM-DD)"
+// @Param doc_date_to query string false "Document date on or before (YYYY-MM-DD)"
+// @Param posted_date_from query string false "Posted date on or after (YYYY-MM-DD)"
+// @Param posted_date_to query string false "Posted date on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/ar-receipts [get]
 func (h *ARReceiptHandler) GetAll(c *gin.Context) {
 	var arReceipts []models.ARReceipt
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), arReceiptListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
-	query := tenantDB.Model(&models.ARReceipt{})
+	query := tenantDB.Model(&models.ARReceipt{}).Scopes(middleware.LocationScope(c, "lacation_id"))
 
 	// Apply filters
 	if customerID := c.Query("customer_id"); customerID != "" {
@@ -71,17 +143,18 @@ func (h *ARReceiptHandler) GetAll(c *gin.Context) {
 	if statusID := c.Query("status_id"); statusID != "" {
 		query = query.Where("status_id = ?", statusID)
 	}
-
-	// Preload relationships
-	query = query.Preload("Details")
+	if invNumber := c.Query("inv_number"); invNumber != "" {
+		query = query.Where("invnumber ILIKE ?", "%"+invNumber+"%")
+	}
 
 	// Execute query
-	if err := query.Find(&arReceipts).Error; err != nil {
+	meta, err := list.Find(query, &arReceipts, "Details")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve AR receipts", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "AR receipts retrieved successfully", arReceipts)
+	utils.PaginatedResponse(c, http.StatusOK, "AR receipts retrieved successfully", arReceipts, meta)
 }
 
 // GetByID retrieves a single AR receipt by ID
@@ -107,15 +180,14 @@ func (h *ARReceiptHandler) GetByID(c *gin.Context) {
 	var arReceipt models.ARReceipt
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query AR receipt by ID with relationships
-	if err := tenantDB.Preload("Details").
+	if err := tenantDB.Scopes(middleware.LocationScope(c, "lacation_id")).Preload("Details").
 		First(&arReceipt, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "AR receipt not found", nil)
@@ -130,13 +202,14 @@ func (h *ARReceiptHandler) GetByID(c *gin.Context) {
 
 // Create creates a new AR receipt
 // @Summary Create a new AR receipt
-// @Description Create a new AR receipt with details
+// @Description Create a new AR receipt and allocate it to posted sales orders, either by its details or with auto_allocate to the customer's oldest unpaid orders. Each allocation is checked against the order's outstanding balance and updates the order in the same transaction.
 // @Tags ARReceipt
 // @Accept json
 // @Produce json
 // @Param request body CreateARReceiptRequest true "AR Receipt data"
 // @Success 201 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/ar-receipts [post]
 func (h *ARReceiptHandler) Create(c *gin.Context) {
@@ -147,25 +220,48 @@ func (h *ARReceiptHandler) Create(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
 		return
 	}
+	if !checkAllocationMode(c, req.Details, req.AutoAllocate) {
+		return
+	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationID(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
+	}
+
+	// Parse dates in the tenant's timezone; the document date defaults to today
+	timeZone := middleware.GetTenantTimeZone(c)
+	dates := utils.NewDateParser(timeZone)
+	docDate := dates.Optional("doc_date", req.DocDate)
+	postedDate := dates.Optional("posted_date", req.PostedDate)
+	if dates.Failed(c) {
+		return
+	}
+	if docDate == nil {
+		today := utils.Today(timeZone)
+		docDate = &today
+	}
+
 	// Create AR receipt
 	arReceipt := models.ARReceipt{
-		LocationID:      req.LocationID,
+		LocationID:      locationID,
 		CustomerID:      req.CustomerID,
 		PaymentMethodID: req.PaymentMethodID,
-		DocNumber:       req.DocNumber,
+		DocDate:         docDate,
+		PostedDate:      postedDate,
 		TotalAmount:     req.TotalAmount,
 		Note:            req.Note,
 		StatusID:        req.StatusID,
@@ -180,6 +276,17 @@ func (h *ARReceiptHandler) Create(c *gin.Context) {
 		}
 	}()
 
+	// Allocate the document number in this transaction so it is never shared or skipped
+	number, err := h.numbering.Next(tx, services.DocumentARReceipt, locationID, *docDate)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to allocate document number", err.Error())
+		return
+	}
+	docNumber := int(number.Sequence)
+	arReceipt.DocNumber = &docNumber
+	arReceipt.InvNumber = &number.Formatted
+
 	// Create AR receipt
 	if err := tx.Create(&arReceipt).Error; err != nil {
 		tx.Rollback()
@@ -187,20 +294,18 @@ func (h *ARReceiptHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// Create details if provided
+	// Allocate the receipt to sales orders, updating their balances
+	today := utils.Today(timeZone)
+	orderScope := middleware.LocationScope(c, "location_id")
 	if len(req.Details) > 0 {
-		for _, detailReq := range req.Details {
-			detail := models.ARReceiptDetail{
-				SalesOrderID:  detailReq.SalesOrderID,
-				ReceiptAmount: detailReq.ReceiptAmount,
-				CreatedBy:     &userIDInt64,
-			}
-			if err := tx.Create(&detail).Error; err != nil {
-				tx.Rollback()
-				utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create AR receipt detail", err.Error())
-				return
-			}
-		}
+		_, err = h.allocation.Allocate(tx, &arReceipt, allocations(req.Details), userIDInt64, today, orderScope)
+	} else if req.AutoAllocate {
+		_, err = h.allocation.AutoAllocate(tx, &arReceipt, userIDInt64, today, orderScope)
+	}
+	if err != nil {
+		tx.Rollback()
+		allocationError(c, err, "Failed to allocate AR receipt")
+		return
 	}
 
 	// Commit transaction
@@ -217,7 +322,7 @@ func (h *ARReceiptHandler) Create(c *gin.Context) {
 
 // Update updates an existing AR receipt
 // @Summary Update AR receipt
-// @Description Update an existing AR receipt by ID
+// @Description Update an existing AR receipt by ID. Allocations are kept: the customer of an allocated receipt cannot change and its total cannot drop below the allocated amount.
 // @Tags ARReceipt
 // @Accept json
 // @Produce json
@@ -245,53 +350,89 @@ func (h *ARReceiptHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Check if AR receipt exists
-	var arReceipt models.ARReceipt
-	if err := tenantDB.First(&arReceipt, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, http.StatusNotFound, "AR receipt not found", nil)
-			return
-		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve AR receipt", nil)
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationID(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
 		return
 	}
 
-	// Update fields
-	arReceipt.LocationID = req.LocationID
-	arReceipt.CustomerID = req.CustomerID
-	arReceipt.PaymentMethodID = req.PaymentMethodID
-	arReceipt.DocNumber = req.DocNumber
-	arReceipt.TotalAmount = req.TotalAmount
-	arReceipt.Note = req.Note
-	arReceipt.StatusID = req.StatusID
-	arReceipt.UpdatedBy = &userIDInt64
+	// Parse dates in the tenant's timezone; an omitted document date is kept
+	dates := utils.NewDateParser(middleware.GetTenantTimeZone(c))
+	docDate := dates.Optional("doc_date", req.DocDate)
+	postedDate := dates.Optional("posted_date", req.PostedDate)
+	if dates.Failed(c) {
+		return
+	}
 
-	// Save updates
-	if err := tenantDB.Save(&arReceipt).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update AR receipt", err.Error())
+	// Lock the receipt and write only the edited columns, keeping it
+	// consistent with its allocations; a concurrent allocation either runs
+	// first and is checked here or waits for this update
+	var arReceipt *models.ARReceipt
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		arReceipt, err = h.allocation.LockReceipt(tx, id, middleware.LocationScope(c, "lacation_id"))
+		if err != nil {
+			return err
+		}
+		allocated, err := h.allocation.Allocated(tx, arReceipt.ID)
+		if err != nil {
+			return err
+		}
+		if allocated.IsPositive() {
+			var errs services.ValidationErrors
+			if arReceipt.CustomerID != nil && (req.CustomerID == nil || *req.CustomerID != *arReceipt.CustomerID) {
+				errs = append(errs, models.ErrorDetail{Field: "customer_id", Message: "Customer of an allocated receipt cannot change"})
+			}
+			if req.TotalAmount == nil || req.TotalAmount.Cmp(allocated) < 0 {
+				errs = append(errs, models.ErrorDetail{Field: "total_amount", Message: "Total amount cannot be less than the allocated amount (" + allocated.String() + ")"})
+			}
+			if len(errs) > 0 {
+				return errs
+			}
+		}
+
+		// Update fields
+		arReceipt.LocationID = locationID
+		arReceipt.CustomerID = req.CustomerID
+		arReceipt.PaymentMethodID = req.PaymentMethodID
+		if docDate != nil {
+			arReceipt.DocDate = docDate
+		}
+		arReceipt.PostedDate = postedDate
+		arReceipt.TotalAmount = req.TotalAmount
+		arReceipt.Note = req.Note
+		arReceipt.StatusID = req.StatusID
+		arReceipt.UpdatedBy = &userIDInt64
+
+		return tx.Model(arReceipt).
+			Select("LocationID", "CustomerID", "PaymentMethodID", "DocDate", "PostedDate", "TotalAmount", "Note", "StatusID", "UpdatedBy").
+			Updates(arReceipt).Error
+	})
+	if err != nil {
+		allocationError(c, err, "Failed to update AR receipt")
 		return
 	}
 
 	// Load updated AR receipt with relationships
-	tenantDB.Preload("Details").First(&arReceipt, "id = ?", arReceipt.ID)
+	tenantDB.Preload("Details").First(arReceipt, "id = ?", arReceipt.ID)
 
 	utils.SuccessResponse(c, http.StatusOK, "AR receipt updated successfully", arReceipt)
 }
 
 // Delete soft deletes an AR receipt
 // @Summary Delete AR receipt
-// @Description Soft delete an AR receipt by ID
+// @Description Void (soft delete) an AR receipt by ID. Its allocations are reversed: the sales orders it paid get their outstanding balance back and paid orders return to posted.
 // @Tags ARReceipt
 // @Accept json
 // @Produce json
@@ -310,12 +451,11 @@ func (h *ARReceiptHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -323,7 +463,7 @@ func (h *ARReceiptHandler) Delete(c *gin.Context) {
 
 	// Check if AR receipt exists
 	var arReceipt models.ARReceipt
-	if err := tenantDB.First(&arReceipt, "id = ?", id).Error; err != nil {
+	if err := tenantDB.Scopes(middleware.LocationScope(c, "lacation_id")).First(&arReceipt, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "AR receipt not found", nil)
 			return
@@ -332,18 +472,121 @@ func (h *ARReceiptHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	// Set deleted_by before soft delete
-	arReceipt.DeletedBy = &userIDInt64
-	if err := tenantDB.Save(&arReceipt).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+	// Reverse the allocations and soft delete in one transaction
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		locked, err := h.allocation.LockReceipt(tx, arReceipt.ID)
+		if err != nil {
+			return err
+		}
+		today := utils.Today(middleware.GetTenantTimeZone(c))
+		if err := h.allocation.Reverse(tx, locked, userIDInt64, today); err != nil {
+			return err
+		}
+
+		// Set deleted_by before soft delete
+		locked.DeletedBy = &userIDInt64
+		if err := tx.Save(locked).Error; err != nil {
+			return err
+		}
+		return tx.Delete(locked).Error
+	})
+	if err != nil {
+		allocationError(c, err, "Failed to delete AR receipt")
 		return
 	}
 
-	// Soft delete
-	if err := tenantDB.Delete(&arReceipt).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete AR receipt", err.Error())
+	utils.SuccessResponse(c, http.StatusOK, "AR receipt deleted successfully", nil)
+}
+
+// Allocate allocates the unallocated amount of an existing AR receipt
+// @Summary Allocate AR receipt
+// @Description Allocate the unallocated amount of an AR receipt to posted sales orders, either by details or with auto_allocate to the customer's oldest unpaid orders
+// @Tags ARReceipt
+// @Accept json
+// @Produce json
+// @Param id path string true "AR Receipt ID (UUID)"
+// @Param request body AllocateARReceiptRequest true "Allocations"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/ar-receipts/{id}/allocate [post]
+func (h *ARReceiptHandler) Allocate(c *gin.Context) {
+	// Parse UUID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid AR receipt ID", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "AR receipt deleted successfully", nil)
+	var req AllocateARReceiptRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if !checkAllocationMode(c, req.Details, req.AutoAllocate) {
+		return
+	}
+	if len(req.Details) == 0 && !req.AutoAllocate {
+		utils.ValidationErrorResponse(c, []models.ErrorDetail{{Field: "details", Message: "Send details or auto_allocate"}})
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	var arReceipt *models.ARReceipt
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		arReceipt, err = h.allocation.LockReceipt(tx, id, middleware.LocationScope(c, "lacation_id"))
+		if err != nil {
+			return err
+		}
+		today := utils.Today(middleware.GetTenantTimeZone(c))
+		orderScope := middleware.LocationScope(c, "location_id")
+		if req.AutoAllocate {
+			_, err = h.allocation.AutoAllocate(tx, arReceipt, userIDInt64, today, orderScope)
+		} else {
+			_, err = h.allocation.Allocate(tx, arReceipt, allocations(req.Details), userIDInt64, today, orderScope)
+		}
+		return err
+	})
+	if err != nil {
+		allocationError(c, err, "Failed to allocate AR receipt")
+		return
+	}
+
+	// Load the AR receipt with its allocations
+	tenantDB.Preload("Details").First(arReceipt, "id = ?", arReceipt.ID)
+
+	utils.SuccessResponse(c, http.StatusOK, "AR receipt allocated successfully", arReceipt)
+}
+
+// allocationError writes validation failures as a 400 response, a missing
+// receipt as a 404, a refused sales order transition as a 409 and anything
+// else as a 500 with the given message
+func allocationError(c *gin.Context, err error, message string) {
+	var validationErrs services.ValidationErrors
+	var transitionErr *services.TransitionError
+	switch {
+	case errors.As(err, &validationErrs):
+		utils.ValidationErrorResponse(c, validationErrs)
+	case errors.Is(err, services.ErrReceiptNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "AR receipt not found", nil)
+	case errors.As(err, &transitionErr):
+		utils.ErrorResponse(c, http.StatusConflict, transitionErr.Error(), nil)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err.Error())
+	}
 }
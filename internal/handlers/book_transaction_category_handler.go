@@ -6,16 +6,25 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type BookTransactionCategoryHandler struct {
-	db *gorm.DB
+type BookTransactionCategoryHandler struct{}
+
+func NewBookTransactionCategoryHandler() *BookTransactionCategoryHandler {
+	return &BookTransactionCategoryHandler{}
 }
 
-func NewBookTransactionCategoryHandler(db *gorm.DB) *BookTransactionCategoryHandler {
-	return &BookTransactionCategoryHandler{db: db}
+// bookTransactionCategoryListSpec is what GET /book-transaction-category sorts and searches by
+var bookTransactionCategoryListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"name":       "name",
+	},
+	DefaultSort: "name",
+	Search:      []string{"name"},
 }
 
 // BookTransactionCategoryRequest represents the request body for creating/updating a book transaction category
@@ -29,20 +38,31 @@ type BookTransactionCategoryRequest struct {
 // @Tags BookTransactionCategory
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, name)"
+// @Param search query string false "Search name (case-insensitive substring)"
 // @Param name query string false "Filter by name (partial match)"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/book-transaction-category [get]
 func (h *BookTransactionCategoryHandler) GetAll(c *gin.Context) {
 	var categories []models.BookTransactionCategory
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), bookTransactionCategoryListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
 	query := tenantDB.Model(&models.BookTransactionCategory{})
@@ -53,12 +73,13 @@ func (h *BookTransactionCategoryHandler) GetAll(c *gin.Context) {
 	}
 
 	// Execute query
-	if err := query.Find(&categories).Error; err != nil {
+	meta, err := list.Find(query, &categories)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve book transaction categories", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Book transaction categories retrieved successfully", categories)
+	utils.PaginatedResponse(c, http.StatusOK, "Book transaction categories retrieved successfully", categories, meta)
 }
 
 // GetByID retrieves a single book transaction category by ID
@@ -84,12 +105,11 @@ func (h *BookTransactionCategoryHandler) GetByID(c *gin.Context) {
 	var category models.BookTransactionCategory
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query book transaction category by ID
 	if err := tenantDB.First(&category, id).Error; err != nil {
@@ -125,12 +145,11 @@ func (h *BookTransactionCategoryHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
@@ -181,12 +200,11 @@ func (h *BookTransactionCategoryHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -237,12 +255,11 @@ func (h *BookTransactionCategoryHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
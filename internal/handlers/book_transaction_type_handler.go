@@ -6,16 +6,25 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type BookTransactionTypeHandler struct {
-	db *gorm.DB
+type BookTransactionTypeHandler struct{}
+
+func NewBookTransactionTypeHandler() *BookTransactionTypeHandler {
+	return &BookTransactionTypeHandler{}
 }
 
-func NewBookTransactionTypeHandler(db *gorm.DB) *BookTransactionTypeHandler {
-	return &BookTransactionTypeHandler{db: db}
+// bookTransactionTypeListSpec is what GET /book-transaction-type sorts and searches by
+var bookTransactionTypeListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"name":       "name",
+	},
+	DefaultSort: "name",
+	Search:      []string{"name"},
 }
 
 // BookTransactionTypeRequest represents the request body for creating/updating a book transaction type
@@ -29,20 +38,31 @@ type BookTransactionTypeRequest struct {
 // @Tags BookTransactionType
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, name)"
+// @Param search query string false "Search name (case-insensitive substring)"
 // @Param name query string false "Filter by name (partial match)"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/book-transaction-type [get]
 func (h *BookTransactionTypeHandler) GetAll(c *gin.Context) {
 	var types []models.BookTransactionType
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), bookTransactionTypeListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
 	query := tenantDB.Model(&models.BookTransactionType{})
@@ -53,12 +73,13 @@ func (h *BookTransactionTypeHandler) GetAll(c *gin.Context) {
 	}
 
 	// Execute query
-	if err := query.Find(&types).Error; err != nil {
+	meta, err := list.Find(query, &types)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve book transaction types", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Book transaction types retrieved successfully", types)
+	utils.PaginatedResponse(c, http.StatusOK, "Book transaction types retrieved successfully", types, meta)
 }
 
 // GetByID retrieves a single book transaction type by ID
@@ -84,12 +105,11 @@ func (h *BookTransactionTypeHandler) GetByID(c *gin.Context) {
 	var transactionType models.BookTransactionType
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query book transaction type by ID
 	if err := tenantDB.First(&transactionType, id).Error; err != nil {
@@ -125,12 +145,11 @@ func (h *BookTransactionTypeHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
@@ -181,12 +200,11 @@ func (h *BookTransactionTypeHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -237,12 +255,11 @@ func (h *BookTransactionTypeHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
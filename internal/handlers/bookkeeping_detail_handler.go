@@ -7,29 +7,42 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type BookkeepingDetailHandler struct {
-	db *gorm.DB
+type BookkeepingDetailHandler struct{}
+
+func NewBookkeepingDetailHandler() *BookkeepingDetailHandler {
+	return &BookkeepingDetailHandler{}
 }
 
-func NewBookkeepingDetailHandler(db *gorm.DB) *BookkeepingDetailHandler {
-	return &BookkeepingDetailHandler{db: db}
+// bookkeepingDetailListSpec is what GET /bookkeeping-detail sorts, searches and filters by
+var bookkeepingDetailListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at":  "created_at",
+		"doc_number":  "docnumber",
+		"posted_date": "posteddate",
+	},
+	DefaultSort: "-posted_date",
+	Search:      []string{"docnumber", "description"},
+	DateRanges: map[string]string{
+		"posted_date": "posteddate",
+	},
 }
 
 // BookkeepingDetailRequest represents the request body for creating/updating a bookkeeping detail
 type BookkeepingDetailRequest struct {
-	BookkeepingID   *int       `json:"bookkeeping_id"`
-	TypeID          *int       `json:"type_id"`
-	CategoryID      *int       `json:"category_id"`
-	PaymentMethodID *int       `json:"payment_method_id"`
-	PostedDate      *time.Time `json:"posted_date"`
-	DocNumber       *string    `json:"doc_number"`
-	Income          *float64   `json:"income"`
-	Expanse         *float64   `json:"expanse"`
-	Description     *string    `json:"description"`
+	BookkeepingID   *int          `json:"bookkeeping_id"`
+	TypeID          *int          `json:"type_id"`
+	CategoryID      *int          `json:"category_id"`
+	PaymentMethodID *int          `json:"payment_method_id"`
+	PostedDate      *time.Time    `json:"posted_date"`
+	DocNumber       *string       `json:"doc_number"`
+	Income          *models.Money `json:"income"`
+	Expanse         *models.Money `json:"expanse"`
+	Description     *string       `json:"description"`
 }
 
 // GetAll retrieves all bookkeeping details with optional filters
@@ -38,32 +51,39 @@ type BookkeepingDetailRequest struct {
 // @Tags BookkeepingDetail
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, doc_number, posted_date)"
+// @Param search query string false "Search document number and description (case-insensitive substring)"
 // @Param bookkeeping_id query int false "Filter by bookkeeping ID"
 // @Param type_id query int false "Filter by transaction type ID"
 // @Param category_id query int false "Filter by category ID"
 // @Param payment_method_id query int false "Filter by payment method ID"
 // @Param posted_date_from query string false "Filter by posted date from (YYYY-MM-DD)"
 // @Param posted_date_to query string false "Filter by posted date to (YYYY-MM-DD)"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/bookkeeping-detail [get]
 func (h *BookkeepingDetailHandler) GetAll(c *gin.Context) {
 	var details []models.BookkeepingDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
-	// Build query with preload relationships
-	query := tenantDB.Model(&models.BookkeepingDetail{}).
-		Preload("Bookkeeping").
-		Preload("Type").
-		Preload("Category").
-		Preload("PaymentMethod")
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), bookkeepingDetailListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.BookkeepingDetail{}).Scopes(bookkeepingDetailScope(c))
 
 	// Apply filters
 	if bookkeepingID := c.Query("bookkeeping_id"); bookkeepingID != "" {
@@ -78,20 +98,15 @@ func (h *BookkeepingDetailHandler) GetAll(c *gin.Context) {
 	if paymentMethodID := c.Query("payment_method_id"); paymentMethodID != "" {
 		query = query.Where("paymentmethod_id = ?", paymentMethodID)
 	}
-	if postedDateFrom := c.Query("posted_date_from"); postedDateFrom != "" {
-		query = query.Where("posteddate >= ?", postedDateFrom)
-	}
-	if postedDateTo := c.Query("posted_date_to"); postedDateTo != "" {
-		query = query.Where("posteddate <= ?", postedDateTo)
-	}
 
 	// Execute query
-	if err := query.Find(&details).Error; err != nil {
+	meta, err := list.Find(query, &details, "Bookkeeping", "Type", "Category", "PaymentMethod")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve bookkeeping details", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Bookkeeping details retrieved successfully", details)
+	utils.PaginatedResponse(c, http.StatusOK, "Bookkeeping details retrieved successfully", details, meta)
 }
 
 // GetByID retrieves a single bookkeeping detail by ID
@@ -117,15 +132,14 @@ func (h *BookkeepingDetailHandler) GetByID(c *gin.Context) {
 	var detail models.BookkeepingDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query bookkeeping detail by ID with relationships
-	if err := tenantDB.Preload("Bookkeeping").
+	if err := tenantDB.Scopes(bookkeepingDetailScope(c)).Preload("Bookkeeping").
 		Preload("Type").
 		Preload("Category").
 		Preload("PaymentMethod").
@@ -163,15 +177,14 @@ func (h *BookkeepingDetailHandler) GetByBookkeepingID(c *gin.Context) {
 	var details []models.BookkeepingDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query details by bookkeeping ID with relationships
-	if err := tenantDB.Preload("Type").
+	if err := tenantDB.Scopes(bookkeepingDetailScope(c)).Preload("Type").
 		Preload("Category").
 		Preload("PaymentMethod").
 		Where("bookkeeping_id = ?", bookkeepingID).
@@ -204,17 +217,21 @@ func (h *BookkeepingDetailHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only record detail lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Create bookkeeping detail
 	detail := models.BookkeepingDetail{
 		BookkeepingID:   req.BookkeepingID,
@@ -271,12 +288,11 @@ func (h *BookkeepingDetailHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -284,7 +300,7 @@ func (h *BookkeepingDetailHandler) Update(c *gin.Context) {
 
 	// Check if detail exists
 	var detail models.BookkeepingDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	if err := tenantDB.Scopes(bookkeepingDetailScope(c)).First(&detail, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Bookkeeping detail not found", nil)
 			return
@@ -293,6 +309,11 @@ func (h *BookkeepingDetailHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// Scoped users may only record detail lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Update fields
 	detail.BookkeepingID = req.BookkeepingID
 	detail.TypeID = req.TypeID
@@ -338,12 +359,11 @@ func (h *BookkeepingDetailHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -351,7 +371,7 @@ func (h *BookkeepingDetailHandler) Delete(c *gin.Context) {
 
 	// Check if detail exists
 	var detail models.BookkeepingDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	if err := tenantDB.Scopes(bookkeepingDetailScope(c)).First(&detail, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Bookkeeping detail not found", nil)
 			return
@@ -375,3 +395,8 @@ func (h *BookkeepingDetailHandler) Delete(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Bookkeeping detail deleted successfully", nil)
 }
+
+// bookkeepingDetailScope limits rows to those of bookkeeping at the caller's location
+func bookkeepingDetailScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationTextScope(c, "bookkeeping_detail.bookkeeping_id", "bookkeeping", "location_id")
+}
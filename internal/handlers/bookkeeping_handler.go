@@ -1,34 +1,58 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type BookkeepingHandler struct {
-	db *gorm.DB
+// bookkeepingClosedStatus is the name of the bookkeeping_status a closed
+// record has, matched case-insensitively
+const bookkeepingClosedStatus = "completed"
+
+var (
+	errBookkeepingNotFound      = errors.New("bookkeeping record not found")
+	errBookkeepingAlreadyClosed = errors.New("bookkeeping record is already closed")
+	errBookkeepingNoCloseStatus = errors.New("no Completed bookkeeping status is set up")
+)
+
+type BookkeepingHandler struct{}
+
+func NewBookkeepingHandler() *BookkeepingHandler {
+	return &BookkeepingHandler{}
 }
 
-func NewBookkeepingHandler(db *gorm.DB) *BookkeepingHandler {
-	return &BookkeepingHandler{db: db}
+// bookkeepingListSpec is what GET /bookkeeping sorts, searches and filters by
+var bookkeepingListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"book_date":  "bookdate",
+		"created_at": "created_at",
+	},
+	DefaultSort: "-book_date",
+	Search:      []string{"note"},
+	DateRanges: map[string]string{
+		"book_date": "bookdate",
+	},
 }
 
 // BookkeepingRequest represents the request body for creating/updating a bookkeeping record
 type BookkeepingRequest struct {
-	LocationID *string    `json:"location_id"`
-	BookDate   *time.Time `json:"book_date"`
-	Opening    *float64   `json:"opening"`
-	Income     *float64   `json:"income"`
-	Expanse    *float64   `json:"expanse"`
-	Balance    *float64   `json:"balance"`
-	Note       *string    `json:"note"`
-	StatusID   *int       `json:"status_id"`
+	LocationID *string       `json:"location_id"`
+	BookDate   *time.Time    `json:"book_date"`
+	Opening    *models.Money `json:"opening"`
+	Income     *models.Money `json:"income"`
+	Expanse    *models.Money `json:"expanse"`
+	Balance    *models.Money `json:"balance"`
+	Note       *string       `json:"note"`
+	StatusID   *int          `json:"status_id"`
 }
 
 // GetAll retrieves all bookkeeping records with optional filters
@@ -37,28 +61,37 @@ type BookkeepingRequest struct {
 // @Tags Bookkeeping
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, book_date, created_at)"
+// @Param search query string false "Search note (case-insensitive substring)"
 // @Param location_id query string false "Filter by location ID"
 // @Param status_id query int false "Filter by status ID"
 // @Param book_date_from query string false "Filter by book date from (YYYY-MM-DD)"
 // @Param book_date_to query string false "Filter by book date to (YYYY-MM-DD)"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/bookkeeping [get]
 func (h *BookkeepingHandler) GetAll(c *gin.Context) {
 	var bookkeepings []models.Bookkeeping
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
-	// Build query with preload relationships
-	query := tenantDB.Model(&models.Bookkeeping{}).
-		Preload("Status").
-		Preload("Details")
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), bookkeepingListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.Bookkeeping{}).Scopes(middleware.LocationTextScope(c, "location_id"))
 
 	// Apply filters
 	if locationID := c.Query("location_id"); locationID != "" {
@@ -67,20 +100,15 @@ func (h *BookkeepingHandler) GetAll(c *gin.Context) {
 	if statusID := c.Query("status_id"); statusID != "" {
 		query = query.Where("status_id = ?", statusID)
 	}
-	if bookDateFrom := c.Query("book_date_from"); bookDateFrom != "" {
-		query = query.Where("bookdate >= ?", bookDateFrom)
-	}
-	if bookDateTo := c.Query("book_date_to"); bookDateTo != "" {
-		query = query.Where("bookdate <= ?", bookDateTo)
-	}
 
 	// Execute query
-	if err := query.Find(&bookkeepings).Error; err != nil {
+	meta, err := list.Find(query, &bookkeepings, "Status", "Details")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve bookkeeping records", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Bookkeeping records retrieved successfully", bookkeepings)
+	utils.PaginatedResponse(c, http.StatusOK, "Bookkeeping records retrieved successfully", bookkeepings, meta)
 }
 
 // GetByID retrieves a single bookkeeping record by ID
@@ -106,15 +134,14 @@ func (h *BookkeepingHandler) GetByID(c *gin.Context) {
 	var bookkeeping models.Bookkeeping
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query bookkeeping by ID with relationships
-	if err := tenantDB.Preload("Status").
+	if err := tenantDB.Scopes(middleware.LocationTextScope(c, "location_id")).Preload("Status").
 		Preload("Details").
 		Preload("SummaryByTransactionType").
 		Preload("SummaryByPaymentMethod").
@@ -147,15 +174,14 @@ func (h *BookkeepingHandler) GetByLocationID(c *gin.Context) {
 	var bookkeepings []models.Bookkeeping
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query bookkeeping by location ID with relationships
-	if err := tenantDB.Preload("Status").
+	if err := tenantDB.Scopes(middleware.LocationTextScope(c, "location_id")).Preload("Status").
 		Preload("Details").
 		Where("location_id = ?", locationID).
 		Find(&bookkeepings).Error; err != nil {
@@ -187,20 +213,31 @@ func (h *BookkeepingHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationText(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
+	}
+
+	// Only book.close may create a record that is already closed
+	if !h.mayChangeClosing(c, tenantDB, nil, req.StatusID) {
+		return
+	}
+
 	// Create bookkeeping record
 	bookkeeping := models.Bookkeeping{
-		LocationID: req.LocationID,
+		LocationID: locationID,
 		BookDate:   req.BookDate,
 		Opening:    req.Opening,
 		Income:     req.Income,
@@ -253,20 +290,26 @@ func (h *BookkeepingHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationText(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
+	}
+
 	// Check if bookkeeping exists
 	var bookkeeping models.Bookkeeping
-	if err := tenantDB.First(&bookkeeping, id).Error; err != nil {
+	if err := tenantDB.Scopes(middleware.LocationTextScope(c, "location_id")).First(&bookkeeping, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Bookkeeping record not found", nil)
 			return
@@ -275,8 +318,13 @@ func (h *BookkeepingHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// Closing or reopening through an update needs book.close as well
+	if !h.mayChangeClosing(c, tenantDB, bookkeeping.StatusID, req.StatusID) {
+		return
+	}
+
 	// Update fields
-	bookkeeping.LocationID = req.LocationID
+	bookkeeping.LocationID = locationID
 	bookkeeping.BookDate = req.BookDate
 	bookkeeping.Opening = req.Opening
 	bookkeeping.Income = req.Income
@@ -319,12 +367,11 @@ func (h *BookkeepingHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -332,7 +379,7 @@ func (h *BookkeepingHandler) Delete(c *gin.Context) {
 
 	// Check if bookkeeping exists
 	var bookkeeping models.Bookkeeping
-	if err := tenantDB.First(&bookkeeping, id).Error; err != nil {
+	if err := tenantDB.Scopes(middleware.LocationTextScope(c, "location_id")).First(&bookkeeping, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Bookkeeping record not found", nil)
 			return
@@ -356,3 +403,121 @@ func (h *BookkeepingHandler) Delete(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Bookkeeping record deleted successfully", nil)
 }
+
+// Close closes a bookkeeping record
+// @Summary Close bookkeeping record
+// @Description Move a bookkeeping record to the Completed status. Needs book.close.
+// @Tags Bookkeeping
+// @Accept json
+// @Produce json
+// @Param id path int true "Bookkeeping ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/bookkeeping/{id}/close [patch]
+func (h *BookkeepingHandler) Close(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid bookkeeping ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Lock the record so a concurrent update cannot overwrite the close
+	var bookkeeping models.Bookkeeping
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		closedID, err := closedBookkeepingStatusID(tx)
+		if err != nil {
+			return err
+		}
+		if closedID == nil {
+			return errBookkeepingNoCloseStatus
+		}
+
+		if err := tx.Scopes(middleware.LocationTextScope(c, "location_id")).
+			Clauses(clause.Locking{Strength: "UPDATE"}).First(&bookkeeping, id).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errBookkeepingNotFound
+			}
+			return err
+		}
+		if bookkeeping.StatusID != nil && *bookkeeping.StatusID == *closedID {
+			return errBookkeepingAlreadyClosed
+		}
+
+		return tx.Model(&bookkeeping).Updates(map[string]interface{}{
+			"status_id":  *closedID,
+			"updated_by": userIDInt64,
+		}).Error
+	})
+	switch {
+	case errors.Is(err, errBookkeepingNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Bookkeeping record not found", nil)
+		return
+	case errors.Is(err, errBookkeepingAlreadyClosed):
+		utils.ErrorResponse(c, http.StatusConflict, "Bookkeeping record is already closed", nil)
+		return
+	case errors.Is(err, errBookkeepingNoCloseStatus):
+		utils.ErrorResponse(c, http.StatusConflict, "No Completed bookkeeping status is set up", nil)
+		return
+	case err != nil:
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to close bookkeeping record", err.Error())
+		return
+	}
+
+	// Load relationships
+	tenantDB.Preload("Status").First(&bookkeeping, bookkeeping.ID)
+
+	utils.SuccessResponse(c, http.StatusOK, "Bookkeeping record closed successfully", bookkeeping)
+}
+
+// closedBookkeepingStatusID returns the ID of the Completed bookkeeping
+// status, or nil when the tenant has none
+func closedBookkeepingStatusID(tx *gorm.DB) (*int, error) {
+	var statuses []models.BookkeepingStatus
+	if err := tx.Where("LOWER(TRIM(name)) = ?", bookkeepingClosedStatus).Order("id").Limit(1).
+		Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	return &statuses[0].ID, nil
+}
+
+// mayChangeClosing writes a forbidden response and returns false when a
+// status change from stored to requested closes or reopens a record and the
+// caller lacks book.close
+func (h *BookkeepingHandler) mayChangeClosing(c *gin.Context, tenantDB *gorm.DB, stored, requested *int) bool {
+	if middleware.HasPermission(c, middleware.PermissionBookClose) || sameStatus(stored, requested) {
+		return true
+	}
+
+	closedID, err := closedBookkeepingStatusID(tenantDB)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to resolve bookkeeping status", err.Error())
+		return false
+	}
+	if closedID != nil && (sameStatus(stored, closedID) || sameStatus(requested, closedID)) {
+		utils.ForbiddenResponse(c, "Closing or reopening a bookkeeping record needs the book.close permission")
+		return false
+	}
+	return true
+}
+
+func sameStatus(a, b *int) bool {
+	return a == b || (a != nil && b != nil && *a == *b)
+}
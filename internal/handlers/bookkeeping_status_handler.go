@@ -6,16 +6,25 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type BookkeepingStatusHandler struct {
-	db *gorm.DB
+type BookkeepingStatusHandler struct{}
+
+func NewBookkeepingStatusHandler() *BookkeepingStatusHandler {
+	return &BookkeepingStatusHandler{}
 }
 
-func NewBookkeepingStatusHandler(db *gorm.DB) *BookkeepingStatusHandler {
-	return &BookkeepingStatusHandler{db: db}
+// bookkeepingStatusListSpec is what GET /bookkeeping-status sorts and searches by
+var bookkeepingStatusListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"name":       "name",
+	},
+	DefaultSort: "name",
+	Search:      []string{"name"},
 }
 
 // GetAll retrieves all bookkeeping statuses
@@ -24,20 +33,31 @@ func NewBookkeepingStatusHandler(db *gorm.DB) *BookkeepingStatusHandler {
 // @Tags BookkeepingStatus
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, name)"
+// @Param search query string false "Search name (case-insensitive substring)"
 // @Param name query string false "Filter by name (partial match)"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/bookkeeping-status [get]
 func (h *BookkeepingStatusHandler) GetAll(c *gin.Context) {
 	var statuses []models.BookkeepingStatus
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), bookkeepingStatusListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
 	query := tenantDB.Model(&models.BookkeepingStatus{})
@@ -48,12 +68,13 @@ func (h *BookkeepingStatusHandler) GetAll(c *gin.Context) {
 	}
 
 	// Execute query
-	if err := query.Find(&statuses).Error; err != nil {
+	meta, err := list.Find(query, &statuses)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve bookkeeping statuses", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Bookkeeping statuses retrieved successfully", statuses)
+	utils.PaginatedResponse(c, http.StatusOK, "Bookkeeping statuses retrieved successfully", statuses, meta)
 }
 
 // GetByID retrieves a single bookkeeping status by ID
@@ -79,12 +100,11 @@ func (h *BookkeepingStatusHandler) GetByID(c *gin.Context) {
 	var status models.BookkeepingStatus
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query bookkeeping status by ID
 	if err := tenantDB.First(&status, id).Error; err != nil {
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type CommissionHandler struct {
+	commissions *services.StaffCommissions
+}
+
+func NewCommissionHandler(commissions *services.StaffCommissions) *CommissionHandler {
+	return &CommissionHandler{commissions: commissions}
+}
+
+// GetCommissions reports the commissions staff earned in a month
+// @Summary Get staff commissions
+// @Description Get what each promoter, doctor, nurse and beautician earned in a month under the commission rules, per staff member with every sales order line and treatment it comes from. format=csv returns one row per line or treatment.
+// @Tags Commission
+// @Accept json
+// @Produce json
+// @Produce text/csv
+// @Param period query string true "Month (YYYY-MM)"
+// @Param role query string false "Filter by role (promoter, doctor, nurse, beautician)"
+// @Param staff_id query int false "Filter by staff ID"
+// @Param location_id query int false "Filter by location ID; scoped users only see their own location"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/commissions [get]
+func (h *CommissionHandler) GetCommissions(c *gin.Context) {
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse the month in the tenant's timezone
+	dates := utils.NewDateParser(middleware.GetTenantTimeZone(c))
+	period := c.Query("period")
+	from, to := dates.Month("period", period)
+	if period == "" {
+		dates.Errors = append(dates.Errors, models.ErrorDetail{Field: "period", Message: "Period is required in YYYY-MM format"})
+	}
+	filter, errs := parseCommissionFilter(c)
+	dates.Errors = append(dates.Errors, errs...)
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		dates.Errors = append(dates.Errors, models.ErrorDetail{Field: "format", Message: "Format must be json or csv"})
+	}
+	if dates.Failed(c) {
+		return
+	}
+
+	locationID, ok := middleware.ResolveLocationID(c, filter.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
+	}
+	filter.LocationID = locationID
+
+	report, err := h.commissions.Calculate(tenantDB, services.StatementPeriod{From: from, To: to}, filter)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to calculate commissions", err.Error())
+		return
+	}
+
+	if format == "csv" {
+		writeCommissionCSV(c, period, report)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "Commissions retrieved successfully", report)
+}
+
+// parseCommissionFilter reads the role, staff_id and location_id filters
+func parseCommissionFilter(c *gin.Context) (services.CommissionFilter, []models.ErrorDetail) {
+	var filter services.CommissionFilter
+	var errs []models.ErrorDetail
+
+	switch role := c.Query("role"); role {
+	case "", models.CommissionRolePromoter, models.CommissionRoleDoctor, models.CommissionRoleNurse, models.CommissionRoleBeautician:
+		filter.Role = role
+	default:
+		errs = append(errs, models.ErrorDetail{Field: "role", Message: "Role must be promoter, doctor, nurse or beautician"})
+	}
+	for field, target := range map[string]**int{"staff_id": &filter.StaffID, "location_id": &filter.LocationID} {
+		value := c.Query(field)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, models.ErrorDetail{Field: field, Message: "Must be an integer"})
+			continue
+		}
+		*target = &parsed
+	}
+	return filter, errs
+}
+
+// writeCommissionCSV writes the report with one row per commission entry
+func writeCommissionCSV(c *gin.Context, period string, report *services.CommissionReport) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="commissions-%s.csv"`, period))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{
+		"role", "staff_id", "source", "document_id", "doc_number", "date", "location_id",
+		"item_id", "service_id", "quantity", "base", "rule_id", "type", "value", "commission",
+	})
+	for _, staff := range report.Staff {
+		for _, entry := range staff.Entries {
+			_ = w.Write([]string{
+				entry.Role,
+				strconv.Itoa(entry.StaffID),
+				entry.Source,
+				entry.DocumentID.String(),
+				csvString(entry.DocNumber),
+				entry.Date.Format(utils.DateLayout),
+				csvInt(entry.LocationID),
+				csvInt(entry.ItemID),
+				csvInt(entry.ServiceID),
+				strconv.Itoa(entry.Quantity),
+				entry.Base.String(),
+				strconv.Itoa(entry.RuleID),
+				entry.Type,
+				entry.Value.String(),
+				entry.Commission.String(),
+			})
+		}
+	}
+	w.Flush()
+}
+
+// csvString returns the value, or an empty cell for nil
+func csvString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// csvInt returns the value, or an empty cell for nil
+func csvInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type CommissionRuleHandler struct{}
+
+func NewCommissionRuleHandler() *CommissionRuleHandler {
+	return &CommissionRuleHandler{}
+}
+
+// commissionRuleListSpec is what GET /commission-rules sorts and searches by
+var commissionRuleListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"role":       "role",
+		"item_id":    "item_id",
+		"service_id": "service_id",
+	},
+	Search: []string{"note"},
+}
+
+// CommissionRuleRequest represents the request body for creating/updating a
+// commission rule. Item, service and location narrow the rule; omitted they
+// match anything.
+type CommissionRuleRequest struct {
+	Role       string       `json:"role" binding:"required"`
+	ItemID     *int         `json:"item_id"`
+	ServiceID  *int         `json:"service_id"`
+	LocationID *int         `json:"location_id"`
+	Type       string       `json:"type" binding:"required"`
+	Value      models.Money `json:"value"`
+	Note       *string      `json:"note"`
+}
+
+// GetAll retrieves all commission rules
+// @Summary Get all commission rules
+// @Description Get list of commission rules with optional filters
+// @Tags CommissionRule
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, role, item_id, service_id)"
+// @Param search query string false "Search note (case-insensitive substring)"
+// @Param role query string false "Filter by role (promoter, doctor, nurse, beautician)"
+// @Param item_id query int false "Filter by item ID"
+// @Param service_id query int false "Filter by service ID"
+// @Param location_id query int false "Filter by location ID"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/commission-rules [get]
+func (h *CommissionRuleHandler) GetAll(c *gin.Context) {
+	var rules []models.CommissionRule
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), commissionRuleListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.CommissionRule{})
+
+	// Apply filters
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if itemID := c.Query("item_id"); itemID != "" {
+		query = query.Where("item_id = ?", itemID)
+	}
+	if serviceID := c.Query("service_id"); serviceID != "" {
+		query = query.Where("service_id = ?", serviceID)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	// Execute query
+	meta, err := list.Find(query, &rules)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve commission rules", nil)
+		return
+	}
+
+	utils.PaginatedResponse(c, http.StatusOK, "Commission rules retrieved successfully", rules, meta)
+}
+
+// GetByID retrieves a single commission rule by ID
+// @Summary Get commission rule by ID
+// @Description Get a single commission rule by its ID
+// @Tags CommissionRule
+// @Accept json
+// @Produce json
+// @Param id path int true "Commission Rule ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/commission-rules/{id} [get]
+func (h *CommissionRuleHandler) GetByID(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid commission rule ID", nil)
+		return
+	}
+
+	var rule models.CommissionRule
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Query commission rule by ID
+	if err := tenantDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Commission rule not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve commission rule", nil)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Commission rule retrieved successfully", rule)
+}
+
+// Create creates a new commission rule
+// @Summary Create a new commission rule
+// @Description Create a commission rule for a role: a percentage of the amount sold or a fixed amount per unit sold or per treatment. Item, service and location narrow the rule.
+// @Tags CommissionRule
+// @Accept json
+// @Produce json
+// @Param request body CommissionRuleRequest true "Commission rule data"
+// @Success 201 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/commission-rules [post]
+func (h *CommissionRuleHandler) Create(c *gin.Context) {
+	var req CommissionRuleRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if errs := validateCommissionRule(&req); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	if !h.requireUnique(c, tenantDB, &req, 0) {
+		return
+	}
+
+	// Create commission rule
+	rule := models.CommissionRule{
+		Role:       req.Role,
+		ItemID:     req.ItemID,
+		ServiceID:  req.ServiceID,
+		LocationID: req.LocationID,
+		CalcType:   req.Type,
+		CalcValue:  req.Value,
+		Note:       req.Note,
+		CreatedBy:  &userIDInt64,
+	}
+
+	if err := tenantDB.Create(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create commission rule", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Commission rule created successfully", rule)
+}
+
+// Update updates an existing commission rule
+// @Summary Update commission rule
+// @Description Update a commission rule by ID. Commissions are calculated when reported, so the change applies to every period reported afterwards.
+// @Tags CommissionRule
+// @Accept json
+// @Produce json
+// @Param id path int true "Commission Rule ID"
+// @Param request body CommissionRuleRequest true "Commission rule data"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/commission-rules/{id} [put]
+func (h *CommissionRuleHandler) Update(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid commission rule ID", nil)
+		return
+	}
+
+	var req CommissionRuleRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if errs := validateCommissionRule(&req); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if commission rule exists
+	var rule models.CommissionRule
+	if err := tenantDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Commission rule not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve commission rule", nil)
+		return
+	}
+
+	if !h.requireUnique(c, tenantDB, &req, rule.ID) {
+		return
+	}
+
+	// Update fields
+	rule.Role = req.Role
+	rule.ItemID = req.ItemID
+	rule.ServiceID = req.ServiceID
+	rule.LocationID = req.LocationID
+	rule.CalcType = req.Type
+	rule.CalcValue = req.Value
+	rule.Note = req.Note
+	rule.UpdatedBy = &userIDInt64
+
+	// Save updates
+	if err := tenantDB.Save(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update commission rule", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Commission rule updated successfully", rule)
+}
+
+// Delete soft deletes a commission rule
+// @Summary Delete commission rule
+// @Description Soft delete a commission rule by ID
+// @Tags CommissionRule
+// @Accept json
+// @Produce json
+// @Param id path int true "Commission Rule ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/commission-rules/{id} [delete]
+func (h *CommissionRuleHandler) Delete(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid commission rule ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if commission rule exists
+	var rule models.CommissionRule
+	if err := tenantDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Commission rule not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve commission rule", nil)
+		return
+	}
+
+	// Set deleted_by before soft delete
+	rule.DeletedBy = &userIDInt64
+	if err := tenantDB.Save(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+		return
+	}
+
+	// Soft delete
+	if err := tenantDB.Delete(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete commission rule", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Commission rule deleted successfully", nil)
+}
+
+// validateCommissionRule checks the role, the calculation and that a
+// promoter rule does not name a service, since promoters earn on sales
+// order lines, which have no service
+func validateCommissionRule(req *CommissionRuleRequest) []models.ErrorDetail {
+	var errs []models.ErrorDetail
+	switch req.Role {
+	case models.CommissionRolePromoter:
+		if req.ServiceID != nil {
+			errs = append(errs, models.ErrorDetail{Field: "service_id", Message: "Promoter rules cannot name a service"})
+		}
+	case models.CommissionRoleDoctor, models.CommissionRoleNurse, models.CommissionRoleBeautician:
+	default:
+		errs = append(errs, models.ErrorDetail{Field: "role", Message: "Role must be promoter, doctor, nurse or beautician"})
+	}
+
+	switch req.Type {
+	case models.CommissionPercentage:
+		if req.Value.Cmp(models.NewMoney(100)) > 0 {
+			errs = append(errs, models.ErrorDetail{Field: "value", Message: "Percentage must not exceed 100"})
+		}
+	case models.CommissionFixed:
+	default:
+		errs = append(errs, models.ErrorDetail{Field: "type", Message: "Type must be percentage or fixed"})
+	}
+	if !req.Value.IsPositive() {
+		errs = append(errs, models.ErrorDetail{Field: "value", Message: "Value must be greater than zero"})
+	}
+	return errs
+}
+
+// requireUnique writes a conflict response and returns false when another
+// rule already covers the role, item, service and location
+func (h *CommissionRuleHandler) requireUnique(c *gin.Context, tenantDB *gorm.DB, req *CommissionRuleRequest, id int) bool {
+	query := tenantDB.Model(&models.CommissionRule{}).Where("id <> ? AND role = ?", id, req.Role)
+	scopes := map[string]*int{"item_id": req.ItemID, "service_id": req.ServiceID, "location_id": req.LocationID}
+	for column, value := range scopes {
+		if value != nil {
+			query = query.Where(column+" = ?", *value)
+		} else {
+			query = query.Where(column + " IS NULL")
+		}
+	}
+
+	var existing int64
+	if err := query.Count(&existing).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check commission rules", err.Error())
+		return false
+	}
+	if existing > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "A rule for this role, item, service and location already exists", nil)
+		return false
+	}
+	return true
+}
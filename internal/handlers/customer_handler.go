@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type CustomerHandler struct {
+	statements *services.CustomerStatements
+}
+
+func NewCustomerHandler(statements *services.CustomerStatements) *CustomerHandler {
+	return &CustomerHandler{statements: statements}
+}
+
+// GetStatement retrieves a customer's sales history and outstanding balance
+// @Summary Get customer statement
+// @Description Get a customer's posted orders, receipts, running balance, outstanding per order, remaining package sessions and treatments
+// @Tags Customer
+// @Accept json
+// @Produce json
+// @Param customer_id path int true "Customer ID"
+// @Param date_from query string false "Documents dated on or after (YYYY-MM-DD); earlier activity becomes the opening balance"
+// @Param date_to query string false "Documents dated on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/customers/{customer_id}/statement [get]
+func (h *CustomerHandler) GetStatement(c *gin.Context) {
+	// Parse customer ID from URL parameter
+	customerID, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid customer ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse the statement period in the tenant's timezone
+	timeZone := middleware.GetTenantTimeZone(c)
+	dates := utils.NewDateParser(timeZone)
+	from, to := dates.Range(c, "date")
+	if dates.Failed(c) {
+		return
+	}
+
+	period := services.StatementPeriod{From: from, To: to}
+	statement, err := h.statements.Build(tenantDB, customerID, period, middleware.GetLocationID(c), utils.Today(timeZone))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to build customer statement", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Customer statement retrieved successfully", statement)
+}
+
+// GetPackages retrieves the remaining sessions of a customer's packages
+// @Summary Get customer package sessions
+// @Description Get the sessions sold, used, forfeited and remaining and the expiry date of every package line on the customer's posted or paid orders
+// @Tags Customer
+// @Accept json
+// @Produce json
+// @Param customer_id path int true "Customer ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/customers/{customer_id}/packages [get]
+func (h *CustomerHandler) GetPackages(c *gin.Context) {
+	// Parse customer ID from URL parameter
+	customerID, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid customer ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	today := utils.Today(middleware.GetTenantTimeZone(c))
+	packages, err := h.statements.Packages(tenantDB, customerID, middleware.GetLocationID(c), today)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve customer packages", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Customer packages retrieved successfully", packages)
+}
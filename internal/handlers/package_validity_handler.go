@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type PackageValidityHandler struct{}
+
+func NewPackageValidityHandler() *PackageValidityHandler {
+	return &PackageValidityHandler{}
+}
+
+// packageValidityListSpec is what GET /package-validities sorts and searches by
+var packageValidityListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"item_id":    "item_id",
+		"service_id": "service_id",
+	},
+	Search: []string{"note"},
+}
+
+// PackageValidityRequest represents the request body for creating/updating a
+// package validity rule. Exactly one of item_id and service_id is set.
+type PackageValidityRequest struct {
+	ItemID         *int    `json:"item_id"`
+	ServiceID      *int    `json:"service_id"`
+	ValidityMonths int     `json:"validity_months"`
+	ValidityDays   int     `json:"validity_days"`
+	Note           *string `json:"note"`
+}
+
+// GetAll retrieves all package validity rules
+// @Summary Get all package validity rules
+// @Description Get list of package validity rules with optional filters
+// @Tags PackageValidity
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, item_id, service_id)"
+// @Param search query string false "Search note (case-insensitive substring)"
+// @Param item_id query int false "Filter by item ID"
+// @Param service_id query int false "Filter by service ID"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/package-validities [get]
+func (h *PackageValidityHandler) GetAll(c *gin.Context) {
+	var rules []models.PackageValidity
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), packageValidityListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.PackageValidity{})
+
+	// Apply filters
+	if itemID := c.Query("item_id"); itemID != "" {
+		query = query.Where("item_id = ?", itemID)
+	}
+	if serviceID := c.Query("service_id"); serviceID != "" {
+		query = query.Where("service_id = ?", serviceID)
+	}
+
+	// Execute query
+	meta, err := list.Find(query, &rules)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve package validity rules", nil)
+		return
+	}
+
+	utils.PaginatedResponse(c, http.StatusOK, "Package validity rules retrieved successfully", rules, meta)
+}
+
+// GetByID retrieves a single package validity rule by ID
+// @Summary Get package validity rule by ID
+// @Description Get a single package validity rule by its ID
+// @Tags PackageValidity
+// @Accept json
+// @Produce json
+// @Param id path int true "Package Validity ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/package-validities/{id} [get]
+func (h *PackageValidityHandler) GetByID(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid package validity ID", nil)
+		return
+	}
+
+	var rule models.PackageValidity
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Query package validity rule by ID
+	if err := tenantDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Package validity rule not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve package validity rule", nil)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Package validity rule retrieved successfully", rule)
+}
+
+// Create creates a new package validity rule
+// @Summary Create a new package validity rule
+// @Description Create a validity rule for an item or a service. Orders posted afterwards get expiry dates from it.
+// @Tags PackageValidity
+// @Accept json
+// @Produce json
+// @Param request body PackageValidityRequest true "Package validity data"
+// @Success 201 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/package-validities [post]
+func (h *PackageValidityHandler) Create(c *gin.Context) {
+	var req PackageValidityRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if errs := validatePackageValidity(&req); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	if !h.requireUnique(c, tenantDB, &req, 0) {
+		return
+	}
+
+	// Create package validity rule
+	rule := models.PackageValidity{
+		ItemID:         req.ItemID,
+		ServiceID:      req.ServiceID,
+		ValidityMonths: req.ValidityMonths,
+		ValidityDays:   req.ValidityDays,
+		Note:           req.Note,
+		CreatedBy:      &userIDInt64,
+	}
+
+	if err := tenantDB.Create(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create package validity rule", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Package validity rule created successfully", rule)
+}
+
+// Update updates an existing package validity rule
+// @Summary Update package validity rule
+// @Description Update a package validity rule by ID. Expiry dates already set on posted orders are kept.
+// @Tags PackageValidity
+// @Accept json
+// @Produce json
+// @Param id path int true "Package Validity ID"
+// @Param request body PackageValidityRequest true "Package validity data"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/package-validities/{id} [put]
+func (h *PackageValidityHandler) Update(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid package validity ID", nil)
+		return
+	}
+
+	var req PackageValidityRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if errs := validatePackageValidity(&req); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if package validity rule exists
+	var rule models.PackageValidity
+	if err := tenantDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Package validity rule not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve package validity rule", nil)
+		return
+	}
+
+	if !h.requireUnique(c, tenantDB, &req, rule.ID) {
+		return
+	}
+
+	// Update fields
+	rule.ItemID = req.ItemID
+	rule.ServiceID = req.ServiceID
+	rule.ValidityMonths = req.ValidityMonths
+	rule.ValidityDays = req.ValidityDays
+	rule.Note = req.Note
+	rule.UpdatedBy = &userIDInt64
+
+	// Save updates
+	if err := tenantDB.Save(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update package validity rule", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Package validity rule updated successfully", rule)
+}
+
+// Delete soft deletes a package validity rule
+// @Summary Delete package validity rule
+// @Description Soft delete a package validity rule by ID. Orders posted afterwards no longer expire by it.
+// @Tags PackageValidity
+// @Accept json
+// @Produce json
+// @Param id path int true "Package Validity ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/package-validities/{id} [delete]
+func (h *PackageValidityHandler) Delete(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid package validity ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if package validity rule exists
+	var rule models.PackageValidity
+	if err := tenantDB.First(&rule, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Package validity rule not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve package validity rule", nil)
+		return
+	}
+
+	// Set deleted_by before soft delete
+	rule.DeletedBy = &userIDInt64
+	if err := tenantDB.Save(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+		return
+	}
+
+	// Soft delete
+	if err := tenantDB.Delete(&rule).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete package validity rule", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Package validity rule deleted successfully", nil)
+}
+
+// validatePackageValidity checks that the rule names one target and a
+// positive validity
+func validatePackageValidity(req *PackageValidityRequest) []models.ErrorDetail {
+	var errs []models.ErrorDetail
+	if (req.ItemID == nil) == (req.ServiceID == nil) {
+		errs = append(errs, models.ErrorDetail{Field: "item_id", Message: "Set exactly one of item_id and service_id"})
+	}
+	if req.ValidityMonths < 0 {
+		errs = append(errs, models.ErrorDetail{Field: "validity_months", Message: "Validity months must not be negative"})
+	}
+	if req.ValidityDays < 0 {
+		errs = append(errs, models.ErrorDetail{Field: "validity_days", Message: "Validity days must not be negative"})
+	}
+	if req.ValidityMonths+req.ValidityDays <= 0 {
+		errs = append(errs, models.ErrorDetail{Field: "validity_months", Message: "Validity must be at least one day"})
+	}
+	return errs
+}
+
+// requireUnique writes a conflict response and returns false when another
+// rule already covers the item or service
+func (h *PackageValidityHandler) requireUnique(c *gin.Context, tenantDB *gorm.DB, req *PackageValidityRequest, id int) bool {
+	query := tenantDB.Model(&models.PackageValidity{}).Where("id <> ?", id)
+	if req.ItemID != nil {
+		query = query.Where("item_id = ?", *req.ItemID)
+	} else {
+		query = query.Where("service_id = ?", *req.ServiceID)
+	}
+
+	var existing int64
+	if err := query.Count(&existing).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check package validity rules", err.Error())
+		return false
+	}
+	if existing > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "A validity rule for this item or service already exists", nil)
+		return false
+	}
+	return true
+}
@@ -6,16 +6,25 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type PaymentMethodHandler struct {
-	db *gorm.DB
+type PaymentMethodHandler struct{}
+
+func NewPaymentMethodHandler() *PaymentMethodHandler {
+	return &PaymentMethodHandler{}
 }
 
-func NewPaymentMethodHandler(db *gorm.DB) *PaymentMethodHandler {
-	return &PaymentMethodHandler{db: db}
+// paymentMethodListSpec is what GET /payment-method sorts and searches by
+var paymentMethodListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"name":       "name",
+	},
+	DefaultSort: "name",
+	Search:      []string{"name"},
 }
 
 // PaymentMethodRequest represents the request body for creating/updating a payment method
@@ -29,20 +38,31 @@ type PaymentMethodRequest struct {
 // @Tags PaymentMethod
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, name)"
+// @Param search query string false "Search name (case-insensitive substring)"
 // @Param name query string false "Filter by name (partial match)"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/payment-method [get]
 func (h *PaymentMethodHandler) GetAll(c *gin.Context) {
 	var paymentMethods []models.PaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), paymentMethodListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
 	query := tenantDB.Model(&models.PaymentMethod{})
@@ -53,12 +73,13 @@ func (h *PaymentMethodHandler) GetAll(c *gin.Context) {
 	}
 
 	// Execute query
-	if err := query.Find(&paymentMethods).Error; err != nil {
+	meta, err := list.Find(query, &paymentMethods)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve payment methods", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Payment methods retrieved successfully", paymentMethods)
+	utils.PaginatedResponse(c, http.StatusOK, "Payment methods retrieved successfully", paymentMethods, meta)
 }
 
 // GetByID retrieves a single payment method by ID
@@ -84,12 +105,11 @@ func (h *PaymentMethodHandler) GetByID(c *gin.Context) {
 	var paymentMethod models.PaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query payment method by ID
 	if err := tenantDB.First(&paymentMethod, id).Error; err != nil {
@@ -125,12 +145,11 @@ func (h *PaymentMethodHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
@@ -181,12 +200,11 @@ func (h *PaymentMethodHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -237,12 +255,11 @@ func (h *PaymentMethodHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type PermissionHandler struct{}
+
+func NewPermissionHandler() *PermissionHandler {
+	return &PermissionHandler{}
+}
+
+// PermissionResponse is a catalogue entry with whether the caller holds it
+type PermissionResponse struct {
+	middleware.Permission
+	Granted bool `json:"granted"`
+}
+
+// GetAll lists the permission catalogue
+// @Summary Get permission catalogue
+// @Description Get every permission checked by the service and whether the caller's token grants it
+// @Tags Permission
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.SuccessResponse
+// @Router /so/api/permissions [get]
+func (h *PermissionHandler) GetAll(c *gin.Context) {
+	granted := make(map[string]bool)
+	if permissions, exists := c.Get("permissions"); exists {
+		if permissionList, ok := permissions.([]string); ok {
+			for _, p := range permissionList {
+				granted[p] = true
+			}
+		}
+	}
+
+	permissions := make([]PermissionResponse, 0, len(middleware.PermissionCatalogue))
+	for _, p := range middleware.PermissionCatalogue {
+		permissions = append(permissions, PermissionResponse{
+			Permission: p,
+			Granted:    granted[p.Code],
+		})
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Permissions retrieved successfully", permissions)
+}
@@ -6,16 +6,25 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type RemindedHandler struct {
-	db *gorm.DB
+type RemindedHandler struct{}
+
+func NewRemindedHandler() *RemindedHandler {
+	return &RemindedHandler{}
 }
 
-func NewRemindedHandler(db *gorm.DB) *RemindedHandler {
-	return &RemindedHandler{db: db}
+// remindedListSpec is what GET /reminded sorts and searches by
+var remindedListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"name":       "name",
+	},
+	DefaultSort: "name",
+	Search:      []string{"name"},
 }
 
 // GetAll retrieves all reminded records
@@ -24,27 +33,42 @@ func NewRemindedHandler(db *gorm.DB) *RemindedHandler {
 // @Tags Reminded
 // @Accept json
 // @Produce json
-// @Success 200 {object} utils.SuccessResponse
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, name)"
+// @Param search query string false "Search name (case-insensitive substring)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/reminded [get]
 func (h *RemindedHandler) GetAll(c *gin.Context) {
 	var reminded []models.Reminded
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
-	// Query all reminded records (excluding soft deleted)
-	if err := tenantDB.Find(&reminded).Error; err != nil {
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), remindedListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query (excluding soft deleted)
+	query := tenantDB.Model(&models.Reminded{})
+
+	// Execute query
+	meta, err := list.Find(query, &reminded)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve reminded records", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Reminded records retrieved successfully", reminded)
+	utils.PaginatedResponse(c, http.StatusOK, "Reminded records retrieved successfully", reminded, meta)
 }
 
 // GetByID retrieves a single reminded record by ID
@@ -70,12 +94,11 @@ func (h *RemindedHandler) GetByID(c *gin.Context) {
 	var reminded models.Reminded
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query reminded record by ID
 	if err := tenantDB.First(&reminded, id).Error; err != nil {
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type ReminderHandler struct {
+	reminders *services.TreatmentReminders
+}
+
+func NewReminderHandler(reminders *services.TreatmentReminders) *ReminderHandler {
+	return &ReminderHandler{reminders: reminders}
+}
+
+// Run sends the reminders due in the tenant now
+// @Summary Send due reminders
+// @Description Send the appointment and package reminders due in the tenant now, as the reminder job does on its interval, and record the delivery on the services
+// @Tags Reminder
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reminders/run [post]
+func (h *ReminderHandler) Run(c *gin.Context) {
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	today := utils.Today(middleware.GetTenantTimeZone(c))
+	run, err := h.reminders.Run(c.Request.Context(), tenantDB, middleware.GetTenantCode(c), today)
+	if err != nil {
+		if errors.Is(err, services.ErrRemindersRunning) {
+			utils.ErrorResponse(c, http.StatusConflict, "Reminders are already being sent", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to send reminders", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reminders sent successfully", run)
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type ReminderTemplateHandler struct{}
+
+func NewReminderTemplateHandler() *ReminderTemplateHandler {
+	return &ReminderTemplateHandler{}
+}
+
+// reminderTemplateListSpec is what GET /reminder-templates sorts and searches by
+var reminderTemplateListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"kind":       "kind",
+	},
+	DefaultSort: "kind",
+	Search:      []string{"subject", "body"},
+}
+
+// ReminderTemplateRequest represents the request body for creating/updating
+// a reminder template. Subject and body are Go text/template strings.
+type ReminderTemplateRequest struct {
+	Kind       string  `json:"kind" binding:"required"`
+	RemindedID *int    `json:"reminded_id"`
+	Subject    *string `json:"subject"`
+	Body       string  `json:"body" binding:"required"`
+}
+
+// GetAll retrieves all reminder templates
+// @Summary Get all reminder templates
+// @Description Get list of the tenant's reminder templates. Kinds without one use the built-in default.
+// @Tags ReminderTemplate
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, kind)"
+// @Param search query string false "Search subject and body (case-insensitive substring)"
+// @Param kind query string false "Filter by kind (appointment, package)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reminder-templates [get]
+func (h *ReminderTemplateHandler) GetAll(c *gin.Context) {
+	var templates []models.ReminderTemplate
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), reminderTemplateListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.ReminderTemplate{})
+
+	// Apply filters
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	// Execute query
+	meta, err := list.Find(query, &templates)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve reminder templates", nil)
+		return
+	}
+
+	utils.PaginatedResponse(c, http.StatusOK, "Reminder templates retrieved successfully", templates, meta)
+}
+
+// GetByID retrieves a single reminder template by ID
+// @Summary Get reminder template by ID
+// @Description Get a single reminder template by its ID
+// @Tags ReminderTemplate
+// @Accept json
+// @Produce json
+// @Param id path int true "Reminder Template ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reminder-templates/{id} [get]
+func (h *ReminderTemplateHandler) GetByID(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid reminder template ID", nil)
+		return
+	}
+
+	var template models.ReminderTemplate
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Query reminder template by ID
+	if err := tenantDB.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Reminder template not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve reminder template", nil)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reminder template retrieved successfully", template)
+}
+
+// Create creates a new reminder template
+// @Summary Create a new reminder template
+// @Description Create the tenant's template for a reminder kind. The subject and body are rendered as Go templates and must render against sample data.
+// @Tags ReminderTemplate
+// @Accept json
+// @Produce json
+// @Param request body ReminderTemplateRequest true "Reminder template data"
+// @Success 201 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reminder-templates [post]
+func (h *ReminderTemplateHandler) Create(c *gin.Context) {
+	var req ReminderTemplateRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Create reminder template
+	template := models.ReminderTemplate{
+		Kind:       req.Kind,
+		RemindedID: req.RemindedID,
+		Subject:    req.Subject,
+		Body:       req.Body,
+		CreatedBy:  &userIDInt64,
+	}
+	if errs := services.ValidateReminderTemplate(&template); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+	if !h.requireUnique(c, tenantDB, template.Kind, 0) {
+		return
+	}
+
+	if err := tenantDB.Create(&template).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create reminder template", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Reminder template created successfully", template)
+}
+
+// Update updates an existing reminder template
+// @Summary Update reminder template
+// @Description Update a reminder template by ID. Reminders already sent are kept.
+// @Tags ReminderTemplate
+// @Accept json
+// @Produce json
+// @Param id path int true "Reminder Template ID"
+// @Param request body ReminderTemplateRequest true "Reminder template data"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reminder-templates/{id} [put]
+func (h *ReminderTemplateHandler) Update(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid reminder template ID", nil)
+		return
+	}
+
+	var req ReminderTemplateRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if reminder template exists
+	var template models.ReminderTemplate
+	if err := tenantDB.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Reminder template not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve reminder template", nil)
+		return
+	}
+
+	// Update fields
+	template.Kind = req.Kind
+	template.RemindedID = req.RemindedID
+	template.Subject = req.Subject
+	template.Body = req.Body
+	template.UpdatedBy = &userIDInt64
+	if errs := services.ValidateReminderTemplate(&template); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+	if !h.requireUnique(c, tenantDB, template.Kind, template.ID) {
+		return
+	}
+
+	// Save updates
+	if err := tenantDB.Save(&template).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update reminder template", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reminder template updated successfully", template)
+}
+
+// Delete soft deletes a reminder template
+// @Summary Delete reminder template
+// @Description Soft delete a reminder template by ID. Its kind falls back to the built-in default.
+// @Tags ReminderTemplate
+// @Accept json
+// @Produce json
+// @Param id path int true "Reminder Template ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reminder-templates/{id} [delete]
+func (h *ReminderTemplateHandler) Delete(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid reminder template ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if reminder template exists
+	var template models.ReminderTemplate
+	if err := tenantDB.First(&template, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Reminder template not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve reminder template", nil)
+		return
+	}
+
+	// Set deleted_by before soft delete
+	template.DeletedBy = &userIDInt64
+	if err := tenantDB.Save(&template).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+		return
+	}
+
+	// Soft delete
+	if err := tenantDB.Delete(&template).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete reminder template", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Reminder template deleted successfully", nil)
+}
+
+// requireUnique writes a conflict response and returns false when the
+// tenant already has a template of the kind
+func (h *ReminderTemplateHandler) requireUnique(c *gin.Context, tenantDB *gorm.DB, kind string, id int) bool {
+	var existing int64
+	if err := tenantDB.Model(&models.ReminderTemplate{}).Where("kind = ? AND id <> ?", kind, id).
+		Count(&existing).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check reminder templates", err.Error())
+		return false
+	}
+	if existing > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "A template for this kind already exists", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type ReportHandler struct {
+	expiry *services.PackageExpiry
+	aging  *services.ARAging
+}
+
+func NewReportHandler(expiry *services.PackageExpiry, aging *services.ARAging) *ReportHandler {
+	return &ReportHandler{expiry: expiry, aging: aging}
+}
+
+// GetExpiredPackages reports package sessions forfeited by expiry
+// @Summary Get expired packages
+// @Description Get package lines that expired with sessions unused, the forfeited sessions and the deferred revenue they release
+// @Tags Report
+// @Accept json
+// @Produce json
+// @Param expiry_date_from query string false "Expired on or after (YYYY-MM-DD)"
+// @Param expiry_date_to query string false "Expired on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reports/expired-packages [get]
+func (h *ReportHandler) GetExpiredPackages(c *gin.Context) {
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse the expiry period in the tenant's timezone
+	timeZone := middleware.GetTenantTimeZone(c)
+	dates := utils.NewDateParser(timeZone)
+	from, to := dates.Range(c, "expiry_date")
+	if dates.Failed(c) {
+		return
+	}
+
+	period := services.StatementPeriod{From: from, To: to}
+	report, err := h.expiry.Expired(tenantDB, period, middleware.GetLocationID(c), utils.Today(timeZone))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to build expired packages report", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Expired packages retrieved successfully", report)
+}
+
+// GetARAging reports what customers owe and for how long
+// @Summary Get accounts receivable aging
+// @Description Get the outstanding balance of posted and paid sales orders on a date, per customer and in total, in 0-30, 31-60, 61-90 and 90+ day buckets by document date. format=csv returns one row per order.
+// @Tags Report
+// @Accept json
+// @Produce json
+// @Produce text/csv
+// @Param as_of query string false "Age balances as of this date (YYYY-MM-DD, default today)"
+// @Param customer_id query int false "Filter by customer ID"
+// @Param location_id query int false "Filter by location ID; scoped users only see their own location"
+// @Param format query string false "json (default) or csv"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/reports/ar-aging [get]
+func (h *ReportHandler) GetARAging(c *gin.Context) {
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse the as-of date in the tenant's timezone
+	timeZone := middleware.GetTenantTimeZone(c)
+	dates := utils.NewDateParser(timeZone)
+	asOf := dates.Query(c, "as_of")
+	if asOf == nil {
+		today := utils.Today(timeZone)
+		asOf = &today
+	}
+	var filter services.ARAgingFilter
+	for field, target := range map[string]**int{"customer_id": &filter.CustomerID, "location_id": &filter.LocationID} {
+		value := c.Query(field)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			dates.Errors = append(dates.Errors, models.ErrorDetail{Field: field, Message: "Must be an integer"})
+			continue
+		}
+		*target = &parsed
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		dates.Errors = append(dates.Errors, models.ErrorDetail{Field: "format", Message: "Format must be json or csv"})
+	}
+	if dates.Failed(c) {
+		return
+	}
+
+	locationID, ok := middleware.ResolveLocationID(c, filter.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
+	}
+	filter.LocationID = locationID
+
+	report, err := h.aging.Build(tenantDB, *asOf, filter)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to build AR aging report", err.Error())
+		return
+	}
+
+	if format == "csv" {
+		writeARAgingCSV(c, report)
+		return
+	}
+	utils.SuccessResponse(c, http.StatusOK, "AR aging retrieved successfully", report)
+}
+
+// writeARAgingCSV writes the report with one row per outstanding order and
+// the amount in the column of its bucket
+func writeARAgingCSV(c *gin.Context, report *services.ARAgingReport) {
+	asOf := report.AsOf.Format(utils.DateLayout)
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="ar-aging-%s.csv"`, asOf))
+	c.Status(http.StatusOK)
+
+	buckets := []string{services.ARAgingBucket0To30, services.ARAgingBucket31To60, services.ARAgingBucket61To90, services.ARAgingBucketOver90}
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write(append([]string{
+		"as_of", "customer_id", "sales_order_id", "inv_number", "location_id", "doc_date", "days",
+		"total_amount", "paid", "outstanding",
+	}, buckets...))
+	for _, customer := range report.Customers {
+		for _, order := range customer.Orders {
+			row := []string{
+				asOf,
+				csvInt(order.CustomerID),
+				order.SalesOrderID.String(),
+				csvString(order.InvNumber),
+				csvInt(order.LocationID),
+				order.DocDate.Format(utils.DateLayout),
+				strconv.Itoa(order.Days),
+				order.TotalAmount.String(),
+				order.Paid.String(),
+				order.Outstanding.String(),
+			}
+			for _, bucket := range buckets {
+				var amount models.Money
+				if bucket == order.Bucket {
+					amount = order.Outstanding
+				}
+				row = append(row, amount.String())
+			}
+			_ = w.Write(row)
+		}
+	}
+	totals := report.Totals
+	_ = w.Write([]string{
+		asOf, "total", "", "", "", "", "", "", "", totals.Total.String(),
+		totals.Days0To30.String(), totals.Days31To60.String(), totals.Days61To90.String(), totals.Over90.String(),
+	})
+	w.Flush()
+}
@@ -1,35 +1,52 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
 type SalesOrderDetailHandler struct {
-	db *gorm.DB
+	states  *services.SalesOrderStateMachine
+	pricing *services.SalesOrderPricing
+	lines   *services.SalesOrderLines
 }
 
-func NewSalesOrderDetailHandler(db *gorm.DB) *SalesOrderDetailHandler {
-	return &SalesOrderDetailHandler{db: db}
+func NewSalesOrderDetailHandler(states *services.SalesOrderStateMachine, pricing *services.SalesOrderPricing, lines *services.SalesOrderLines) *SalesOrderDetailHandler {
+	return &SalesOrderDetailHandler{states: states, pricing: pricing, lines: lines}
+}
+
+// salesOrderDetailListSpec is what GET /sales-order-details sorts and searches by
+var salesOrderDetailListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"item_name":  "itemname",
+		"item_total": "itemtotal",
+	},
+	DefaultSort: "id",
+	Search:      []string{"itemname"},
 }
 
 // SalesOrderDetailRequest represents the request body for creating/updating a sales order detail
 type SalesOrderDetailRequest struct {
-	SalesOrderID *int     `json:"sales_order_id"`
-	ItemID       *int     `json:"item_id"`
-	UnitID       *int     `json:"unit_id"`
-	PromoterID   *int     `json:"promoter_id"`
-	ItemName     *string  `json:"item_name"`
-	Quantity     *int     `json:"quantity" binding:"required"`
-	Price        *float64 `json:"price" binding:"required"`
-	ItemTotal    *float64 `json:"item_total"`
-	DiscountPct  *int     `json:"discount_pct"`
-	UsedSessions *int     `json:"used_sessions"`
+	SalesOrderID *uuid.UUID    `json:"sales_order_id" binding:"required"`
+	ItemID       *int          `json:"item_id"`
+	UnitID       *int          `json:"unit_id"`
+	PromoterID   *int          `json:"promoter_id"`
+	ItemName     *string       `json:"item_name"`
+	Quantity     *int          `json:"quantity" binding:"required"`
+	Price        *models.Money `json:"price" binding:"required"`
+	ItemTotal    *models.Money `json:"item_total"`
+	DiscountPct  *int          `json:"discount_pct"`
 }
 
 // GetAll retrieves all sales order details with optional filters
@@ -38,40 +55,57 @@ type SalesOrderDetailRequest struct {
 // @Tags SalesOrderDetail
 // @Accept json
 // @Produce json
-// @Param sales_order_id query int false "Filter by sales order ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, item_name, item_total)"
+// @Param search query string false "Search item name (case-insensitive substring)"
+// @Param sales_order_id query string false "Filter by sales order ID (UUID)"
 // @Param item_id query int false "Filter by item ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-details [get]
 func (h *SalesOrderDetailHandler) GetAll(c *gin.Context) {
 	var details []models.SalesOrderDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), salesOrderDetailListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
-	query := tenantDB.Model(&models.SalesOrderDetail{})
+	query := tenantDB.Model(&models.SalesOrderDetail{}).Scopes(salesOrderDetailScope(c))
 
 	// Apply filters
 	if salesOrderID := c.Query("sales_order_id"); salesOrderID != "" {
-		query = query.Where("salesorder_id = ?", salesOrderID)
+		id, err := uuid.Parse(salesOrderID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sales order ID", nil)
+			return
+		}
+		query = query.Where("salesorder_id = ?", id)
 	}
 	if itemID := c.Query("item_id"); itemID != "" {
 		query = query.Where("item_id = ?", itemID)
 	}
 
 	// Execute query
-	if err := query.Find(&details).Error; err != nil {
+	meta, err := list.Find(query, &details)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order details", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Sales order details retrieved successfully", details)
+	utils.PaginatedResponse(c, http.StatusOK, "Sales order details retrieved successfully", details, meta)
 }
 
 // GetByID retrieves a single sales order detail by ID
@@ -97,15 +131,14 @@ func (h *SalesOrderDetailHandler) GetByID(c *gin.Context) {
 	var detail models.SalesOrderDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query detail by ID
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	if err := tenantDB.Scopes(salesOrderDetailScope(c)).First(&detail, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Sales order detail not found", nil)
 			return
@@ -123,14 +156,14 @@ func (h *SalesOrderDetailHandler) GetByID(c *gin.Context) {
 // @Tags SalesOrderDetail
 // @Accept json
 // @Produce json
-// @Param sales_order_id path int true "Sales Order ID"
+// @Param sales_order_id path string true "Sales Order ID (UUID)"
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-details/by-sales-order/{sales_order_id} [get]
 func (h *SalesOrderDetailHandler) GetBySalesOrderID(c *gin.Context) {
 	// Parse Sales Order ID from URL parameter
-	salesOrderID, err := strconv.Atoi(c.Param("sales_order_id"))
+	salesOrderID, err := uuid.Parse(c.Param("sales_order_id"))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sales order ID", nil)
 		return
@@ -139,15 +172,14 @@ func (h *SalesOrderDetailHandler) GetBySalesOrderID(c *gin.Context) {
 	var details []models.SalesOrderDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query details by sales order ID
-	if err := tenantDB.Where("salesorder_id = ?", salesOrderID).Find(&details).Error; err != nil {
+	if err := tenantDB.Scopes(salesOrderDetailScope(c)).Where("salesorder_id = ?", salesOrderID).Find(&details).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order details", nil)
 		return
 	}
@@ -155,15 +187,17 @@ func (h *SalesOrderDetailHandler) GetBySalesOrderID(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "Sales order details retrieved successfully", details)
 }
 
-// Create creates a new sales order detail
+// Create adds a detail line to a draft sales order
 // @Summary Create a new sales order detail
-// @Description Create a new sales order detail
+// @Description Add a detail line to a draft sales order. The order is locked while the line is added and its total_amount, outstanding and fully_paid are re-priced from its lines.
 // @Tags SalesOrderDetail
 // @Accept json
 // @Produce json
 // @Param request body SalesOrderDetailRequest true "Sales Order Detail data"
 // @Success 201 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-details [post]
 func (h *SalesOrderDetailHandler) Create(c *gin.Context) {
@@ -176,56 +210,51 @@ func (h *SalesOrderDetailHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Calculate item total if not provided
-	itemTotal := req.ItemTotal
-	if itemTotal == nil && req.Quantity != nil && req.Price != nil {
-		calculated := float64(*req.Quantity) * *req.Price
-		// Apply discount if provided
-		if req.DiscountPct != nil && *req.DiscountPct > 0 {
-			discount := calculated * float64(*req.DiscountPct) / 100
-			calculated = calculated - discount
-		}
-		itemTotal = &calculated
+	// Derive item total; a client-supplied item_total must match
+	itemTotal, validationErrs := h.pricing.LineTotal(req.pricingLine())
+	if len(validationErrs) > 0 {
+		utils.ValidationErrorResponse(c, validationErrs)
+		return
 	}
 
-	// Create sales order detail
+	// Append the line to the order's stored lines
 	detail := models.SalesOrderDetail{
-		SalesOrderID: req.SalesOrderID,
-		ItemID:       req.ItemID,
-		UnitID:       req.UnitID,
-		PromoterID:   req.PromoterID,
-		ItemName:     req.ItemName,
-		Quantity:     req.Quantity,
-		Price:        req.Price,
-		ItemTotal:    itemTotal,
-		DiscountPct:  req.DiscountPct,
-		UsedSessions: req.UsedSessions,
-		CreatedBy:    &userIDInt64,
+		ItemID:      req.ItemID,
+		UnitID:      req.UnitID,
+		PromoterID:  req.PromoterID,
+		ItemName:    req.ItemName,
+		Quantity:    req.Quantity,
+		Price:       req.Price,
+		ItemTotal:   &itemTotal,
+		DiscountPct: req.DiscountPct,
 	}
-
-	// Create detail
-	if err := tenantDB.Create(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create sales order detail", err.Error())
+	changes, err := h.changeDetails(c, tenantDB, *req.SalesOrderID, userIDInt64, func(stored []models.SalesOrderDetail) ([]models.SalesOrderDetail, error) {
+		return append(stored, detail), nil
+	})
+	if err != nil {
+		h.serviceError(c, err, "Failed to create sales order detail")
 		return
 	}
 
+	// Load the created detail
+	tenantDB.First(&detail, changes.Details.Added[0])
+
 	utils.SuccessResponse(c, http.StatusCreated, "Sales order detail created successfully", detail)
 }
 
 // Update updates an existing sales order detail
 // @Summary Update sales order detail
-// @Description Update an existing sales order detail by ID
+// @Description Update a detail line of a draft sales order by ID. The order is locked while the line changes and its total_amount, outstanding and fully_paid are re-priced from its lines. The quantity cannot go below the sessions already used.
 // @Tags SalesOrderDetail
 // @Accept json
 // @Produce json
@@ -234,6 +263,7 @@ func (h *SalesOrderDetailHandler) Create(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-details/{id} [put]
 func (h *SalesOrderDetailHandler) Update(c *gin.Context) {
@@ -253,12 +283,11 @@ func (h *SalesOrderDetailHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -266,52 +295,60 @@ func (h *SalesOrderDetailHandler) Update(c *gin.Context) {
 
 	// Check if detail exists
 	var detail models.SalesOrderDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, http.StatusNotFound, "Sales order detail not found", nil)
-			return
-		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order detail", nil)
+	if !h.findDetail(c, tenantDB, id, &detail) {
+		return
+	}
+	if *req.SalesOrderID != *detail.SalesOrderID {
+		utils.ValidationErrorResponse(c, []models.ErrorDetail{{Field: "sales_order_id", Message: "A detail cannot be moved to another sales order"}})
 		return
 	}
 
-	// Calculate item total if not provided
-	itemTotal := req.ItemTotal
-	if itemTotal == nil && req.Quantity != nil && req.Price != nil {
-		calculated := float64(*req.Quantity) * *req.Price
-		// Apply discount if provided
-		if req.DiscountPct != nil && *req.DiscountPct > 0 {
-			discount := calculated * float64(*req.DiscountPct) / 100
-			calculated = calculated - discount
-		}
-		itemTotal = &calculated
+	// Derive item total; a client-supplied item_total must match
+	itemTotal, validationErrs := h.pricing.LineTotal(req.pricingLine())
+	if len(validationErrs) > 0 {
+		utils.ValidationErrorResponse(c, validationErrs)
+		return
 	}
 
-	// Update fields
-	detail.SalesOrderID = req.SalesOrderID
-	detail.ItemID = req.ItemID
-	detail.UnitID = req.UnitID
-	detail.PromoterID = req.PromoterID
-	detail.ItemName = req.ItemName
-	detail.Quantity = req.Quantity
-	detail.Price = req.Price
-	detail.ItemTotal = itemTotal
-	detail.DiscountPct = req.DiscountPct
-	detail.UsedSessions = req.UsedSessions
-	detail.UpdatedBy = &userIDInt64
-
-	// Save updates
-	if err := tenantDB.Save(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update sales order detail", err.Error())
+	// Replace the line among the order's stored lines; used sessions are
+	// only changed by treatments
+	_, err = h.changeDetails(c, tenantDB, *detail.SalesOrderID, userIDInt64, func(stored []models.SalesOrderDetail) ([]models.SalesOrderDetail, error) {
+		for i := range stored {
+			if stored[i].ID != id {
+				continue
+			}
+			if used := stored[i].UsedSessions; used != nil && *req.Quantity < *used {
+				return nil, services.ValidationErrors{{
+					Field:   "quantity",
+					Message: fmt.Sprintf("Quantity cannot be below the %d sessions already used", *used),
+				}}
+			}
+			stored[i].ItemID = req.ItemID
+			stored[i].UnitID = req.UnitID
+			stored[i].PromoterID = req.PromoterID
+			stored[i].ItemName = req.ItemName
+			stored[i].Quantity = req.Quantity
+			stored[i].Price = req.Price
+			stored[i].ItemTotal = &itemTotal
+			stored[i].DiscountPct = req.DiscountPct
+			return stored, nil
+		}
+		return nil, errSalesOrderDetailNotFound
+	})
+	if err != nil {
+		h.serviceError(c, err, "Failed to update sales order detail")
 		return
 	}
 
+	// Load the updated detail
+	tenantDB.First(&detail, id)
+
 	utils.SuccessResponse(c, http.StatusOK, "Sales order detail updated successfully", detail)
 }
 
 // Delete soft deletes a sales order detail
 // @Summary Delete sales order detail
-// @Description Soft delete a sales order detail by ID
+// @Description Soft delete a detail line of a draft sales order by ID and re-price the order. Lines with used sessions or linked services cannot be deleted.
 // @Tags SalesOrderDetail
 // @Accept json
 // @Produce json
@@ -319,6 +356,7 @@ func (h *SalesOrderDetailHandler) Update(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-details/{id} [delete]
 func (h *SalesOrderDetailHandler) Delete(c *gin.Context) {
@@ -330,12 +368,11 @@ func (h *SalesOrderDetailHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -343,27 +380,133 @@ func (h *SalesOrderDetailHandler) Delete(c *gin.Context) {
 
 	// Check if detail exists
 	var detail models.SalesOrderDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, http.StatusNotFound, "Sales order detail not found", nil)
-			return
-		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order detail", nil)
+	if !h.findDetail(c, tenantDB, id, &detail) {
 		return
 	}
 
-	// Set deleted_by before soft delete
-	detail.DeletedBy = &userIDInt64
-	if err := tenantDB.Save(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+	// Drop the line from the order's stored lines; the reconcile refuses
+	// lines with used sessions
+	_, err = h.changeDetails(c, tenantDB, *detail.SalesOrderID, userIDInt64, func(stored []models.SalesOrderDetail) ([]models.SalesOrderDetail, error) {
+		for i := range stored {
+			if stored[i].ID == id {
+				return append(stored[:i:i], stored[i+1:]...), nil
+			}
+		}
+		return nil, errSalesOrderDetailNotFound
+	})
+	if err != nil {
+		h.serviceError(c, err, "Failed to delete sales order detail")
 		return
 	}
 
-	// Soft delete
-	if err := tenantDB.Delete(&detail).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete sales order detail", err.Error())
-		return
+	utils.SuccessResponse(c, http.StatusOK, "Sales order detail deleted successfully", nil)
+}
+
+// salesOrderDetailScope limits details to those of orders at the caller's location
+func salesOrderDetailScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationScope(c, "sales_order_detail.salesorder_id", "sales_order", "location_id")
+}
+
+var errSalesOrderDetailNotFound = errors.New("sales order detail not found")
+
+// pricingLine returns the request's line for the pricing engine
+func (req *SalesOrderDetailRequest) pricingLine() services.PricingLine {
+	return services.PricingLine{
+		Quantity:    req.Quantity,
+		Price:       req.Price,
+		DiscountPct: req.DiscountPct,
+		ItemTotal:   req.ItemTotal,
 	}
+}
 
-	utils.SuccessResponse(c, http.StatusOK, "Sales order detail deleted successfully", nil)
+// findDetail loads the detail with the given ID, writing a response and
+// returning false when it is missing or not linked to a sales order
+func (h *SalesOrderDetailHandler) findDetail(c *gin.Context, tenantDB *gorm.DB, id int, detail *models.SalesOrderDetail) bool {
+	if err := tenantDB.Scopes(salesOrderDetailScope(c)).First(detail, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Sales order detail not found", nil)
+			return false
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order detail", nil)
+		return false
+	}
+	if detail.SalesOrderID == nil {
+		utils.ErrorResponse(c, http.StatusConflict, "Sales order detail is not linked to a sales order", nil)
+		return false
+	}
+	return true
+}
+
+// changeDetails locks the draft order, applies edit to its stored details,
+// reconciles them and re-prices the order from the result, all in one
+// transaction
+func (h *SalesOrderDetailHandler) changeDetails(c *gin.Context, tenantDB *gorm.DB, orderID uuid.UUID, userID int64, edit func([]models.SalesOrderDetail) ([]models.SalesOrderDetail, error)) (*services.SalesOrderChanges, error) {
+	var changes *services.SalesOrderChanges
+	err := tenantDB.Transaction(func(tx *gorm.DB) error {
+		order, err := h.states.LockDraft(tx, orderID, middleware.LocationScope(c, "location_id"))
+		if err != nil {
+			return err
+		}
+
+		var stored []models.SalesOrderDetail
+		if err := tx.Where("salesorder_id = ?", order.ID).Order("id").Find(&stored).Error; err != nil {
+			return err
+		}
+		details, err := edit(stored)
+		if err != nil {
+			return err
+		}
+
+		lines := make([]services.PricingLine, 0, len(details))
+		for _, detail := range details {
+			lines = append(lines, services.PricingLine{
+				Quantity:    detail.Quantity,
+				Price:       detail.Price,
+				DiscountPct: detail.DiscountPct,
+			})
+		}
+		totals, err := h.pricing.Price(services.PricingInput{
+			Lines:          lines,
+			TotalVoucher:   order.TotalVoucher,
+			DeliveryCost:   order.DeliveryCost,
+			AdditionalCost: order.AdditionalCost,
+			TotalPayment:   order.TotalPayment,
+		})
+		if err != nil {
+			return err
+		}
+		for i := range details {
+			details[i].ItemTotal = &totals.LineTotals[i]
+		}
+
+		changes, err = h.lines.Reconcile(tx, order.ID, details, nil, userID)
+		if err != nil {
+			return err
+		}
+
+		order.TotalAmount = &totals.TotalAmount
+		order.Outstanding = &totals.Outstanding
+		order.FullyPaid = &totals.FullyPaid
+		order.UpdatedBy = &userID
+		return tx.Save(order).Error
+	})
+	return changes, err
+}
+
+// serviceError maps errors from changeDetails onto a response, falling back
+// to a 500 with the given message
+func (h *SalesOrderDetailHandler) serviceError(c *gin.Context, err error, message string) {
+	var validationErrs services.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		utils.ValidationErrorResponse(c, validationErrs)
+	case errors.Is(err, services.ErrSalesOrderNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Sales order not found", nil)
+	case errors.Is(err, errSalesOrderDetailNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Sales order detail not found", nil)
+	case errors.Is(err, services.ErrSalesOrderNotDraft):
+		utils.ErrorResponse(c, http.StatusConflict, "Only draft sales orders can be changed; reopen or void it instead", nil)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err.Error())
+	}
 }
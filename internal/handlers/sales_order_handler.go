@@ -1,67 +1,158 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
 type SalesOrderHandler struct {
-	db *gorm.DB
+	states    *services.SalesOrderStateMachine
+	pricing   *services.SalesOrderPricing
+	lines     *services.SalesOrderLines
+	numbering *services.DocumentNumbering
+	expiry    *services.PackageExpiry
 }
 
-func NewSalesOrderHandler(db *gorm.DB) *SalesOrderHandler {
-	return &SalesOrderHandler{db: db}
+func NewSalesOrderHandler(states *services.SalesOrderStateMachine, pricing *services.SalesOrderPricing, lines *services.SalesOrderLines, numbering *services.DocumentNumbering, expiry *services.PackageExpiry) *SalesOrderHandler {
+	return &SalesOrderHandler{states: states, pricing: pricing, lines: lines, numbering: numbering, expiry: expiry}
+}
+
+// salesOrderListSpec is what GET /sales-orders sorts, searches and filters by
+var salesOrderListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at":   "created_at",
+		"doc_date":     "docdate",
+		"inv_number":   "invnumber",
+		"posted_date":  "posteddate",
+		"total_amount": "totalamounth",
+	},
+	DefaultSort: "-doc_date",
+	Search:      []string{"invnumber", "note"},
+	DateRanges: map[string]string{
+		"doc_date":    "docdate",
+		"posted_date": "posteddate",
+	},
 }
 
 // CreateSalesOrderRequest represents the request body for creating a sales order
 type CreateSalesOrderRequest struct {
-	LocationID      *int                        `json:"location_id"`
-	CustomerID      *int                        `json:"customer_id" binding:"required"`
-	DocDate         *string                     `json:"doc_date"`
-	InvNumber       *string                     `json:"inv_number"`
-	Address         *string                     `json:"address"`
-	DeliveryCost    *float64                    `json:"delivery_cost"`
-	TotalAmount     *float64                    `json:"total_amount"`
-	TotalPayment    *float64                    `json:"total_payment"`
-	Outstanding     *float64                    `json:"outstanding"`
-	TotalVoucher    *float64                    `json:"total_voucher"`
-	VoucherNumber   *string                     `json:"voucher_number"`
-	PostedDate      *string                     `json:"posted_date"`
-	AdditionalCost  *float64                    `json:"additional_cost"`
-	PreviousPayment *float64                    `json:"previous_payment"`
-	FullyPaid       *bool                       `json:"fully_paid"`
-	Note            *string                     `json:"note"`
-	StatusID        *int                        `json:"status_id"`
-	Details         []CreateSalesOrderDetailRequest `json:"details"`
+	LocationID      *int                             `json:"location_id"`
+	CustomerID      *int                             `json:"customer_id" binding:"required"`
+	DocDate         *string                          `json:"doc_date"`
+	Address         *string                          `json:"address"`
+	DeliveryCost    *models.Money                    `json:"delivery_cost"`
+	TotalAmount     *models.Money                    `json:"total_amount"`
+	Outstanding     *models.Money                    `json:"outstanding"`
+	TotalVoucher    *models.Money                    `json:"total_voucher"`
+	VoucherNumber   *string                          `json:"voucher_number"`
+	AdditionalCost  *models.Money                    `json:"additional_cost"`
+	PreviousPayment *models.Money                    `json:"previous_payment"`
+	FullyPaid       *bool                            `json:"fully_paid"`
+	Note            *string                          `json:"note"`
+	Details         []CreateSalesOrderDetailRequest  `json:"details"`
 	Services        []CreateSalesOrderServiceRequest `json:"services"`
 }
 
+// CreateSalesOrderDetailRequest is a detail line; ID is only set on update to
+// keep an existing line
 type CreateSalesOrderDetailRequest struct {
-	ItemID       *int     `json:"item_id"`
-	UnitID       *int     `json:"unit_id"`
-	PromoterID   *int     `json:"promoter_id"`
-	ItemName     *string  `json:"item_name"`
-	Quantity     *int     `json:"quantity"`
-	Price        *float64 `json:"price"`
-	ItemTotal    *float64 `json:"item_total"`
-	DiscountPct  *int     `json:"discount_pct"`
-	UsedSessions *int     `json:"used_sessions"`
+	ID          *int          `json:"id"`
+	ItemID      *int          `json:"item_id"`
+	UnitID      *int          `json:"unit_id"`
+	PromoterID  *int          `json:"promoter_id"`
+	ItemName    *string       `json:"item_name"`
+	Quantity    *int          `json:"quantity"`
+	Price       *models.Money `json:"price"`
+	ItemTotal   *models.Money `json:"item_total"`
+	DiscountPct *int          `json:"discount_pct"`
 }
 
+// CreateSalesOrderServiceRequest is a service line; DetailIndex is the position
+// in details of the line the service was sold on and ID is only set on update
+// to keep an existing service
 type CreateSalesOrderServiceRequest struct {
-	SalesOrderDetailID *int    `json:"sales_order_detail_id"`
+	ID                 *int    `json:"id"`
+	DetailIndex        *int    `json:"detail_index"`
 	ServiceID          *int    `json:"service_id"`
 	TreatmentID        *int    `json:"treatment_id"`
 	MessageLogDetailID *string `json:"message_log_detail_id"`
 	RemindedID         *int    `json:"reminded_id"`
 	ServiceName        *string `json:"service_name"`
-	Treated            *bool   `json:"treated"`
-	Schedule           *string `json:"schedule"`
+}
+
+// SalesOrderUpdateResponse is the updated order with the diff applied to its lines
+type SalesOrderUpdateResponse struct {
+	SalesOrder models.SalesOrder           `json:"sales_order"`
+	Changes    *services.SalesOrderChanges `json:"changes"`
+}
+
+// pricingInput combines the request's order-level charges and claimed totals
+// with the given lines and the order's stored payment, which only AR receipt
+// allocations change
+func (req *CreateSalesOrderRequest) pricingInput(lines []services.PricingLine, payment *models.Money) services.PricingInput {
+	return services.PricingInput{
+		Lines:          lines,
+		TotalVoucher:   req.TotalVoucher,
+		DeliveryCost:   req.DeliveryCost,
+		AdditionalCost: req.AdditionalCost,
+		TotalPayment:   payment,
+		TotalAmount:    req.TotalAmount,
+		Outstanding:    req.Outstanding,
+		FullyPaid:      req.FullyPaid,
+	}
+}
+
+// wantedLines converts the request's details and services into the lines to
+// reconcile. A nil array in the request stays nil so the stored lines are kept.
+func (req *CreateSalesOrderRequest) wantedLines(lineTotals []models.Money) ([]models.SalesOrderDetail, []services.ServiceLine) {
+	var details []models.SalesOrderDetail
+	if req.Details != nil {
+		details = make([]models.SalesOrderDetail, 0, len(req.Details))
+		for i, detailReq := range req.Details {
+			detail := models.SalesOrderDetail{
+				ItemID:      detailReq.ItemID,
+				UnitID:      detailReq.UnitID,
+				PromoterID:  detailReq.PromoterID,
+				ItemName:    detailReq.ItemName,
+				Quantity:    detailReq.Quantity,
+				Price:       detailReq.Price,
+				ItemTotal:   &lineTotals[i],
+				DiscountPct: detailReq.DiscountPct,
+			}
+			if detailReq.ID != nil {
+				detail.ID = *detailReq.ID
+			}
+			details = append(details, detail)
+		}
+	}
+
+	var serviceLines []services.ServiceLine
+	if req.Services != nil {
+		serviceLines = make([]services.ServiceLine, 0, len(req.Services))
+		for _, serviceReq := range req.Services {
+			service := models.SalesOrderService{
+				ServiceID:          serviceReq.ServiceID,
+				TreatmentID:        serviceReq.TreatmentID,
+				MessageLogDetailID: serviceReq.MessageLogDetailID,
+				RemindedID:         serviceReq.RemindedID,
+				ServiceName:        serviceReq.ServiceName,
+			}
+			if serviceReq.ID != nil {
+				service.ID = *serviceReq.ID
+			}
+			serviceLines = append(serviceLines, services.ServiceLine{Service: service, DetailIndex: serviceReq.DetailIndex})
+		}
+	}
+
+	return details, serviceLines
 }
 
 // GetAll retrieves all sales orders with optional filters
@@ -71,25 +162,39 @@ type CreateSalesOrderServiceRequest struct {
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number" default(1)
-// @Param limit query int false "Items per page" default(10)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, doc_date, inv_number, posted_date, total_amount)"
+// @Param search query string false "Search document number and note (case-insensitive substring)"
 // @Param status_id query int false "Filter by status ID"
 // @Param customer_id query int false "Filter by customer ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Param inv_number query string false "Search by document number, e.g. SO/JKT/2026"
+// @Param doc_date_from query string false "Document date on or after (YYYY-MM-DD)"
+// @Param doc_date_to query string false "Document date on or before (YYYY-MM-DD)"
+// @Param posted_date_from query string false "Posted date on or after (YYYY-MM-DD)"
+// @Param posted_date_to query string false "Posted date on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-orders [get]
 func (h *SalesOrderHandler) GetAll(c *gin.Context) {
 	var salesOrders []models.SalesOrder
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), salesOrderListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
-	query := tenantDB.Model(&models.SalesOrder{})
+	query := tenantDB.Model(&models.SalesOrder{}).Scopes(middleware.LocationScope(c, "location_id"))
 
 	// Apply filters
 	if statusID := c.Query("status_id"); statusID != "" {
@@ -98,17 +203,18 @@ func (h *SalesOrderHandler) GetAll(c *gin.Context) {
 	if customerID := c.Query("customer_id"); customerID != "" {
 		query = query.Where("costumer_id = ?", customerID)
 	}
-
-	// Preload relationships
-	query = query.Preload("Status").Preload("Details").Preload("Services")
+	if invNumber := c.Query("inv_number"); invNumber != "" {
+		query = query.Where("invnumber ILIKE ?", "%"+invNumber+"%")
+	}
 
 	// Execute query
-	if err := query.Find(&salesOrders).Error; err != nil {
+	meta, err := list.Find(query, &salesOrders, "Status", "Details", "Services")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales orders", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Sales orders retrieved successfully", salesOrders)
+	utils.PaginatedResponse(c, http.StatusOK, "Sales orders retrieved successfully", salesOrders, meta)
 }
 
 // GetByID retrieves a single sales order by ID
@@ -134,15 +240,14 @@ func (h *SalesOrderHandler) GetByID(c *gin.Context) {
 	var salesOrder models.SalesOrder
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query sales order by ID with relationships
-	if err := tenantDB.Preload("Status").Preload("Details").Preload("Services").
+	if err := tenantDB.Scopes(middleware.LocationScope(c, "location_id")).Preload("Status").Preload("Details").Preload("Services").
 		First(&salesOrder, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Sales order not found", nil)
@@ -176,34 +281,66 @@ func (h *SalesOrderHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationID(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
+	}
+
+	// Parse dates in the tenant's timezone; the document date defaults to today
+	timeZone := middleware.GetTenantTimeZone(c)
+	dates := utils.NewDateParser(timeZone)
+	docDate := dates.Optional("doc_date", req.DocDate)
+	if dates.Failed(c) {
+		return
+	}
+	if docDate == nil {
+		today := utils.Today(timeZone)
+		docDate = &today
+	}
+
+	// Derive line and order totals; client-supplied totals must reconcile
+	lines := make([]services.PricingLine, 0, len(req.Details))
+	for _, detailReq := range req.Details {
+		lines = append(lines, services.PricingLine{
+			Quantity:    detailReq.Quantity,
+			Price:       detailReq.Price,
+			DiscountPct: detailReq.DiscountPct,
+			ItemTotal:   detailReq.ItemTotal,
+		})
+	}
+	totals, err := h.pricing.Price(req.pricingInput(lines, nil))
+	if err != nil {
+		h.serviceError(c, err, "Failed to price sales order")
+		return
+	}
+
 	// Create sales order
 	salesOrder := models.SalesOrder{
-		LocationID:      req.LocationID,
+		LocationID:      locationID,
 		CustomerID:      req.CustomerID,
-		InvNumber:       req.InvNumber,
+		DocDate:         docDate,
 		Address:         req.Address,
 		DeliveryCost:    req.DeliveryCost,
-		TotalAmount:     req.TotalAmount,
-		TotalPayment:    req.TotalPayment,
-		Outstanding:     req.Outstanding,
+		TotalAmount:     &totals.TotalAmount,
+		Outstanding:     &totals.Outstanding,
 		TotalVoucher:    req.TotalVoucher,
 		VoucherNumber:   req.VoucherNumber,
 		AdditionalCost:  req.AdditionalCost,
 		PreviousPayment: req.PreviousPayment,
-		FullyPaid:       req.FullyPaid,
+		FullyPaid:       &totals.FullyPaid,
 		Note:            req.Note,
-		StatusID:        req.StatusID,
 		CreatedBy:       &userIDInt64,
 	}
 
@@ -215,6 +352,26 @@ func (h *SalesOrderHandler) Create(c *gin.Context) {
 		}
 	}()
 
+	// New sales orders always start as drafts; status changes go through the state machine
+	draftStatusID, err := h.states.DraftStatusID(tx)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to resolve draft status", err.Error())
+		return
+	}
+	salesOrder.StatusID = &draftStatusID
+
+	// Allocate the document number in this transaction so it is never shared or skipped
+	number, err := h.numbering.Next(tx, services.DocumentSalesOrder, locationID, *docDate)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to allocate document number", err.Error())
+		return
+	}
+	docNumber := int(number.Sequence)
+	salesOrder.DocNumber = &docNumber
+	salesOrder.InvNumber = &number.Formatted
+
 	// Create sales order
 	if err := tx.Create(&salesOrder).Error; err != nil {
 		tx.Rollback()
@@ -222,48 +379,12 @@ func (h *SalesOrderHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// Create details if provided
-	if len(req.Details) > 0 {
-		for _, detailReq := range req.Details {
-			detail := models.SalesOrderDetail{
-				ItemID:       detailReq.ItemID,
-				UnitID:       detailReq.UnitID,
-				PromoterID:   detailReq.PromoterID,
-				ItemName:     detailReq.ItemName,
-				Quantity:     detailReq.Quantity,
-				Price:        detailReq.Price,
-				ItemTotal:    detailReq.ItemTotal,
-				DiscountPct:  detailReq.DiscountPct,
-				UsedSessions: detailReq.UsedSessions,
-				CreatedBy:    &userIDInt64,
-			}
-			if err := tx.Create(&detail).Error; err != nil {
-				tx.Rollback()
-				utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create sales order detail", err.Error())
-				return
-			}
-		}
-	}
-
-	// Create services if provided
-	if len(req.Services) > 0 {
-		for _, serviceReq := range req.Services {
-			service := models.SalesOrderService{
-				SalesOrderDetailID: serviceReq.SalesOrderDetailID,
-				ServiceID:          serviceReq.ServiceID,
-				TreatmentID:        serviceReq.TreatmentID,
-				MessageLogDetailID: serviceReq.MessageLogDetailID,
-				RemindedID:         serviceReq.RemindedID,
-				ServiceName:        serviceReq.ServiceName,
-				Treated:            serviceReq.Treated,
-				CreatedBy:          &userIDInt64,
-			}
-			if err := tx.Create(&service).Error; err != nil {
-				tx.Rollback()
-				utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create sales order service", err.Error())
-				return
-			}
-		}
+	// Create details and services, linking each to the new order
+	details, serviceLines := req.wantedLines(totals.LineTotals)
+	if _, err := h.lines.Reconcile(tx, salesOrder.ID, details, serviceLines, userIDInt64); err != nil {
+		tx.Rollback()
+		h.serviceError(c, err, "Failed to create sales order lines")
+		return
 	}
 
 	// Commit transaction
@@ -279,9 +400,9 @@ func (h *SalesOrderHandler) Create(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusCreated, "Sales order created successfully", salesOrder)
 }
 
-// Update updates an existing sales order
+// Update updates an existing sales order and reconciles its lines
 // @Summary Update sales order
-// @Description Update an existing sales order by ID
+// @Description Update a draft sales order by ID. When details or services are sent they replace the stored lines: lines with an id are updated, lines without one are inserted and missing lines are soft-deleted. The response includes the applied diff.
 // @Tags SalesOrder
 // @Accept json
 // @Produce json
@@ -290,6 +411,7 @@ func (h *SalesOrderHandler) Create(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-orders/{id} [put]
 func (h *SalesOrderHandler) Update(c *gin.Context) {
@@ -309,57 +431,108 @@ func (h *SalesOrderHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Check if sales order exists
-	var salesOrder models.SalesOrder
-	if err := tenantDB.First(&salesOrder, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, http.StatusNotFound, "Sales order not found", nil)
-			return
-		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order", nil)
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationID(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
 		return
 	}
 
-	// Update fields
-	salesOrder.LocationID = req.LocationID
-	salesOrder.CustomerID = req.CustomerID
-	salesOrder.InvNumber = req.InvNumber
-	salesOrder.Address = req.Address
-	salesOrder.DeliveryCost = req.DeliveryCost
-	salesOrder.TotalAmount = req.TotalAmount
-	salesOrder.TotalPayment = req.TotalPayment
-	salesOrder.Outstanding = req.Outstanding
-	salesOrder.TotalVoucher = req.TotalVoucher
-	salesOrder.VoucherNumber = req.VoucherNumber
-	salesOrder.AdditionalCost = req.AdditionalCost
-	salesOrder.PreviousPayment = req.PreviousPayment
-	salesOrder.FullyPaid = req.FullyPaid
-	salesOrder.Note = req.Note
-	salesOrder.StatusID = req.StatusID
-	salesOrder.UpdatedBy = &userIDInt64
-
-	// Save updates
-	if err := tenantDB.Save(&salesOrder).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update sales order", err.Error())
+	// Parse dates in the tenant's timezone; an omitted document date is kept
+	dates := utils.NewDateParser(middleware.GetTenantTimeZone(c))
+	docDate := dates.Optional("doc_date", req.DocDate)
+	if dates.Failed(c) {
+		return
+	}
+
+	// Lock the draft order, price it and reconcile the lines in one
+	// transaction, so a concurrent post cannot slip in between
+	var salesOrder *models.SalesOrder
+	var changes *services.SalesOrderChanges
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		// Only drafts can be edited; posted orders must be reopened or voided
+		salesOrder, err = h.states.LockDraft(tx, id, middleware.LocationScope(c, "location_id"))
+		if err != nil {
+			return err
+		}
+
+		// Price the submitted lines, or the stored ones when details are omitted
+		lines := make([]services.PricingLine, 0, len(req.Details))
+		if req.Details != nil {
+			for _, detailReq := range req.Details {
+				lines = append(lines, services.PricingLine{
+					Quantity:    detailReq.Quantity,
+					Price:       detailReq.Price,
+					DiscountPct: detailReq.DiscountPct,
+					ItemTotal:   detailReq.ItemTotal,
+				})
+			}
+		} else {
+			var stored []models.SalesOrderDetail
+			if err := tx.Where("salesorder_id = ?", salesOrder.ID).Find(&stored).Error; err != nil {
+				return err
+			}
+			for _, detail := range stored {
+				lines = append(lines, services.PricingLine{
+					Quantity:    detail.Quantity,
+					Price:       detail.Price,
+					DiscountPct: detail.DiscountPct,
+				})
+			}
+		}
+		totals, err := h.pricing.Price(req.pricingInput(lines, salesOrder.TotalPayment))
+		if err != nil {
+			return err
+		}
+
+		// Update fields
+		salesOrder.LocationID = locationID
+		salesOrder.CustomerID = req.CustomerID
+		if docDate != nil {
+			salesOrder.DocDate = docDate
+		}
+		salesOrder.Address = req.Address
+		salesOrder.DeliveryCost = req.DeliveryCost
+		salesOrder.TotalAmount = &totals.TotalAmount
+		salesOrder.Outstanding = &totals.Outstanding
+		salesOrder.TotalVoucher = req.TotalVoucher
+		salesOrder.VoucherNumber = req.VoucherNumber
+		salesOrder.AdditionalCost = req.AdditionalCost
+		salesOrder.PreviousPayment = req.PreviousPayment
+		salesOrder.FullyPaid = &totals.FullyPaid
+		salesOrder.Note = req.Note
+		salesOrder.UpdatedBy = &userIDInt64
+
+		if err := tx.Save(salesOrder).Error; err != nil {
+			return err
+		}
+		details, serviceLines := req.wantedLines(totals.LineTotals)
+		changes, err = h.lines.Reconcile(tx, salesOrder.ID, details, serviceLines, userIDInt64)
+		return err
+	})
+	if err != nil {
+		h.serviceError(c, err, "Failed to update sales order")
 		return
 	}
 
 	// Load updated sales order with relationships
 	tenantDB.Preload("Status").Preload("Details").Preload("Services").
-		First(&salesOrder, "id = ?", salesOrder.ID)
+		First(salesOrder, "id = ?", salesOrder.ID)
 
-	utils.SuccessResponse(c, http.StatusOK, "Sales order updated successfully", salesOrder)
+	utils.SuccessResponse(c, http.StatusOK, "Sales order updated successfully", SalesOrderUpdateResponse{
+		SalesOrder: *salesOrder,
+		Changes:    changes,
+	})
 }
 
 // Delete soft deletes a sales order
@@ -372,6 +545,7 @@ func (h *SalesOrderHandler) Update(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-orders/{id} [delete]
 func (h *SalesOrderHandler) Delete(c *gin.Context) {
@@ -383,40 +557,160 @@ func (h *SalesOrderHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Check if sales order exists
-	var salesOrder models.SalesOrder
-	if err := tenantDB.First(&salesOrder, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, http.StatusNotFound, "Sales order not found", nil)
-			return
+	// Lock the draft order and delete it in one transaction, so a concurrent
+	// post cannot slip in between; posted orders must be reopened or voided
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		salesOrder, err := h.states.LockDraft(tx, id, middleware.LocationScope(c, "location_id"))
+		if err != nil {
+			return err
 		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order", nil)
+
+		// Set deleted_by before soft delete
+		if err := tx.Model(salesOrder).UpdateColumn("deleted_by", userIDInt64).Error; err != nil {
+			return err
+		}
+		return tx.Delete(salesOrder).Error
+	})
+	if err != nil {
+		h.serviceError(c, err, "Failed to delete sales order")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Sales order deleted successfully", nil)
+}
+
+// Post moves a draft sales order to posted
+// @Summary Post sales order
+// @Description Post a draft sales order. The order must have at least one detail. Package lines get an expiry date from their validity rule.
+// @Tags SalesOrder
+// @Accept json
+// @Produce json
+// @Param id path string true "Sales Order ID (UUID)"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/sales-orders/{id}/post [patch]
+func (h *SalesOrderHandler) Post(c *gin.Context) {
+	h.fire(c, services.SalesOrderEventPost, "Sales order posted successfully")
+}
+
+// Void voids a draft or posted sales order
+// @Summary Void sales order
+// @Description Void a sales order. Orders with a performed treatment cannot be voided.
+// @Tags SalesOrder
+// @Accept json
+// @Produce json
+// @Param id path string true "Sales Order ID (UUID)"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/sales-orders/{id}/void [patch]
+func (h *SalesOrderHandler) Void(c *gin.Context) {
+	h.fire(c, services.SalesOrderEventVoid, "Sales order voided successfully")
+}
+
+// Reopen moves a posted sales order back to draft
+// @Summary Reopen sales order
+// @Description Reopen a posted sales order for editing. Orders with payments cannot be reopened.
+// @Tags SalesOrder
+// @Accept json
+// @Produce json
+// @Param id path string true "Sales Order ID (UUID)"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/sales-orders/{id}/reopen [patch]
+func (h *SalesOrderHandler) Reopen(c *gin.Context) {
+	h.fire(c, services.SalesOrderEventReopen, "Sales order reopened successfully")
+}
+
+// fire applies a state machine event to the sales order in the URL
+func (h *SalesOrderHandler) fire(c *gin.Context, event services.SalesOrderEvent, message string) {
+	// Parse UUID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sales order ID", nil)
 		return
 	}
 
-	// Set deleted_by before soft delete
-	salesOrder.DeletedBy = &userIDInt64
-	if err := tenantDB.Save(&salesOrder).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
 
-	// Soft delete
-	if err := tenantDB.Delete(&salesOrder).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete sales order", err.Error())
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	var salesOrder *models.SalesOrder
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		today := utils.Today(middleware.GetTenantTimeZone(c))
+		salesOrder, err = h.states.Fire(tx, id, event, userIDInt64, today, middleware.LocationScope(c, "location_id"))
+		if err != nil {
+			return err
+		}
+
+		// Package expiry runs from the posted date
+		switch event {
+		case services.SalesOrderEventPost:
+			return h.expiry.Stamp(tx, salesOrder)
+		case services.SalesOrderEventReopen:
+			return h.expiry.Clear(tx, salesOrder.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		var transitionErr *services.TransitionError
+		switch {
+		case errors.Is(err, services.ErrSalesOrderNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, "Sales order not found", nil)
+		case errors.As(err, &transitionErr):
+			utils.ErrorResponse(c, http.StatusConflict, transitionErr.Error(), nil)
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to change sales order status", err.Error())
+		}
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Sales order deleted successfully", nil)
+	// Load the sales order with relationships
+	tenantDB.Preload("Status").Preload("Details").Preload("Services").
+		First(salesOrder, "id = ?", salesOrder.ID)
+
+	utils.SuccessResponse(c, http.StatusOK, message, salesOrder)
+}
+
+// serviceError writes validation failures from the services as a 400
+// response, a missing order as a 404, a non-draft order as a 409 and
+// anything else as a 500 with the given message
+func (h *SalesOrderHandler) serviceError(c *gin.Context, err error, message string) {
+	var validationErrs services.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		utils.ValidationErrorResponse(c, validationErrs)
+	case errors.Is(err, services.ErrSalesOrderNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Sales order not found", nil)
+	case errors.Is(err, services.ErrSalesOrderNotDraft):
+		utils.ErrorResponse(c, http.StatusConflict, "Only draft sales orders can be changed; reopen or void it instead", nil)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err.Error())
+	}
 }
@@ -3,32 +3,46 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type SalesOrderServiceHandler struct {
-	db *gorm.DB
+type SalesOrderServiceHandler struct{}
+
+func NewSalesOrderServiceHandler() *SalesOrderServiceHandler {
+	return &SalesOrderServiceHandler{}
 }
 
-func NewSalesOrderServiceHandler(db *gorm.DB) *SalesOrderServiceHandler {
-	return &SalesOrderServiceHandler{db: db}
+// salesOrderServiceListSpec is what GET /sales-order-services sorts, searches and filters by
+var salesOrderServiceListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at":   "created_at",
+		"schedule":     "schedule",
+		"service_name": "servicename",
+	},
+	DefaultSort: "id",
+	Search:      []string{"servicename"},
+	DateRanges: map[string]string{
+		"schedule": "schedule",
+	},
 }
 
 // SalesOrderServiceRequest represents the request body for creating/updating a sales order service
 type SalesOrderServiceRequest struct {
-	SalesOrderID       *int    `json:"sales_order_id"`
-	SalesOrderDetailID *int    `json:"sales_order_detail_id"`
-	ServiceID          *int    `json:"service_id"`
-	TreatmentID        *int    `json:"treatment_id"`
-	MessageLogDetailID *string `json:"message_log_detail_id"`
-	RemindedID         *int    `json:"reminded_id"`
-	ServiceName        *string `json:"service_name"`
-	Treated            *bool   `json:"treated"`
-	Schedule           *string `json:"schedule"`
+	SalesOrderID       *uuid.UUID `json:"sales_order_id"`
+	SalesOrderDetailID *int       `json:"sales_order_detail_id"`
+	ServiceID          *int       `json:"service_id"`
+	TreatmentID        *int       `json:"treatment_id"`
+	MessageLogDetailID *string    `json:"message_log_detail_id"`
+	RemindedID         *int       `json:"reminded_id"`
+	ServiceName        *string    `json:"service_name"`
+	Treated            *bool      `json:"treated"`
 }
 
 // GetAll retrieves all sales order services with optional filters
@@ -37,29 +51,47 @@ type SalesOrderServiceRequest struct {
 // @Tags SalesOrderService
 // @Accept json
 // @Produce json
-// @Param sales_order_id query int false "Filter by sales order ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, schedule, service_name)"
+// @Param search query string false "Search service name (case-insensitive substring)"
+// @Param sales_order_id query string false "Filter by sales order ID (UUID)"
 // @Param treated query bool false "Filter by treated status"
 // @Param service_id query int false "Filter by service ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Param schedule_from query string false "Scheduled on or after (YYYY-MM-DD)"
+// @Param schedule_to query string false "Scheduled on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-services [get]
 func (h *SalesOrderServiceHandler) GetAll(c *gin.Context) {
 	var services []models.SalesOrderService
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), salesOrderServiceListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
-	query := tenantDB.Model(&models.SalesOrderService{})
+	query := tenantDB.Model(&models.SalesOrderService{}).Scopes(salesOrderServiceScope(c))
 
 	// Apply filters
 	if salesOrderID := c.Query("sales_order_id"); salesOrderID != "" {
-		query = query.Where("salesorder_id = ?", salesOrderID)
+		id, err := uuid.Parse(salesOrderID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid sales order ID", nil)
+			return
+		}
+		query = query.Where("salesorder_id = ?", id)
 	}
 	if treated := c.Query("treated"); treated != "" {
 		query = query.Where("treated = ?", treated)
@@ -69,12 +101,13 @@ func (h *SalesOrderServiceHandler) GetAll(c *gin.Context) {
 	}
 
 	// Execute query
-	if err := query.Find(&services).Error; err != nil {
+	meta, err := list.Find(query, &services)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order services", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Sales order services retrieved successfully", services)
+	utils.PaginatedResponse(c, http.StatusOK, "Sales order services retrieved successfully", services, meta)
 }
 
 // GetByID retrieves a single sales order service by ID
@@ -100,15 +133,14 @@ func (h *SalesOrderServiceHandler) GetByID(c *gin.Context) {
 	var service models.SalesOrderService
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query service by ID
-	if err := tenantDB.First(&service, id).Error; err != nil {
+	if err := tenantDB.Scopes(salesOrderServiceScope(c)).First(&service, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Sales order service not found", nil)
 			return
@@ -141,17 +173,21 @@ func (h *SalesOrderServiceHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only add services to orders at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "sales_order", req.SalesOrderID, middleware.LocationScope(c, "location_id")) {
+		return
+	}
+
 	// Create sales order service
 	service := models.SalesOrderService{
 		SalesOrderID:       req.SalesOrderID,
@@ -204,12 +240,11 @@ func (h *SalesOrderServiceHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -217,7 +252,7 @@ func (h *SalesOrderServiceHandler) Update(c *gin.Context) {
 
 	// Check if service exists
 	var service models.SalesOrderService
-	if err := tenantDB.First(&service, id).Error; err != nil {
+	if err := tenantDB.Scopes(salesOrderServiceScope(c)).First(&service, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Sales order service not found", nil)
 			return
@@ -226,6 +261,11 @@ func (h *SalesOrderServiceHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// Scoped users may only move services to orders at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "sales_order", req.SalesOrderID, middleware.LocationScope(c, "location_id")) {
+		return
+	}
+
 	// Update fields
 	service.SalesOrderID = req.SalesOrderID
 	service.SalesOrderDetailID = req.SalesOrderDetailID
@@ -256,6 +296,7 @@ func (h *SalesOrderServiceHandler) Update(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-services/{id} [delete]
 func (h *SalesOrderServiceHandler) Delete(c *gin.Context) {
@@ -267,12 +308,11 @@ func (h *SalesOrderServiceHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -280,7 +320,7 @@ func (h *SalesOrderServiceHandler) Delete(c *gin.Context) {
 
 	// Check if service exists
 	var service models.SalesOrderService
-	if err := tenantDB.First(&service, id).Error; err != nil {
+	if err := tenantDB.Scopes(salesOrderServiceScope(c)).First(&service, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Sales order service not found", nil)
 			return
@@ -289,6 +329,19 @@ func (h *SalesOrderServiceHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// A booked appointment has to be cancelled before its service is removed
+	var booked int64
+	if err := tenantDB.Model(&models.Appointment{}).
+		Where("salesorderservice_id = ? AND status = ?", service.ID, models.AppointmentBooked).
+		Count(&booked).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check appointments", err.Error())
+		return
+	}
+	if booked > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "Service has a booked appointment; cancel it first", nil)
+		return
+	}
+
 	// Set deleted_by before soft delete
 	service.DeletedBy = &userIDInt64
 	if err := tenantDB.Save(&service).Error; err != nil {
@@ -307,7 +360,7 @@ func (h *SalesOrderServiceHandler) Delete(c *gin.Context) {
 
 // MarkAsTreated marks a service as treated
 // @Summary Mark service as treated
-// @Description Mark a sales order service as treated
+// @Description Mark a sales order service as treated and stamp when it was treated
 // @Tags SalesOrderService
 // @Accept json
 // @Produce json
@@ -326,12 +379,11 @@ func (h *SalesOrderServiceHandler) MarkAsTreated(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -339,7 +391,7 @@ func (h *SalesOrderServiceHandler) MarkAsTreated(c *gin.Context) {
 
 	// Check if service exists
 	var service models.SalesOrderService
-	if err := tenantDB.First(&service, id).Error; err != nil {
+	if err := tenantDB.Scopes(salesOrderServiceScope(c)).First(&service, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Sales order service not found", nil)
 			return
@@ -348,9 +400,13 @@ func (h *SalesOrderServiceHandler) MarkAsTreated(c *gin.Context) {
 		return
 	}
 
-	// Mark as treated
+	// Mark as treated, keeping the time of an earlier treatment
 	treated := true
 	service.Treated = &treated
+	if service.TreatedAt == nil {
+		now := time.Now()
+		service.TreatedAt = &now
+	}
 	service.UpdatedBy = &userIDInt64
 
 	// Save updates
@@ -361,3 +417,8 @@ func (h *SalesOrderServiceHandler) MarkAsTreated(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Service marked as treated successfully", service)
 }
+
+// salesOrderServiceScope limits services to those of orders at the caller's location
+func salesOrderServiceScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationScope(c, "sales_order_service.salesorder_id", "sales_order", "location_id")
+}
@@ -6,16 +6,25 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type SalesOrderStatusHandler struct {
-	db *gorm.DB
+type SalesOrderStatusHandler struct{}
+
+func NewSalesOrderStatusHandler() *SalesOrderStatusHandler {
+	return &SalesOrderStatusHandler{}
 }
 
-func NewSalesOrderStatusHandler(db *gorm.DB) *SalesOrderStatusHandler {
-	return &SalesOrderStatusHandler{db: db}
+// salesOrderStatusListSpec is what GET /sales-order-status sorts and searches by
+var salesOrderStatusListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"name":       "name",
+	},
+	DefaultSort: "name",
+	Search:      []string{"name"},
 }
 
 // GetAll retrieves all sales order statuses
@@ -24,27 +33,42 @@ func NewSalesOrderStatusHandler(db *gorm.DB) *SalesOrderStatusHandler {
 // @Tags SalesOrderStatus
 // @Accept json
 // @Produce json
-// @Success 200 {object} utils.SuccessResponse
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, name)"
+// @Param search query string false "Search name (case-insensitive substring)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/sales-order-status [get]
 func (h *SalesOrderStatusHandler) GetAll(c *gin.Context) {
 	var statuses []models.SalesOrderStatus
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
-	// Query all statuses (excluding soft deleted)
-	if err := tenantDB.Find(&statuses).Error; err != nil {
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), salesOrderStatusListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query (excluding soft deleted)
+	query := tenantDB.Model(&models.SalesOrderStatus{})
+
+	// Execute query
+	meta, err := list.Find(query, &statuses)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sales order statuses", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Sales order statuses retrieved successfully", statuses)
+	utils.PaginatedResponse(c, http.StatusOK, "Sales order statuses retrieved successfully", statuses, meta)
 }
 
 // GetByID retrieves a single sales order status by ID
@@ -70,12 +94,11 @@ func (h *SalesOrderStatusHandler) GetByID(c *gin.Context) {
 	var status models.SalesOrderStatus
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query status by ID
 	if err := tenantDB.First(&status, id).Error; err != nil {
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type StockMovementHandler struct {
+	stock *services.ConsumableStock
+}
+
+func NewStockMovementHandler(stock *services.ConsumableStock) *StockMovementHandler {
+	return &StockMovementHandler{stock: stock}
+}
+
+// stockMovementListSpec is what GET /stock-movements sorts and filters by
+var stockMovementListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"seq":           "seq",
+		"created_at":    "created_at",
+		"movement_date": "movementdate",
+	},
+	DefaultSort: "-seq",
+	DateRanges: map[string]string{
+		"movement_date": "movementdate",
+	},
+}
+
+// GetAll retrieves the stock movements of treatment consumables
+// @Summary Get all stock movements
+// @Description Get the stock movements written for posted and voided treatments and their delivery to the inventory service
+// @Tags StockMovement
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, seq, created_at, movement_date)"
+// @Param treatment_id query string false "Filter by treatment ID (UUID)"
+// @Param item_id query int false "Filter by item ID"
+// @Param direction query string false "Filter by direction (out, in)"
+// @Param status query string false "Filter by delivery status (pending, sent)"
+// @Param movement_date_from query string false "Movement date on or after (YYYY-MM-DD)"
+// @Param movement_date_to query string false "Movement date on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/stock-movements [get]
+func (h *StockMovementHandler) GetAll(c *gin.Context) {
+	var movements []models.StockMovement
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), stockMovementListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.StockMovement{}).Scopes(middleware.LocationScope(c, "location_id"))
+
+	// Apply filters
+	if treatmentID := c.Query("treatment_id"); treatmentID != "" {
+		id, err := uuid.Parse(treatmentID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid treatment ID", nil)
+			return
+		}
+		query = query.Where("treatment_id = ?", id)
+	}
+	if itemID := c.Query("item_id"); itemID != "" {
+		query = query.Where("item_id = ?", itemID)
+	}
+	if direction := c.Query("direction"); direction != "" {
+		query = query.Where("direction = ?", direction)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	// Execute query
+	meta, err := list.Find(query, &movements)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve stock movements", nil)
+		return
+	}
+
+	utils.PaginatedResponse(c, http.StatusOK, "Stock movements retrieved successfully", movements, meta)
+}
+
+// Relay delivers the tenant's pending stock movements now
+// @Summary Relay pending stock movements
+// @Description Deliver the tenant's pending stock movements to the inventory service in order, as the relay job does on its interval. The run stops at the first failure.
+// @Tags StockMovement
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/stock-movements/relay [post]
+func (h *StockMovementHandler) Relay(c *gin.Context) {
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	run, err := h.stock.Relay(c.Request.Context(), tenantDB, middleware.GetTenantCode(c))
+	if err != nil {
+		if errors.Is(err, services.ErrStockRelayRunning) {
+			utils.ErrorResponse(c, http.StatusConflict, "Stock movements are already being relayed", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to relay stock movements", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Stock movements relayed successfully", run)
+}
@@ -6,23 +6,31 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type SummaryByPaymentMethodHandler struct {
-	db *gorm.DB
+type SummaryByPaymentMethodHandler struct{}
+
+func NewSummaryByPaymentMethodHandler() *SummaryByPaymentMethodHandler {
+	return &SummaryByPaymentMethodHandler{}
 }
 
-func NewSummaryByPaymentMethodHandler(db *gorm.DB) *SummaryByPaymentMethodHandler {
-	return &SummaryByPaymentMethodHandler{db: db}
+// summaryByPaymentMethodListSpec is what GET /summary-by-payment-method sorts by
+var summaryByPaymentMethodListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"total":      "total",
+	},
+	DefaultSort: "id",
 }
 
 // SummaryByPaymentMethodRequest represents the request body for creating/updating a summary
 type SummaryByPaymentMethodRequest struct {
-	BookkeepingID   *int     `json:"bookkeeping_id"`
-	PaymentMethodID *int     `json:"payment_method_id"`
-	Total           *float64 `json:"total"`
+	BookkeepingID   *int          `json:"bookkeeping_id"`
+	PaymentMethodID *int          `json:"payment_method_id"`
+	Total           *models.Money `json:"total"`
 }
 
 // GetAll retrieves all summaries with optional filters
@@ -31,26 +39,34 @@ type SummaryByPaymentMethodRequest struct {
 // @Tags SummaryByPaymentMethod
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, total)"
 // @Param bookkeeping_id query int false "Filter by bookkeeping ID"
 // @Param payment_method_id query int false "Filter by payment method ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/summary-by-payment-method [get]
 func (h *SummaryByPaymentMethodHandler) GetAll(c *gin.Context) {
 	var summaries []models.SummaryByPaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
-	// Build query with preload relationships
-	query := tenantDB.Model(&models.SummaryByPaymentMethod{}).
-		Preload("Bookkeeping").
-		Preload("PaymentMethod")
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), summaryByPaymentMethodListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.SummaryByPaymentMethod{}).Scopes(summaryByPaymentMethodScope(c))
 
 	// Apply filters
 	if bookkeepingID := c.Query("bookkeeping_id"); bookkeepingID != "" {
@@ -61,12 +77,13 @@ func (h *SummaryByPaymentMethodHandler) GetAll(c *gin.Context) {
 	}
 
 	// Execute query
-	if err := query.Find(&summaries).Error; err != nil {
+	meta, err := list.Find(query, &summaries, "Bookkeeping", "PaymentMethod")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve summaries", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Summaries retrieved successfully", summaries)
+	utils.PaginatedResponse(c, http.StatusOK, "Summaries retrieved successfully", summaries, meta)
 }
 
 // GetByID retrieves a single summary by ID
@@ -92,15 +109,14 @@ func (h *SummaryByPaymentMethodHandler) GetByID(c *gin.Context) {
 	var summary models.SummaryByPaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query summary by ID with relationships
-	if err := tenantDB.Preload("Bookkeeping").
+	if err := tenantDB.Scopes(summaryByPaymentMethodScope(c)).Preload("Bookkeeping").
 		Preload("PaymentMethod").
 		First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -136,15 +152,14 @@ func (h *SummaryByPaymentMethodHandler) GetByBookkeepingID(c *gin.Context) {
 	var summaries []models.SummaryByPaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query summaries by bookkeeping ID with relationships
-	if err := tenantDB.Preload("PaymentMethod").
+	if err := tenantDB.Scopes(summaryByPaymentMethodScope(c)).Preload("PaymentMethod").
 		Where("bookkeeping_id = ?", bookkeepingID).
 		Find(&summaries).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve summaries", nil)
@@ -175,17 +190,21 @@ func (h *SummaryByPaymentMethodHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only record summary lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Create summary
 	summary := models.SummaryByPaymentMethod{
 		BookkeepingID:   req.BookkeepingID,
@@ -236,12 +255,11 @@ func (h *SummaryByPaymentMethodHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -249,7 +267,7 @@ func (h *SummaryByPaymentMethodHandler) Update(c *gin.Context) {
 
 	// Check if summary exists
 	var summary models.SummaryByPaymentMethod
-	if err := tenantDB.First(&summary, id).Error; err != nil {
+	if err := tenantDB.Scopes(summaryByPaymentMethodScope(c)).First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Summary not found", nil)
 			return
@@ -258,6 +276,11 @@ func (h *SummaryByPaymentMethodHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// Scoped users may only record summary lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Update fields
 	summary.BookkeepingID = req.BookkeepingID
 	summary.PaymentMethodID = req.PaymentMethodID
@@ -297,12 +320,11 @@ func (h *SummaryByPaymentMethodHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -310,7 +332,7 @@ func (h *SummaryByPaymentMethodHandler) Delete(c *gin.Context) {
 
 	// Check if summary exists
 	var summary models.SummaryByPaymentMethod
-	if err := tenantDB.First(&summary, id).Error; err != nil {
+	if err := tenantDB.Scopes(summaryByPaymentMethodScope(c)).First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Summary not found", nil)
 			return
@@ -334,3 +356,8 @@ func (h *SummaryByPaymentMethodHandler) Delete(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Summary deleted successfully", nil)
 }
+
+// summaryByPaymentMethodScope limits rows to those of bookkeeping at the caller's location
+func summaryByPaymentMethodScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationTextScope(c, "summary_by_payment_method.bookkeeping_id", "bookkeeping", "location_id")
+}
@@ -6,24 +6,32 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type SummaryByTransactionTypeAndPaymentMethodHandler struct {
-	db *gorm.DB
+type SummaryByTransactionTypeAndPaymentMethodHandler struct{}
+
+func NewSummaryByTransactionTypeAndPaymentMethodHandler() *SummaryByTransactionTypeAndPaymentMethodHandler {
+	return &SummaryByTransactionTypeAndPaymentMethodHandler{}
 }
 
-func NewSummaryByTransactionTypeAndPaymentMethodHandler(db *gorm.DB) *SummaryByTransactionTypeAndPaymentMethodHandler {
-	return &SummaryByTransactionTypeAndPaymentMethodHandler{db: db}
+// summaryByTransactionTypeAndPaymentMethodListSpec is what GET /summary-by-transaction-type-and-payment-method sorts by
+var summaryByTransactionTypeAndPaymentMethodListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"total":      "total",
+	},
+	DefaultSort: "id",
 }
 
 // SummaryByTransactionTypeAndPaymentMethodRequest represents the request body for creating/updating a summary
 type SummaryByTransactionTypeAndPaymentMethodRequest struct {
-	BookkeepingID   *int     `json:"bookkeeping_id"`
-	TypeID          *int     `json:"type_id"`
-	PaymentMethodID *int     `json:"payment_method_id"`
-	Total           *float64 `json:"total"`
+	BookkeepingID   *int          `json:"bookkeeping_id"`
+	TypeID          *int          `json:"type_id"`
+	PaymentMethodID *int          `json:"payment_method_id"`
+	Total           *models.Money `json:"total"`
 }
 
 // GetAll retrieves all summaries with optional filters
@@ -32,28 +40,35 @@ type SummaryByTransactionTypeAndPaymentMethodRequest struct {
 // @Tags SummaryByTransactionTypeAndPaymentMethod
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, total)"
 // @Param bookkeeping_id query int false "Filter by bookkeeping ID"
 // @Param type_id query int false "Filter by transaction type ID"
 // @Param payment_method_id query int false "Filter by payment method ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/summary-by-transaction-type-and-payment-method [get]
 func (h *SummaryByTransactionTypeAndPaymentMethodHandler) GetAll(c *gin.Context) {
 	var summaries []models.SummaryByTransactionTypeAndPaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
-	// Build query with preload relationships
-	query := tenantDB.Model(&models.SummaryByTransactionTypeAndPaymentMethod{}).
-		Preload("Bookkeeping").
-		Preload("Type").
-		Preload("PaymentMethod")
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), summaryByTransactionTypeAndPaymentMethodListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.SummaryByTransactionTypeAndPaymentMethod{}).Scopes(summaryByTransactionTypeAndPaymentMethodScope(c))
 
 	// Apply filters
 	if bookkeepingID := c.Query("bookkeeping_id"); bookkeepingID != "" {
@@ -67,12 +82,13 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) GetAll(c *gin.Context)
 	}
 
 	// Execute query
-	if err := query.Find(&summaries).Error; err != nil {
+	meta, err := list.Find(query, &summaries, "Bookkeeping", "Type", "PaymentMethod")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve summaries", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Summaries retrieved successfully", summaries)
+	utils.PaginatedResponse(c, http.StatusOK, "Summaries retrieved successfully", summaries, meta)
 }
 
 // GetByID retrieves a single summary by ID
@@ -98,15 +114,14 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) GetByID(c *gin.Context
 	var summary models.SummaryByTransactionTypeAndPaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query summary by ID with relationships
-	if err := tenantDB.Preload("Bookkeeping").
+	if err := tenantDB.Scopes(summaryByTransactionTypeAndPaymentMethodScope(c)).Preload("Bookkeeping").
 		Preload("Type").
 		Preload("PaymentMethod").
 		First(&summary, id).Error; err != nil {
@@ -143,15 +158,14 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) GetByBookkeepingID(c *
 	var summaries []models.SummaryByTransactionTypeAndPaymentMethod
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query summaries by bookkeeping ID with relationships
-	if err := tenantDB.Preload("Type").
+	if err := tenantDB.Scopes(summaryByTransactionTypeAndPaymentMethodScope(c)).Preload("Type").
 		Preload("PaymentMethod").
 		Where("bookkeeping_id = ?", bookkeepingID).
 		Find(&summaries).Error; err != nil {
@@ -183,17 +197,21 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) Create(c *gin.Context)
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only record summary lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Create summary
 	summary := models.SummaryByTransactionTypeAndPaymentMethod{
 		BookkeepingID:   req.BookkeepingID,
@@ -245,12 +263,11 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) Update(c *gin.Context)
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -258,7 +275,7 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) Update(c *gin.Context)
 
 	// Check if summary exists
 	var summary models.SummaryByTransactionTypeAndPaymentMethod
-	if err := tenantDB.First(&summary, id).Error; err != nil {
+	if err := tenantDB.Scopes(summaryByTransactionTypeAndPaymentMethodScope(c)).First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Summary not found", nil)
 			return
@@ -267,6 +284,11 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) Update(c *gin.Context)
 		return
 	}
 
+	// Scoped users may only record summary lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Update fields
 	summary.BookkeepingID = req.BookkeepingID
 	summary.TypeID = req.TypeID
@@ -307,12 +329,11 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) Delete(c *gin.Context)
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -320,7 +341,7 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) Delete(c *gin.Context)
 
 	// Check if summary exists
 	var summary models.SummaryByTransactionTypeAndPaymentMethod
-	if err := tenantDB.First(&summary, id).Error; err != nil {
+	if err := tenantDB.Scopes(summaryByTransactionTypeAndPaymentMethodScope(c)).First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Summary not found", nil)
 			return
@@ -344,3 +365,8 @@ func (h *SummaryByTransactionTypeAndPaymentMethodHandler) Delete(c *gin.Context)
 
 	utils.SuccessResponse(c, http.StatusOK, "Summary deleted successfully", nil)
 }
+
+// summaryByTransactionTypeAndPaymentMethodScope limits rows to those of bookkeeping at the caller's location
+func summaryByTransactionTypeAndPaymentMethodScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationTextScope(c, "summary_by_transaction_type_and_payment_method.bookkeeping_id", "bookkeeping", "location_id")
+}
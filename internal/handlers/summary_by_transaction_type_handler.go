@@ -6,23 +6,31 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type SummaryByTransactionTypeHandler struct {
-	db *gorm.DB
+type SummaryByTransactionTypeHandler struct{}
+
+func NewSummaryByTransactionTypeHandler() *SummaryByTransactionTypeHandler {
+	return &SummaryByTransactionTypeHandler{}
 }
 
-func NewSummaryByTransactionTypeHandler(db *gorm.DB) *SummaryByTransactionTypeHandler {
-	return &SummaryByTransactionTypeHandler{db: db}
+// summaryByTransactionTypeListSpec is what GET /summary-by-transaction-type sorts by
+var summaryByTransactionTypeListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"total":      "total",
+	},
+	DefaultSort: "id",
 }
 
 // SummaryByTransactionTypeRequest represents the request body for creating/updating a summary
 type SummaryByTransactionTypeRequest struct {
-	BookkeepingID *int     `json:"bookkeeping_id"`
-	TypeID        *int     `json:"type_id"`
-	Total         *float64 `json:"total"`
+	BookkeepingID *int          `json:"bookkeeping_id"`
+	TypeID        *int          `json:"type_id"`
+	Total         *models.Money `json:"total"`
 }
 
 // GetAll retrieves all summaries with optional filters
@@ -31,26 +39,34 @@ type SummaryByTransactionTypeRequest struct {
 // @Tags SummaryByTransactionType
 // @Accept json
 // @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, total)"
 // @Param bookkeeping_id query int false "Filter by bookkeeping ID"
 // @Param type_id query int false "Filter by transaction type ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/summary-by-transaction-type [get]
 func (h *SummaryByTransactionTypeHandler) GetAll(c *gin.Context) {
 	var summaries []models.SummaryByTransactionType
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
-	// Build query with preload relationships
-	query := tenantDB.Model(&models.SummaryByTransactionType{}).
-		Preload("Bookkeeping").
-		Preload("Type")
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), summaryByTransactionTypeListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.SummaryByTransactionType{}).Scopes(summaryByTransactionTypeScope(c))
 
 	// Apply filters
 	if bookkeepingID := c.Query("bookkeeping_id"); bookkeepingID != "" {
@@ -61,12 +77,13 @@ func (h *SummaryByTransactionTypeHandler) GetAll(c *gin.Context) {
 	}
 
 	// Execute query
-	if err := query.Find(&summaries).Error; err != nil {
+	meta, err := list.Find(query, &summaries, "Bookkeeping", "Type")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve summaries", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Summaries retrieved successfully", summaries)
+	utils.PaginatedResponse(c, http.StatusOK, "Summaries retrieved successfully", summaries, meta)
 }
 
 // GetByID retrieves a single summary by ID
@@ -92,15 +109,14 @@ func (h *SummaryByTransactionTypeHandler) GetByID(c *gin.Context) {
 	var summary models.SummaryByTransactionType
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query summary by ID with relationships
-	if err := tenantDB.Preload("Bookkeeping").
+	if err := tenantDB.Scopes(summaryByTransactionTypeScope(c)).Preload("Bookkeeping").
 		Preload("Type").
 		First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -136,15 +152,14 @@ func (h *SummaryByTransactionTypeHandler) GetByBookkeepingID(c *gin.Context) {
 	var summaries []models.SummaryByTransactionType
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query summaries by bookkeeping ID with relationships
-	if err := tenantDB.Preload("Type").
+	if err := tenantDB.Scopes(summaryByTransactionTypeScope(c)).Preload("Type").
 		Where("bookkeeping_id = ?", bookkeepingID).
 		Find(&summaries).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve summaries", nil)
@@ -175,17 +190,21 @@ func (h *SummaryByTransactionTypeHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// Scoped users may only record summary lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Create summary
 	summary := models.SummaryByTransactionType{
 		BookkeepingID: req.BookkeepingID,
@@ -236,12 +255,11 @@ func (h *SummaryByTransactionTypeHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -249,7 +267,7 @@ func (h *SummaryByTransactionTypeHandler) Update(c *gin.Context) {
 
 	// Check if summary exists
 	var summary models.SummaryByTransactionType
-	if err := tenantDB.First(&summary, id).Error; err != nil {
+	if err := tenantDB.Scopes(summaryByTransactionTypeScope(c)).First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Summary not found", nil)
 			return
@@ -258,6 +276,11 @@ func (h *SummaryByTransactionTypeHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// Scoped users may only record summary lines of bookkeeping at their location
+	if !middleware.RequireParentLocation(c, tenantDB, "bookkeeping", req.BookkeepingID, middleware.LocationTextScope(c, "location_id")) {
+		return
+	}
+
 	// Update fields
 	summary.BookkeepingID = req.BookkeepingID
 	summary.TypeID = req.TypeID
@@ -297,12 +320,11 @@ func (h *SummaryByTransactionTypeHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -310,7 +332,7 @@ func (h *SummaryByTransactionTypeHandler) Delete(c *gin.Context) {
 
 	// Check if summary exists
 	var summary models.SummaryByTransactionType
-	if err := tenantDB.First(&summary, id).Error; err != nil {
+	if err := tenantDB.Scopes(summaryByTransactionTypeScope(c)).First(&summary, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Summary not found", nil)
 			return
@@ -334,3 +356,8 @@ func (h *SummaryByTransactionTypeHandler) Delete(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Summary deleted successfully", nil)
 }
+
+// summaryByTransactionTypeScope limits rows to those of bookkeeping at the caller's location
+func summaryByTransactionTypeScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationTextScope(c, "summary_by_transaction_type.bookkeeping_id", "bookkeeping", "location_id")
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type TenantHandler struct {
+	manager *config.TenantDBManager
+}
+
+func NewTenantHandler(manager *config.TenantDBManager) *TenantHandler {
+	return &TenantHandler{manager: manager}
+}
+
+// GetAll lists the tenants currently known to the registry
+// @Summary Get tenant registry
+// @Description Get the registered tenants, where each came from and whether a connection is open
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.SuccessResponse
+// @Router /so/admin/tenants [get]
+func (h *TenantHandler) GetAll(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "Tenants retrieved successfully", h.manager.ListTenants())
+}
+
+// Refresh reloads the tenant registry immediately instead of waiting for the next poll
+// @Summary Refresh tenant registry
+// @Description Re-read the tenant registry table and apply added or removed tenants
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/admin/tenants/refresh [post]
+func (h *TenantHandler) Refresh(c *gin.Context) {
+	if err := h.manager.RefreshRegistry(); err != nil {
+		if errors.Is(err, config.ErrRegistryNotConfigured) {
+			utils.ErrorResponse(c, http.StatusConflict, "Tenant registry is not configured; set TENANT_REGISTRY_TABLE", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to refresh tenant registry", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Tenant registry refreshed successfully", h.manager.ListTenants())
+}
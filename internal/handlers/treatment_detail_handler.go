@@ -5,25 +5,33 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
-type TreatmentDetailHandler struct {
-	db *gorm.DB
+type TreatmentDetailHandler struct{}
+
+func NewTreatmentDetailHandler() *TreatmentDetailHandler {
+	return &TreatmentDetailHandler{}
 }
 
-func NewTreatmentDetailHandler(db *gorm.DB) *TreatmentDetailHandler {
-	return &TreatmentDetailHandler{db: db}
+// treatmentDetailListSpec is what GET /treatment-details sorts by
+var treatmentDetailListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+	},
+	DefaultSort: "id",
 }
 
 // TreatmentDetailRequest represents the request body for creating/updating a treatment detail
 type TreatmentDetailRequest struct {
-	TreatmentID *int `json:"treatment_id"`
-	ItemID      *int `json:"item_id"`
-	UnitID      *int `json:"unit_id"`
-	Quantity    *int `json:"quantity" binding:"required"`
+	TreatmentID *uuid.UUID `json:"treatment_id"`
+	ItemID      *int       `json:"item_id"`
+	UnitID      *int       `json:"unit_id"`
+	Quantity    *int       `json:"quantity" binding:"required"`
 }
 
 // GetAll retrieves all treatment details with optional filters
@@ -32,40 +40,56 @@ type TreatmentDetailRequest struct {
 // @Tags TreatmentDetail
 // @Accept json
 // @Produce json
-// @Param treatment_id query int false "Filter by treatment ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at)"
+// @Param treatment_id query string false "Filter by treatment ID (UUID)"
 // @Param item_id query int false "Filter by item ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatment-details [get]
 func (h *TreatmentDetailHandler) GetAll(c *gin.Context) {
 	var details []models.TreatmentDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), treatmentDetailListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
-	query := tenantDB.Model(&models.TreatmentDetail{})
+	query := tenantDB.Model(&models.TreatmentDetail{}).Scopes(treatmentDetailScope(c))
 
 	// Apply filters
 	if treatmentID := c.Query("treatment_id"); treatmentID != "" {
-		query = query.Where("treatment_id = ?", treatmentID)
+		id, err := uuid.Parse(treatmentID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid treatment ID", nil)
+			return
+		}
+		query = query.Where("treatment_id = ?", id)
 	}
 	if itemID := c.Query("item_id"); itemID != "" {
 		query = query.Where("item_id = ?", itemID)
 	}
 
 	// Execute query
-	if err := query.Find(&details).Error; err != nil {
+	meta, err := list.Find(query, &details)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve treatment details", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Treatment details retrieved successfully", details)
+	utils.PaginatedResponse(c, http.StatusOK, "Treatment details retrieved successfully", details, meta)
 }
 
 // GetByID retrieves a single treatment detail by ID
@@ -91,15 +115,14 @@ func (h *TreatmentDetailHandler) GetByID(c *gin.Context) {
 	var detail models.TreatmentDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query detail by ID
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	if err := tenantDB.Scopes(treatmentDetailScope(c)).First(&detail, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Treatment detail not found", nil)
 			return
@@ -117,14 +140,14 @@ func (h *TreatmentDetailHandler) GetByID(c *gin.Context) {
 // @Tags TreatmentDetail
 // @Accept json
 // @Produce json
-// @Param treatment_id path int true "Treatment ID"
+// @Param treatment_id path string true "Treatment ID (UUID)"
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatment-details/by-treatment/{treatment_id} [get]
 func (h *TreatmentDetailHandler) GetByTreatmentID(c *gin.Context) {
 	// Parse Treatment ID from URL parameter
-	treatmentID, err := strconv.Atoi(c.Param("treatment_id"))
+	treatmentID, err := uuid.Parse(c.Param("treatment_id"))
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid treatment ID", nil)
 		return
@@ -133,15 +156,14 @@ func (h *TreatmentDetailHandler) GetByTreatmentID(c *gin.Context) {
 	var details []models.TreatmentDetail
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query details by treatment ID
-	if err := tenantDB.Where("treatment_id = ?", treatmentID).Find(&details).Error; err != nil {
+	if err := tenantDB.Scopes(treatmentDetailScope(c)).Where("treatment_id = ?", treatmentID).Find(&details).Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve treatment details", nil)
 		return
 	}
@@ -151,13 +173,14 @@ func (h *TreatmentDetailHandler) GetByTreatmentID(c *gin.Context) {
 
 // Create creates a new treatment detail
 // @Summary Create a new treatment detail
-// @Description Create a new treatment detail
+// @Description Create a new treatment detail. Details of a posted or completed treatment cannot be added.
 // @Tags TreatmentDetail
 // @Accept json
 // @Produce json
 // @Param request body TreatmentDetailRequest true "Treatment Detail data"
 // @Success 201 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatment-details [post]
 func (h *TreatmentDetailHandler) Create(c *gin.Context) {
@@ -170,17 +193,21 @@ func (h *TreatmentDetailHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	// The consumables of a posted or completed treatment are fixed
+	if !h.requireEditable(c, tenantDB, req.TreatmentID) {
+		return
+	}
+
 	// Create treatment detail
 	detail := models.TreatmentDetail{
 		TreatmentID: req.TreatmentID,
@@ -201,7 +228,7 @@ func (h *TreatmentDetailHandler) Create(c *gin.Context) {
 
 // Update updates an existing treatment detail
 // @Summary Update treatment detail
-// @Description Update an existing treatment detail by ID
+// @Description Update an existing treatment detail by ID. Details of a posted or completed treatment cannot be changed.
 // @Tags TreatmentDetail
 // @Accept json
 // @Produce json
@@ -210,6 +237,7 @@ func (h *TreatmentDetailHandler) Create(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatment-details/{id} [put]
 func (h *TreatmentDetailHandler) Update(c *gin.Context) {
@@ -229,12 +257,11 @@ func (h *TreatmentDetailHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -242,7 +269,7 @@ func (h *TreatmentDetailHandler) Update(c *gin.Context) {
 
 	// Check if detail exists
 	var detail models.TreatmentDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	if err := tenantDB.Scopes(treatmentDetailScope(c)).First(&detail, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Treatment detail not found", nil)
 			return
@@ -251,6 +278,11 @@ func (h *TreatmentDetailHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// The consumables of a posted or completed treatment are fixed
+	if !h.requireEditable(c, tenantDB, detail.TreatmentID) || !h.requireEditable(c, tenantDB, req.TreatmentID) {
+		return
+	}
+
 	// Update fields
 	detail.TreatmentID = req.TreatmentID
 	detail.ItemID = req.ItemID
@@ -269,7 +301,7 @@ func (h *TreatmentDetailHandler) Update(c *gin.Context) {
 
 // Delete soft deletes a treatment detail
 // @Summary Delete treatment detail
-// @Description Soft delete a treatment detail by ID
+// @Description Soft delete a treatment detail by ID. Details of a posted or completed treatment cannot be deleted.
 // @Tags TreatmentDetail
 // @Accept json
 // @Produce json
@@ -277,6 +309,7 @@ func (h *TreatmentDetailHandler) Update(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatment-details/{id} [delete]
 func (h *TreatmentDetailHandler) Delete(c *gin.Context) {
@@ -288,12 +321,11 @@ func (h *TreatmentDetailHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
@@ -301,7 +333,7 @@ func (h *TreatmentDetailHandler) Delete(c *gin.Context) {
 
 	// Check if detail exists
 	var detail models.TreatmentDetail
-	if err := tenantDB.First(&detail, id).Error; err != nil {
+	if err := tenantDB.Scopes(treatmentDetailScope(c)).First(&detail, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Treatment detail not found", nil)
 			return
@@ -310,6 +342,11 @@ func (h *TreatmentDetailHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	// The consumables of a posted or completed treatment are fixed
+	if !h.requireEditable(c, tenantDB, detail.TreatmentID) {
+		return
+	}
+
 	// Set deleted_by before soft delete
 	detail.DeletedBy = &userIDInt64
 	if err := tenantDB.Save(&detail).Error; err != nil {
@@ -325,3 +362,40 @@ func (h *TreatmentDetailHandler) Delete(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Treatment detail deleted successfully", nil)
 }
+
+// requireEditable writes a response and returns false when the treatment
+// does not exist at the caller's location, is posted or is completed.
+// Details without a treatment pass unless the caller is location scoped.
+func (h *TreatmentDetailHandler) requireEditable(c *gin.Context, tenantDB *gorm.DB, treatmentID *uuid.UUID) bool {
+	if treatmentID == nil {
+		if middleware.GetLocationID(c) != nil {
+			utils.ForbiddenResponse(c, "Location is outside your assigned location")
+			return false
+		}
+		return true
+	}
+	var treatment models.Treatment
+	if err := tenantDB.Scopes(middleware.LocationScope(c, "location_id")).Select("id", "posteddate", "completed_at").
+		First(&treatment, "id = ?", *treatmentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ValidationErrorResponse(c, []models.ErrorDetail{{Field: "treatment_id", Message: "Treatment not found"}})
+			return false
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve treatment", err.Error())
+		return false
+	}
+	if treatment.PostedDate != nil {
+		utils.ErrorResponse(c, http.StatusConflict, "Details of a posted treatment cannot be changed", nil)
+		return false
+	}
+	if treatment.CompletedAt != nil {
+		utils.ErrorResponse(c, http.StatusConflict, "Details of a completed treatment cannot be changed", nil)
+		return false
+	}
+	return true
+}
+
+// treatmentDetailScope limits details to those of treatments at the caller's location
+func treatmentDetailScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return middleware.ParentLocationScope(c, "treatment_detail.treatment_id", "treatment", "location_id")
+}
@@ -1,42 +1,63 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
 	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/services"
 	"pos-mojosoft-so-service/internal/utils"
 )
 
 type TreatmentHandler struct {
-	db *gorm.DB
+	numbering *services.DocumentNumbering
+	sessions  *services.SessionRedemption
+	stock     *services.ConsumableStock
+	workflow  *services.TreatmentWorkflow
 }
 
-func NewTreatmentHandler(db *gorm.DB) *TreatmentHandler {
-	return &TreatmentHandler{db: db}
+func NewTreatmentHandler(numbering *services.DocumentNumbering, sessions *services.SessionRedemption, stock *services.ConsumableStock, workflow *services.TreatmentWorkflow) *TreatmentHandler {
+	return &TreatmentHandler{numbering: numbering, sessions: sessions, stock: stock, workflow: workflow}
+}
+
+// treatmentListSpec is what GET /treatments sorts, searches and filters by
+var treatmentListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at":  "created_at",
+		"doc_date":    "docdate",
+		"doc_number":  "docnumber",
+		"posted_date": "posteddate",
+	},
+	DefaultSort: "-doc_date",
+	Search:      []string{"docnumber", "note"},
+	DateRanges: map[string]string{
+		"doc_date":    "docdate",
+		"posted_date": "posteddate",
+	},
 }
 
 // CreateTreatmentRequest represents the request body for creating a treatment
 type CreateTreatmentRequest struct {
-	LocationID          *int                         `json:"location_id"`
-	CustomerID          *int                         `json:"customer_id"`
-	SalesOrderID        *int                         `json:"sales_order_id"`
-	SalesOrderDetailID  *int                         `json:"sales_order_detail_id"`
-	SalesOrderServiceID *int                         `json:"sales_order_service_id"`
-	ServiceID           *int                         `json:"service_id"`
-	PatientID           *int                         `json:"patient_id"`
-	DoctorID            *int                         `json:"doctor_id"`
-	NurseID             *int                         `json:"nurse_id"`
-	BeauticianID        *int                         `json:"beautician_id"`
-	DocNumber           *string                      `json:"doc_number"`
-	DocDate             *string                      `json:"doc_date"`
-	PostedDate          *string                      `json:"posted_date"`
-	ServiceText         *string                      `json:"service_text"`
-	Note                *string                      `json:"note"`
-	StatusID            *int                         `json:"status_id"`
+	LocationID          *int                           `json:"location_id"`
+	CustomerID          *int                           `json:"customer_id"`
+	SalesOrderID        *uuid.UUID                     `json:"sales_order_id"`
+	SalesOrderDetailID  *int                           `json:"sales_order_detail_id"`
+	SalesOrderServiceID *int                           `json:"sales_order_service_id"`
+	ServiceID           *int                           `json:"service_id"`
+	PatientID           *int                           `json:"patient_id"`
+	DoctorID            *int                           `json:"doctor_id"`
+	NurseID             *int                           `json:"nurse_id"`
+	BeauticianID        *int                           `json:"beautician_id"`
+	DocDate             *string                        `json:"doc_date"`
+	PostedDate          *string                        `json:"posted_date"`
+	ServiceText         *string                        `json:"service_text"`
+	Note                *string                        `json:"note"`
+	OverrideExpiry      bool                           `json:"override_expiry"`
 	Details             []CreateTreatmentDetailRequest `json:"details"`
 }
 
@@ -46,6 +67,27 @@ type CreateTreatmentDetailRequest struct {
 	Quantity *int `json:"quantity"`
 }
 
+// TreatmentStaffRequest assigns staff as a treatment moves through its
+// workflow; omitted fields keep the staff already assigned
+type TreatmentStaffRequest struct {
+	DoctorID     *int `json:"doctor_id"`
+	NurseID      *int `json:"nurse_id"`
+	BeauticianID *int `json:"beautician_id"`
+}
+
+// CorrectTreatmentRequest represents the request body for correcting a
+// completed treatment. Every field is replaced, as with an update.
+type CorrectTreatmentRequest struct {
+	Reason       string  `json:"reason" binding:"required"`
+	PatientID    *int    `json:"patient_id"`
+	ServiceID    *int    `json:"service_id"`
+	DoctorID     *int    `json:"doctor_id"`
+	NurseID      *int    `json:"nurse_id"`
+	BeauticianID *int    `json:"beautician_id"`
+	ServiceText  *string `json:"service_text"`
+	Note         *string `json:"note"`
+}
+
 // GetAll retrieves all treatments with optional filters
 // @Summary Get all treatments
 // @Description Get list of all treatments with optional pagination and filters
@@ -53,26 +95,40 @@ type CreateTreatmentDetailRequest struct {
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number" default(1)
-// @Param limit query int false "Items per page" default(10)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, doc_date, doc_number, posted_date)"
+// @Param search query string false "Search document number and note (case-insensitive substring)"
 // @Param status_id query int false "Filter by status ID"
 // @Param patient_id query int false "Filter by patient ID"
 // @Param doctor_id query int false "Filter by doctor ID"
-// @Success 200 {object} utils.SuccessResponse
+// @Param doc_number query string false "Search by document number, e.g. TR/JKT/2026"
+// @Param doc_date_from query string false "Document date on or after (YYYY-MM-DD)"
+// @Param doc_date_to query string false "Document date on or before (YYYY-MM-DD)"
+// @Param posted_date_from query string false "Posted date on or after (YYYY-MM-DD)"
+// @Param posted_date_to query string false "Posted date on or before (YYYY-MM-DD)"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatments [get]
 func (h *TreatmentHandler) GetAll(c *gin.Context) {
 	var treatments []models.Treatment
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), treatmentListSpec)
+	if !ok {
+		return
+	}
 
 	// Build query
-	query := tenantDB.Model(&models.Treatment{})
+	query := tenantDB.Model(&models.Treatment{}).Scopes(middleware.LocationScope(c, "location_id"))
 
 	// Apply filters
 	if statusID := c.Query("status_id"); statusID != "" {
@@ -84,17 +140,18 @@ func (h *TreatmentHandler) GetAll(c *gin.Context) {
 	if doctorID := c.Query("doctor_id"); doctorID != "" {
 		query = query.Where("doctor_id = ?", doctorID)
 	}
-
-	// Preload relationships
-	query = query.Preload("Details")
+	if docNumber := c.Query("doc_number"); docNumber != "" {
+		query = query.Where("docnumber ILIKE ?", "%"+docNumber+"%")
+	}
 
 	// Execute query
-	if err := query.Find(&treatments).Error; err != nil {
+	meta, err := list.Find(query, &treatments, "Status", "Details")
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve treatments", nil)
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Treatments retrieved successfully", treatments)
+	utils.PaginatedResponse(c, http.StatusOK, "Treatments retrieved successfully", treatments, meta)
 }
 
 // GetByID retrieves a single treatment by ID
@@ -120,15 +177,14 @@ func (h *TreatmentHandler) GetByID(c *gin.Context) {
 	var treatment models.Treatment
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Query treatment by ID with relationships
-	if err := tenantDB.Preload("Details").
+	if err := tenantDB.Scopes(middleware.LocationScope(c, "location_id")).Preload("Status").Preload("Details").
 		First(&treatment, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Treatment not found", nil)
@@ -143,13 +199,16 @@ func (h *TreatmentHandler) GetByID(c *gin.Context) {
 
 // Create creates a new treatment
 // @Summary Create a new treatment
-// @Description Create a new treatment with details
+// @Description Create a new scheduled treatment with details. A treatment against a package line (sales_order_detail_id) redeems its next session; override_expiry lets a manager redeem an expired package. A treatment created with a posted_date stocks out its consumables.
 // @Tags Treatment
 // @Accept json
 // @Produce json
 // @Param request body CreateTreatmentRequest true "Treatment data"
 // @Success 201 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatments [post]
 func (h *TreatmentHandler) Create(c *gin.Context) {
@@ -162,35 +221,44 @@ func (h *TreatmentHandler) Create(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context (set by auth middleware)
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Parse dates
-	var docDate, postedDate *time.Time
-	if req.DocDate != nil {
-		parsedDate, err := time.Parse("2006-01-02", *req.DocDate)
-		if err == nil {
-			docDate = &parsedDate
-		}
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationID(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return
 	}
-	if req.PostedDate != nil {
-		parsedDate, err := time.Parse("2006-01-02", *req.PostedDate)
-		if err == nil {
-			postedDate = &parsedDate
-		}
+
+	// Parse dates in the tenant's timezone; the document date defaults to today
+	timeZone := middleware.GetTenantTimeZone(c)
+	dates := utils.NewDateParser(timeZone)
+	docDate := dates.Optional("doc_date", req.DocDate)
+	postedDate := dates.Optional("posted_date", req.PostedDate)
+	if dates.Failed(c) {
+		return
+	}
+	today := utils.Today(timeZone)
+	if docDate == nil {
+		docDate = &today
+	}
+
+	// Only managers may redeem sessions of an expired package
+	if !h.allowExpiryOverride(c, req.OverrideExpiry) {
+		return
 	}
 
 	// Create treatment
 	treatment := models.Treatment{
-		LocationID:          req.LocationID,
+		LocationID:          locationID,
 		CustomerID:          req.CustomerID,
 		SalesOrderID:        req.SalesOrderID,
 		SalesOrderDetailID:  req.SalesOrderDetailID,
@@ -200,12 +268,10 @@ func (h *TreatmentHandler) Create(c *gin.Context) {
 		DoctorID:            req.DoctorID,
 		NurseID:             req.NurseID,
 		BeauticianID:        req.BeauticianID,
-		DocNumber:           req.DocNumber,
 		DocDate:             docDate,
 		PostedDate:          postedDate,
 		ServiceText:         req.ServiceText,
 		Note:                req.Note,
-		StatusID:            req.StatusID,
 		CreatedBy:           &userIDInt64,
 	}
 
@@ -217,6 +283,35 @@ func (h *TreatmentHandler) Create(c *gin.Context) {
 		}
 	}()
 
+	// Allocate the document number in this transaction so it is never shared or skipped
+	number, err := h.numbering.Next(tx, services.DocumentTreatment, locationID, *docDate)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to allocate document number", err.Error())
+		return
+	}
+	treatment.DocNumber = &number.Formatted
+
+	// New treatments start out scheduled
+	scheduledStatusID, err := h.workflow.ScheduledStatusID(tx)
+	if err != nil {
+		tx.Rollback()
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to resolve treatment status", err.Error())
+		return
+	}
+	treatment.StatusID = &scheduledStatusID
+
+	// Redeem a session when the treatment is booked against a package line
+	if req.SalesOrderDetailID != nil {
+		redemption, err := h.sessions.Redeem(tx, *req.SalesOrderDetailID, req.CustomerID, userIDInt64, today, req.OverrideExpiry, middleware.LocationScope(c, "location_id"))
+		if err != nil {
+			tx.Rollback()
+			h.serviceError(c, err, "Failed to redeem package session")
+			return
+		}
+		applyRedemption(&treatment, redemption, userIDInt64)
+	}
+
 	// Create treatment
 	if err := tx.Create(&treatment).Error; err != nil {
 		tx.Rollback()
@@ -228,10 +323,11 @@ func (h *TreatmentHandler) Create(c *gin.Context) {
 	if len(req.Details) > 0 {
 		for _, detailReq := range req.Details {
 			detail := models.TreatmentDetail{
-				ItemID:    detailReq.ItemID,
-				UnitID:    detailReq.UnitID,
-				Quantity:  detailReq.Quantity,
-				CreatedBy: &userIDInt64,
+				TreatmentID: &treatment.ID,
+				ItemID:      detailReq.ItemID,
+				UnitID:      detailReq.UnitID,
+				Quantity:    detailReq.Quantity,
+				CreatedBy:   &userIDInt64,
 			}
 			if err := tx.Create(&detail).Error; err != nil {
 				tx.Rollback()
@@ -241,6 +337,13 @@ func (h *TreatmentHandler) Create(c *gin.Context) {
 		}
 	}
 
+	// Stock out the consumables of a posted treatment
+	if err := h.stock.Issue(tx, &treatment, userIDInt64); err != nil {
+		tx.Rollback()
+		h.serviceError(c, err, "Failed to stock out treatment consumables")
+		return
+	}
+
 	// Commit transaction
 	if err := tx.Commit().Error; err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to commit transaction", err.Error())
@@ -248,14 +351,14 @@ func (h *TreatmentHandler) Create(c *gin.Context) {
 	}
 
 	// Load the created treatment with relationships
-	tenantDB.Preload("Details").First(&treatment, "id = ?", treatment.ID)
+	tenantDB.Preload("Status").Preload("Details").First(&treatment, "id = ?", treatment.ID)
 
 	utils.SuccessResponse(c, http.StatusCreated, "Treatment created successfully", treatment)
 }
 
 // Update updates an existing treatment
 // @Summary Update treatment
-// @Description Update an existing treatment by ID
+// @Description Update an existing treatment by ID. Setting posted_date posts the treatment and stocks out its consumables; the posted date of a posted treatment cannot be changed. Completed treatments are changed through a correction; the status changes through the workflow endpoints.
 // @Tags Treatment
 // @Accept json
 // @Produce json
@@ -263,7 +366,9 @@ func (h *TreatmentHandler) Create(c *gin.Context) {
 // @Param request body CreateTreatmentRequest true "Treatment data"
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
+// @Failure 403 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatments/{id} [put]
 func (h *TreatmentHandler) Update(c *gin.Context) {
@@ -283,77 +388,149 @@ func (h *TreatmentHandler) Update(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
-	// Check if treatment exists
-	var treatment models.Treatment
-	if err := tenantDB.First(&treatment, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			utils.ErrorResponse(c, http.StatusNotFound, "Treatment not found", nil)
-			return
-		}
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve treatment", nil)
+	// Scoped users may only write records for their own location
+	locationID, ok := middleware.ResolveLocationID(c, req.LocationID)
+	if !ok {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
 		return
 	}
 
-	// Parse dates
-	var docDate, postedDate *time.Time
-	if req.DocDate != nil {
-		parsedDate, err := time.Parse("2006-01-02", *req.DocDate)
-		if err == nil {
-			docDate = &parsedDate
-		}
+	// Parse dates in the tenant's timezone; an omitted document date is kept
+	dates := utils.NewDateParser(middleware.GetTenantTimeZone(c))
+	docDate := dates.Optional("doc_date", req.DocDate)
+	postedDate := dates.Optional("posted_date", req.PostedDate)
+	if dates.Failed(c) {
+		return
 	}
-	if req.PostedDate != nil {
-		parsedDate, err := time.Parse("2006-01-02", *req.PostedDate)
-		if err == nil {
-			postedDate = &parsedDate
-		}
+
+	// Only managers may redeem sessions of an expired package
+	if !h.allowExpiryOverride(c, req.OverrideExpiry) {
+		return
 	}
 
-	// Update fields
-	treatment.LocationID = req.LocationID
-	treatment.CustomerID = req.CustomerID
-	treatment.SalesOrderID = req.SalesOrderID
-	treatment.SalesOrderDetailID = req.SalesOrderDetailID
-	treatment.SalesOrderServiceID = req.SalesOrderServiceID
-	treatment.ServiceID = req.ServiceID
-	treatment.PatientID = req.PatientID
-	treatment.DoctorID = req.DoctorID
-	treatment.NurseID = req.NurseID
-	treatment.BeauticianID = req.BeauticianID
-	treatment.DocNumber = req.DocNumber
-	treatment.DocDate = docDate
-	treatment.PostedDate = postedDate
-	treatment.ServiceText = req.ServiceText
-	treatment.Note = req.Note
-	treatment.StatusID = req.StatusID
-	treatment.UpdatedBy = &userIDInt64
+	// Lock the treatment and write only its editable columns, redeeming and
+	// stocking out in the same transaction, so a concurrent Complete or
+	// SignOff is never overwritten
+	var treatment *models.Treatment
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		// A completed treatment is a clinical record and only changes through a correction
+		var err error
+		treatment, err = h.workflow.LockEditable(tx, id, middleware.LocationScope(c, "location_id"))
+		if err != nil {
+			return err
+		}
+		if docDate == nil {
+			docDate = treatment.DocDate
+		}
+
+		// A posted treatment keeps its posted date; posting one stocks out its consumables
+		posting := treatment.PostedDate == nil && postedDate != nil
+		if treatment.PostedDate != nil {
+			if postedDate != nil && postedDate.Format("2006-01-02") != treatment.PostedDate.Format("2006-01-02") {
+				return services.ValidationErrors{{
+					Field:   "posted_date",
+					Message: "Posted date of a posted treatment cannot be changed",
+				}}
+			}
+			postedDate = treatment.PostedDate
+		}
+
+		// The package links of a redeemed treatment are fixed; linking a
+		// treatment to a different package line redeems a session of it
+		redeem := false
+		if treatment.SessionNumber != nil {
+			if req.SalesOrderDetailID != nil && *req.SalesOrderDetailID != *treatment.SalesOrderDetailID {
+				return services.ValidationErrors{{
+					Field:   "sales_order_detail_id",
+					Message: "Package line of a treatment that redeemed a session cannot be changed",
+				}}
+			}
+		} else {
+			redeem = req.SalesOrderDetailID != nil &&
+				(treatment.SalesOrderDetailID == nil || *treatment.SalesOrderDetailID != *req.SalesOrderDetailID)
+			treatment.CustomerID = req.CustomerID
+			treatment.SalesOrderID = req.SalesOrderID
+			treatment.SalesOrderDetailID = req.SalesOrderDetailID
+		}
+
+		// Update fields
+		treatment.LocationID = locationID
+		treatment.SalesOrderServiceID = req.SalesOrderServiceID
+		treatment.ServiceID = req.ServiceID
+		treatment.PatientID = req.PatientID
+		treatment.DoctorID = req.DoctorID
+		treatment.NurseID = req.NurseID
+		treatment.BeauticianID = req.BeauticianID
+		treatment.DocDate = docDate
+		treatment.PostedDate = postedDate
+		treatment.ServiceText = req.ServiceText
+		treatment.Note = req.Note
+		treatment.UpdatedBy = &userIDInt64
+
+		if redeem {
+			today := utils.Today(middleware.GetTenantTimeZone(c))
+			redemption, err := h.sessions.Redeem(tx, *treatment.SalesOrderDetailID, treatment.CustomerID, userIDInt64, today, req.OverrideExpiry, middleware.LocationScope(c, "location_id"))
+			if err != nil {
+				return err
+			}
+			applyRedemption(treatment, redemption, userIDInt64)
+		}
 
-	// Save updates
-	if err := tenantDB.Save(&treatment).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update treatment", err.Error())
+		// The status and its timestamps only change through the workflow
+		if err := tx.Model(treatment).Updates(map[string]interface{}{
+			"location_id":          treatment.LocationID,
+			"costumer_id":          treatment.CustomerID,
+			"salesorder_id":        treatment.SalesOrderID,
+			"salesorderdetail_id":  treatment.SalesOrderDetailID,
+			"salesorderservice_id": treatment.SalesOrderServiceID,
+			"service_id":           treatment.ServiceID,
+			"patient_id":           treatment.PatientID,
+			"doctor_id":            treatment.DoctorID,
+			"nurse_id":             treatment.NurseID,
+			"beautician_id":        treatment.BeauticianID,
+			"docdate":              treatment.DocDate,
+			"posteddate":           treatment.PostedDate,
+			"servicetext":          treatment.ServiceText,
+			"sessionnumber":        treatment.SessionNumber,
+			"expiryoverride_by":    treatment.ExpiryOverrideBy,
+			"note":                 treatment.Note,
+			"updated_by":           treatment.UpdatedBy,
+		}).Error; err != nil {
+			return err
+		}
+		if posting {
+			return h.stock.Issue(tx, treatment, userIDInt64)
+		}
+		return nil
+	})
+	if errors.Is(err, services.ErrTreatmentCompleted) {
+		utils.ErrorResponse(c, http.StatusConflict, "A completed treatment can only be changed through a correction", nil)
+		return
+	}
+	if err != nil {
+		h.serviceError(c, err, "Failed to update treatment")
 		return
 	}
 
 	// Load updated treatment with relationships
-	tenantDB.Preload("Details").First(&treatment, "id = ?", treatment.ID)
+	tenantDB.Preload("Status").Preload("Details").First(treatment, "id = ?", treatment.ID)
 
 	utils.SuccessResponse(c, http.StatusOK, "Treatment updated successfully", treatment)
 }
 
 // Delete soft deletes a treatment
 // @Summary Delete treatment
-// @Description Soft delete a treatment by ID
+// @Description Soft delete a treatment by ID. Its redeemed session is returned to the package and the stock-outs of its consumables are reversed. Completed treatments cannot be deleted.
 // @Tags Treatment
 // @Accept json
 // @Produce json
@@ -361,6 +538,7 @@ func (h *TreatmentHandler) Update(c *gin.Context) {
 // @Success 200 {object} utils.SuccessResponse
 // @Failure 400 {object} utils.ErrorResponse
 // @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
 // @Failure 500 {object} utils.ErrorResponse
 // @Router /so/api/treatments/{id} [delete]
 func (h *TreatmentHandler) Delete(c *gin.Context) {
@@ -372,20 +550,250 @@ func (h *TreatmentHandler) Delete(c *gin.Context) {
 	}
 
 	// Get tenant DB from context
-	db, exists := c.Get("tenantDB")
-	if !exists {
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Lock the treatment, return its redeemed session to the package,
+	// reverse the stock-outs, set deleted_by and soft delete. A treatment
+	// deleted or completed by a concurrent request is found that way here.
+	today := utils.Today(middleware.GetTenantTimeZone(c))
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		// A completed treatment is a clinical record and is kept
+		treatment, err := h.workflow.LockEditable(tx, id, middleware.LocationScope(c, "location_id"))
+		if err != nil {
+			return err
+		}
+		if err := h.sessions.Release(tx, treatment, userIDInt64); err != nil {
+			return err
+		}
+		if err := h.stock.Reverse(tx, treatment, userIDInt64, today); err != nil {
+			return err
+		}
+		if err := tx.Model(treatment).UpdateColumn("deleted_by", userIDInt64).Error; err != nil {
+			return err
+		}
+		return tx.Delete(treatment).Error
+	})
+	if errors.Is(err, services.ErrTreatmentCompleted) {
+		utils.ErrorResponse(c, http.StatusConflict, "A completed treatment cannot be deleted", nil)
+		return
+	}
+	if err != nil {
+		h.serviceError(c, err, "Failed to delete treatment")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Treatment deleted successfully", nil)
+}
+
+// Start moves a scheduled treatment to in progress
+// @Summary Start treatment
+// @Description Start a scheduled treatment. A doctor or beautician must be assigned, in the body or before.
+// @Tags Treatment
+// @Accept json
+// @Produce json
+// @Param id path string true "Treatment ID (UUID)"
+// @Param request body TreatmentStaffRequest false "Staff to assign"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/treatments/{id}/start [patch]
+func (h *TreatmentHandler) Start(c *gin.Context) {
+	h.fire(c, services.TreatmentEventStart, "Treatment started successfully")
+}
+
+// Complete moves a treatment in progress to completed
+// @Summary Complete treatment
+// @Description Complete a treatment in progress. The linked sales order service is marked treated and the completion time is stamped. A doctor or beautician must be assigned.
+// @Tags Treatment
+// @Accept json
+// @Produce json
+// @Param id path string true "Treatment ID (UUID)"
+// @Param request body TreatmentStaffRequest false "Staff to assign"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/treatments/{id}/complete [patch]
+func (h *TreatmentHandler) Complete(c *gin.Context) {
+	h.fire(c, services.TreatmentEventComplete, "Treatment completed successfully")
+}
+
+// SignOff moves a completed treatment to signed off
+// @Summary Sign off treatment
+// @Description Sign off a completed treatment. A doctor must be assigned; the signing user and time are recorded.
+// @Tags Treatment
+// @Accept json
+// @Produce json
+// @Param id path string true "Treatment ID (UUID)"
+// @Param request body TreatmentStaffRequest false "Staff to assign"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/treatments/{id}/sign-off [patch]
+func (h *TreatmentHandler) SignOff(c *gin.Context) {
+	h.fire(c, services.TreatmentEventSignOff, "Treatment signed off successfully")
+}
+
+// fire applies a workflow event to the treatment in the URL
+func (h *TreatmentHandler) fire(c *gin.Context, event services.TreatmentEvent, message string) {
+	// Parse UUID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid treatment ID", nil)
+		return
+	}
+
+	// The body is optional
+	var req TreatmentStaffRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	staff := services.TreatmentStaff{
+		DoctorID:     req.DoctorID,
+		NurseID:      req.NurseID,
+		BeauticianID: req.BeauticianID,
+	}
+
+	var treatment *models.Treatment
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		treatment, err = h.workflow.Fire(tx, id, event, staff, userIDInt64, time.Now(), middleware.LocationScope(c, "location_id"))
+		return err
+	})
+	if err != nil {
+		h.serviceError(c, err, "Failed to change treatment status")
+		return
+	}
+
+	// Load the treatment with relationships
+	tenantDB.Preload("Status").Preload("Details").First(treatment, "id = ?", treatment.ID)
+
+	utils.SuccessResponse(c, http.StatusOK, message, treatment)
+}
+
+// Correct changes a completed treatment and keeps the original
+// @Summary Correct treatment
+// @Description Correct the staff, patient, service or notes of a completed or signed off treatment. The treatment as it was and as it became are kept as a correction; the status and its timestamps do not change.
+// @Tags Treatment
+// @Accept json
+// @Produce json
+// @Param id path string true "Treatment ID (UUID)"
+// @Param request body CorrectTreatmentRequest true "Corrected treatment data"
+// @Success 201 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/treatments/{id}/corrections [post]
+func (h *TreatmentHandler) Correct(c *gin.Context) {
+	// Parse UUID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid treatment ID", nil)
+		return
+	}
+
+	var req CorrectTreatmentRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
 		return
 	}
-	tenantDB := db.(*gorm.DB)
 
 	// Get user ID from context
 	userID, _ := c.Get("user_id")
 	userIDInt64 := int64(userID.(uint))
 
+	change := services.TreatmentChange{
+		PatientID:    req.PatientID,
+		ServiceID:    req.ServiceID,
+		DoctorID:     req.DoctorID,
+		NurseID:      req.NurseID,
+		BeauticianID: req.BeauticianID,
+		ServiceText:  req.ServiceText,
+		Note:         req.Note,
+	}
+
+	var correction *models.TreatmentCorrection
+	err = tenantDB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, correction, err = h.workflow.Correct(tx, id, change, req.Reason, userIDInt64, middleware.LocationScope(c, "location_id"))
+		return err
+	})
+	if err != nil {
+		h.serviceError(c, err, "Failed to correct treatment")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Treatment corrected successfully", correction)
+}
+
+// GetCorrections retrieves the corrections of a treatment
+// @Summary Get treatment corrections
+// @Description Get the corrections of a treatment, oldest first. The original of the first correction is the treatment as it was completed.
+// @Tags Treatment
+// @Accept json
+// @Produce json
+// @Param id path string true "Treatment ID (UUID)"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/treatments/{id}/corrections [get]
+func (h *TreatmentHandler) GetCorrections(c *gin.Context) {
+	// Parse UUID from URL parameter
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid treatment ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
 	// Check if treatment exists
 	var treatment models.Treatment
-	if err := tenantDB.First(&treatment, "id = ?", id).Error; err != nil {
+	if err := tenantDB.Scopes(middleware.LocationScope(c, "location_id")).Select("id").First(&treatment, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			utils.ErrorResponse(c, http.StatusNotFound, "Treatment not found", nil)
 			return
@@ -394,18 +802,59 @@ func (h *TreatmentHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	// Set deleted_by before soft delete
-	treatment.DeletedBy = &userIDInt64
-	if err := tenantDB.Save(&treatment).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+	var corrections []models.TreatmentCorrection
+	if err := tenantDB.Where("treatment_id = ?", id).Order("id").Find(&corrections).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve treatment corrections", nil)
 		return
 	}
 
-	// Soft delete
-	if err := tenantDB.Delete(&treatment).Error; err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete treatment", err.Error())
-		return
+	utils.SuccessResponse(c, http.StatusOK, "Treatment corrections retrieved successfully", corrections)
+}
+
+// applyRedemption links a treatment to the package session it redeemed and
+// records the user who overrode an expired package
+func applyRedemption(treatment *models.Treatment, redemption *services.Redemption, userID int64) {
+	if redemption.ExpiryOverridden {
+		treatment.ExpiryOverrideBy = &userID
+	}
+	treatment.SalesOrderID = &redemption.Order.ID
+	treatment.SalesOrderDetailID = &redemption.Detail.ID
+	treatment.SessionNumber = &redemption.SessionNumber
+	if redemption.Order.CustomerID != nil {
+		treatment.CustomerID = redemption.Order.CustomerID
 	}
+}
 
-	utils.SuccessResponse(c, http.StatusOK, "Treatment deleted successfully", nil)
+// allowExpiryOverride writes a forbidden response and returns false when an
+// expiry override is requested without the override permission
+func (h *TreatmentHandler) allowExpiryOverride(c *gin.Context, override bool) bool {
+	if override && !middleware.HasPermission(c, middleware.PermissionTreatmentOverride) {
+		utils.ForbiddenResponse(c, "Overriding package expiry requires the "+middleware.PermissionTreatmentOverride+" permission")
+		return false
+	}
+	return true
+}
+
+// serviceError maps redemption, stock and workflow errors onto 400, 404
+// and 409 responses
+func (h *TreatmentHandler) serviceError(c *gin.Context, err error, message string) {
+	var validationErrs services.ValidationErrors
+	var sessionErr *services.SessionError
+	var workflowErr *services.WorkflowError
+	switch {
+	case errors.As(err, &validationErrs):
+		utils.ValidationErrorResponse(c, validationErrs)
+	case errors.Is(err, services.ErrSalesOrderDetailNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Sales order detail not found", nil)
+	case errors.Is(err, services.ErrTreatmentNotFound):
+		utils.ErrorResponse(c, http.StatusNotFound, "Treatment not found", nil)
+	case errors.As(err, &sessionErr):
+		utils.ErrorResponse(c, http.StatusConflict, sessionErr.Error(), nil)
+	case errors.As(err, &workflowErr):
+		utils.ErrorResponse(c, http.StatusConflict, workflowErr.Error(), nil)
+	case errors.Is(err, services.ErrLinkedServiceNotFound):
+		utils.ErrorResponse(c, http.StatusConflict, "Sales order service of the treatment not found", nil)
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, message, err.Error())
+	}
 }
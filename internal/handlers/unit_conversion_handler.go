@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/middleware"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+type UnitConversionHandler struct{}
+
+func NewUnitConversionHandler() *UnitConversionHandler {
+	return &UnitConversionHandler{}
+}
+
+// unitConversionListSpec is what GET /unit-conversions sorts and searches by
+var unitConversionListSpec = utils.ListSpec{
+	Sorts: map[string]string{
+		"created_at": "created_at",
+		"item_id":    "item_id",
+		"unit_id":    "unit_id",
+	},
+	Search: []string{"note"},
+}
+
+// UnitConversionRequest represents the request body for creating/updating a
+// unit conversion. Without item_id the conversion applies to every item.
+type UnitConversionRequest struct {
+	ItemID     *int    `json:"item_id"`
+	UnitID     int     `json:"unit_id" binding:"required"`
+	BaseUnitID int     `json:"base_unit_id" binding:"required"`
+	Factor     int     `json:"factor" binding:"required"`
+	Note       *string `json:"note"`
+}
+
+// GetAll retrieves all unit conversions
+// @Summary Get all unit conversions
+// @Description Get list of unit conversions with optional filters
+// @Tags UnitConversion
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Items per page, at most 100 (limit is accepted as an alias)" default(20)
+// @Param cursor query string false "Cursor from pagination.next_cursor; send it empty to start cursor pagination"
+// @Param sort query string false "Sort field, prefixed with - for descending (id, created_at, item_id, unit_id)"
+// @Param search query string false "Search note (case-insensitive substring)"
+// @Param item_id query int false "Filter by item ID"
+// @Param unit_id query int false "Filter by unit ID"
+// @Success 200 {object} utils.PaginatedResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/unit-conversions [get]
+func (h *UnitConversionHandler) GetAll(c *gin.Context) {
+	var conversions []models.UnitConversion
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Parse pagination, sorting and filters
+	list, ok := utils.ParseListQuery(c, middleware.GetTenantTimeZone(c), unitConversionListSpec)
+	if !ok {
+		return
+	}
+
+	// Build query
+	query := tenantDB.Model(&models.UnitConversion{})
+
+	// Apply filters
+	if itemID := c.Query("item_id"); itemID != "" {
+		query = query.Where("item_id = ?", itemID)
+	}
+	if unitID := c.Query("unit_id"); unitID != "" {
+		query = query.Where("unit_id = ?", unitID)
+	}
+
+	// Execute query
+	meta, err := list.Find(query, &conversions)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve unit conversions", nil)
+		return
+	}
+
+	utils.PaginatedResponse(c, http.StatusOK, "Unit conversions retrieved successfully", conversions, meta)
+}
+
+// GetByID retrieves a single unit conversion by ID
+// @Summary Get unit conversion by ID
+// @Description Get a single unit conversion by its ID
+// @Tags UnitConversion
+// @Accept json
+// @Produce json
+// @Param id path int true "Unit Conversion ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/unit-conversions/{id} [get]
+func (h *UnitConversionHandler) GetByID(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid unit conversion ID", nil)
+		return
+	}
+
+	var conversion models.UnitConversion
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Query unit conversion by ID
+	if err := tenantDB.First(&conversion, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Unit conversion not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve unit conversion", nil)
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Unit conversion retrieved successfully", conversion)
+}
+
+// Create creates a new unit conversion
+// @Summary Create a new unit conversion
+// @Description Create a unit conversion for an item, or for every item when item_id is omitted. factor is the number of base units in one unit.
+// @Tags UnitConversion
+// @Accept json
+// @Produce json
+// @Param request body UnitConversionRequest true "Unit conversion data"
+// @Success 201 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/unit-conversions [post]
+func (h *UnitConversionHandler) Create(c *gin.Context) {
+	var req UnitConversionRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if errs := validateUnitConversion(&req); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context (set by auth middleware)
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	if !h.requireUnique(c, tenantDB, &req, 0) {
+		return
+	}
+
+	// Create unit conversion
+	conversion := models.UnitConversion{
+		ItemID:     req.ItemID,
+		UnitID:     req.UnitID,
+		BaseUnitID: req.BaseUnitID,
+		Factor:     req.Factor,
+		Note:       req.Note,
+		CreatedBy:  &userIDInt64,
+	}
+
+	if err := tenantDB.Create(&conversion).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to create unit conversion", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Unit conversion created successfully", conversion)
+}
+
+// Update updates an existing unit conversion
+// @Summary Update unit conversion
+// @Description Update a unit conversion by ID. Stock movements already written keep their quantities.
+// @Tags UnitConversion
+// @Accept json
+// @Produce json
+// @Param id path int true "Unit Conversion ID"
+// @Param request body UnitConversionRequest true "Unit conversion data"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 409 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/unit-conversions/{id} [put]
+func (h *UnitConversionHandler) Update(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid unit conversion ID", nil)
+		return
+	}
+
+	var req UnitConversionRequest
+
+	// Bind and validate request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+	if errs := validateUnitConversion(&req); len(errs) > 0 {
+		utils.ValidationErrorResponse(c, errs)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if unit conversion exists
+	var conversion models.UnitConversion
+	if err := tenantDB.First(&conversion, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Unit conversion not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve unit conversion", nil)
+		return
+	}
+
+	if !h.requireUnique(c, tenantDB, &req, conversion.ID) {
+		return
+	}
+
+	// Update fields
+	conversion.ItemID = req.ItemID
+	conversion.UnitID = req.UnitID
+	conversion.BaseUnitID = req.BaseUnitID
+	conversion.Factor = req.Factor
+	conversion.Note = req.Note
+	conversion.UpdatedBy = &userIDInt64
+
+	// Save updates
+	if err := tenantDB.Save(&conversion).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update unit conversion", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Unit conversion updated successfully", conversion)
+}
+
+// Delete soft deletes a unit conversion
+// @Summary Delete unit conversion
+// @Description Soft delete a unit conversion by ID
+// @Tags UnitConversion
+// @Accept json
+// @Produce json
+// @Param id path int true "Unit Conversion ID"
+// @Success 200 {object} utils.SuccessResponse
+// @Failure 400 {object} utils.ErrorResponse
+// @Failure 404 {object} utils.ErrorResponse
+// @Failure 500 {object} utils.ErrorResponse
+// @Router /so/api/unit-conversions/{id} [delete]
+func (h *UnitConversionHandler) Delete(c *gin.Context) {
+	// Parse ID from URL parameter
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid unit conversion ID", nil)
+		return
+	}
+
+	// Get tenant DB from context
+	tenantDB, err := middleware.GetTenantDB(c)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Database connection not found", nil)
+		return
+	}
+
+	// Get user ID from context
+	userID, _ := c.Get("user_id")
+	userIDInt64 := int64(userID.(uint))
+
+	// Check if unit conversion exists
+	var conversion models.UnitConversion
+	if err := tenantDB.First(&conversion, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			utils.ErrorResponse(c, http.StatusNotFound, "Unit conversion not found", nil)
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve unit conversion", nil)
+		return
+	}
+
+	// Set deleted_by before soft delete
+	conversion.DeletedBy = &userIDInt64
+	if err := tenantDB.Save(&conversion).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update deleted_by", err.Error())
+		return
+	}
+
+	// Soft delete
+	if err := tenantDB.Delete(&conversion).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete unit conversion", err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Unit conversion deleted successfully", nil)
+}
+
+// validateUnitConversion checks that the conversion is between two units
+// and holds at least one base unit
+func validateUnitConversion(req *UnitConversionRequest) []models.ErrorDetail {
+	var errs []models.ErrorDetail
+	if req.UnitID == req.BaseUnitID {
+		errs = append(errs, models.ErrorDetail{Field: "base_unit_id", Message: "Base unit must differ from the unit"})
+	}
+	if req.Factor <= 0 {
+		errs = append(errs, models.ErrorDetail{Field: "factor", Message: "Factor must be greater than zero"})
+	}
+	return errs
+}
+
+// requireUnique writes a conflict response and returns false when another
+// conversion already covers the item and unit
+func (h *UnitConversionHandler) requireUnique(c *gin.Context, tenantDB *gorm.DB, req *UnitConversionRequest, id int) bool {
+	query := tenantDB.Model(&models.UnitConversion{}).Where("id <> ? AND unit_id = ?", id, req.UnitID)
+	if req.ItemID != nil {
+		query = query.Where("item_id = ?", *req.ItemID)
+	} else {
+		query = query.Where("item_id IS NULL")
+	}
+
+	var existing int64
+	if err := query.Count(&existing).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check unit conversions", err.Error())
+		return false
+	}
+	if existing > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "A conversion for this item and unit already exists", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FilePort appends every movement to a file as a JSON line instead of
+// delivering it. It stands in for the inventory service in development and
+// tests.
+type FilePort struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFilePort(path string) (*FilePort, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return &FilePort{path: path}, nil
+}
+
+// fileEntry is a line of the port file
+type fileEntry struct {
+	PublishedAt time.Time `json:"published_at"`
+	Movement
+}
+
+func (p *FilePort) Publish(ctx context.Context, movement Movement) error {
+	line, err := json.Marshal(fileEntry{PublishedAt: time.Now(), Movement: movement})
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file, err := os.OpenFile(p.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,53 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPPort posts every movement as JSON to the inventory service with the
+// movement ID as Idempotency-Key. 2xx means applied; 409 means the movement
+// was applied before.
+type HTTPPort struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHTTPPort(url, token string, timeout time.Duration) *HTTPPort {
+	return &HTTPPort{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+func (p *HTTPPort) Publish(ctx context.Context, movement Movement) error {
+	body, err := json.Marshal(movement)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", movement.ID)
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict || resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	payload, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return fmt.Errorf("inventory service returned %s: %s", resp.Status, bytes.TrimSpace(payload))
+}
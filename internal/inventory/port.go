@@ -0,0 +1,51 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+
+	"pos-mojosoft-so-service/internal/config"
+)
+
+// Movement is a stock movement of one item at a location. Quantity is in
+// the item's base unit; SourceUnitID and SourceQuantity are what was
+// recorded on the treatment.
+type Movement struct {
+	// ID is stable across retries; the inventory service must ignore a
+	// movement whose ID it has already applied
+	ID             string  `json:"id"`
+	Tenant         string  `json:"tenant"`
+	Direction      string  `json:"direction"`
+	ReversesID     *string `json:"reverses_id,omitempty"`
+	LocationID     *int    `json:"location_id"`
+	ItemID         int     `json:"item_id"`
+	UnitID         *int    `json:"unit_id"`
+	Quantity       int     `json:"quantity"`
+	SourceUnitID   *int    `json:"source_unit_id"`
+	SourceQuantity int     `json:"source_quantity"`
+	Date           string  `json:"date"`
+	// Reference identifies the document that moved the stock, e.g.
+	// "treatment:<id>"
+	Reference string `json:"reference"`
+}
+
+// Port delivers stock movements to the inventory service. Publish returns
+// nil once the movement is applied or was applied before.
+type Port interface {
+	Publish(ctx context.Context, movement Movement) error
+}
+
+// New returns the port selected by cfg.Driver
+func New(cfg config.InventoryConfig) (Port, error) {
+	switch cfg.Driver {
+	case "file":
+		return NewFilePort(cfg.FilePath)
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("INVENTORY_URL is required for the http inventory port")
+		}
+		return NewHTTPPort(cfg.URL, cfg.Token, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown inventory driver %q", cfg.Driver)
+	}
+}
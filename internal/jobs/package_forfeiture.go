@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/services"
+)
+
+// NewPackageForfeitureJob flags the unused sessions of expired packages as
+// forfeited in every tenant
+func NewPackageForfeitureJob(cfg config.JobsConfig, tenants *config.TenantDBManager, expiry *services.PackageExpiry) *TenantJob {
+	return NewTenantJob("package-forfeiture", cfg.PackageForfeitureInterval, tenants, func(tenantCode string, db *gorm.DB, today time.Time) error {
+		flagged, err := expiry.Forfeit(db, today)
+		if err == nil && flagged > 0 {
+			logrus.Infof("Flagged forfeited sessions on %d package lines for tenant %s", flagged, tenantCode)
+		}
+		return err
+	})
+}
@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/services"
+)
+
+// NewStockRelayJob delivers the pending stock movements of every tenant to
+// the inventory service
+func NewStockRelayJob(cfg config.JobsConfig, tenants *config.TenantDBManager, stock *services.ConsumableStock) *TenantJob {
+	return NewTenantJob("stock-relay", cfg.StockRelayInterval, tenants, func(tenantCode string, db *gorm.DB, today time.Time) error {
+		run, err := stock.Relay(context.Background(), db, tenantCode)
+		if errors.Is(err, services.ErrStockRelayRunning) {
+			logrus.Infof("Skipping stock relay for tenant %s: another run is in progress", tenantCode)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if run.Sent > 0 {
+			logrus.Infof("Relayed %d stock movements for tenant %s, %d pending", run.Sent, tenantCode, run.Pending)
+		}
+		if run.Error != nil {
+			return errors.New("inventory port: " + *run.Error)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/utils"
+)
+
+// TenantTask is one run of a job against a tenant database. today is the
+// current date in the tenant's timezone.
+type TenantTask func(tenantCode string, db *gorm.DB, today time.Time) error
+
+// TenantJob runs a task for every registered tenant on a fixed interval.
+// A failing tenant is logged and does not stop the others.
+type TenantJob struct {
+	name     string
+	interval time.Duration
+	tenants  *config.TenantDBManager
+	task     TenantTask
+
+	mu   sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewTenantJob(name string, interval time.Duration, tenants *config.TenantDBManager, task TenantTask) *TenantJob {
+	return &TenantJob{name: name, interval: interval, tenants: tenants, task: task}
+}
+
+// Start runs the job once and then on every interval until Stop. A zero
+// interval leaves the job disabled.
+func (j *TenantJob) Start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.interval <= 0 {
+		logrus.Infof("Job %s is disabled", j.name)
+		return
+	}
+	if j.stop != nil {
+		return
+	}
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+
+	go j.loop(j.stop, j.done)
+	logrus.Infof("Running job %s every %s", j.name, j.interval)
+}
+
+// Stop ends the job and waits for a run in progress to finish
+func (j *TenantJob) Stop() {
+	j.mu.Lock()
+	stop, done := j.stop, j.done
+	j.stop, j.done = nil, nil
+	j.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+func (j *TenantJob) loop(stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	j.RunOnce()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			j.RunOnce()
+		}
+	}
+}
+
+// RunOnce runs the task for every tenant now
+func (j *TenantJob) RunOnce() {
+	for _, tenantCode := range j.tenants.GetAvailableTenants() {
+		db, release, err := j.tenants.AcquireTenantDB(tenantCode)
+		if err != nil {
+			logrus.Errorf("Job %s: no database for tenant %s: %v", j.name, tenantCode, err)
+			continue
+		}
+		today := utils.Today(j.tenants.TimeZone(tenantCode))
+		err = j.task(tenantCode, db, today)
+		release()
+		if err != nil {
+			logrus.Errorf("Job %s failed for tenant %s: %v", j.name, tenantCode, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/services"
+)
+
+// NewTreatmentReminderJob sends the treatment reminders due in every tenant
+func NewTreatmentReminderJob(cfg config.JobsConfig, tenants *config.TenantDBManager, reminders *services.TreatmentReminders) *TenantJob {
+	return NewTenantJob("treatment-reminders", cfg.ReminderInterval, tenants, func(tenantCode string, db *gorm.DB, today time.Time) error {
+		run, err := reminders.Run(context.Background(), db, tenantCode, today)
+		if errors.Is(err, services.ErrRemindersRunning) {
+			logrus.Infof("Skipping reminders for tenant %s: another run is in progress", tenantCode)
+			return nil
+		}
+		if err == nil && run.Sent+run.Failed > 0 {
+			logrus.Infof("Sent %d reminders for tenant %s, %d failed", run.Sent, tenantCode, run.Failed)
+		}
+		return err
+	})
+}
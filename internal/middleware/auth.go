@@ -3,9 +3,11 @@ package middleware
 import (
 	"strings"
 
+	"pos-mojosoft-so-service/internal/models"
 	"pos-mojosoft-so-service/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 func AuthMiddleware(jwtUtil *utils.JWTUtil) gin.HandlerFunc {
@@ -32,6 +34,12 @@ func AuthMiddleware(jwtUtil *utils.JWTUtil) gin.HandlerFunc {
 			return
 		}
 
+		if !authorizeTenant(c, claims) {
+			utils.ForbiddenResponse(c, "Token is not valid for this tenant")
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("name", claims.Name)
 		c.Set("role_id", claims.RoleID)
@@ -58,16 +66,29 @@ func RequirePermission(permission string) gin.HandlerFunc {
 			return
 		}
 
-		hasPermission := false
-		for _, p := range permissionList {
-			if p == permission {
-				hasPermission = true
-				break
-			}
+		if !hasPermission(permissionList, permission) {
+			utils.ForbiddenResponse(c, "Insufficient permissions")
+			c.Abort()
+			return
 		}
 
-		if !hasPermission {
-			utils.ForbiddenResponse(c, "Insufficient permissions")
+		c.Next()
+	}
+}
+
+// RequirePlatform admits only platform operator tokens. Routes outside
+// TenantMiddleware have no tenant for authorizeTenant to check, so a tenant
+// user's token, whatever its permissions, must not reach them.
+func RequirePlatform() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := c.Get("claims")
+		if !ok {
+			utils.ForbiddenResponse(c, "Platform token required")
+			c.Abort()
+			return
+		}
+		if platformClaims, ok := claims.(*models.Claims); !ok || !platformClaims.Platform {
+			utils.ForbiddenResponse(c, "Platform token required")
 			c.Abort()
 			return
 		}
@@ -92,7 +113,7 @@ func OptionalAuth(jwtUtil *utils.JWTUtil) gin.HandlerFunc {
 
 		token := tokenParts[1]
 		claims, err := jwtUtil.ValidateAccessToken(token)
-		if err != nil {
+		if err != nil || !authorizeTenant(c, claims) {
 			c.Next()
 			return
 		}
@@ -107,6 +128,60 @@ func OptionalAuth(jwtUtil *utils.JWTUtil) gin.HandlerFunc {
 	}
 }
 
+// authorizeTenant verifies the tenant selected by TenantMiddleware against the
+// tenant the token was issued for. Only tokens carrying PermissionCrossTenant
+// may access another tenant, and every such access is audit-logged. Routes
+// without a tenant pass here and are guarded by RequirePlatform instead.
+func authorizeTenant(c *gin.Context, claims *models.Claims) bool {
+	tenantCode := GetTenantCode(c)
+	if tenantCode == "" || tenantCode == claims.TenantCode {
+		return true
+	}
+
+	if !hasPermission(claims.Permissions, PermissionCrossTenant) {
+		logrus.WithFields(logrus.Fields{
+			"user_id":       claims.UserID,
+			"token_tenant":  claims.TenantCode,
+			"header_tenant": tenantCode,
+			"method":        c.Request.Method,
+			"path":          c.Request.URL.Path,
+			"ip":            c.ClientIP(),
+		}).Warn("Rejected tenant mismatch between token and header")
+		return false
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"audit":         "cross_tenant_access",
+		"user_id":       claims.UserID,
+		"name":          claims.Name,
+		"token_tenant":  claims.TenantCode,
+		"header_tenant": tenantCode,
+		"method":        c.Request.Method,
+		"path":          c.Request.URL.Path,
+		"ip":            c.ClientIP(),
+	}).Warn("Cross-tenant access")
+	return true
+}
+
+func hasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the authenticated caller holds permission
+func HasPermission(c *gin.Context, permission string) bool {
+	permissions, exists := c.Get("permissions")
+	if !exists {
+		return false
+	}
+	permissionList, ok := permissions.([]string)
+	return ok && hasPermission(permissionList, permission)
+}
+
 // GetUserID retrieves the user ID from the context
 func GetUserID(c *gin.Context) uint {
 	userID, exists := c.Get("user_id")
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// LocationIDKey holds the caller's location in context; it is unset for
+// users with PermissionAllLocations
+const LocationIDKey = "location_id"
+
+// LocationMiddleware restricts the request to the location carried in the
+// token's id_location claim. It must run after AuthMiddleware.
+func LocationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("claims")
+		if !exists {
+			utils.UnauthorizedResponse(c, "Authentication required")
+			c.Abort()
+			return
+		}
+		claims := value.(*models.Claims)
+
+		if hasPermission(claims.Permissions, PermissionAllLocations) {
+			c.Next()
+			return
+		}
+
+		if claims.IDLocation == nil {
+			utils.ForbiddenResponse(c, "Token is not bound to a location")
+			c.Abort()
+			return
+		}
+
+		c.Set(LocationIDKey, *claims.IDLocation)
+		c.Next()
+	}
+}
+
+// GetLocationID returns the caller's location, or nil when unrestricted
+func GetLocationID(c *gin.Context) *int {
+	value, exists := c.Get(LocationIDKey)
+	if !exists {
+		return nil
+	}
+	locationID := value.(int)
+	return &locationID
+}
+
+// LocationScope limits a query on an integer location column to the caller's location
+func LocationScope(c *gin.Context, column string) func(db *gorm.DB) *gorm.DB {
+	locationID := GetLocationID(c)
+	return func(db *gorm.DB) *gorm.DB {
+		if locationID == nil {
+			return db
+		}
+		return db.Where(column+" = ?", *locationID)
+	}
+}
+
+// LocationTextScope is LocationScope for tables that store the location as text
+func LocationTextScope(c *gin.Context, column string) func(db *gorm.DB) *gorm.DB {
+	locationID := GetLocationID(c)
+	return func(db *gorm.DB) *gorm.DB {
+		if locationID == nil {
+			return db
+		}
+		return db.Where(column+" = ?", strconv.Itoa(*locationID))
+	}
+}
+
+// ParentLocationScope limits a query on a child table to rows whose parent
+// document is at the caller's location. foreignKey is the qualified child
+// column holding the parent's id, e.g. sales_order_detail.salesorder_id, and
+// column the parent's integer location column. Rows without a parent are
+// hidden from scoped callers.
+func ParentLocationScope(c *gin.Context, foreignKey, parentTable, column string) func(db *gorm.DB) *gorm.DB {
+	locationID := GetLocationID(c)
+	return func(db *gorm.DB) *gorm.DB {
+		if locationID == nil {
+			return db
+		}
+		return db.Where(parentLocationExists(foreignKey, parentTable, column), *locationID)
+	}
+}
+
+// ParentLocationTextScope is ParentLocationScope for parents that store the
+// location as text
+func ParentLocationTextScope(c *gin.Context, foreignKey, parentTable, column string) func(db *gorm.DB) *gorm.DB {
+	locationID := GetLocationID(c)
+	return func(db *gorm.DB) *gorm.DB {
+		if locationID == nil {
+			return db
+		}
+		return db.Where(parentLocationExists(foreignKey, parentTable, column), strconv.Itoa(*locationID))
+	}
+}
+
+// RequireParentLocation writes a 403 and returns false unless the parent row
+// of parentTable with the given id passes scope, the parent's LocationScope
+// or LocationTextScope. Unscoped callers may use any parent.
+func RequireParentLocation(c *gin.Context, db *gorm.DB, parentTable string, parentID interface{}, scope func(db *gorm.DB) *gorm.DB) bool {
+	if GetLocationID(c) == nil {
+		return true
+	}
+	var count int64
+	if err := db.Table(parentTable).Scopes(scope).Where("id = ?", parentID).Count(&count).Error; err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check location", nil)
+		return false
+	}
+	if count == 0 {
+		utils.ForbiddenResponse(c, "Location is outside your assigned location")
+		return false
+	}
+	return true
+}
+
+// parentLocationExists joins a child row to its parent and matches the
+// parent's location; a semi-join keeps the child's own columns unambiguous
+func parentLocationExists(foreignKey, parentTable, column string) string {
+	return "EXISTS (SELECT 1 FROM " + parentTable + " WHERE " + parentTable + ".id = " + foreignKey +
+		" AND " + parentTable + "." + column + " = ?)"
+}
+
+// ResolveLocationID returns the location a record should be written with.
+// Scoped callers default to their own location and may not write to another.
+func ResolveLocationID(c *gin.Context, requested *int) (*int, bool) {
+	locationID := GetLocationID(c)
+	if locationID == nil {
+		return requested, true
+	}
+	if requested != nil && *requested != *locationID {
+		return nil, false
+	}
+	return locationID, true
+}
+
+// ResolveLocationText is ResolveLocationID for text location columns
+func ResolveLocationText(c *gin.Context, requested *string) (*string, bool) {
+	locationID := GetLocationID(c)
+	if locationID == nil {
+		return requested, true
+	}
+	location := strconv.Itoa(*locationID)
+	if requested != nil && *requested != location {
+		return nil, false
+	}
+	return &location, true
+}
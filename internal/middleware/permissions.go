@@ -0,0 +1,101 @@
+package middleware
+
+// Permission catalogue. Tokens carry these codes in their permissions claim
+// and routes are guarded with RequirePermission.
+const (
+	PermissionSORead   = "so.read"
+	PermissionSOCreate = "so.create"
+	PermissionSOUpdate = "so.update"
+	PermissionSOPost   = "so.post"
+	PermissionSOVoid   = "so.void"
+
+	PermissionARRead   = "ar.read"
+	PermissionARCreate = "ar.create"
+	PermissionARUpdate = "ar.update"
+	PermissionARVoid   = "ar.void"
+
+	PermissionTreatmentRead   = "treatment.read"
+	PermissionTreatmentCreate = "treatment.create"
+	PermissionTreatmentUpdate = "treatment.update"
+	PermissionTreatmentVoid   = "treatment.void"
+	// PermissionTreatmentOverride lets a manager redeem sessions of an expired package
+	PermissionTreatmentOverride = "treatment.override"
+	// PermissionTreatmentSignOff lets a clinician sign off completed treatments
+	PermissionTreatmentSignOff = "treatment.sign_off"
+	// PermissionTreatmentCorrect lets a user correct completed treatments
+	PermissionTreatmentCorrect = "treatment.correct"
+
+	PermissionAppointmentRead   = "appointment.read"
+	PermissionAppointmentCreate = "appointment.create"
+	PermissionAppointmentUpdate = "appointment.update"
+	PermissionAppointmentCancel = "appointment.cancel"
+
+	// PermissionCommissionRead lets payroll view staff commissions
+	PermissionCommissionRead = "commission.read"
+
+	PermissionBookRead   = "book.read"
+	PermissionBookCreate = "book.create"
+	PermissionBookUpdate = "book.update"
+	PermissionBookDelete = "book.delete"
+	// PermissionBookClose lets a user close bookkeeping records and reopen them
+	PermissionBookClose = "book.close"
+
+	PermissionMasterRead   = "master.read"
+	PermissionMasterManage = "master.manage"
+
+	// PermissionAllLocations exempts a user from location scoping
+	PermissionAllLocations = "location:all"
+	// PermissionCrossTenant allows a token issued for one tenant to access another
+	PermissionCrossTenant = "tenant.cross_access"
+	// PermissionTenantManage grants access to the tenant registry admin endpoints
+	PermissionTenantManage = "tenant.manage"
+)
+
+// Permission describes an entry in the permission catalogue
+type Permission struct {
+	Code        string `json:"code"`
+	Group       string `json:"group"`
+	Description string `json:"description"`
+}
+
+// PermissionCatalogue lists every permission checked by this service
+var PermissionCatalogue = []Permission{
+	{PermissionSORead, "sales_order", "View sales orders, details, services, statuses and reminders"},
+	{PermissionSOCreate, "sales_order", "Create sales orders, details and services"},
+	{PermissionSOUpdate, "sales_order", "Edit sales orders, details and services"},
+	{PermissionSOPost, "sales_order", "Post and reopen sales orders"},
+	{PermissionSOVoid, "sales_order", "Delete or void sales orders, details and services"},
+
+	{PermissionARRead, "ar_receipt", "View AR receipts and their details"},
+	{PermissionARCreate, "ar_receipt", "Create AR receipts and their details"},
+	{PermissionARUpdate, "ar_receipt", "Edit AR receipts and their details"},
+	{PermissionARVoid, "ar_receipt", "Delete or void AR receipts and their details"},
+
+	{PermissionTreatmentRead, "treatment", "View treatments, their details and stock movements"},
+	{PermissionTreatmentCreate, "treatment", "Create treatments and their details"},
+	{PermissionTreatmentUpdate, "treatment", "Edit, start and complete treatments and mark services as treated"},
+	{PermissionTreatmentVoid, "treatment", "Delete or void treatments and their details"},
+	{PermissionTreatmentOverride, "treatment", "Redeem sessions of expired packages"},
+	{PermissionTreatmentSignOff, "treatment", "Sign off completed treatments"},
+	{PermissionTreatmentCorrect, "treatment", "Correct completed treatments"},
+
+	{PermissionAppointmentRead, "appointment", "View appointments, the day view and free slots"},
+	{PermissionAppointmentCreate, "appointment", "Book appointments"},
+	{PermissionAppointmentUpdate, "appointment", "Reschedule appointments"},
+	{PermissionAppointmentCancel, "appointment", "Cancel appointments"},
+
+	{PermissionCommissionRead, "commission", "View staff commissions"},
+
+	{PermissionBookRead, "bookkeeping", "View bookkeeping records, details and summaries"},
+	{PermissionBookCreate, "bookkeeping", "Create bookkeeping records, details and summaries"},
+	{PermissionBookUpdate, "bookkeeping", "Edit bookkeeping records, details and summaries"},
+	{PermissionBookDelete, "bookkeeping", "Delete bookkeeping records, details and summaries"},
+	{PermissionBookClose, "bookkeeping", "Close bookkeeping records and reopen closed ones"},
+
+	{PermissionMasterRead, "master", "View payment methods, book transaction types and categories, package validity rules, appointment hours, reminder templates, unit conversions and commission rules"},
+	{PermissionMasterManage, "master", "Manage payment methods, book transaction types and categories, package validity rules, appointment hours, reminder templates, unit conversions and commission rules; send reminders and relay stock movements"},
+
+	{PermissionAllLocations, "access", "Access records of every location"},
+	{PermissionCrossTenant, "access", "Access tenants other than the one the token was issued for"},
+	{PermissionTenantManage, "admin", "View and refresh the tenant registry"},
+}
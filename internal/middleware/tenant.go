@@ -2,16 +2,19 @@ package middleware
 
 import (
 	"net/http"
+	"time"
 
 	"pos-mojosoft-so-service/internal/config"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 const TenantCodeHeader = "X-Tenant-Code"
 const TenantCodeKey = "tenant_code"
 const TenantDBKey = "tenant_db"
+const TenantTimeZoneKey = "tenant_time_zone"
 
 // TenantMiddleware extracts tenant code from header, validates it, and injects tenant DB into context
 func TenantMiddleware() gin.HandlerFunc {
@@ -26,9 +29,19 @@ func TenantMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Get tenant database connection from manager
+		if !config.ValidTenantCode(tenantCode) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":       "invalid tenant code",
+				"tenant_code": tenantCode,
+			})
+			c.Abort()
+			return
+		}
+
+		// Get tenant database connection from manager; the pool stays open
+		// until the request is done even if the tenant is removed meanwhile
 		dbManager := config.GetTenantDBManager()
-		tenantDB, err := dbManager.GetTenantDB(tenantCode)
+		tenantDB, release, err := dbManager.AcquireTenantDB(tenantCode)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":       "invalid tenant code",
@@ -37,10 +50,12 @@ func TenantMiddleware() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		defer release()
 
 		// Store tenant code and DB connection in context
 		c.Set(TenantCodeKey, tenantCode)
 		c.Set(TenantDBKey, tenantDB)
+		c.Set(TenantTimeZoneKey, dbManager.TimeZone(tenantCode))
 		c.Next()
 	}
 }
@@ -54,13 +69,40 @@ func GetTenantCode(c *gin.Context) string {
 	return tenantCode.(string)
 }
 
-// GetTenantDB retrieves tenant database connection from context
+// GetTenantTimeZone returns the tenant's timezone used to interpret and
+// stamp business dates, or UTC when TenantMiddleware did not run
+func GetTenantTimeZone(c *gin.Context) *time.Location {
+	if value, exists := c.Get(TenantTimeZoneKey); exists {
+		if location, ok := value.(*time.Location); ok {
+			return location
+		}
+	}
+	return time.UTC
+}
+
+// GetTenantDB retrieves tenant database connection from context.
+// A missing connection means TenantMiddleware did not run for the route,
+// which is a wiring bug, so it is logged as an error rather than ignored.
 func GetTenantDB(c *gin.Context) (*gorm.DB, error) {
-	db, exists := c.Get(TenantDBKey)
+	value, exists := c.Get(TenantDBKey)
 	if !exists {
+		logrus.WithFields(logrus.Fields{
+			"method": c.Request.Method,
+			"path":   c.FullPath(),
+		}).Error("Tenant database not found in context; is TenantMiddleware applied to this route?")
 		return nil, ErrTenantDBNotFound
 	}
-	return db.(*gorm.DB), nil
+
+	db, ok := value.(*gorm.DB)
+	if !ok || db == nil {
+		logrus.WithFields(logrus.Fields{
+			"method": c.Request.Method,
+			"path":   c.FullPath(),
+		}).Error("Tenant database in context has an unexpected type")
+		return nil, ErrTenantDBNotFound
+	}
+
+	return db.WithContext(c.Request.Context()), nil
 }
 
 var ErrTenantDBNotFound = &TenantDBError{Message: "tenant database not found in context"}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Appointment statuses
+const (
+	AppointmentBooked    = "booked"
+	AppointmentCancelled = "cancelled"
+)
+
+// Appointment represents the appointment table: a booked time of a room and
+// staff for a customer, usually for a sold service
+type Appointment struct {
+	ID                  uuid.UUID      `gorm:"type:uuid;primaryKey;column:id" json:"id"`
+	LocationID          int            `gorm:"column:location_id" json:"location_id"`
+	CustomerID          *int           `gorm:"column:customer_id" json:"customer_id"`
+	SalesOrderID        *uuid.UUID     `gorm:"column:salesorder_id" json:"sales_order_id"`
+	SalesOrderServiceID *int           `gorm:"column:salesorderservice_id" json:"sales_order_service_id"`
+	RoomID              *int           `gorm:"column:room_id" json:"room_id"`
+	DoctorID            *int           `gorm:"column:doctor_id" json:"doctor_id"`
+	NurseID             *int           `gorm:"column:nurse_id" json:"nurse_id"`
+	BeauticianID        *int           `gorm:"column:beautician_id" json:"beautician_id"`
+	StartsAt            time.Time      `gorm:"column:starts_at" json:"starts_at"`
+	EndsAt              time.Time      `gorm:"column:ends_at" json:"ends_at"`
+	Status              string         `gorm:"column:status" json:"status"`
+	RescheduleCount     int            `gorm:"column:reschedulecount" json:"reschedule_count"`
+	Note                *string        `gorm:"column:note" json:"note"`
+	CancelReason        *string        `gorm:"column:cancelreason" json:"cancel_reason"`
+	CancelledAt         *time.Time     `gorm:"column:cancelled_at" json:"cancelled_at"`
+	CancelledBy         *int64         `gorm:"column:cancelled_by" json:"cancelled_by"`
+	CreatedBy           *int64         `gorm:"column:created_by" json:"created_by"`
+	UpdatedBy           *int64         `gorm:"column:updated_by" json:"updated_by"`
+	DeletedBy           *int64         `gorm:"column:deleted_by" json:"deleted_by"`
+	DeletedAt           gorm.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+	CreatedAt           *time.Time     `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt           *time.Time     `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TableName specifies the table name for Appointment model
+func (Appointment) TableName() string {
+	return "appointment"
+}
+
+// BeforeCreate hook to generate UUID
+func (a *Appointment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// AppointmentHours represents the appointment_hours table: the opening
+// hours and slot length of a location. Times are "HH:MM" in the tenant's
+// timezone.
+type AppointmentHours struct {
+	LocationID  int        `gorm:"primaryKey;column:location_id" json:"location_id"`
+	OpensAt     string     `gorm:"column:opens_at;type:time" json:"opens_at"`
+	ClosesAt    string     `gorm:"column:closes_at;type:time" json:"closes_at"`
+	SlotMinutes int        `gorm:"column:slotminutes" json:"slot_minutes"`
+	UpdatedBy   *int64     `gorm:"column:updated_by" json:"updated_by"`
+	UpdatedAt   *time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TableName specifies the table name for AppointmentHours model
+func (AppointmentHours) TableName() string {
+	return "appointment_hours"
+}
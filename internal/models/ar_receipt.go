@@ -14,9 +14,10 @@ type ARReceipt struct {
 	CustomerID      *int              `gorm:"column:customer_id" json:"customer_id"`
 	PaymentMethodID *int              `gorm:"column:paymentmethod_id" json:"payment_method_id"`
 	DocNumber       *int              `gorm:"column:docnumber" json:"doc_number"`
+	InvNumber       *string           `gorm:"column:invnumber" json:"inv_number"`
 	DocDate         *time.Time        `gorm:"column:docdate;type:date" json:"doc_date"`
 	PostedDate      *time.Time        `gorm:"column:posteddate;type:date" json:"posted_date"`
-	TotalAmount     *float64          `gorm:"column:totalamounth;type:numeric" json:"total_amount"`
+	TotalAmount     *Money            `gorm:"column:totalamounth;type:numeric" json:"total_amount"`
 	Note            *string           `gorm:"column:note " json:"note"`
 	StatusID        *int              `gorm:"column:status_id" json:"status_id"`
 	CreatedBy       *int64            `gorm:"column:created_by" json:"created_by"`
@@ -32,7 +33,7 @@ type ARReceipt struct {
 
 // TableName specifies the table name for ARReceipt model
 func (ARReceipt) TableName() string {
-	return "alana.ar_receipt"
+	return "ar_receipt"
 }
 
 // BeforeCreate hook to generate UUID before creating a new record
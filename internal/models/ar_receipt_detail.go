@@ -3,15 +3,18 @@ package models
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
-// ARReceiptDetail represents the ar_receipt_detail table in the database
+// ARReceiptDetail represents the ar_receipt_detail table in the database.
+// Each row allocates part of a receipt to a sales order; rows are written
+// through services.ReceiptAllocation so the order's balance follows them.
 type ARReceiptDetail struct {
 	ID            int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
-	ARReceiptID   *int           `gorm:"column:arreceipt_id" json:"ar_receipt_id"`
-	SalesOrderID  *int           `gorm:"column:salesorder_id" json:"sales_order_id"`
-	ReceiptAmount *float64       `gorm:"column:receiptamount;type:numeric" json:"receipt_amount"`
+	ARReceiptID   *uuid.UUID     `gorm:"column:arreceipt_id" json:"ar_receipt_id"`
+	SalesOrderID  *uuid.UUID     `gorm:"column:salesorder_id" json:"sales_order_id"`
+	ReceiptAmount *Money         `gorm:"column:receiptamount;type:numeric" json:"receipt_amount"`
 	CreatedBy     *int64         `gorm:"column:created_by" json:"created_by"`
 	UpdatedBy     *int64         `gorm:"column:updated_by" json:"updated_by"`
 	DeletedBy     *int64         `gorm:"column:deleted_by" json:"deleted_by"`
@@ -22,5 +25,5 @@ type ARReceiptDetail struct {
 
 // TableName specifies the table name for ARReceiptDetail model
 func (ARReceiptDetail) TableName() string {
-	return "alana.ar_receipt_detail"
+	return "ar_receipt_detail"
 }
@@ -14,6 +14,9 @@ type Claims struct {
 	TenantCode  string   `json:"tenant_code"`
 	IDLocation  *int     `json:"id_location,omitempty"`
 	Permissions []string `json:"permissions,omitempty"`
+	// Platform marks tokens issued to platform operators rather than to a
+	// tenant's users; only these reach the tenant registry admin endpoints
+	Platform bool `json:"platform,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -20,5 +20,5 @@ type BookTransactionCategory struct {
 
 // TableName specifies the table name for BookTransactionCategory model
 func (BookTransactionCategory) TableName() string {
-	return "alana.book_transaction_category"
+	return "book_transaction_category"
 }
@@ -20,5 +20,5 @@ type BookTransactionType struct {
 
 // TableName specifies the table name for BookTransactionType model
 func (BookTransactionType) TableName() string {
-	return "alana.book_transaction_type"
+	return "book_transaction_type"
 }
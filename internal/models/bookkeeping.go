@@ -11,10 +11,10 @@ type Bookkeeping struct {
 	ID         int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
 	LocationID *string        `gorm:"column: location_id" json:"location_id"`
 	BookDate   *time.Time     `gorm:"column:bookdate;type:date" json:"book_date"`
-	Opening    *float64       `gorm:"column:opening;type:numeric" json:"opening"`
-	Income     *float64       `gorm:"column:income;type:numeric" json:"income"`
-	Expanse    *float64       `gorm:"column:expanse;type:numeric" json:"expanse"`
-	Balance    *float64       `gorm:"column:balance;type:numeric" json:"balance"`
+	Opening    *Money         `gorm:"column:opening;type:numeric" json:"opening"`
+	Income     *Money         `gorm:"column:income;type:numeric" json:"income"`
+	Expanse    *Money         `gorm:"column:expanse;type:numeric" json:"expanse"`
+	Balance    *Money         `gorm:"column:balance;type:numeric" json:"balance"`
 	Note       *string        `gorm:"column:note" json:"note"`
 	StatusID   *int           `gorm:"column:status_id" json:"status_id"`
 	CreatedBy  *int64         `gorm:"column:created_by" json:"created_by"`
@@ -34,5 +34,5 @@ type Bookkeeping struct {
 
 // TableName specifies the table name for Bookkeeping model
 func (Bookkeeping) TableName() string {
-	return "alana.bookkeeping"
+	return "bookkeeping"
 }
@@ -16,8 +16,8 @@ type BookkeepingDetail struct {
 	PaymentMethodID *int           `gorm:"column:paymentmethod_id" json:"payment_method_id"`
 	PostedDate      *time.Time     `gorm:"column:posteddate;type:date" json:"posted_date"`
 	DocNumber       *string        `gorm:"column:docnumber" json:"doc_number"`
-	Income          *float64       `gorm:"column:income;type:numeric" json:"income"`
-	Expanse         *float64       `gorm:"column:expanse;type:numeric" json:"expanse"`
+	Income          *Money         `gorm:"column:income;type:numeric" json:"income"`
+	Expanse         *Money         `gorm:"column:expanse;type:numeric" json:"expanse"`
 	Description     *string        `gorm:"column:description" json:"description"`
 	CreatedBy       *int64         `gorm:"column:created_by" json:"created_by"`
 	UpdatedBy       *int64         `gorm:"column:updated_by" json:"updated_by"`
@@ -36,5 +36,5 @@ type BookkeepingDetail struct {
 // TableName specifies the table name for BookkeepingDetail model
 // Note: The actual table name in database has a typo (bookeeping_detail)
 func (BookkeepingDetail) TableName() string {
-	return "alana.bookeeping_detail"
+	return "bookeeping_detail"
 }
@@ -20,5 +20,5 @@ type BookkeepingStatus struct {
 
 // TableName specifies the table name for BookkeepingStatus model
 func (BookkeepingStatus) TableName() string {
-	return "alana.bookkeeping_status"
+	return "bookkeeping_status"
 }
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Staff roles commissions are paid to. Promoters earn on the sales order
+// lines they promoted, the others on the treatments they performed.
+const (
+	CommissionRolePromoter   = "promoter"
+	CommissionRoleDoctor     = "doctor"
+	CommissionRoleNurse      = "nurse"
+	CommissionRoleBeautician = "beautician"
+)
+
+// How a commission rule calculates
+const (
+	CommissionPercentage = "percentage"
+	CommissionFixed      = "fixed"
+)
+
+// CommissionRule represents the commission_rule table: what a staff role
+// earns, either a percentage of the amount sold or a fixed amount. Item,
+// service and location narrow the rule; left empty they match anything.
+type CommissionRule struct {
+	ID         int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
+	Role       string         `gorm:"column:role" json:"role"`
+	ItemID     *int           `gorm:"column:item_id" json:"item_id"`
+	ServiceID  *int           `gorm:"column:service_id" json:"service_id"`
+	LocationID *int           `gorm:"column:location_id" json:"location_id"`
+	CalcType   string         `gorm:"column:calctype" json:"type"`
+	CalcValue  Money          `gorm:"column:calcvalue;type:numeric" json:"value"`
+	Note       *string        `gorm:"column:note" json:"note"`
+	CreatedBy  *int64         `gorm:"column:created_by" json:"created_by"`
+	UpdatedBy  *int64         `gorm:"column:updated_by" json:"updated_by"`
+	DeletedBy  *int64         `gorm:"column:deleted_by" json:"deleted_by"`
+	DeletedAt  gorm.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+	CreatedAt  *time.Time     `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt  *time.Time     `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TableName specifies the table name for CommissionRule model
+func (CommissionRule) TableName() string {
+	return "commission_rule"
+}
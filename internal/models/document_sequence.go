@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// DocumentSequence represents the document_sequence table: the last number
+// issued per document type, location and year
+type DocumentSequence struct {
+	DocumentType string     `gorm:"primaryKey;column:document_type" json:"document_type"`
+	LocationID   int        `gorm:"primaryKey;column:location_id" json:"location_id"`
+	Year         int        `gorm:"primaryKey;column:year" json:"year"`
+	LastNumber   int64      `gorm:"column:last_number" json:"last_number"`
+	UpdatedAt    *time.Time `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TableName specifies the table name for DocumentSequence model
+func (DocumentSequence) TableName() string {
+	return "document_sequence"
+}
+
+// DocumentFormat represents the document_format table: a tenant's own number
+// format for a document type
+type DocumentFormat struct {
+	DocumentType string `gorm:"primaryKey;column:document_type" json:"document_type"`
+	Format       string `gorm:"column:format" json:"format"`
+}
+
+// TableName specifies the table name for DocumentFormat model
+func (DocumentFormat) TableName() string {
+	return "document_format"
+}
+
+// DocumentLocationCode represents the document_location_code table: the short
+// code printed for a location in document numbers, e.g. JKT
+type DocumentLocationCode struct {
+	LocationID int    `gorm:"primaryKey;column:location_id" json:"location_id"`
+	Code       string `gorm:"column:code" json:"code"`
+}
+
+// TableName specifies the table name for DocumentLocationCode model
+func (DocumentLocationCode) TableName() string {
+	return "document_location_code"
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// moneyScale is the number of decimal places a Money value carries
+const moneyScale = 2
+
+// ErrMoneyOverflow is returned when a product does not fit in a Money value
+var ErrMoneyOverflow = errors.New("amount is out of range")
+
+// Money is an exact decimal amount stored as a whole number of hundredths.
+// It maps to numeric columns and is marshalled as a JSON number with two
+// decimals, so sums never drift the way float64 does.
+type Money struct {
+	cents int64
+}
+
+// NewMoney returns a whole-unit amount, e.g. NewMoney(150000) is 150000.00
+func NewMoney(units int64) Money {
+	return Money{cents: units * 100}
+}
+
+// MoneyFromCents returns the amount with the given number of hundredths
+func MoneyFromCents(cents int64) Money {
+	return Money{cents: cents}
+}
+
+// ParseMoney parses a plain decimal string such as "150000", "-12.5" or
+// "270000.00". Values with more than two non-zero decimals are rejected.
+func ParseMoney(s string) (Money, error) {
+	return parseMoney(s, false)
+}
+
+// parseMoney parses a decimal string; with round set, digits beyond the
+// second decimal are rounded half away from zero instead of rejected
+func parseMoney(s string, round bool) (Money, error) {
+	text := strings.TrimSpace(s)
+	if text == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+
+	negative := false
+	switch text[0] {
+	case '-':
+		negative = true
+		text = text[1:]
+	case '+':
+		text = text[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" && fraction == "" || !isDigits(whole) || !isDigits(fraction) {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+
+	roundUp := false
+	if len(fraction) > moneyScale {
+		extra := strings.TrimRight(fraction[moneyScale:], "0")
+		if extra != "" && !round {
+			return Money{}, fmt.Errorf("amount %q has more than %d decimal places", s, moneyScale)
+		}
+		roundUp = extra != "" && extra[0] >= '5'
+		fraction = fraction[:moneyScale]
+	}
+	fraction += strings.Repeat("0", moneyScale-len(fraction))
+
+	if whole == "" {
+		whole = "0"
+	}
+	cents, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is out of range", s)
+	}
+	if roundUp {
+		cents++
+	}
+	if negative {
+		cents = -cents
+	}
+	return Money{cents: cents}, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Cents returns the amount as a whole number of hundredths
+func (m Money) Cents() int64 {
+	return m.cents
+}
+
+// Add returns m + other
+func (m Money) Add(other Money) Money {
+	return Money{cents: m.cents + other.cents}
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) Money {
+	return Money{cents: m.cents - other.cents}
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return Money{cents: -m.cents}
+}
+
+// Mul returns m multiplied by a whole quantity, or ErrMoneyOverflow when
+// the product is out of range
+func (m Money) Mul(quantity int64) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.cents), big.NewInt(quantity))
+	if !product.IsInt64() {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{cents: product.Int64()}, nil
+}
+
+// Percent returns pct percent of m, rounded half away from zero to the cent
+func (m Money) Percent(pct int64) (Money, error) {
+	return m.Ratio(pct, 100)
+}
+
+// Ratio returns m * numerator / denominator, rounded half away from zero to
+// the cent. denominator must be positive. The product is computed exactly;
+// ErrMoneyOverflow is returned when the result is out of range.
+func (m Money) Ratio(numerator, denominator int64) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.cents), big.NewInt(numerator))
+	divisor := big.NewInt(denominator)
+	quotient, remainder := new(big.Int).QuoRem(product, divisor, new(big.Int))
+	// Round away from zero when twice the remainder reaches the divisor
+	if remainder.Lsh(remainder.Abs(remainder), 1).Cmp(divisor) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(product.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{cents: quotient.Int64()}, nil
+}
+
+// Cmp returns -1, 0 or +1 as m is less than, equal to or greater than other
+func (m Money) Cmp(other Money) int {
+	switch {
+	case m.cents < other.cents:
+		return -1
+	case m.cents > other.cents:
+		return 1
+	}
+	return 0
+}
+
+// IsZero reports whether m is zero
+func (m Money) IsZero() bool {
+	return m.cents == 0
+}
+
+// IsNegative reports whether m is below zero
+func (m Money) IsNegative() bool {
+	return m.cents < 0
+}
+
+// IsPositive reports whether m is above zero
+func (m Money) IsPositive() bool {
+	return m.cents > 0
+}
+
+// String formats m with exactly two decimals, e.g. "270000.00"
+func (m Money) String() string {
+	cents := m.cents
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON writes m as a JSON number with two decimals
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) >= 2 && data[0] == '"' && data[len(data)-1] == '"' {
+		data = data[1 : len(data)-1]
+	}
+	parsed, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for numeric columns. Stored values with more
+// than two decimals are rounded to the cent.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = Money{}
+		return nil
+	case string:
+		parsed, err := parseMoney(v, true)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case []byte:
+		parsed, err := parseMoney(string(v), true)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	case int64:
+		*m = NewMoney(v)
+		return nil
+	case float64:
+		parsed, err := parseMoney(strconv.FormatFloat(v, 'f', -1, 64), true)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into Money", value)
+}
+
+// Value implements driver.Valuer, sending m as an exact decimal string
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// GormDataType tells GORM that Money columns are numeric
+func (Money) GormDataType() string {
+	return "numeric"
+}
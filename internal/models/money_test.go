@@ -0,0 +1,185 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in    string
+		cents int64
+		ok    bool
+	}{
+		{"150000", 15000000, true},
+		{"270000.00", 27000000, true},
+		{"-12.5", -1250, true},
+		{"+3.07", 307, true},
+		{".5", 50, true},
+		{"7.", 700, true},
+		{" 42 ", 4200, true},
+		{"1.2300", 123, true},
+		{"92233720368547758.07", math.MaxInt64, true},
+		{"1.234", 0, false},
+		{"", 0, false},
+		{"-", 0, false},
+		{".", 0, false},
+		{"1,000", 0, false},
+		{"1e3", 0, false},
+		{"abc", 0, false},
+		{"92233720368547758.08", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseMoney(%q) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && got.Cents() != tt.cents {
+			t.Errorf("ParseMoney(%q) = %d cents, want %d", tt.in, got.Cents(), tt.cents)
+		}
+	}
+}
+
+func TestScanRoundsToCent(t *testing.T) {
+	tests := []struct {
+		in    interface{}
+		cents int64
+	}{
+		{nil, 0},
+		{"10.005", 1001},
+		{"10.004", 1000},
+		{"-10.005", -1001},
+		{"0.995", 100},
+		{[]byte("123.45"), 12345},
+		{int64(7), 700},
+		{float64(19.99), 1999},
+		{float64(0.125), 13},
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := m.Scan(tt.in); err != nil {
+			t.Errorf("Scan(%#v) error = %v", tt.in, err)
+			continue
+		}
+		if m.Cents() != tt.cents {
+			t.Errorf("Scan(%#v) = %d cents, want %d", tt.in, m.Cents(), tt.cents)
+		}
+	}
+
+	var m Money
+	if err := m.Scan(true); err == nil {
+		t.Error("Scan(bool) succeeded, want an error")
+	}
+	if err := m.Scan("12x"); err == nil {
+		t.Error(`Scan("12x") succeeded, want an error`)
+	}
+}
+
+func TestValueAndString(t *testing.T) {
+	tests := []struct {
+		cents int64
+		want  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{27000000, "270000.00"},
+		{-123456, "-1234.56"},
+	}
+	for _, tt := range tests {
+		m := MoneyFromCents(tt.cents)
+		value, err := m.Value()
+		if err != nil {
+			t.Fatalf("Value() error = %v", err)
+		}
+		if value != tt.want || m.String() != tt.want {
+			t.Errorf("MoneyFromCents(%d) = %v / %s, want %s", tt.cents, value, m, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		in    string
+		cents int64
+		out   string
+		ok    bool
+	}{
+		{`150000`, 15000000, `150000.00`, true},
+		{`"150000.5"`, 15000050, `150000.50`, true},
+		{`-0.1`, -10, `-0.10`, true},
+		{`12.345`, 0, ``, false},
+		{`"abc"`, 0, ``, false},
+		{`true`, 0, ``, false},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := json.Unmarshal([]byte(tt.in), &m)
+		if (err == nil) != tt.ok {
+			t.Errorf("Unmarshal(%s) error = %v, want ok %v", tt.in, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if m.Cents() != tt.cents {
+			t.Errorf("Unmarshal(%s) = %d cents, want %d", tt.in, m.Cents(), tt.cents)
+		}
+		out, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal error = %v", err)
+		}
+		if string(out) != tt.out {
+			t.Errorf("Marshal(%s) = %s, want %s", tt.in, out, tt.out)
+		}
+	}
+
+	// Optional amounts stay null
+	var body struct {
+		Amount *Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount":null}`), &body); err != nil || body.Amount != nil {
+		t.Errorf("null amount = %v, %v; want nil", body.Amount, err)
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	tests := []struct {
+		name  string
+		got   func() (Money, error)
+		cents int64
+		err   error
+	}{
+		{"mul", func() (Money, error) { return MoneyFromCents(1999).Mul(3) }, 5997, nil},
+		{"mul negative", func() (Money, error) { return MoneyFromCents(-1999).Mul(3) }, -5997, nil},
+		{"mul overflow", func() (Money, error) { return MoneyFromCents(math.MaxInt64 / 2).Mul(3) }, 0, ErrMoneyOverflow},
+		{"mul negative overflow", func() (Money, error) { return MoneyFromCents(math.MinInt64).Mul(-1) }, 0, ErrMoneyOverflow},
+
+		{"percent", func() (Money, error) { return MoneyFromCents(10000).Percent(15) }, 1500, nil},
+		{"percent rounds half up", func() (Money, error) { return MoneyFromCents(150).Percent(33) }, 50, nil},
+		{"percent rounds down", func() (Money, error) { return MoneyFromCents(149).Percent(33) }, 49, nil},
+		{"percent rounds half away from zero", func() (Money, error) { return MoneyFromCents(-150).Percent(33) }, -50, nil},
+		{"percent of a large amount", func() (Money, error) { return MoneyFromCents(math.MaxInt64).Percent(50) }, math.MaxInt64/2 + 1, nil},
+		{"percent overflow", func() (Money, error) { return MoneyFromCents(math.MaxInt64).Percent(101) }, 0, ErrMoneyOverflow},
+
+		{"ratio", func() (Money, error) { return MoneyFromCents(10000).Ratio(1, 3) }, 3333, nil},
+		{"ratio rounds up", func() (Money, error) { return MoneyFromCents(20000).Ratio(1, 3) }, 6667, nil},
+		{"ratio half", func() (Money, error) { return MoneyFromCents(1).Ratio(1, 2) }, 1, nil},
+		{"ratio negative half", func() (Money, error) { return MoneyFromCents(-1).Ratio(1, 2) }, -1, nil},
+		{"ratio with a large product", func() (Money, error) { return MoneyFromCents(math.MaxInt64).Ratio(3, 4) }, 6917529027641081855, nil},
+		{"ratio overflow", func() (Money, error) { return MoneyFromCents(math.MaxInt64).Ratio(4, 3) }, 0, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		got, err := tt.got()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && got.Cents() != tt.cents {
+			t.Errorf("%s = %d cents, want %d", tt.name, got.Cents(), tt.cents)
+		}
+	}
+}
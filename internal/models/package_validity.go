@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PackageValidity represents the package_validity table: how long the
+// sessions of a package stay redeemable after the order is posted. A rule
+// names either an item or a service.
+type PackageValidity struct {
+	ID             int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
+	ItemID         *int           `gorm:"column:item_id" json:"item_id"`
+	ServiceID      *int           `gorm:"column:service_id" json:"service_id"`
+	ValidityMonths int            `gorm:"column:validitymonths" json:"validity_months"`
+	ValidityDays   int            `gorm:"column:validitydays" json:"validity_days"`
+	Note           *string        `gorm:"column:note" json:"note"`
+	CreatedBy      *int64         `gorm:"column:created_by" json:"created_by"`
+	UpdatedBy      *int64         `gorm:"column:updated_by" json:"updated_by"`
+	DeletedBy      *int64         `gorm:"column:deleted_by" json:"deleted_by"`
+	DeletedAt      gorm.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+	CreatedAt      *time.Time     `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      *time.Time     `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TableName specifies the table name for PackageValidity model
+func (PackageValidity) TableName() string {
+	return "package_validity"
+}
+
+// ExpiryDate returns the last day a package sold on start can be redeemed
+func (v PackageValidity) ExpiryDate(start time.Time) time.Time {
+	return start.AddDate(0, v.ValidityMonths, v.ValidityDays)
+}
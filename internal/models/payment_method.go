@@ -20,5 +20,5 @@ type PaymentMethod struct {
 
 // TableName specifies the table name for PaymentMethod model
 func (PaymentMethod) TableName() string {
-	return "alana.payment_method"
+	return "payment_method"
 }
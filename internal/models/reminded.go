@@ -20,5 +20,5 @@ type Reminded struct {
 
 // TableName specifies the table name for Reminded model
 func (Reminded) TableName() string {
-	return "alana.reminded"
+	return "reminded"
 }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reminder kinds
+const (
+	ReminderAppointment = "appointment"
+	ReminderPackage     = "package"
+)
+
+// Reminder delivery statuses recorded on sales_order_service
+const (
+	ReminderSent   = "sent"
+	ReminderFailed = "failed"
+)
+
+// ReminderTemplate represents the reminder_template table: the message a
+// tenant sends for a reminder kind, as a Go text/template
+type ReminderTemplate struct {
+	ID         int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
+	Kind       string         `gorm:"column:kind" json:"kind"`
+	RemindedID *int           `gorm:"column:reminded_id" json:"reminded_id"`
+	Subject    *string        `gorm:"column:subject" json:"subject"`
+	Body       string         `gorm:"column:body" json:"body"`
+	CreatedBy  *int64         `gorm:"column:created_by" json:"created_by"`
+	UpdatedBy  *int64         `gorm:"column:updated_by" json:"updated_by"`
+	DeletedBy  *int64         `gorm:"column:deleted_by" json:"deleted_by"`
+	DeletedAt  gorm.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+	CreatedAt  *time.Time     `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt  *time.Time     `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TableName specifies the table name for ReminderTemplate model
+func (ReminderTemplate) TableName() string {
+	return "reminder_template"
+}
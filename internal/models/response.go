@@ -22,6 +22,8 @@ type PaginationMeta struct {
 	PageSize   int   `json:"page_size"`
 	TotalItems int64 `json:"total_items"`
 	TotalPages int   `json:"total_pages"`
+	// NextCursor is set in cursor mode while more rows follow
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // ErrorDetail represents validation error detail
@@ -16,16 +16,16 @@ type SalesOrder struct {
 	DocDate           *time.Time        `gorm:"column:docdate;type:date" json:"doc_date"`
 	InvNumber         *string           `gorm:"column:invnumber" json:"inv_number"`
 	Address           *string           `gorm:"column:address" json:"address"`
-	DeliveryCost      *float64          `gorm:"column:deliverycost;type:numeric" json:"delivery_cost"`
-	TotalAmount       *float64          `gorm:"column:totalamounth;type:numeric" json:"total_amount"`
-	TotalPayment      *float64          `gorm:"column:totalpayment;type:numeric" json:"total_payment"`
-	Outstanding       *float64          `gorm:"column:outstanding;type:numeric" json:"outstanding"`
-	TotalVoucher      *float64          `gorm:"column:totalvoucher;type:numeric" json:"total_voucher"`
+	DeliveryCost      *Money            `gorm:"column:deliverycost;type:numeric" json:"delivery_cost"`
+	TotalAmount       *Money            `gorm:"column:totalamounth;type:numeric" json:"total_amount"`
+	TotalPayment      *Money            `gorm:"column:totalpayment;type:numeric" json:"total_payment"`
+	Outstanding       *Money            `gorm:"column:outstanding;type:numeric" json:"outstanding"`
+	TotalVoucher      *Money            `gorm:"column:totalvoucher;type:numeric" json:"total_voucher"`
 	VoucherNumber     *string           `gorm:"column:vouchernumbeer " json:"voucher_number"`
 	PostedDate        *time.Time        `gorm:"column:posteddate;type:date" json:"posted_date"`
 	Migrated          *bool             `gorm:"column:migrated" json:"migrated"`
-	AdditionalCost    *float64          `gorm:"column:maddittionalcost;type:numeric" json:"additional_cost"`
-	PreviousPayment   *float64          `gorm:"column:mpreviouspayment;type:numeric" json:"previous_payment"`
+	AdditionalCost    *Money            `gorm:"column:maddittionalcost;type:numeric" json:"additional_cost"`
+	PreviousPayment   *Money            `gorm:"column:mpreviouspayment;type:numeric" json:"previous_payment"`
 	FullyPaid         *bool             `gorm:"column:fullypaid" json:"fully_paid"`
 	Note              *string           `gorm:"column:note" json:"note"`
 	StatusID          *int              `gorm:"column:status_id" json:"status_id"`
@@ -44,7 +44,7 @@ type SalesOrder struct {
 
 // TableName specifies the table name for SalesOrder model
 func (SalesOrder) TableName() string {
-	return "alana.sales_order"
+	return "sales_order"
 }
 
 // BeforeCreate hook to generate UUID before creating a new record
@@ -3,13 +3,14 @@ package models
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // SalesOrderService represents the sales_order_service table in the database
 type SalesOrderService struct {
 	ID                  int            `gorm:"primaryKey;column:id ;autoIncrement" json:"id"`
-	SalesOrderID        *int           `gorm:"column:salesorder_id" json:"sales_order_id"`
+	SalesOrderID        *uuid.UUID     `gorm:"column:salesorder_id" json:"sales_order_id"`
 	SalesOrderDetailID  *int           `gorm:"column:salesorderdetail_id" json:"sales_order_detail_id"`
 	ServiceID           *int           `gorm:"column:service_id" json:"service_id"`
 	TreatmentID         *int           `gorm:"column:treatment_id" json:"treatment_id"`
@@ -17,7 +18,13 @@ type SalesOrderService struct {
 	RemindedID          *int           `gorm:"column:reminded_id" json:"reminded_id"`
 	ServiceName         *string        `gorm:"column:servicename" json:"service_name"`
 	Treated             *bool          `gorm:"column:treated" json:"treated"`
+	TreatedAt           *time.Time     `gorm:"column:treated_at" json:"treated_at"`
 	Schedule            *time.Time     `gorm:"column:schedule;type:date" json:"schedule"`
+	ReminderStatus      *string        `gorm:"column:reminderstatus" json:"reminder_status"`
+	RemindedAt          *time.Time     `gorm:"column:reminded_at" json:"reminded_at"`
+	ReminderFor         *time.Time     `gorm:"column:reminderfor;type:date" json:"reminder_for"`
+	ReminderAttempts    int            `gorm:"column:reminderattempts" json:"reminder_attempts"`
+	ReminderError       *string        `gorm:"column:remindererror" json:"reminder_error"`
 	CreatedBy           *int64         `gorm:"column:created_by" json:"created_by"`
 	UpdatedBy           *int64         `gorm:"column:updated_by" json:"updated_by"`
 	DeletedBy           *int64         `gorm:"column:deleted_by" json:"deleted_by"`
@@ -28,5 +35,5 @@ type SalesOrderService struct {
 
 // TableName specifies the table name for SalesOrderService model
 func (SalesOrderService) TableName() string {
-	return "alana.sales_order_service"
+	return "sales_order_service"
 }
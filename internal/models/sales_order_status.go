@@ -20,5 +20,5 @@ type SalesOrderStatus struct {
 
 // TableName specifies the table name for SalesOrderStatus model
 func (SalesOrderStatus) TableName() string {
-	return "alana.sales_order_status"
+	return "sales_order_status"
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SalesOrderStatusLog represents the sales_order_status_log table in the
+// database: one status change of a sales order and the date it took effect.
+// FromStatusID is nil when the order had no status before the change.
+type SalesOrderStatusLog struct {
+	ID            int        `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
+	SalesOrderID  uuid.UUID  `gorm:"type:uuid;column:salesorder_id" json:"sales_order_id"`
+	Event         string     `gorm:"column:event" json:"event"`
+	FromStatusID  *int       `gorm:"column:from_status_id" json:"from_status_id"`
+	StatusID      int        `gorm:"column:status_id" json:"status_id"`
+	EffectiveDate time.Time  `gorm:"column:effective_date;type:date" json:"effective_date"`
+	CreatedBy     *int64     `gorm:"column:created_by" json:"created_by"`
+	CreatedAt     *time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName specifies the table name for SalesOrderStatusLog model
+func (SalesOrderStatusLog) TableName() string {
+	return "sales_order_status_log"
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Stock movement directions
+const (
+	StockOut = "out"
+	StockIn  = "in"
+)
+
+// Stock movement outbox statuses
+const (
+	StockMovementPending = "pending"
+	StockMovementSent    = "sent"
+)
+
+// StockMovement represents the stock_movement_outbox table: a stock movement
+// of a treatment consumable waiting for, or delivered to, the inventory
+// service. Quantity is in UnitID as recorded on the treatment detail;
+// BaseQuantity is converted to BaseUnitID.
+type StockMovement struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primaryKey;column:id" json:"id"`
+	Seq               int64      `gorm:"column:seq;<-:false" json:"seq"`
+	Direction         string     `gorm:"column:direction" json:"direction"`
+	TreatmentID       uuid.UUID  `gorm:"type:uuid;column:treatment_id" json:"treatment_id"`
+	TreatmentDetailID int        `gorm:"column:treatmentdetail_id" json:"treatment_detail_id"`
+	ReversesID        *uuid.UUID `gorm:"type:uuid;column:reverses_id" json:"reverses_id"`
+	LocationID        *int       `gorm:"column:location_id" json:"location_id"`
+	ItemID            int        `gorm:"column:item_id" json:"item_id"`
+	UnitID            *int       `gorm:"column:unit_id" json:"unit_id"`
+	Quantity          int        `gorm:"column:quantity" json:"quantity"`
+	BaseUnitID        *int       `gorm:"column:baseunit_id" json:"base_unit_id"`
+	BaseQuantity      int        `gorm:"column:basequantity" json:"base_quantity"`
+	MovementDate      time.Time  `gorm:"column:movementdate;type:date" json:"movement_date"`
+	Status            string     `gorm:"column:status" json:"status"`
+	Attempts          int        `gorm:"column:attempts" json:"attempts"`
+	LastError         *string    `gorm:"column:lasterror" json:"last_error"`
+	SentAt            *time.Time `gorm:"column:sent_at" json:"sent_at"`
+	CreatedBy         *int64     `gorm:"column:created_by" json:"created_by"`
+	CreatedAt         *time.Time `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName specifies the table name for StockMovement model
+func (StockMovement) TableName() string {
+	return "stock_movement_outbox"
+}
+
+// BeforeCreate hook to generate UUID before creating a new record
+func (m *StockMovement) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
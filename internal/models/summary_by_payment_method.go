@@ -11,7 +11,7 @@ type SummaryByPaymentMethod struct {
 	ID              int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
 	BookkeepingID   *int           `gorm:"column:bookkeeping_id" json:"bookkeeping_id"`
 	PaymentMethodID *int           `gorm:"column:paymentmethod_id" json:"payment_method_id"`
-	Total           *float64       `gorm:"column:total;type:numeric" json:"total"`
+	Total           *Money         `gorm:"column:total;type:numeric" json:"total"`
 	CreatedBy       *int64         `gorm:"column:created_by" json:"created_by"`
 	UpdatedBy       *int64         `gorm:"column:updated_by" json:"updated_by"`
 	DeletedBy       *int64         `gorm:"column:deleted_by" json:"deleted_by"`
@@ -26,5 +26,5 @@ type SummaryByPaymentMethod struct {
 
 // TableName specifies the table name for SummaryByPaymentMethod model
 func (SummaryByPaymentMethod) TableName() string {
-	return "alana.summary_by_payment_method"
+	return "summary_by_payment_method"
 }
@@ -12,7 +12,7 @@ type SummaryByTransactionTypeAndPaymentMethod struct {
 	BookkeepingID   *int           `gorm:"column:bookkeeping_id" json:"bookkeeping_id"`
 	TypeID          *int           `gorm:"column:type_id" json:"type_id"`
 	PaymentMethodID *int           `gorm:"column:paymentmethod_id" json:"payment_method_id"`
-	Total           *float64       `gorm:"column:total;type:numeric" json:"total"`
+	Total           *Money         `gorm:"column:total;type:numeric" json:"total"`
 	CreatedBy       *int64         `gorm:"column:created_by" json:"created_by"`
 	UpdatedBy       *int64         `gorm:"column:updated_by" json:"updated_by"`
 	DeletedBy       *int64         `gorm:"column:deleted_by" json:"deleted_by"`
@@ -28,5 +28,5 @@ type SummaryByTransactionTypeAndPaymentMethod struct {
 
 // TableName specifies the table name for SummaryByTransactionTypeAndPaymentMethod model
 func (SummaryByTransactionTypeAndPaymentMethod) TableName() string {
-	return "alana.summary_by_transaction_type_and_payment_method"
+	return "summary_by_transaction_type_and_payment_method"
 }
@@ -12,7 +12,7 @@ type Treatment struct {
 	ID                   uuid.UUID      `gorm:"type:uuid;primaryKey;column:id" json:"id"`
 	LocationID           *int           `gorm:"column:location_id" json:"location_id"`
 	CustomerID           *int           `gorm:"column:costumer_id" json:"customer_id"`
-	SalesOrderID         *int           `gorm:"column:salesorder_id" json:"sales_order_id"`
+	SalesOrderID         *uuid.UUID     `gorm:"column:salesorder_id" json:"sales_order_id"`
 	SalesOrderDetailID   *int           `gorm:"column:salesorderdetail_id" json:"sales_order_detail_id"`
 	SalesOrderServiceID  *int           `gorm:"column:salesorderservice_id" json:"sales_order_service_id"`
 	ServiceID            *int           `gorm:"column:service_id" json:"service_id"`
@@ -24,8 +24,14 @@ type Treatment struct {
 	DocDate              *time.Time     `gorm:"column:docdate;type:date" json:"doc_date"`
 	PostedDate           *time.Time     `gorm:"column:posteddate;type:date" json:"posted_date"`
 	ServiceText          *string        `gorm:"column:servicetext" json:"service_text"`
+	SessionNumber        *int           `gorm:"column:sessionnumber" json:"session_number"`
+	ExpiryOverrideBy     *int64         `gorm:"column:expiryoverride_by" json:"expiry_override_by"`
 	Note                 *string        `gorm:"column:note" json:"note"`
 	StatusID             *int           `gorm:"column:status_id" json:"status_id"`
+	StartedAt            *time.Time     `gorm:"column:started_at" json:"started_at"`
+	CompletedAt          *time.Time     `gorm:"column:completed_at" json:"completed_at"`
+	SignedOffAt          *time.Time     `gorm:"column:signedoff_at" json:"signed_off_at"`
+	SignedOffBy          *int64         `gorm:"column:signedoff_by" json:"signed_off_by"`
 	CreatedBy            *int64         `gorm:"column:created_by" json:"created_by"`
 	UpdatedBy            *int64         `gorm:"column:updated_by" json:"updated_by"`
 	DeletedBy            *int64         `gorm:"column:deleted_by" json:"deleted_by"`
@@ -34,12 +40,13 @@ type Treatment struct {
 	UpdatedAt            *time.Time     `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
 	// Relationships
+	Status               *TreatmentStatus  `gorm:"foreignKey:StatusID;references:ID" json:"status,omitempty"`
 	Details              []TreatmentDetail `gorm:"foreignKey:TreatmentID;references:ID" json:"details,omitempty"`
 }
 
 // TableName specifies the table name for Treatment model
 func (Treatment) TableName() string {
-	return "alana.treatment"
+	return "treatment"
 }
 
 // BeforeCreate hook to generate UUID before creating a new record
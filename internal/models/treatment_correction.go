@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TreatmentSnapshot is a treatment as JSON, stored in a jsonb column and
+// marshalled as the object it holds
+type TreatmentSnapshot json.RawMessage
+
+// Value implements driver.Valuer
+func (s TreatmentSnapshot) Value() (driver.Value, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return string(s), nil
+}
+
+// Scan implements sql.Scanner
+func (s *TreatmentSnapshot) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*s = nil
+	case []byte:
+		*s = append((*s)[:0], v...)
+	case string:
+		*s = TreatmentSnapshot(v)
+	default:
+		return fmt.Errorf("cannot scan %T into TreatmentSnapshot", value)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (s TreatmentSnapshot) MarshalJSON() ([]byte, error) {
+	if s == nil {
+		return []byte("null"), nil
+	}
+	return s, nil
+}
+
+// TreatmentCorrection represents the treatment_correction table in the
+// database: a change to a completed treatment, with the treatment as it
+// was before and after the change
+type TreatmentCorrection struct {
+	ID          int               `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
+	TreatmentID uuid.UUID         `gorm:"type:uuid;column:treatment_id" json:"treatment_id"`
+	Reason      string            `gorm:"column:reason" json:"reason"`
+	Original    TreatmentSnapshot `gorm:"column:original;type:jsonb" json:"original"`
+	Corrected   TreatmentSnapshot `gorm:"column:corrected;type:jsonb" json:"corrected"`
+	CreatedBy   *int64            `gorm:"column:created_by" json:"created_by"`
+	CreatedAt   *time.Time        `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// TableName specifies the table name for TreatmentCorrection model
+func (TreatmentCorrection) TableName() string {
+	return "treatment_correction"
+}
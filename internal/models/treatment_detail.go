@@ -3,13 +3,14 @@ package models
 import (
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 // TreatmentDetail represents the treatment_detail table in the database
 type TreatmentDetail struct {
 	ID          int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
-	TreatmentID *int           `gorm:"column:treatment_id" json:"treatment_id"`
+	TreatmentID *uuid.UUID     `gorm:"type:uuid;column:treatment_id" json:"treatment_id"`
 	ItemID      *int           `gorm:"column:item_id" json:"item_id"`
 	UnitID      *int           `gorm:"column:unit_id" json:"unit_id"`
 	Quantity    *int           `gorm:"column:quantity" json:"quantity"`
@@ -23,5 +24,5 @@ type TreatmentDetail struct {
 
 // TableName specifies the table name for TreatmentDetail model
 func (TreatmentDetail) TableName() string {
-	return "alana.treatment_detail"
+	return "treatment_detail"
 }
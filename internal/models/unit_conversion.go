@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UnitConversion represents the unit_conversion table: how many base units
+// of an item one unit holds. A rule without ItemID applies to every item.
+type UnitConversion struct {
+	ID         int            `gorm:"primaryKey;column:id;autoIncrement" json:"id"`
+	ItemID     *int           `gorm:"column:item_id" json:"item_id"`
+	UnitID     int            `gorm:"column:unit_id" json:"unit_id"`
+	BaseUnitID int            `gorm:"column:baseunit_id" json:"base_unit_id"`
+	Factor     int            `gorm:"column:factor" json:"factor"`
+	Note       *string        `gorm:"column:note" json:"note"`
+	CreatedBy  *int64         `gorm:"column:created_by" json:"created_by"`
+	UpdatedBy  *int64         `gorm:"column:updated_by" json:"updated_by"`
+	DeletedBy  *int64         `gorm:"column:deleted_by" json:"deleted_by"`
+	DeletedAt  gorm.DeletedAt `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+	CreatedAt  *time.Time     `gorm:"column:created_at;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt  *time.Time     `gorm:"column:updated_at;default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// TableName specifies the table name for UnitConversion model
+func (UnitConversion) TableName() string {
+	return "unit_conversion"
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileNotifier appends every message to a file as a JSON line instead of
+// delivering it. It stands in for a real channel in development and tests.
+type FileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileNotifier(path string) (*FileNotifier, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return &FileNotifier{path: path}, nil
+}
+
+// fileEntry is a line of the notifier file
+type fileEntry struct {
+	ID     string    `json:"id"`
+	SentAt time.Time `json:"sent_at"`
+	Message
+}
+
+func (n *FileNotifier) Send(ctx context.Context, message Message) (string, error) {
+	entry := fileEntry{ID: uuid.NewString(), SentAt: time.Now(), Message: message}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return "", err
+	}
+	return entry.ID, nil
+}
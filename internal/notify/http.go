@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// HTTPNotifier posts every message as JSON to a messaging endpoint, which
+// answers 2xx with {"id": "<message id>"}
+type HTTPNotifier struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewHTTPNotifier(url, token string, timeout time.Duration) *HTTPNotifier {
+	return &HTTPNotifier{url: url, token: token, client: &http.Client{Timeout: timeout}}
+}
+
+func (n *HTTPNotifier) Send(ctx context.Context, message Message) (string, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("notifier returned %s: %s", resp.Status, bytes.TrimSpace(payload))
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return "", fmt.Errorf("notifier returned an unreadable response: %w", err)
+	}
+	if result.ID == "" {
+		return "", fmt.Errorf("notifier returned no message id")
+	}
+	return result.ID, nil
+}
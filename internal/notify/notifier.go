@@ -0,0 +1,42 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"pos-mojosoft-so-service/internal/config"
+)
+
+// Message is a rendered notification for a customer. The customer's contact
+// details are resolved by the delivery channel from CustomerID.
+type Message struct {
+	Tenant     string `json:"tenant"`
+	Kind       string `json:"kind"`
+	CustomerID *int   `json:"customer_id"`
+	Subject    string `json:"subject,omitempty"`
+	Body       string `json:"body"`
+	// Reference identifies what the message is about, e.g.
+	// "sales_order_service:42", so that a retry can be recognised
+	Reference string `json:"reference"`
+}
+
+// Notifier delivers messages. Send returns the channel's message ID, which
+// is recorded as the service's message_log_detail_id.
+type Notifier interface {
+	Send(ctx context.Context, message Message) (string, error)
+}
+
+// New returns the notifier selected by cfg.Driver
+func New(cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Driver {
+	case "file":
+		return NewFileNotifier(cfg.FilePath)
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("NOTIFIER_URL is required for the http notifier")
+		}
+		return NewHTTPNotifier(cfg.URL, cfg.Token, cfg.Timeout), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier driver %q", cfg.Driver)
+	}
+}
@@ -0,0 +1,643 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+var ErrAppointmentNotFound = errors.New("appointment not found")
+
+// AppointmentError reports a change the appointment's status does not allow
+type AppointmentError struct {
+	ID     uuid.UUID
+	Reason string
+}
+
+func (e *AppointmentError) Error() string {
+	return fmt.Sprintf("cannot change appointment %s: %s", e.ID, e.Reason)
+}
+
+// AppointmentConflict is a booked appointment holding a room, staff member
+// or customer that a booking also needs
+type AppointmentConflict struct {
+	AppointmentID uuid.UUID `json:"appointment_id"`
+	Resource      string    `json:"resource"`
+	ResourceID    int       `json:"resource_id"`
+	StartsAt      time.Time `json:"starts_at"`
+	EndsAt        time.Time `json:"ends_at"`
+}
+
+// ConflictError reports a booking that overlaps other appointments
+type ConflictError struct {
+	Conflicts []AppointmentConflict
+}
+
+func (e *ConflictError) Error() string {
+	held := make([]string, 0, len(e.Conflicts))
+	for _, conflict := range e.Conflicts {
+		held = append(held, fmt.Sprintf("%s %d is booked from %s to %s",
+			conflict.Resource, conflict.ResourceID,
+			conflict.StartsAt.Format(time.RFC3339), conflict.EndsAt.Format(time.RFC3339)))
+	}
+	return "time slot is taken: " + strings.Join(held, "; ")
+}
+
+// AppointmentChange moves an appointment. Resources left nil are kept.
+type AppointmentChange struct {
+	StartsAt     time.Time
+	EndsAt       time.Time
+	RoomID       *int
+	DoctorID     *int
+	NurseID      *int
+	BeauticianID *int
+	Note         *string
+}
+
+// AvailabilityQuery asks for the free slots of a location on a day for
+// the given room and staff
+type AvailabilityQuery struct {
+	LocationID   int
+	Date         time.Time
+	Duration     time.Duration
+	RoomID       *int
+	DoctorID     *int
+	NurseID      *int
+	BeauticianID *int
+}
+
+// AvailableSlot is a slot of the day and whether it can still be booked
+type AvailableSlot struct {
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Available bool      `json:"available"`
+}
+
+// DayAppointment is an appointment as listed in the day view
+type DayAppointment struct {
+	models.Appointment
+	ServiceName *string `gorm:"column:servicename" json:"service_name"`
+	InvNumber   *string `gorm:"column:invnumber" json:"inv_number"`
+}
+
+// AppointmentDay is the front desk's view of a location's day
+type AppointmentDay struct {
+	Date         string                  `json:"date"`
+	LocationID   int                     `json:"location_id"`
+	Hours        models.AppointmentHours `json:"hours"`
+	Appointments []DayAppointment        `json:"appointments"`
+	Booked       int                     `json:"booked"`
+	Cancelled    int                     `json:"cancelled"`
+}
+
+// appointmentResource is a room, staff member or customer an appointment
+// holds for its duration
+type appointmentResource struct {
+	name string
+	id   int
+}
+
+var appointmentResourceColumns = map[string]string{
+	"room":       "room_id",
+	"doctor":     "doctor_id",
+	"nurse":      "nurse_id",
+	"beautician": "beautician_id",
+	"customer":   "customer_id",
+}
+
+func appointmentResources(a *models.Appointment) []appointmentResource {
+	var resources []appointmentResource
+	for _, resource := range []struct {
+		name string
+		id   *int
+	}{
+		{"room", a.RoomID},
+		{"doctor", a.DoctorID},
+		{"nurse", a.NurseID},
+		{"beautician", a.BeauticianID},
+		{"customer", a.CustomerID},
+	} {
+		if resource.id != nil {
+			resources = append(resources, appointmentResource{name: resource.name, id: *resource.id})
+		}
+	}
+	return resources
+}
+
+// holds reports whether a booked appointment at locationID holds the
+// resource. Rooms belong to a location; staff and customers do not.
+func (r appointmentResource) holds(a models.Appointment, locationID int) bool {
+	var id *int
+	switch r.name {
+	case "room":
+		if a.LocationID != locationID {
+			return false
+		}
+		id = a.RoomID
+	case "doctor":
+		id = a.DoctorID
+	case "nurse":
+		id = a.NurseID
+	case "beautician":
+		id = a.BeauticianID
+	case "customer":
+		id = a.CustomerID
+	}
+	return id != nil && *id == r.id
+}
+
+// AppointmentScheduler books the rooms and staff of a location in slots of
+// its opening hours and refuses double bookings. Bookings of the same
+// resource are serialised with transaction-scoped advisory locks, so two
+// concurrent requests cannot both take the last free slot.
+type AppointmentScheduler struct {
+	states   *SalesOrderStateMachine
+	defaults models.AppointmentHours
+}
+
+// NewAppointmentScheduler uses defaults for locations without their own
+// appointment_hours row
+func NewAppointmentScheduler(states *SalesOrderStateMachine, defaults models.AppointmentHours) *AppointmentScheduler {
+	return &AppointmentScheduler{states: states, defaults: defaults}
+}
+
+// Hours returns the opening hours of a location, or the defaults
+func (s *AppointmentScheduler) Hours(tx *gorm.DB, locationID int) (models.AppointmentHours, error) {
+	var stored []models.AppointmentHours
+	if err := tx.Where("location_id = ?", locationID).Limit(1).Find(&stored).Error; err != nil {
+		return models.AppointmentHours{}, err
+	}
+	hours := s.defaults
+	if len(stored) > 0 {
+		hours = stored[0]
+	}
+	hours.LocationID = locationID
+
+	opens, err := parseClock(hours.OpensAt)
+	if err != nil {
+		return hours, fmt.Errorf("opening time of location %d: %w", locationID, err)
+	}
+	closes, err := parseClock(hours.ClosesAt)
+	if err != nil {
+		return hours, fmt.Errorf("closing time of location %d: %w", locationID, err)
+	}
+	if hours.SlotMinutes <= 0 {
+		return hours, fmt.Errorf("slot length of location %d must be positive", locationID)
+	}
+	hours.OpensAt, hours.ClosesAt = opens.Format("15:04"), closes.Format("15:04")
+	return hours, nil
+}
+
+// ValidateHours checks opening hours before they are saved
+func ValidateHours(hours *models.AppointmentHours) ValidationErrors {
+	var errs ValidationErrors
+	opens, err := parseClock(hours.OpensAt)
+	if err != nil {
+		errs = append(errs, models.ErrorDetail{Field: "opens_at", Message: "Time must be a valid time in HH:MM format"})
+	}
+	closes, err2 := parseClock(hours.ClosesAt)
+	if err2 != nil {
+		errs = append(errs, models.ErrorDetail{Field: "closes_at", Message: "Time must be a valid time in HH:MM format"})
+	}
+	if err == nil && err2 == nil && !closes.After(opens) {
+		errs = append(errs, models.ErrorDetail{Field: "closes_at", Message: "Closing time must be after opening time"})
+	}
+	if hours.SlotMinutes <= 0 {
+		errs = append(errs, models.ErrorDetail{Field: "slot_minutes", Message: "Slot length must be positive"})
+	}
+	return errs
+}
+
+// parseClock reads a time of day as stored ("15:04:05") or sent ("15:04")
+func parseClock(value string) (time.Time, error) {
+	if clock, err := time.Parse("15:04:05", value); err == nil {
+		return clock, nil
+	}
+	return time.Parse("15:04", value)
+}
+
+// openingHours returns when the location opens and closes on the day of
+// date in loc
+func openingHours(hours models.AppointmentHours, date time.Time, loc *time.Location) (opens, closes time.Time) {
+	local := date.In(loc)
+	at := func(value string) time.Time {
+		clock, _ := parseClock(value)
+		return time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	}
+	return at(hours.OpensAt), at(hours.ClosesAt)
+}
+
+// validateTimes checks that an appointment lies on whole slots within the
+// opening hours of its day and does not start in the past
+func validateTimes(a *models.Appointment, hours models.AppointmentHours, loc *time.Location, now time.Time) ValidationErrors {
+	var errs ValidationErrors
+	slot := time.Duration(hours.SlotMinutes) * time.Minute
+	duration := a.EndsAt.Sub(a.StartsAt)
+	opens, closes := openingHours(hours, a.StartsAt, loc)
+
+	if duration <= 0 {
+		return ValidationErrors{{Field: "duration_minutes", Message: "Duration must be positive"}}
+	}
+	if duration%slot != 0 {
+		errs = append(errs, models.ErrorDetail{
+			Field:   "duration_minutes",
+			Message: fmt.Sprintf("Duration must be a multiple of the %d-minute slot", hours.SlotMinutes),
+		})
+	}
+	if a.StartsAt.Before(opens) || a.EndsAt.After(closes) {
+		errs = append(errs, models.ErrorDetail{
+			Field:   "start_time",
+			Message: fmt.Sprintf("Appointment must fall within opening hours %s-%s", hours.OpensAt, hours.ClosesAt),
+		})
+	} else if a.StartsAt.Sub(opens)%slot != 0 {
+		errs = append(errs, models.ErrorDetail{
+			Field:   "start_time",
+			Message: fmt.Sprintf("Appointment must start on a %d-minute slot from %s", hours.SlotMinutes, hours.OpensAt),
+		})
+	}
+	if a.StartsAt.Before(now) {
+		errs = append(errs, models.ErrorDetail{Field: "start_time", Message: "Appointment cannot start in the past"})
+	}
+	return errs
+}
+
+// Book creates an appointment. When it is for a sold service the customer
+// and sales order are taken from the service's order and the service's
+// schedule date is set to the appointment's day.
+func (s *AppointmentScheduler) Book(tx *gorm.DB, a *models.Appointment, userID int64, loc *time.Location) error {
+	a.Status = models.AppointmentBooked
+	a.CreatedBy = &userID
+
+	if err := s.linkService(tx, a); err != nil {
+		return err
+	}
+	hours, err := s.Hours(tx, a.LocationID)
+	if err != nil {
+		return err
+	}
+	if errs := validateTimes(a, hours, loc, time.Now()); len(errs) > 0 {
+		return errs
+	}
+	if err := s.reserve(tx, a); err != nil {
+		return err
+	}
+
+	if err := tx.Create(a).Error; err != nil {
+		return err
+	}
+	return syncSchedule(tx, a, loc)
+}
+
+// Reschedule moves a booked appointment to another time, and optionally to
+// other rooms or staff
+func (s *AppointmentScheduler) Reschedule(tx *gorm.DB, id uuid.UUID, change AppointmentChange, userID int64, loc *time.Location, scopes ...func(*gorm.DB) *gorm.DB) (*models.Appointment, error) {
+	a, err := s.lockBooked(tx, id, scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	a.StartsAt, a.EndsAt = change.StartsAt, change.EndsAt
+	if change.RoomID != nil {
+		a.RoomID = change.RoomID
+	}
+	if change.DoctorID != nil {
+		a.DoctorID = change.DoctorID
+	}
+	if change.NurseID != nil {
+		a.NurseID = change.NurseID
+	}
+	if change.BeauticianID != nil {
+		a.BeauticianID = change.BeauticianID
+	}
+	if change.Note != nil {
+		a.Note = change.Note
+	}
+
+	hours, err := s.Hours(tx, a.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	if errs := validateTimes(a, hours, loc, time.Now()); len(errs) > 0 {
+		return nil, errs
+	}
+	if err := s.reserve(tx, a); err != nil {
+		return nil, err
+	}
+
+	a.RescheduleCount++
+	a.UpdatedBy = &userID
+	if err := tx.Save(a).Error; err != nil {
+		return nil, err
+	}
+	return a, syncSchedule(tx, a, loc)
+}
+
+// Cancel frees the appointment's slot and clears the schedule date of its
+// service. The appointment is kept with its reason.
+func (s *AppointmentScheduler) Cancel(tx *gorm.DB, id uuid.UUID, reason *string, userID int64, scopes ...func(*gorm.DB) *gorm.DB) (*models.Appointment, error) {
+	a, err := s.lockBooked(tx, id, scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	a.Status = models.AppointmentCancelled
+	a.CancelReason = reason
+	a.CancelledAt = &now
+	a.CancelledBy = &userID
+	a.UpdatedBy = &userID
+	if err := tx.Save(a).Error; err != nil {
+		return nil, err
+	}
+	return a, syncSchedule(tx, a, time.UTC)
+}
+
+// lockBooked loads an appointment for update and checks it is still booked
+func (s *AppointmentScheduler) lockBooked(tx *gorm.DB, id uuid.UUID, scopes ...func(*gorm.DB) *gorm.DB) (*models.Appointment, error) {
+	var a models.Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Scopes(scopes...).
+		First(&a, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrAppointmentNotFound
+		}
+		return nil, err
+	}
+	if a.Status != models.AppointmentBooked {
+		return nil, &AppointmentError{ID: a.ID, Reason: "appointment is " + a.Status}
+	}
+	return &a, nil
+}
+
+// linkService fills the customer and sales order of an appointment for a
+// sold service and checks the service can still be booked
+func (s *AppointmentScheduler) linkService(tx *gorm.DB, a *models.Appointment) error {
+	if a.SalesOrderServiceID == nil {
+		if a.CustomerID == nil {
+			return ValidationErrors{{Field: "customer_id", Message: "Customer is required unless a sales order service is booked"}}
+		}
+		return nil
+	}
+
+	var service models.SalesOrderService
+	if err := tx.First(&service, *a.SalesOrderServiceID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ValidationErrors{{Field: "sales_order_service_id", Message: "Sales order service not found"}}
+		}
+		return err
+	}
+	if service.Treated != nil && *service.Treated {
+		return ValidationErrors{{Field: "sales_order_service_id", Message: "Service has already been treated"}}
+	}
+	if service.SalesOrderID == nil {
+		return ValidationErrors{{Field: "sales_order_service_id", Message: "Service is not linked to a sales order"}}
+	}
+
+	var order models.SalesOrder
+	if err := tx.First(&order, "id = ?", *service.SalesOrderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ValidationErrors{{Field: "sales_order_service_id", Message: "Sales order of the service no longer exists"}}
+		}
+		return err
+	}
+	state, err := s.states.StateOf(tx, &order)
+	if err != nil {
+		return err
+	}
+	if state == SalesOrderVoid {
+		return ValidationErrors{{Field: "sales_order_service_id", Message: "Sales order of the service is void"}}
+	}
+	if a.CustomerID != nil && order.CustomerID != nil && *a.CustomerID != *order.CustomerID {
+		return ValidationErrors{{Field: "customer_id", Message: "Service was sold to another customer"}}
+	}
+
+	a.SalesOrderID = service.SalesOrderID
+	if order.CustomerID != nil {
+		a.CustomerID = order.CustomerID
+	}
+	return nil
+}
+
+// reserve locks every resource of the appointment and fails with a
+// ConflictError when another booked appointment holds one of them in the
+// same time
+func (s *AppointmentScheduler) reserve(tx *gorm.DB, a *models.Appointment) error {
+	resources := appointmentResources(a)
+
+	keys := make([]string, 0, len(resources)+1)
+	for _, resource := range resources {
+		if resource.name == "room" {
+			keys = append(keys, fmt.Sprintf("appointment:room:%d:%d", a.LocationID, resource.id))
+		} else {
+			keys = append(keys, fmt.Sprintf("appointment:%s:%d", resource.name, resource.id))
+		}
+	}
+	if a.SalesOrderServiceID != nil {
+		keys = append(keys, fmt.Sprintf("appointment:service:%d", *a.SalesOrderServiceID))
+	}
+	// Lock in a fixed order so that two bookings never wait on each other
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+	}
+
+	if a.SalesOrderServiceID != nil {
+		var booked int64
+		query := tx.Model(&models.Appointment{}).
+			Where("salesorderservice_id = ? AND status = ?", *a.SalesOrderServiceID, models.AppointmentBooked)
+		if a.ID != uuid.Nil {
+			query = query.Where("id <> ?", a.ID)
+		}
+		if err := query.Count(&booked).Error; err != nil {
+			return err
+		}
+		if booked > 0 {
+			return ValidationErrors{{Field: "sales_order_service_id", Message: "Service already has a booked appointment; reschedule it instead"}}
+		}
+	}
+
+	overlapping, err := bookedOverlapping(tx, resources, a.LocationID, a.StartsAt, a.EndsAt, a.ID)
+	if err != nil {
+		return err
+	}
+	var conflicts []AppointmentConflict
+	for _, other := range overlapping {
+		for _, resource := range resources {
+			if resource.holds(other, a.LocationID) {
+				conflicts = append(conflicts, AppointmentConflict{
+					AppointmentID: other.ID,
+					Resource:      resource.name,
+					ResourceID:    resource.id,
+					StartsAt:      other.StartsAt,
+					EndsAt:        other.EndsAt,
+				})
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		return &ConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// bookedOverlapping finds the booked appointments between from and to that
+// hold any of the resources, other than exclude
+func bookedOverlapping(tx *gorm.DB, resources []appointmentResource, locationID int, from, to time.Time, exclude uuid.UUID) ([]models.Appointment, error) {
+	if len(resources) == 0 {
+		return nil, nil
+	}
+
+	conditions := make([]string, 0, len(resources))
+	args := make([]interface{}, 0, 2*len(resources))
+	for _, resource := range resources {
+		column := appointmentResourceColumns[resource.name]
+		if resource.name == "room" {
+			conditions = append(conditions, "(location_id = ? AND room_id = ?)")
+			args = append(args, locationID, resource.id)
+		} else {
+			conditions = append(conditions, column+" = ?")
+			args = append(args, resource.id)
+		}
+	}
+
+	query := tx.Where("status = ? AND starts_at < ? AND ends_at > ?", models.AppointmentBooked, to, from).
+		Where("("+strings.Join(conditions, " OR ")+")", args...)
+	if exclude != uuid.Nil {
+		query = query.Where("id <> ?", exclude)
+	}
+
+	var appointments []models.Appointment
+	err := query.Order("starts_at").Find(&appointments).Error
+	return appointments, err
+}
+
+// syncSchedule keeps the schedule date of the appointment's service on the
+// day of the appointment, and clears it once the appointment is cancelled
+func syncSchedule(tx *gorm.DB, a *models.Appointment, loc *time.Location) error {
+	if a.SalesOrderServiceID == nil {
+		return nil
+	}
+	var schedule interface{}
+	if a.Status == models.AppointmentBooked {
+		schedule = a.StartsAt.In(loc).Format("2006-01-02")
+	}
+	return tx.Model(&models.SalesOrderService{}).Where("id = ?", *a.SalesOrderServiceID).
+		UpdateColumn("schedule", schedule).Error
+}
+
+// requireNoBookedAppointment refuses to remove a service that still holds a
+// booked appointment; the appointment has to be cancelled first
+func requireNoBookedAppointment(tx *gorm.DB, serviceID int) error {
+	var booked int64
+	if err := tx.Model(&models.Appointment{}).
+		Where("salesorderservice_id = ? AND status = ?", serviceID, models.AppointmentBooked).
+		Count(&booked).Error; err != nil {
+		return err
+	}
+	if booked > 0 {
+		return ValidationErrors{{
+			Field:   "services",
+			Message: fmt.Sprintf("Service %d has a booked appointment; cancel it first", serviceID),
+		}}
+	}
+	return nil
+}
+
+// Availability lists the slots of the day and whether the requested room and
+// staff are all free for the duration starting at each. Slots in the past
+// are not available.
+func (s *AppointmentScheduler) Availability(tx *gorm.DB, query AvailabilityQuery, loc *time.Location) ([]AvailableSlot, error) {
+	hours, err := s.Hours(tx, query.LocationID)
+	if err != nil {
+		return nil, err
+	}
+	slot := time.Duration(hours.SlotMinutes) * time.Minute
+	duration := query.Duration
+	if duration == 0 {
+		duration = slot
+	}
+	if duration < 0 || duration%slot != 0 {
+		return nil, ValidationErrors{{
+			Field:   "duration_minutes",
+			Message: fmt.Sprintf("Duration must be a multiple of the %d-minute slot", hours.SlotMinutes),
+		}}
+	}
+
+	opens, closes := openingHours(hours, query.Date, loc)
+	resources := appointmentResources(&models.Appointment{
+		RoomID:       query.RoomID,
+		DoctorID:     query.DoctorID,
+		NurseID:      query.NurseID,
+		BeauticianID: query.BeauticianID,
+	})
+	booked, err := bookedOverlapping(tx, resources, query.LocationID, opens, closes, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	slots := make([]AvailableSlot, 0)
+	for start := opens; !start.Add(duration).After(closes); start = start.Add(slot) {
+		end := start.Add(duration)
+		available := !start.Before(now)
+		for _, other := range booked {
+			if available && other.StartsAt.Before(end) && other.EndsAt.After(start) {
+				available = false
+			}
+		}
+		slots = append(slots, AvailableSlot{StartsAt: start, EndsAt: end, Available: available})
+	}
+	return slots, nil
+}
+
+// Day lists the appointments of a location starting on the day of date in
+// loc, in start order. Cancelled appointments are included when asked for.
+func (s *AppointmentScheduler) Day(tx *gorm.DB, locationID int, date time.Time, loc *time.Location, includeCancelled bool) (*AppointmentDay, error) {
+	hours, err := s.Hours(tx, locationID)
+	if err != nil {
+		return nil, err
+	}
+	local := date.In(loc)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	query := tx.Model(&models.Appointment{}).
+		Select("appointment.*, sales_order_service.servicename, sales_order.invnumber").
+		Joins("LEFT JOIN sales_order_service ON sales_order_service.id = appointment.salesorderservice_id").
+		Joins("LEFT JOIN sales_order ON sales_order.id = appointment.salesorder_id").
+		Where("appointment.location_id = ? AND appointment.starts_at >= ? AND appointment.starts_at < ?", locationID, dayStart, dayEnd)
+	if !includeCancelled {
+		query = query.Where("appointment.status = ?", models.AppointmentBooked)
+	}
+
+	var appointments []DayAppointment
+	if err := query.Order("appointment.starts_at, appointment.room_id").Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+
+	day := &AppointmentDay{
+		Date:         dayStart.Format("2006-01-02"),
+		LocationID:   locationID,
+		Hours:        hours,
+		Appointments: appointments,
+	}
+	if day.Appointments == nil {
+		day.Appointments = []DayAppointment{}
+	}
+	for _, appointment := range appointments {
+		if appointment.Status == models.AppointmentBooked {
+			day.Booked++
+		} else {
+			day.Cancelled++
+		}
+	}
+	return day, nil
+}
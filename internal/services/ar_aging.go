@@ -0,0 +1,253 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// Aging buckets by days since the order's document date
+const (
+	ARAgingBucket0To30  = "0-30"
+	ARAgingBucket31To60 = "31-60"
+	ARAgingBucket61To90 = "61-90"
+	ARAgingBucketOver90 = "90+"
+)
+
+// ARAgingFilter narrows the aging report; nil fields match everything
+type ARAgingFilter struct {
+	LocationID *int
+	CustomerID *int
+}
+
+// ARAgingBuckets splits an outstanding amount by age
+type ARAgingBuckets struct {
+	Days0To30  models.Money `json:"days_0_30"`
+	Days31To60 models.Money `json:"days_31_60"`
+	Days61To90 models.Money `json:"days_61_90"`
+	Over90     models.Money `json:"over_90"`
+	Total      models.Money `json:"total"`
+}
+
+func (b *ARAgingBuckets) add(bucket string, amount models.Money) {
+	switch bucket {
+	case ARAgingBucket0To30:
+		b.Days0To30 = b.Days0To30.Add(amount)
+	case ARAgingBucket31To60:
+		b.Days31To60 = b.Days31To60.Add(amount)
+	case ARAgingBucket61To90:
+		b.Days61To90 = b.Days61To90.Add(amount)
+	default:
+		b.Over90 = b.Over90.Add(amount)
+	}
+	b.Total = b.Total.Add(amount)
+}
+
+// ARAgingOrder is a sales order with a balance still owed on the as-of date
+type ARAgingOrder struct {
+	SalesOrderID uuid.UUID    `json:"sales_order_id"`
+	InvNumber    *string      `json:"inv_number"`
+	CustomerID   *int         `json:"customer_id"`
+	LocationID   *int         `json:"location_id"`
+	DocDate      time.Time    `json:"doc_date"`
+	Days         int          `json:"days"`
+	Bucket       string       `json:"bucket"`
+	TotalAmount  models.Money `json:"total_amount"`
+	Paid         models.Money `json:"paid"`
+	Outstanding  models.Money `json:"outstanding"`
+}
+
+// ARAgingCustomer is what one customer owes, by age
+type ARAgingCustomer struct {
+	CustomerID *int           `json:"customer_id"`
+	Buckets    ARAgingBuckets `json:"buckets"`
+	Orders     []ARAgingOrder `json:"orders"`
+}
+
+// ARAgingReport is the receivables outstanding on a date, per customer and
+// in total
+type ARAgingReport struct {
+	AsOf      time.Time         `json:"as_of"`
+	Customers []ARAgingCustomer `json:"customers"`
+	Totals    ARAgingBuckets    `json:"totals"`
+}
+
+// ARAging ages the outstanding balance of posted and paid sales orders
+type ARAging struct {
+	states *SalesOrderStateMachine
+}
+
+func NewARAging(states *SalesOrderStateMachine) *ARAging {
+	return &ARAging{states: states}
+}
+
+// Build returns the receivables outstanding at the end of asOf. An order
+// counts when it is dated on or before asOf and was posted or paid at the
+// end of that day (see receivableOn). What it owed then is its current
+// outstanding balance plus the allocations of receipts dated after asOf, so
+// a past date is not reduced by later payments.
+func (a *ARAging) Build(tx *gorm.DB, asOf time.Time, filter ARAgingFilter) (*ARAgingReport, error) {
+	ids, err := a.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	day := asOf.Format("2006-01-02")
+	query := tx.Where("docdate <= ?", day).
+		Where(receivableOn(day, []int{ids[SalesOrderPosted], ids[SalesOrderPaid]}))
+	if filter.LocationID != nil {
+		query = query.Where("location_id = ?", *filter.LocationID)
+	}
+	if filter.CustomerID != nil {
+		query = query.Where("costumer_id = ?", *filter.CustomerID)
+	}
+	var orders []models.SalesOrder
+	if err := query.Order("docdate, created_at, id").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+
+	later, err := a.allocatedAfter(tx, orders, day)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ARAgingReport{AsOf: asOf, Customers: []ARAgingCustomer{}}
+	customers := make(map[int]int)
+	for i := range orders {
+		order := &orders[i]
+		total := amountOrZero(order.TotalAmount)
+		outstanding := amountOrZero(order.Outstanding).Add(later[order.ID])
+		if outstanding.Cmp(total) > 0 {
+			outstanding = total
+		}
+		if !outstanding.IsPositive() {
+			continue
+		}
+
+		days := daysBetween(*order.DocDate, asOf)
+		entry := ARAgingOrder{
+			SalesOrderID: order.ID,
+			InvNumber:    order.InvNumber,
+			CustomerID:   order.CustomerID,
+			LocationID:   order.LocationID,
+			DocDate:      *order.DocDate,
+			Days:         days,
+			Bucket:       agingBucket(days),
+			TotalAmount:  total,
+			Paid:         total.Sub(outstanding),
+			Outstanding:  outstanding,
+		}
+
+		key := -1
+		if order.CustomerID != nil {
+			key = *order.CustomerID
+		}
+		index, seen := customers[key]
+		if !seen {
+			index = len(report.Customers)
+			customers[key] = index
+			report.Customers = append(report.Customers, ARAgingCustomer{CustomerID: order.CustomerID})
+		}
+		customer := &report.Customers[index]
+		customer.Orders = append(customer.Orders, entry)
+		customer.Buckets.add(entry.Bucket, outstanding)
+		report.Totals.add(entry.Bucket, outstanding)
+	}
+
+	// Largest debtors first; orders without a customer last
+	sort.SliceStable(report.Customers, func(i, j int) bool {
+		left, right := report.Customers[i], report.Customers[j]
+		if (left.CustomerID == nil) != (right.CustomerID == nil) {
+			return right.CustomerID == nil
+		}
+		if cmp := left.Buckets.Total.Cmp(right.Buckets.Total); cmp != 0 {
+			return cmp > 0
+		}
+		return left.CustomerID != nil && *left.CustomerID < *right.CustomerID
+	})
+	return report, nil
+}
+
+// receivableOn matches sales orders whose status at the end of day was one
+// of statusIDs. The status log answers that: the status set by the last
+// change on or before day or, when every change came later, the status the
+// first one changed from. An order with no logged change still has the
+// status it had then, unless it was posted after day. When the first logged
+// change came later the posting may predate the log; the posted date is
+// only trusted if no post or reopen has been logged since.
+func receivableOn(day string, statusIDs []int) clause.Expr {
+	return gorm.Expr(`CASE
+		WHEN EXISTS (SELECT 1 FROM sales_order_status_log log
+			WHERE log.salesorder_id = sales_order.id AND log.effective_date <= ?)
+		THEN (SELECT log.status_id FROM sales_order_status_log log
+			WHERE log.salesorder_id = sales_order.id AND log.effective_date <= ?
+			ORDER BY log.effective_date DESC, log.id DESC LIMIT 1) IN ?
+		WHEN EXISTS (SELECT 1 FROM sales_order_status_log log WHERE log.salesorder_id = sales_order.id)
+		THEN COALESCE((SELECT log.from_status_id FROM sales_order_status_log log
+			WHERE log.salesorder_id = sales_order.id
+			ORDER BY log.effective_date, log.id LIMIT 1) IN ?, false)
+			AND (posteddate IS NULL OR posteddate <= ? OR EXISTS (SELECT 1 FROM sales_order_status_log log
+				WHERE log.salesorder_id = sales_order.id AND log.event IN ?))
+		ELSE status_id IN ? AND (posteddate IS NULL OR posteddate <= ?)
+		END`,
+		day, day, statusIDs,
+		statusIDs, day, []string{string(SalesOrderEventPost), string(SalesOrderEventReopen)},
+		statusIDs, day)
+}
+
+// allocatedAfter sums, per order, the allocations of receipts dated after day
+func (a *ARAging) allocatedAfter(tx *gorm.DB, orders []models.SalesOrder, day string) (map[uuid.UUID]models.Money, error) {
+	later := make(map[uuid.UUID]models.Money)
+	if len(orders) == 0 {
+		return later, nil
+	}
+	orderIDs := make([]uuid.UUID, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.ID)
+	}
+
+	type allocatedRow struct {
+		SalesOrderID uuid.UUID    `gorm:"column:salesorder_id"`
+		Amount       models.Money `gorm:"column:amount"`
+	}
+	var rows []allocatedRow
+	if err := tx.Model(&models.ARReceiptDetail{}).
+		Select("ar_receipt_detail.salesorder_id, COALESCE(SUM(ar_receipt_detail.receiptamount), 0) AS amount").
+		Joins("JOIN ar_receipt ON ar_receipt.id = ar_receipt_detail.arreceipt_id AND ar_receipt.deleted_at IS NULL").
+		Where("ar_receipt_detail.salesorder_id IN ?", orderIDs).
+		Where("ar_receipt.docdate > ?", day).
+		Group("ar_receipt_detail.salesorder_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		later[row.SalesOrderID] = row.Amount
+	}
+	return later, nil
+}
+
+// agingBucket returns the bucket of an order dated days before the as-of date
+func agingBucket(days int) string {
+	switch {
+	case days <= 30:
+		return ARAgingBucket0To30
+	case days <= 60:
+		return ARAgingBucket31To60
+	case days <= 90:
+		return ARAgingBucket61To90
+	default:
+		return ARAgingBucketOver90
+	}
+}
+
+// daysBetween counts calendar days from one date to another, ignoring the
+// time of day and timezone the dates were loaded in
+func daysBetween(from, to time.Time) int {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(end.Sub(start).Hours() / 24)
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// Statement entry types
+const (
+	StatementEntryOrder   = "order"
+	StatementEntryReceipt = "receipt"
+)
+
+// StatementPeriod is the inclusive date range a statement covers; nil bounds are open
+type StatementPeriod struct {
+	From *time.Time `json:"from"`
+	To   *time.Time `json:"to"`
+}
+
+// StatementEntry is one line of the running balance: an order raises the
+// balance by its total, a receipt lowers it by the amount received
+type StatementEntry struct {
+	Date       *time.Time   `json:"date"`
+	Type       string       `json:"type"`
+	DocumentID uuid.UUID    `json:"document_id"`
+	DocNumber  *string      `json:"doc_number"`
+	Debit      models.Money `json:"debit"`
+	Credit     models.Money `json:"credit"`
+	Balance    models.Money `json:"balance"`
+}
+
+// StatementOrder is a posted or paid order with what is still owed on it
+type StatementOrder struct {
+	ID           uuid.UUID       `json:"id"`
+	InvNumber    *string         `json:"inv_number"`
+	DocDate      *time.Time      `json:"doc_date"`
+	PostedDate   *time.Time      `json:"posted_date"`
+	State        SalesOrderState `json:"state"`
+	TotalAmount  models.Money    `json:"total_amount"`
+	TotalPayment models.Money    `json:"total_payment"`
+	Outstanding  models.Money    `json:"outstanding"`
+	FullyPaid    bool            `json:"fully_paid"`
+}
+
+// StatementReceipt is an AR receipt taken from the customer
+type StatementReceipt struct {
+	ID          uuid.UUID    `json:"id"`
+	InvNumber   *string      `json:"inv_number"`
+	DocDate     *time.Time   `json:"doc_date"`
+	TotalAmount models.Money `json:"total_amount"`
+}
+
+// PackageSessions is the session balance of a package line: the quantity
+// sold is the number of sessions, UsedSessions counts those redeemed. Once
+// the package has expired its unused sessions are forfeited rather than
+// remaining.
+type PackageSessions struct {
+	SalesOrderID       uuid.UUID  `json:"sales_order_id"`
+	InvNumber          *string    `json:"inv_number"`
+	SalesOrderDetailID int        `json:"sales_order_detail_id"`
+	ItemID             *int       `json:"item_id"`
+	ItemName           *string    `json:"item_name"`
+	ExpiryDate         *time.Time `json:"expiry_date"`
+	Expired            bool       `json:"expired"`
+	Sessions           int        `json:"sessions"`
+	UsedSessions       int        `json:"used_sessions"`
+	ForfeitedSessions  int        `json:"forfeited_sessions"`
+	RemainingSessions  int        `json:"remaining_sessions"`
+}
+
+// StatementTreatment is a treatment performed for the customer
+type StatementTreatment struct {
+	ID                  uuid.UUID  `json:"id"`
+	DocNumber           *string    `json:"doc_number"`
+	DocDate             *time.Time `json:"doc_date"`
+	SalesOrderID        *uuid.UUID `json:"sales_order_id"`
+	SalesOrderDetailID  *int       `json:"sales_order_detail_id"`
+	SessionNumber       *int       `json:"session_number"`
+	SalesOrderServiceID *int       `json:"sales_order_service_id"`
+	ServiceID           *int       `json:"service_id"`
+	ServiceText         *string    `json:"service_text"`
+	DoctorID            *int       `json:"doctor_id"`
+	BeauticianID        *int       `json:"beautician_id"`
+}
+
+// CustomerStatement is everything a customer bought, paid and still has
+// to use within a period
+type CustomerStatement struct {
+	CustomerID       int                  `json:"customer_id"`
+	Period           StatementPeriod      `json:"period"`
+	OpeningBalance   models.Money         `json:"opening_balance"`
+	TotalOrdered     models.Money         `json:"total_ordered"`
+	TotalReceived    models.Money         `json:"total_received"`
+	ClosingBalance   models.Money         `json:"closing_balance"`
+	TotalOutstanding models.Money         `json:"total_outstanding"`
+	Entries          []StatementEntry     `json:"entries"`
+	Orders           []StatementOrder     `json:"orders"`
+	Receipts         []StatementReceipt   `json:"receipts"`
+	Packages         []PackageSessions    `json:"packages"`
+	Treatments       []StatementTreatment `json:"treatments"`
+}
+
+// CustomerStatements builds customer statements from orders, receipts,
+// package lines and treatments
+type CustomerStatements struct {
+	states *SalesOrderStateMachine
+}
+
+func NewCustomerStatements(states *SalesOrderStateMachine) *CustomerStatements {
+	return &CustomerStatements{states: states}
+}
+
+// Build returns the statement of a customer for the period. Only posted and
+// paid orders count towards the balance; drafts and voided orders are left
+// out. locationID restricts every document to one location when set; today
+// decides which packages have expired.
+func (s *CustomerStatements) Build(tx *gorm.DB, customerID int, period StatementPeriod, locationID *int, today time.Time) (*CustomerStatement, error) {
+	ids, err := s.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+	billed := []int{ids[SalesOrderPosted], ids[SalesOrderPaid]}
+
+	orderScope := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("costumer_id = ? AND status_id IN ?", customerID, billed)
+		if locationID != nil {
+			db = db.Where("location_id = ?", *locationID)
+		}
+		return db
+	}
+	receiptScope := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("customer_id = ?", customerID)
+		if locationID != nil {
+			db = db.Where("lacation_id = ?", *locationID)
+		}
+		return db
+	}
+
+	statement := &CustomerStatement{
+		CustomerID: customerID,
+		Period:     period,
+		Entries:    []StatementEntry{},
+		Orders:     []StatementOrder{},
+		Receipts:   []StatementReceipt{},
+		Packages:   []PackageSessions{},
+		Treatments: []StatementTreatment{},
+	}
+
+	if period.From != nil {
+		from := period.From.Format("2006-01-02")
+		ordered, err := sumMoney(tx.Model(&models.SalesOrder{}).Scopes(orderScope).
+			Where("docdate < ?", from), "totalamounth")
+		if err != nil {
+			return nil, err
+		}
+		received, err := sumMoney(tx.Model(&models.ARReceipt{}).Scopes(receiptScope).
+			Where("docdate < ?", from), "totalamounth")
+		if err != nil {
+			return nil, err
+		}
+		statement.OpeningBalance = ordered.Sub(received)
+	}
+
+	var orders []models.SalesOrder
+	if err := tx.Scopes(orderScope, periodScope(period)).
+		Order("docdate, created_at").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	var receipts []models.ARReceipt
+	if err := tx.Scopes(receiptScope, periodScope(period)).
+		Order("docdate, created_at").Find(&receipts).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		state, err := stateOf(ids, order)
+		if err != nil {
+			return nil, err
+		}
+		total := amountOrZero(order.TotalAmount)
+		statement.Orders = append(statement.Orders, StatementOrder{
+			ID:           order.ID,
+			InvNumber:    order.InvNumber,
+			DocDate:      order.DocDate,
+			PostedDate:   order.PostedDate,
+			State:        state,
+			TotalAmount:  total,
+			TotalPayment: amountOrZero(order.TotalPayment),
+			Outstanding:  amountOrZero(order.Outstanding),
+			FullyPaid:    order.FullyPaid != nil && *order.FullyPaid,
+		})
+		statement.Entries = append(statement.Entries, StatementEntry{
+			Date:       order.DocDate,
+			Type:       StatementEntryOrder,
+			DocumentID: order.ID,
+			DocNumber:  order.InvNumber,
+			Debit:      total,
+		})
+		statement.TotalOrdered = statement.TotalOrdered.Add(total)
+		statement.TotalOutstanding = statement.TotalOutstanding.Add(amountOrZero(order.Outstanding))
+	}
+
+	for i := range receipts {
+		receipt := &receipts[i]
+		amount := amountOrZero(receipt.TotalAmount)
+		statement.Receipts = append(statement.Receipts, StatementReceipt{
+			ID:          receipt.ID,
+			InvNumber:   receipt.InvNumber,
+			DocDate:     receipt.DocDate,
+			TotalAmount: amount,
+		})
+		statement.Entries = append(statement.Entries, StatementEntry{
+			Date:       receipt.DocDate,
+			Type:       StatementEntryReceipt,
+			DocumentID: receipt.ID,
+			DocNumber:  receipt.InvNumber,
+			Credit:     amount,
+		})
+		statement.TotalReceived = statement.TotalReceived.Add(amount)
+	}
+
+	// Orders come before receipts of the same day so a same-day payment
+	// never shows a credit balance
+	sort.SliceStable(statement.Entries, func(i, j int) bool {
+		a, b := statement.Entries[i], statement.Entries[j]
+		if !sameDay(a.Date, b.Date) {
+			return dateBefore(a.Date, b.Date)
+		}
+		return a.Type == StatementEntryOrder && b.Type == StatementEntryReceipt
+	})
+	balance := statement.OpeningBalance
+	for i := range statement.Entries {
+		balance = balance.Add(statement.Entries[i].Debit).Sub(statement.Entries[i].Credit)
+		statement.Entries[i].Balance = balance
+	}
+	statement.ClosingBalance = balance
+
+	packages, err := s.Packages(tx, customerID, locationID, today)
+	if err != nil {
+		return nil, err
+	}
+	statement.Packages = packages
+
+	var treatments []models.Treatment
+	treatmentQuery := tx.Scopes(periodScope(period)).Where("costumer_id = ?", customerID)
+	if locationID != nil {
+		treatmentQuery = treatmentQuery.Where("location_id = ?", *locationID)
+	}
+	if err := treatmentQuery.Order("docdate, created_at").Find(&treatments).Error; err != nil {
+		return nil, err
+	}
+	for _, treatment := range treatments {
+		statement.Treatments = append(statement.Treatments, StatementTreatment{
+			ID:                  treatment.ID,
+			DocNumber:           treatment.DocNumber,
+			DocDate:             treatment.DocDate,
+			SalesOrderID:        treatment.SalesOrderID,
+			SalesOrderDetailID:  treatment.SalesOrderDetailID,
+			SessionNumber:       treatment.SessionNumber,
+			SalesOrderServiceID: treatment.SalesOrderServiceID,
+			ServiceID:           treatment.ServiceID,
+			ServiceText:         treatment.ServiceText,
+			DoctorID:            treatment.DoctorID,
+			BeauticianID:        treatment.BeauticianID,
+		})
+	}
+
+	return statement, nil
+}
+
+// Packages returns the session balance of every package line the customer
+// bought on a posted or paid order. A package line is a detail that has at
+// least one service linked to it. today decides which packages have expired.
+func (s *CustomerStatements) Packages(tx *gorm.DB, customerID int, locationID *int, today time.Time) ([]PackageSessions, error) {
+	ids, err := s.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	type packageRow struct {
+		models.SalesOrderDetail
+		InvNumber *string `gorm:"column:invnumber"`
+	}
+	query := tx.Model(&models.SalesOrderDetail{}).
+		Select("sales_order_detail.*, sales_order.invnumber").
+		Joins("JOIN sales_order ON sales_order.id = sales_order_detail.salesorder_id AND sales_order.deleted_at IS NULL").
+		Where("sales_order.costumer_id = ? AND sales_order.status_id IN ?", customerID, []int{ids[SalesOrderPosted], ids[SalesOrderPaid]}).
+		Where("EXISTS (SELECT 1 FROM sales_order_service WHERE sales_order_service.salesorderdetail_id = sales_order_detail.id AND sales_order_service.deleted_at IS NULL)")
+	if locationID != nil {
+		query = query.Where("sales_order.location_id = ?", *locationID)
+	}
+
+	var rows []packageRow
+	if err := query.Order("sales_order.docdate, sales_order_detail.id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	packages := make([]PackageSessions, 0, len(rows))
+	for _, row := range rows {
+		sessions := intOrZero(row.Quantity)
+		used := intOrZero(row.UsedSessions)
+		remaining := sessions - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		forfeited := 0
+		expired := packageExpired(&row.SalesOrderDetail, today)
+		if expired {
+			forfeited, remaining = remaining, 0
+		}
+		packages = append(packages, PackageSessions{
+			SalesOrderID:       *row.SalesOrderID,
+			InvNumber:          row.InvNumber,
+			SalesOrderDetailID: row.ID,
+			ItemID:             row.ItemID,
+			ItemName:           row.ItemName,
+			ExpiryDate:         row.ExpiryDate,
+			Expired:            expired,
+			Sessions:           sessions,
+			UsedSessions:       used,
+			ForfeitedSessions:  forfeited,
+			RemainingSessions:  remaining,
+		})
+	}
+	return packages, nil
+}
+
+// periodScope limits a query to documents dated within the period
+func periodScope(period StatementPeriod) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if period.From != nil {
+			db = db.Where("docdate >= ?", period.From.Format("2006-01-02"))
+		}
+		if period.To != nil {
+			db = db.Where("docdate <= ?", period.To.Format("2006-01-02"))
+		}
+		return db
+	}
+}
+
+// sumMoney returns the sum of a numeric column over the rows of query
+func sumMoney(query *gorm.DB, column string) (models.Money, error) {
+	var total models.Money
+	err := query.Select("COALESCE(SUM(" + column + "), 0)").Row().Scan(&total)
+	return total, err
+}
+
+func intOrZero(value *int) int {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+func sameDay(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+// dateBefore orders undated documents last
+func dateBefore(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a != nil
+	}
+	return a.Before(*b)
+}
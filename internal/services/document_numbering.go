@@ -0,0 +1,134 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// DocumentType names a numbered document kind; it keys both the sequence
+// and the format tables
+type DocumentType string
+
+const (
+	DocumentSalesOrder DocumentType = "sales_order"
+	DocumentTreatment  DocumentType = "treatment"
+	DocumentARReceipt  DocumentType = "ar_receipt"
+)
+
+// seqPlaceholder matches {seq} and {seq:N}, where N is the zero-padded width
+var seqPlaceholder = regexp.MustCompile(`\{seq(?::(\d+))?\}`)
+
+// DocumentNumber is an allocated number: the raw sequence value and the
+// formatted document number
+type DocumentNumber struct {
+	Sequence  int64
+	Formatted string
+}
+
+// DocumentNumbering issues gap-free document numbers per tenant, location and year
+type DocumentNumbering struct {
+	formats map[DocumentType]string
+}
+
+func NewDocumentNumbering(cfg config.DocNumberingConfig) *DocumentNumbering {
+	return &DocumentNumbering{
+		formats: map[DocumentType]string{
+			DocumentSalesOrder: cfg.SalesOrderFormat,
+			DocumentTreatment:  cfg.TreatmentFormat,
+			DocumentARReceipt:  cfg.ARReceiptFormat,
+		},
+	}
+}
+
+// Next allocates the next number for the document type at the location in
+// the year of date. It must run inside the transaction that creates the
+// document: the sequence row stays locked until that transaction ends, so
+// concurrent callers wait for each other and a rollback releases the number.
+func (n *DocumentNumbering) Next(tx *gorm.DB, docType DocumentType, locationID *int, date time.Time) (*DocumentNumber, error) {
+	format, err := n.formatFor(tx, docType)
+	if err != nil {
+		return nil, err
+	}
+
+	location := 0
+	if locationID != nil {
+		location = *locationID
+	}
+
+	var sequence int64
+	if err := tx.Raw(`INSERT INTO document_sequence (document_type, location_id, year, last_number)
+		VALUES (?, ?, ?, 1)
+		ON CONFLICT (document_type, location_id, year)
+		DO UPDATE SET last_number = document_sequence.last_number + 1, updated_at = CURRENT_TIMESTAMP
+		RETURNING last_number`, string(docType), location, date.Year()).
+		Scan(&sequence).Error; err != nil {
+		return nil, fmt.Errorf("failed to allocate %s number: %w", docType, err)
+	}
+
+	code, err := n.locationCode(tx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DocumentNumber{
+		Sequence:  sequence,
+		Formatted: renderDocumentNumber(format, code, date, sequence),
+	}, nil
+}
+
+// formatFor returns the tenant's format for the document type, falling back
+// to the configured default
+func (n *DocumentNumbering) formatFor(tx *gorm.DB, docType DocumentType) (string, error) {
+	var formats []models.DocumentFormat
+	if err := tx.Where("document_type = ?", string(docType)).Limit(1).Find(&formats).Error; err != nil {
+		return "", fmt.Errorf("failed to load %s number format: %w", docType, err)
+	}
+
+	format := n.formats[docType]
+	if len(formats) > 0 && formats[0].Format != "" {
+		format = formats[0].Format
+	}
+	if !seqPlaceholder.MatchString(format) {
+		return "", fmt.Errorf("%s number format %q has no {seq} placeholder", docType, format)
+	}
+	return format, nil
+}
+
+// locationCode returns the short code of a location, or its ID when no code is set
+func (n *DocumentNumbering) locationCode(tx *gorm.DB, locationID int) (string, error) {
+	var codes []models.DocumentLocationCode
+	if err := tx.Where("location_id = ?", locationID).Limit(1).Find(&codes).Error; err != nil {
+		return "", fmt.Errorf("failed to load location code: %w", err)
+	}
+	if len(codes) > 0 && codes[0].Code != "" {
+		return codes[0].Code, nil
+	}
+	return strconv.Itoa(locationID), nil
+}
+
+// renderDocumentNumber fills the {location}, {year}, {yy}, {month} and
+// {seq}/{seq:N} placeholders of a format
+func renderDocumentNumber(format, location string, date time.Time, sequence int64) string {
+	number := strings.NewReplacer(
+		"{location}", location,
+		"{year}", strconv.Itoa(date.Year()),
+		"{yy}", fmt.Sprintf("%02d", date.Year()%100),
+		"{month}", fmt.Sprintf("%02d", int(date.Month())),
+	).Replace(format)
+
+	return seqPlaceholder.ReplaceAllStringFunc(number, func(placeholder string) string {
+		width := seqPlaceholder.FindStringSubmatch(placeholder)[1]
+		if width == "" {
+			return strconv.FormatInt(sequence, 10)
+		}
+		size, _ := strconv.Atoi(width)
+		return fmt.Sprintf("%0*d", size, sequence)
+	})
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// ExpiredPackage is a package line that expired with sessions unused. The
+// unused sessions are forfeited and DeferredRevenue is their share of the
+// line total, which can now be recognised.
+type ExpiredPackage struct {
+	SalesOrderID       uuid.UUID    `json:"sales_order_id"`
+	InvNumber          *string      `json:"inv_number"`
+	LocationID         *int         `json:"location_id"`
+	CustomerID         *int         `json:"customer_id"`
+	SalesOrderDetailID int          `json:"sales_order_detail_id"`
+	ItemID             *int         `json:"item_id"`
+	ItemName           *string      `json:"item_name"`
+	ExpiryDate         time.Time    `json:"expiry_date"`
+	ForfeitedAt        *time.Time   `json:"forfeited_at"`
+	Sessions           int          `json:"sessions"`
+	UsedSessions       int          `json:"used_sessions"`
+	ForfeitedSessions  int          `json:"forfeited_sessions"`
+	ItemTotal          models.Money `json:"item_total"`
+	DeferredRevenue    models.Money `json:"deferred_revenue"`
+}
+
+// ExpiredPackagesReport lists the packages that expired in a period
+type ExpiredPackagesReport struct {
+	Period                 StatementPeriod  `json:"period"`
+	Packages               []ExpiredPackage `json:"packages"`
+	TotalForfeitedSessions int              `json:"total_forfeited_sessions"`
+	TotalDeferredRevenue   models.Money     `json:"total_deferred_revenue"`
+}
+
+// PackageExpiry dates package lines when their order is posted and forfeits
+// the sessions left on them once they expire. The validity of a line comes
+// from the package_validity rule of its item, or else of its services.
+type PackageExpiry struct {
+	states *SalesOrderStateMachine
+}
+
+func NewPackageExpiry(states *SalesOrderStateMachine) *PackageExpiry {
+	return &PackageExpiry{states: states}
+}
+
+// Stamp sets the expiry date of every package line of a posted order,
+// counting from its posted date. Lines without a validity rule never expire.
+func (e *PackageExpiry) Stamp(tx *gorm.DB, order *models.SalesOrder) error {
+	if order.PostedDate == nil {
+		return nil
+	}
+
+	var details []models.SalesOrderDetail
+	if err := tx.Where("salesorder_id = ?", order.ID).Find(&details).Error; err != nil {
+		return err
+	}
+	var services []models.SalesOrderService
+	if err := tx.Where("salesorder_id = ? AND salesorderdetail_id IS NOT NULL", order.ID).
+		Find(&services).Error; err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		return nil
+	}
+
+	serviceIDs := make(map[int][]int)
+	var allServiceIDs, itemIDs []int
+	for _, service := range services {
+		if service.ServiceID != nil {
+			serviceIDs[*service.SalesOrderDetailID] = append(serviceIDs[*service.SalesOrderDetailID], *service.ServiceID)
+			allServiceIDs = append(allServiceIDs, *service.ServiceID)
+		}
+	}
+	for _, detail := range details {
+		if detail.ItemID != nil {
+			itemIDs = append(itemIDs, *detail.ItemID)
+		}
+	}
+
+	var rules []models.PackageValidity
+	if err := tx.Where("item_id IN ? OR service_id IN ?", itemIDs, allServiceIDs).
+		Find(&rules).Error; err != nil {
+		return err
+	}
+	itemRules := make(map[int]models.PackageValidity)
+	serviceRules := make(map[int]models.PackageValidity)
+	for _, rule := range rules {
+		if rule.ItemID != nil {
+			itemRules[*rule.ItemID] = rule
+		} else if rule.ServiceID != nil {
+			serviceRules[*rule.ServiceID] = rule
+		}
+	}
+
+	hasServices := make(map[int]bool, len(services))
+	for _, service := range services {
+		hasServices[*service.SalesOrderDetailID] = true
+	}
+
+	for _, detail := range details {
+		if !hasServices[detail.ID] {
+			continue
+		}
+		expiry, found := lineExpiry(detail, serviceIDs[detail.ID], itemRules, serviceRules, *order.PostedDate)
+		if !found {
+			continue
+		}
+		if err := tx.Model(&detail).UpdateColumn("expirydate", expiry.Format("2006-01-02")).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineExpiry picks the item's rule, or else the earliest expiry among the
+// rules of the line's services
+func lineExpiry(detail models.SalesOrderDetail, serviceIDs []int, itemRules, serviceRules map[int]models.PackageValidity, posted time.Time) (time.Time, bool) {
+	if detail.ItemID != nil {
+		if rule, exists := itemRules[*detail.ItemID]; exists {
+			return rule.ExpiryDate(posted), true
+		}
+	}
+	var expiry time.Time
+	found := false
+	for _, serviceID := range serviceIDs {
+		rule, exists := serviceRules[serviceID]
+		if !exists {
+			continue
+		}
+		if candidate := rule.ExpiryDate(posted); !found || candidate.Before(expiry) {
+			expiry, found = candidate, true
+		}
+	}
+	return expiry, found
+}
+
+// Clear removes the expiry dates and forfeitures of a reopened order; they
+// are set again when it is posted
+func (e *PackageExpiry) Clear(tx *gorm.DB, orderID uuid.UUID) error {
+	return tx.Model(&models.SalesOrderDetail{}).Where("salesorder_id = ?", orderID).
+		UpdateColumns(map[string]interface{}{
+			"expirydate":        nil,
+			"forfeitedsessions": nil,
+			"forfeited_at":      nil,
+		}).Error
+}
+
+// Forfeit flags the unused sessions of package lines on posted and paid
+// orders that expired before today. Lines flagged earlier are brought up to
+// date when sessions were redeemed or returned since. It returns the number
+// of lines changed.
+func (e *PackageExpiry) Forfeit(tx *gorm.DB, today time.Time) (int64, error) {
+	ids, err := e.states.statusIDs(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	result := tx.Exec(`UPDATE sales_order_detail AS d
+		SET forfeitedsessions = GREATEST(COALESCE(d.quantity, 0) - COALESCE(d.usedsessions, 0), 0),
+		    forfeited_at = COALESCE(d.forfeited_at, CURRENT_TIMESTAMP)
+		FROM sales_order AS o
+		WHERE o.id = d.salesorder_id AND o.deleted_at IS NULL AND o.status_id IN ?
+		  AND d.deleted_at IS NULL AND d.expirydate < ?
+		  AND (d.forfeited_at IS NULL OR
+		       d.forfeitedsessions IS DISTINCT FROM GREATEST(COALESCE(d.quantity, 0) - COALESCE(d.usedsessions, 0), 0))`,
+		[]int{ids[SalesOrderPosted], ids[SalesOrderPaid]}, today.Format("2006-01-02"))
+	return result.RowsAffected, result.Error
+}
+
+// Expired reports the package lines on posted and paid orders that expired
+// within the period (on their expiry date) before today with sessions
+// unused, whether or not the forfeiture job has flagged them yet
+func (e *PackageExpiry) Expired(tx *gorm.DB, period StatementPeriod, locationID *int, today time.Time) (*ExpiredPackagesReport, error) {
+	ids, err := e.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	type expiredRow struct {
+		models.SalesOrderDetail
+		InvNumber  *string `gorm:"column:invnumber"`
+		LocationID *int    `gorm:"column:location_id"`
+		CustomerID *int    `gorm:"column:costumer_id"`
+	}
+	query := tx.Model(&models.SalesOrderDetail{}).
+		Select("sales_order_detail.*, sales_order.invnumber, sales_order.location_id, sales_order.costumer_id").
+		Joins("JOIN sales_order ON sales_order.id = sales_order_detail.salesorder_id AND sales_order.deleted_at IS NULL").
+		Where("sales_order.status_id IN ?", []int{ids[SalesOrderPosted], ids[SalesOrderPaid]}).
+		Where("sales_order_detail.expirydate < ?", today.Format("2006-01-02")).
+		Where("COALESCE(sales_order_detail.quantity, 0) > COALESCE(sales_order_detail.usedsessions, 0)")
+	if period.From != nil {
+		query = query.Where("sales_order_detail.expirydate >= ?", period.From.Format("2006-01-02"))
+	}
+	if period.To != nil {
+		query = query.Where("sales_order_detail.expirydate <= ?", period.To.Format("2006-01-02"))
+	}
+	if locationID != nil {
+		query = query.Where("sales_order.location_id = ?", *locationID)
+	}
+
+	var rows []expiredRow
+	if err := query.Order("sales_order_detail.expirydate, sales_order_detail.id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	report := &ExpiredPackagesReport{Period: period, Packages: make([]ExpiredPackage, 0, len(rows))}
+	for _, row := range rows {
+		sessions := intOrZero(row.Quantity)
+		used := intOrZero(row.UsedSessions)
+		forfeited := sessions - used
+		itemTotal := amountOrZero(row.ItemTotal)
+		deferred, err := itemTotal.Ratio(int64(forfeited), int64(sessions))
+		if err != nil {
+			return nil, err
+		}
+
+		report.Packages = append(report.Packages, ExpiredPackage{
+			SalesOrderID:       *row.SalesOrderID,
+			InvNumber:          row.InvNumber,
+			LocationID:         row.LocationID,
+			CustomerID:         row.CustomerID,
+			SalesOrderDetailID: row.ID,
+			ItemID:             row.ItemID,
+			ItemName:           row.ItemName,
+			ExpiryDate:         *row.ExpiryDate,
+			ForfeitedAt:        row.ForfeitedAt,
+			Sessions:           sessions,
+			UsedSessions:       used,
+			ForfeitedSessions:  forfeited,
+			ItemTotal:          itemTotal,
+			DeferredRevenue:    deferred,
+		})
+		report.TotalForfeitedSessions += forfeited
+		report.TotalDeferredRevenue = report.TotalDeferredRevenue.Add(deferred)
+	}
+	return report, nil
+}
+
+// packageExpired reports whether the package line's last redeemable day is
+// before today
+func packageExpired(detail *models.SalesOrderDetail, today time.Time) bool {
+	return detail.ExpiryDate != nil && detail.ExpiryDate.Format("2006-01-02") < today.Format("2006-01-02")
+}
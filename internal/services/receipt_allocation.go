@@ -0,0 +1,311 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+var ErrReceiptNotFound = errors.New("AR receipt not found")
+
+// Allocation applies part of a receipt to a sales order
+type Allocation struct {
+	SalesOrderID uuid.UUID
+	Amount       models.Money
+}
+
+// ReceiptAllocation applies AR receipts to the outstanding balance of posted
+// sales orders. Each allocation is an ar_receipt_detail row; the order's
+// total_payment, outstanding and fully_paid change with it in the same
+// transaction, and an order paid in full moves to Paid.
+type ReceiptAllocation struct {
+	states *SalesOrderStateMachine
+}
+
+func NewReceiptAllocation(states *SalesOrderStateMachine) *ReceiptAllocation {
+	return &ReceiptAllocation{states: states}
+}
+
+// LockReceipt loads and locks the receipt with the given ID for the rest of
+// tx, so allocations to it are serialised; scopes are applied to the lookup
+func (a *ReceiptAllocation) LockReceipt(tx *gorm.DB, receiptID uuid.UUID, scopes ...func(*gorm.DB) *gorm.DB) (*models.ARReceipt, error) {
+	var receipt models.ARReceipt
+	if err := tx.Scopes(scopes...).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&receipt, "id = ?", receiptID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrReceiptNotFound
+		}
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// Allocated returns the amount of the receipt applied to sales orders
+func (a *ReceiptAllocation) Allocated(tx *gorm.DB, receiptID uuid.UUID) (models.Money, error) {
+	return sumMoney(tx.Model(&models.ARReceiptDetail{}).Where("arreceipt_id = ?", receiptID), "receiptamount")
+}
+
+// Allocate applies the receipt to the given orders inside tx. The receipt
+// must be locked with LockReceipt. Each amount must be positive and at most
+// the order's outstanding balance, and together with what is already
+// allocated they must not exceed the receipt's total_amount; a receipt
+// without a total takes the sum of its allocations. scopes are applied to
+// the sales orders so callers can restrict them (e.g. by location); an order
+// they exclude is reported as not found.
+func (a *ReceiptAllocation) Allocate(tx *gorm.DB, receipt *models.ARReceipt, allocations []Allocation, userID int64, today time.Time, scopes ...func(*gorm.DB) *gorm.DB) ([]models.ARReceiptDetail, error) {
+	var errs ValidationErrors
+	seen := make(map[uuid.UUID]bool, len(allocations))
+	var requested models.Money
+	for i, allocation := range allocations {
+		if allocation.SalesOrderID == uuid.Nil {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("details[%d].sales_order_id", i), Message: "Sales order is required"})
+		} else if seen[allocation.SalesOrderID] {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("details[%d].sales_order_id", i), Message: "Sales order is allocated more than once"})
+		}
+		seen[allocation.SalesOrderID] = true
+		if !allocation.Amount.IsPositive() {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("details[%d].receipt_amount", i), Message: "Receipt amount must be greater than zero"})
+		}
+		requested = requested.Add(allocation.Amount)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	if receipt.TotalAmount != nil {
+		allocated, err := a.Allocated(tx, receipt.ID)
+		if err != nil {
+			return nil, err
+		}
+		if available := receipt.TotalAmount.Sub(allocated); requested.Cmp(available) > 0 {
+			return nil, ValidationErrors{{
+				Field:   "details",
+				Message: fmt.Sprintf("Allocations of %s exceed the unallocated receipt amount (%s)", requested, available),
+			}}
+		}
+	}
+
+	orders, err := a.lockOrders(tx, allocations, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := a.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, allocation := range allocations {
+		order := orders[allocation.SalesOrderID]
+		field := fmt.Sprintf("details[%d]", i)
+		if order == nil {
+			errs = append(errs, models.ErrorDetail{Field: field + ".sales_order_id", Message: "Sales order not found"})
+			continue
+		}
+		if receipt.CustomerID != nil && order.CustomerID != nil && *receipt.CustomerID != *order.CustomerID {
+			errs = append(errs, models.ErrorDetail{Field: field + ".sales_order_id", Message: "Sales order belongs to another customer"})
+			continue
+		}
+		state, err := stateOf(ids, order)
+		if err != nil {
+			return nil, err
+		}
+		if state != SalesOrderPosted {
+			errs = append(errs, models.ErrorDetail{Field: field + ".sales_order_id", Message: fmt.Sprintf("Only posted sales orders can be paid; this one is %s", state)})
+			continue
+		}
+		if outstanding := outstandingOf(order); allocation.Amount.Cmp(outstanding) > 0 {
+			errs = append(errs, models.ErrorDetail{
+				Field:   field + ".receipt_amount",
+				Message: fmt.Sprintf("Receipt amount %s exceeds the outstanding balance of the sales order (%s)", allocation.Amount, outstanding),
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	details := make([]models.ARReceiptDetail, 0, len(allocations))
+	for _, allocation := range allocations {
+		amount := allocation.Amount
+		salesOrderID := allocation.SalesOrderID
+		detail := models.ARReceiptDetail{
+			ARReceiptID:   &receipt.ID,
+			SalesOrderID:  &salesOrderID,
+			ReceiptAmount: &amount,
+			CreatedBy:     &userID,
+		}
+		if err := tx.Create(&detail).Error; err != nil {
+			return nil, err
+		}
+		if err := a.applyPayment(tx, orders[salesOrderID], amount, userID, today); err != nil {
+			return nil, err
+		}
+		details = append(details, detail)
+	}
+
+	if receipt.TotalAmount == nil {
+		receipt.TotalAmount = &requested
+		receipt.UpdatedBy = &userID
+		if err := tx.Save(receipt).Error; err != nil {
+			return nil, err
+		}
+	}
+	return details, nil
+}
+
+// AutoAllocate applies the unallocated amount of the receipt to the
+// customer's posted orders with an outstanding balance, oldest first by
+// posted date. The receipt must be locked with LockReceipt and have a
+// customer and a total_amount. Whatever no order is owed stays unallocated.
+// scopes restrict the orders considered, as in Allocate.
+func (a *ReceiptAllocation) AutoAllocate(tx *gorm.DB, receipt *models.ARReceipt, userID int64, today time.Time, scopes ...func(*gorm.DB) *gorm.DB) ([]models.ARReceiptDetail, error) {
+	var errs ValidationErrors
+	if receipt.CustomerID == nil {
+		errs = append(errs, models.ErrorDetail{Field: "customer_id", Message: "Customer is required to allocate automatically"})
+	}
+	if receipt.TotalAmount == nil || !receipt.TotalAmount.IsPositive() {
+		errs = append(errs, models.ErrorDetail{Field: "total_amount", Message: "Total amount is required to allocate automatically"})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	allocated, err := a.Allocated(tx, receipt.ID)
+	if err != nil {
+		return nil, err
+	}
+	remaining := receipt.TotalAmount.Sub(allocated)
+	if !remaining.IsPositive() {
+		return []models.ARReceiptDetail{}, nil
+	}
+
+	ids, err := a.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+	var open []models.SalesOrder
+	if err := tx.Scopes(scopes...).Where("costumer_id = ? AND status_id = ?", *receipt.CustomerID, ids[SalesOrderPosted]).
+		Where("COALESCE(totalamounth, 0) > COALESCE(totalpayment, 0)").
+		Order("posteddate, docdate, created_at, id").Find(&open).Error; err != nil {
+		return nil, err
+	}
+
+	var allocations []Allocation
+	for _, order := range open {
+		if !remaining.IsPositive() {
+			break
+		}
+		amount := outstandingOf(&order)
+		if amount.Cmp(remaining) > 0 {
+			amount = remaining
+		}
+		allocations = append(allocations, Allocation{SalesOrderID: order.ID, Amount: amount})
+		remaining = remaining.Sub(amount)
+	}
+	if len(allocations) == 0 {
+		return []models.ARReceiptDetail{}, nil
+	}
+	return a.Allocate(tx, receipt, allocations, userID, today, scopes...)
+}
+
+// Release reverses one allocation inside tx: the order's payment is reduced
+// by the detail's amount, a paid order returns to Posted, and the detail is
+// deleted
+func (a *ReceiptAllocation) Release(tx *gorm.DB, detail *models.ARReceiptDetail, userID int64, today time.Time) error {
+	if detail.SalesOrderID != nil && detail.ReceiptAmount != nil && !detail.ReceiptAmount.IsZero() {
+		orders, err := a.lockOrders(tx, []Allocation{{SalesOrderID: *detail.SalesOrderID}})
+		if err != nil {
+			return err
+		}
+		if order := orders[*detail.SalesOrderID]; order != nil {
+			if err := a.applyPayment(tx, order, detail.ReceiptAmount.Neg(), userID, today); err != nil {
+				return err
+			}
+		}
+	}
+
+	detail.DeletedBy = &userID
+	if err := tx.Save(detail).Error; err != nil {
+		return err
+	}
+	return tx.Delete(detail).Error
+}
+
+// Reverse releases every allocation of the receipt inside tx, as when the
+// receipt is voided
+func (a *ReceiptAllocation) Reverse(tx *gorm.DB, receipt *models.ARReceipt, userID int64, today time.Time) error {
+	var details []models.ARReceiptDetail
+	if err := tx.Where("arreceipt_id = ?", receipt.ID).Order("id").Find(&details).Error; err != nil {
+		return err
+	}
+	for i := range details {
+		if err := a.Release(tx, &details[i], userID, today); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockOrders loads and locks the sales orders of the allocations in ID
+// order, so concurrent receipts lock them in the same order. Orders excluded
+// by scopes are left out of the result.
+func (a *ReceiptAllocation) lockOrders(tx *gorm.DB, allocations []Allocation, scopes ...func(*gorm.DB) *gorm.DB) (map[uuid.UUID]*models.SalesOrder, error) {
+	orderIDs := make([]uuid.UUID, 0, len(allocations))
+	for _, allocation := range allocations {
+		orderIDs = append(orderIDs, allocation.SalesOrderID)
+	}
+	sort.Slice(orderIDs, func(i, j int) bool { return orderIDs[i].String() < orderIDs[j].String() })
+
+	var found []models.SalesOrder
+	if err := tx.Scopes(scopes...).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", orderIDs).Order("id").Find(&found).Error; err != nil {
+		return nil, err
+	}
+	orders := make(map[uuid.UUID]*models.SalesOrder, len(found))
+	for i := range found {
+		orders[found[i].ID] = &found[i]
+	}
+	return orders, nil
+}
+
+// applyPayment adds amount (negative to reverse) to the order's payment,
+// recomputes its balance and moves it between Posted and Paid to match
+func (a *ReceiptAllocation) applyPayment(tx *gorm.DB, order *models.SalesOrder, amount models.Money, userID int64, today time.Time) error {
+	payment := amountOrZero(order.TotalPayment).Add(amount)
+	outstanding := amountOrZero(order.TotalAmount).Sub(payment)
+	fullyPaid := !outstanding.IsPositive()
+	order.TotalPayment = &payment
+	order.Outstanding = &outstanding
+	order.FullyPaid = &fullyPaid
+	order.UpdatedBy = &userID
+	if err := tx.Save(order).Error; err != nil {
+		return err
+	}
+
+	ids, err := a.states.statusIDs(tx)
+	if err != nil {
+		return err
+	}
+	state, err := stateOf(ids, order)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fullyPaid && state == SalesOrderPosted:
+		_, err = a.states.Fire(tx, order.ID, SalesOrderEventPay, userID, today)
+	case !fullyPaid && state == SalesOrderPaid:
+		_, err = a.states.Fire(tx, order.ID, SalesOrderEventUnpay, userID, today)
+	}
+	return err
+}
+
+// outstandingOf returns what is still owed on the order
+func outstandingOf(order *models.SalesOrder) models.Money {
+	return amountOrZero(order.TotalAmount).Sub(amountOrZero(order.TotalPayment))
+}
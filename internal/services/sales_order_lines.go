@@ -0,0 +1,369 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// LineChanges lists the IDs of the lines a reconcile inserted, changed and
+// soft-deleted
+type LineChanges struct {
+	Added   []int `json:"added"`
+	Updated []int `json:"updated"`
+	Removed []int `json:"removed"`
+}
+
+// SalesOrderChanges is the diff applied to a sales order's nested lines
+type SalesOrderChanges struct {
+	Details  LineChanges `json:"details"`
+	Services LineChanges `json:"services"`
+}
+
+// ServiceLine is a wanted service; DetailIndex is the position in the wanted
+// details of the line the service was sold on
+type ServiceLine struct {
+	Service     models.SalesOrderService
+	DetailIndex *int
+}
+
+// SalesOrderLines reconciles the details and services of a sales order
+type SalesOrderLines struct{}
+
+func NewSalesOrderLines() *SalesOrderLines {
+	return &SalesOrderLines{}
+}
+
+// Reconcile makes the order's lines match the wanted arrays inside tx. Lines
+// with an ID update the stored line of that ID, lines without one are
+// inserted and stored lines that are not listed are soft-deleted. A nil
+// array leaves that kind of line untouched.
+func (l *SalesOrderLines) Reconcile(tx *gorm.DB, orderID uuid.UUID, details []models.SalesOrderDetail, services []ServiceLine, userID int64) (*SalesOrderChanges, error) {
+	changes := &SalesOrderChanges{
+		Details:  emptyLineChanges(),
+		Services: emptyLineChanges(),
+	}
+
+	var storedDetails []models.SalesOrderDetail
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("salesorder_id = ?", orderID).Order("id").Find(&storedDetails).Error; err != nil {
+		return nil, err
+	}
+	var storedServices []models.SalesOrderService
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("salesorder_id = ?", orderID).Order("id").Find(&storedServices).Error; err != nil {
+		return nil, err
+	}
+
+	if errs := validateLines(details, services, storedDetails, storedServices); len(errs) > 0 {
+		return nil, errs
+	}
+
+	var detailIDs []int
+	if details != nil {
+		var err error
+		detailIDs, err = l.reconcileDetails(tx, orderID, storedDetails, details, userID, &changes.Details)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if services != nil {
+		if err := l.reconcileServices(tx, orderID, storedServices, services, detailIDs, changes.Details.Removed, userID, &changes.Services); err != nil {
+			return nil, err
+		}
+	} else if len(changes.Details.Removed) > 0 {
+		// Services that are kept as-is must not point at a removed detail
+		var orphans []models.SalesOrderService
+		if err := tx.Where("salesorder_id = ? AND salesorderdetail_id IN ?", orderID, changes.Details.Removed).
+			Find(&orphans).Error; err != nil {
+			return nil, err
+		}
+		if len(orphans) > 0 {
+			var errs ValidationErrors
+			for _, orphan := range orphans {
+				errs = append(errs, models.ErrorDetail{
+					Field:   "services",
+					Message: fmt.Sprintf("Service %d is linked to removed detail %d; send services to relink it", orphan.ID, *orphan.SalesOrderDetailID),
+				})
+			}
+			return nil, errs
+		}
+	}
+
+	return changes, nil
+}
+
+// validateLines checks that wanted IDs belong to the order and appear once,
+// that detail indexes are in range, that quantities cover the sessions
+// already redeemed and that treated services are kept
+func validateLines(details []models.SalesOrderDetail, services []ServiceLine, storedDetails []models.SalesOrderDetail, storedServices []models.SalesOrderService) ValidationErrors {
+	var errs ValidationErrors
+
+	storedDetailByID := make(map[int]models.SalesOrderDetail, len(storedDetails))
+	for _, detail := range storedDetails {
+		storedDetailByID[detail.ID] = detail
+	}
+	seen := make(map[int]bool)
+	for i, detail := range details {
+		if detail.ID == 0 {
+			continue
+		}
+		stored, exists := storedDetailByID[detail.ID]
+		if !exists {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("details[%d].id", i), Message: "Detail does not belong to this sales order"})
+		} else if seen[detail.ID] {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("details[%d].id", i), Message: "Detail is listed more than once"})
+		} else if used := intOrZero(stored.UsedSessions); intOrZero(detail.Quantity) < used {
+			errs = append(errs, models.ErrorDetail{
+				Field:   fmt.Sprintf("details[%d].quantity", i),
+				Message: fmt.Sprintf("Quantity cannot be below the %d sessions already used", used),
+			})
+		}
+		seen[detail.ID] = true
+	}
+	if details != nil {
+		for _, detail := range storedDetails {
+			if !seen[detail.ID] && intOrZero(detail.UsedSessions) > 0 {
+				errs = append(errs, models.ErrorDetail{
+					Field:   "details",
+					Message: fmt.Sprintf("Detail %d has redeemed sessions and cannot be removed", detail.ID),
+				})
+			}
+		}
+	}
+
+	if services == nil {
+		return errs
+	}
+
+	storedServiceByID := make(map[int]models.SalesOrderService, len(storedServices))
+	for _, service := range storedServices {
+		storedServiceByID[service.ID] = service
+	}
+	seen = make(map[int]bool)
+	for i, line := range services {
+		if line.DetailIndex != nil {
+			if details == nil {
+				errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("services[%d].detail_index", i), Message: "Detail index requires the details array"})
+			} else if *line.DetailIndex < 0 || *line.DetailIndex >= len(details) {
+				errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("services[%d].detail_index", i), Message: "Detail index does not refer to a detail in this order"})
+			}
+		}
+		if line.Service.ID == 0 {
+			continue
+		}
+		if _, exists := storedServiceByID[line.Service.ID]; !exists {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("services[%d].id", i), Message: "Service does not belong to this sales order"})
+		} else if seen[line.Service.ID] {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("services[%d].id", i), Message: "Service is listed more than once"})
+		}
+		seen[line.Service.ID] = true
+	}
+
+	for _, service := range storedServices {
+		if !seen[service.ID] && service.Treated != nil && *service.Treated {
+			errs = append(errs, models.ErrorDetail{
+				Field:   "services",
+				Message: fmt.Sprintf("Service %d has been treated and cannot be removed", service.ID),
+			})
+		}
+	}
+
+	return errs
+}
+
+// reconcileDetails applies the wanted details and returns their IDs in order
+func (l *SalesOrderLines) reconcileDetails(tx *gorm.DB, orderID uuid.UUID, stored, wanted []models.SalesOrderDetail, userID int64, changes *LineChanges) ([]int, error) {
+	storedByID := make(map[int]*models.SalesOrderDetail, len(stored))
+	for i := range stored {
+		storedByID[stored[i].ID] = &stored[i]
+	}
+
+	ids := make([]int, len(wanted))
+	kept := make(map[int]bool, len(wanted))
+	for i := range wanted {
+		want := wanted[i]
+		want.SalesOrderID = &orderID
+
+		current, exists := storedByID[want.ID]
+		if !exists {
+			want.ID = 0
+			want.UsedSessions = nil
+			want.CreatedBy = &userID
+			if err := tx.Create(&want).Error; err != nil {
+				return nil, err
+			}
+			ids[i] = want.ID
+			changes.Added = append(changes.Added, want.ID)
+			continue
+		}
+
+		ids[i] = current.ID
+		kept[current.ID] = true
+		if !detailChanged(current, &want) {
+			continue
+		}
+		current.ItemID = want.ItemID
+		current.UnitID = want.UnitID
+		current.PromoterID = want.PromoterID
+		current.ItemName = want.ItemName
+		current.Quantity = want.Quantity
+		current.Price = want.Price
+		current.ItemTotal = want.ItemTotal
+		current.DiscountPct = want.DiscountPct
+		current.UpdatedBy = &userID
+		if err := tx.Save(current).Error; err != nil {
+			return nil, err
+		}
+		changes.Updated = append(changes.Updated, current.ID)
+	}
+
+	for i := range stored {
+		if kept[stored[i].ID] {
+			continue
+		}
+		if err := softDelete(tx, &stored[i], &stored[i].DeletedBy, userID); err != nil {
+			return nil, err
+		}
+		changes.Removed = append(changes.Removed, stored[i].ID)
+	}
+
+	return ids, nil
+}
+
+// reconcileServices applies the wanted services, linking each to the ID of
+// the detail its DetailIndex points at. A stored service sent without one
+// keeps its link, which must not be to a detail removed by this request.
+// Treated and TreatedAt belong to the treatment flow, so new services start
+// untreated and stored ones keep theirs.
+func (l *SalesOrderLines) reconcileServices(tx *gorm.DB, orderID uuid.UUID, stored []models.SalesOrderService, wanted []ServiceLine, detailIDs []int, removedDetails []int, userID int64, changes *LineChanges) error {
+	storedByID := make(map[int]*models.SalesOrderService, len(stored))
+	for i := range stored {
+		storedByID[stored[i].ID] = &stored[i]
+	}
+	removed := make(map[int]bool, len(removedDetails))
+	for _, id := range removedDetails {
+		removed[id] = true
+	}
+
+	var errs ValidationErrors
+	for i, line := range wanted {
+		current, exists := storedByID[line.Service.ID]
+		if exists && line.DetailIndex == nil && current.SalesOrderDetailID != nil && removed[*current.SalesOrderDetailID] {
+			errs = append(errs, models.ErrorDetail{
+				Field:   fmt.Sprintf("services[%d].detail_index", i),
+				Message: fmt.Sprintf("Service %d is linked to removed detail %d; give it a detail index to relink it", current.ID, *current.SalesOrderDetailID),
+			})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	kept := make(map[int]bool, len(wanted))
+	for _, line := range wanted {
+		want := line.Service
+		want.SalesOrderID = &orderID
+
+		current, exists := storedByID[want.ID]
+		switch {
+		case line.DetailIndex != nil:
+			want.SalesOrderDetailID = &detailIDs[*line.DetailIndex]
+		case exists:
+			want.SalesOrderDetailID = current.SalesOrderDetailID
+		default:
+			want.SalesOrderDetailID = nil
+		}
+		if !exists {
+			want.ID = 0
+			want.Treated = nil
+			want.TreatedAt = nil
+			want.CreatedBy = &userID
+			if err := tx.Create(&want).Error; err != nil {
+				return err
+			}
+			changes.Added = append(changes.Added, want.ID)
+			continue
+		}
+
+		kept[current.ID] = true
+		if !serviceChanged(current, &want) {
+			continue
+		}
+		current.SalesOrderDetailID = want.SalesOrderDetailID
+		current.ServiceID = want.ServiceID
+		current.TreatmentID = want.TreatmentID
+		current.MessageLogDetailID = want.MessageLogDetailID
+		current.RemindedID = want.RemindedID
+		current.ServiceName = want.ServiceName
+		current.UpdatedBy = &userID
+		if err := tx.Save(current).Error; err != nil {
+			return err
+		}
+		changes.Updated = append(changes.Updated, current.ID)
+	}
+
+	for i := range stored {
+		if kept[stored[i].ID] {
+			continue
+		}
+		if err := requireNoBookedAppointment(tx, stored[i].ID); err != nil {
+			return err
+		}
+		if err := softDelete(tx, &stored[i], &stored[i].DeletedBy, userID); err != nil {
+			return err
+		}
+		changes.Removed = append(changes.Removed, stored[i].ID)
+	}
+
+	return nil
+}
+
+// softDelete records who deleted the row and then soft-deletes it
+func softDelete(tx *gorm.DB, row interface{}, deletedBy **int64, userID int64) error {
+	*deletedBy = &userID
+	if err := tx.Save(row).Error; err != nil {
+		return err
+	}
+	return tx.Delete(row).Error
+}
+
+func emptyLineChanges() LineChanges {
+	return LineChanges{Added: []int{}, Updated: []int{}, Removed: []int{}}
+}
+
+func detailChanged(stored, wanted *models.SalesOrderDetail) bool {
+	return !sameInt(stored.ItemID, wanted.ItemID) ||
+		!sameInt(stored.UnitID, wanted.UnitID) ||
+		!sameInt(stored.PromoterID, wanted.PromoterID) ||
+		!sameString(stored.ItemName, wanted.ItemName) ||
+		!sameInt(stored.Quantity, wanted.Quantity) ||
+		!sameMoney(stored.Price, wanted.Price) ||
+		!sameMoney(stored.ItemTotal, wanted.ItemTotal) ||
+		!sameInt(stored.DiscountPct, wanted.DiscountPct)
+}
+
+func serviceChanged(stored, wanted *models.SalesOrderService) bool {
+	return !sameInt(stored.SalesOrderDetailID, wanted.SalesOrderDetailID) ||
+		!sameInt(stored.ServiceID, wanted.ServiceID) ||
+		!sameInt(stored.TreatmentID, wanted.TreatmentID) ||
+		!sameString(stored.MessageLogDetailID, wanted.MessageLogDetailID) ||
+		!sameInt(stored.RemindedID, wanted.RemindedID) ||
+		!sameString(stored.ServiceName, wanted.ServiceName)
+}
+
+func sameInt(a, b *int) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func sameString(a, b *string) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func sameMoney(a, b *models.Money) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Cmp(*b) == 0
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// ValidationErrors is a list of field errors that maps onto a 400 response
+type ValidationErrors []models.ErrorDetail
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, detail := range e {
+		messages = append(messages, detail.Field+": "+detail.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// PricingLine is a sales order line as priced by the engine. ItemTotal is the
+// client-supplied value, if any, and is only used for reconciliation.
+type PricingLine struct {
+	Quantity    *int
+	Price       *models.Money
+	DiscountPct *int
+	ItemTotal   *models.Money
+}
+
+// PricingInput holds the lines and order-level charges of a sales order.
+// TotalAmount, Outstanding and FullyPaid are client-supplied values that are
+// checked against the derived totals when set.
+type PricingInput struct {
+	Lines          []PricingLine
+	TotalVoucher   *models.Money
+	DeliveryCost   *models.Money
+	AdditionalCost *models.Money
+	TotalPayment   *models.Money
+
+	TotalAmount *models.Money
+	Outstanding *models.Money
+	FullyPaid   *bool
+}
+
+// PricingResult holds the derived totals of a sales order
+type PricingResult struct {
+	LineTotals  []models.Money
+	Subtotal    models.Money
+	TotalAmount models.Money
+	Outstanding models.Money
+	FullyPaid   bool
+}
+
+// SalesOrderPricing derives sales order totals from its lines
+type SalesOrderPricing struct{}
+
+func NewSalesOrderPricing() *SalesOrderPricing {
+	return &SalesOrderPricing{}
+}
+
+// LineTotal returns quantity × price less the line discount percentage,
+// rounded to the cent
+func (p *SalesOrderPricing) LineTotal(line PricingLine) (models.Money, ValidationErrors) {
+	var errs ValidationErrors
+
+	if line.Quantity == nil || *line.Quantity <= 0 {
+		errs = append(errs, models.ErrorDetail{Field: "quantity", Message: "Quantity must be greater than zero"})
+	}
+	if line.Price == nil || line.Price.IsNegative() {
+		errs = append(errs, models.ErrorDetail{Field: "price", Message: "Price must be zero or greater"})
+	}
+	discountPct := 0
+	if line.DiscountPct != nil {
+		discountPct = *line.DiscountPct
+	}
+	if discountPct < 0 || discountPct > 100 {
+		errs = append(errs, models.ErrorDetail{Field: "discount_pct", Message: "Discount must be between 0 and 100"})
+	}
+	if len(errs) > 0 {
+		return models.Money{}, errs
+	}
+
+	gross, err := line.Price.Mul(int64(*line.Quantity))
+	if err != nil {
+		return models.Money{}, ValidationErrors{{Field: "price", Message: "Quantity × price is too large"}}
+	}
+	total, err := gross.Percent(int64(100 - discountPct))
+	if err != nil {
+		return models.Money{}, ValidationErrors{{Field: "price", Message: "Quantity × price is too large"}}
+	}
+
+	if line.ItemTotal != nil && line.ItemTotal.Cmp(total) != 0 {
+		return models.Money{}, ValidationErrors{{
+			Field:   "item_total",
+			Message: fmt.Sprintf("Item total %s does not match quantity × price less discount (%s)", line.ItemTotal, total),
+		}}
+	}
+
+	return total, nil
+}
+
+// Price derives line totals, the order total, outstanding balance and
+// fully_paid flag. TotalAmount is the line subtotal less TotalVoucher plus
+// DeliveryCost and AdditionalCost; Outstanding is TotalAmount less TotalPayment.
+func (p *SalesOrderPricing) Price(input PricingInput) (*PricingResult, error) {
+	var errs ValidationErrors
+
+	result := &PricingResult{LineTotals: make([]models.Money, len(input.Lines))}
+	for i, line := range input.Lines {
+		total, lineErrs := p.LineTotal(line)
+		for _, lineErr := range lineErrs {
+			lineErr.Field = fmt.Sprintf("details[%d].%s", i, lineErr.Field)
+			errs = append(errs, lineErr)
+		}
+		result.LineTotals[i] = total
+		result.Subtotal = result.Subtotal.Add(total)
+	}
+
+	voucher := amountOrZero(input.TotalVoucher)
+	deliveryCost := amountOrZero(input.DeliveryCost)
+	additionalCost := amountOrZero(input.AdditionalCost)
+	payment := amountOrZero(input.TotalPayment)
+
+	charges := []struct {
+		field  string
+		amount models.Money
+	}{
+		{"total_voucher", voucher},
+		{"delivery_cost", deliveryCost},
+		{"additional_cost", additionalCost},
+		{"total_payment", payment},
+	}
+	for _, charge := range charges {
+		if charge.amount.IsNegative() {
+			errs = append(errs, models.ErrorDetail{Field: charge.field, Message: "Amount must be zero or greater"})
+		}
+	}
+
+	if voucher.Cmp(result.Subtotal) > 0 {
+		errs = append(errs, models.ErrorDetail{Field: "total_voucher", Message: "Voucher exceeds the line subtotal"})
+	}
+
+	result.TotalAmount = result.Subtotal.Sub(voucher).Add(deliveryCost).Add(additionalCost)
+	result.Outstanding = result.TotalAmount.Sub(payment)
+	result.FullyPaid = !result.Outstanding.IsPositive()
+
+	if result.Outstanding.IsNegative() {
+		errs = append(errs, models.ErrorDetail{Field: "total_payment", Message: "Payment exceeds the order total"})
+	}
+
+	if input.TotalAmount != nil && input.TotalAmount.Cmp(result.TotalAmount) != 0 {
+		errs = append(errs, models.ErrorDetail{
+			Field:   "total_amount",
+			Message: fmt.Sprintf("Total amount %s does not reconcile with the lines (%s)", *input.TotalAmount, result.TotalAmount),
+		})
+	}
+	if input.Outstanding != nil && input.Outstanding.Cmp(result.Outstanding) != 0 {
+		errs = append(errs, models.ErrorDetail{
+			Field:   "outstanding",
+			Message: fmt.Sprintf("Outstanding %s does not reconcile with total and payment (%s)", *input.Outstanding, result.Outstanding),
+		})
+	}
+	if input.FullyPaid != nil && *input.FullyPaid != result.FullyPaid {
+		errs = append(errs, models.ErrorDetail{
+			Field:   "fully_paid",
+			Message: fmt.Sprintf("Fully paid must be %t for the given total and payment", result.FullyPaid),
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return result, nil
+}
+
+func amountOrZero(amount *models.Money) models.Money {
+	if amount == nil {
+		return models.Money{}
+	}
+	return *amount
+}
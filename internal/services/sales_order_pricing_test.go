@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"pos-mojosoft-so-service/internal/models"
+)
+
+func money(t *testing.T, s string) *models.Money {
+	t.Helper()
+	amount, err := models.ParseMoney(s)
+	if err != nil {
+		t.Fatalf("parse %q: %v", s, err)
+	}
+	return &amount
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+// fields returns the fields of a validation error, or nil for any other error
+func fields(err error) []string {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	names := make([]string, 0, len(errs))
+	for _, detail := range errs {
+		names = append(names, detail.Field)
+	}
+	return names
+}
+
+func TestLineTotal(t *testing.T) {
+	pricing := NewSalesOrderPricing()
+	tests := []struct {
+		name  string
+		line  PricingLine
+		total string
+		field string
+	}{
+		{"no discount", PricingLine{Quantity: intPtr(3), Price: money(t, "150000")}, "450000.00", ""},
+		{"percentage discount", PricingLine{Quantity: intPtr(2), Price: money(t, "150000"), DiscountPct: intPtr(10)}, "270000.00", ""},
+		{"full discount", PricingLine{Quantity: intPtr(1), Price: money(t, "99.99"), DiscountPct: intPtr(100)}, "0.00", ""},
+		{"free line", PricingLine{Quantity: intPtr(1), Price: money(t, "0")}, "0.00", ""},
+		// 3 × 33.33 = 99.99 less 15% = 84.9915, rounded to the cent
+		{"discount rounds down", PricingLine{Quantity: intPtr(3), Price: money(t, "33.33"), DiscountPct: intPtr(15)}, "84.99", ""},
+		// 0.05 less 10% = 0.045, rounded half up to the cent
+		{"discount rounds half up", PricingLine{Quantity: intPtr(1), Price: money(t, "0.05"), DiscountPct: intPtr(10)}, "0.05", ""},
+		{"matching item total", PricingLine{Quantity: intPtr(2), Price: money(t, "150000"), DiscountPct: intPtr(10), ItemTotal: money(t, "270000.00")}, "270000.00", ""},
+		{"item total off by a cent", PricingLine{Quantity: intPtr(2), Price: money(t, "150000"), DiscountPct: intPtr(10), ItemTotal: money(t, "270000.01")}, "", "item_total"},
+		{"missing quantity", PricingLine{Price: money(t, "10")}, "", "quantity"},
+		{"zero quantity", PricingLine{Quantity: intPtr(0), Price: money(t, "10")}, "", "quantity"},
+		{"missing price", PricingLine{Quantity: intPtr(1)}, "", "price"},
+		{"negative price", PricingLine{Quantity: intPtr(1), Price: money(t, "-1")}, "", "price"},
+		{"negative discount", PricingLine{Quantity: intPtr(1), Price: money(t, "10"), DiscountPct: intPtr(-1)}, "", "discount_pct"},
+		{"discount above 100", PricingLine{Quantity: intPtr(1), Price: money(t, "10"), DiscountPct: intPtr(101)}, "", "discount_pct"},
+		{"overflowing line", PricingLine{Quantity: intPtr(1 << 30), Price: money(t, "90000000000000")}, "", "price"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, errs := pricing.LineTotal(tt.line)
+			if tt.field != "" {
+				if len(errs) != 1 || errs[0].Field != tt.field {
+					t.Fatalf("errors = %v, want one on %s", errs, tt.field)
+				}
+				return
+			}
+			if len(errs) > 0 {
+				t.Fatalf("errors = %v", errs)
+			}
+			if total.String() != tt.total {
+				t.Errorf("total = %s, want %s", total, tt.total)
+			}
+		})
+	}
+}
+
+func TestPrice(t *testing.T) {
+	pricing := NewSalesOrderPricing()
+	lines := []PricingLine{
+		{Quantity: intPtr(2), Price: money(t, "150000"), DiscountPct: intPtr(10)}, // 270000.00
+		{Quantity: intPtr(3), Price: money(t, "33.33"), DiscountPct: intPtr(15)},  // 84.99
+	}
+
+	t.Run("voucher, charges and payment", func(t *testing.T) {
+		result, err := pricing.Price(PricingInput{
+			Lines:          lines,
+			TotalVoucher:   money(t, "50000.50"),
+			DeliveryCost:   money(t, "15000"),
+			AdditionalCost: money(t, "0.01"),
+			TotalPayment:   money(t, "100000"),
+		})
+		if err != nil {
+			t.Fatalf("price: %v", err)
+		}
+		want := map[string]string{
+			"line 0":      "270000.00",
+			"line 1":      "84.99",
+			"subtotal":    "270084.99",
+			"total":       "235084.50",
+			"outstanding": "135084.50",
+		}
+		got := map[string]string{
+			"line 0":      result.LineTotals[0].String(),
+			"line 1":      result.LineTotals[1].String(),
+			"subtotal":    result.Subtotal.String(),
+			"total":       result.TotalAmount.String(),
+			"outstanding": result.Outstanding.String(),
+		}
+		for key, value := range want {
+			if got[key] != value {
+				t.Errorf("%s = %s, want %s", key, got[key], value)
+			}
+		}
+		if result.FullyPaid {
+			t.Error("fully paid with a balance outstanding")
+		}
+	})
+
+	t.Run("rounding residue stays on the lines", func(t *testing.T) {
+		// Each line is rounded to the cent and the order total is their exact
+		// sum, so the total always equals the sum of the line totals shown
+		var thirds []PricingLine
+		for i := 0; i < 3; i++ {
+			thirds = append(thirds, PricingLine{Quantity: intPtr(1), Price: money(t, "0.10"), DiscountPct: intPtr(33)})
+		}
+		result, err := pricing.Price(PricingInput{Lines: thirds})
+		if err != nil {
+			t.Fatalf("price: %v", err)
+		}
+		// 0.10 less 33% = 0.067, rounded to 0.07 per line; 0.21, not 0.20
+		if result.Subtotal.String() != "0.21" || result.TotalAmount.String() != "0.21" {
+			t.Errorf("subtotal = %s, total = %s, want 0.21 and 0.21", result.Subtotal, result.TotalAmount)
+		}
+	})
+
+	t.Run("voucher of the whole subtotal", func(t *testing.T) {
+		result, err := pricing.Price(PricingInput{Lines: lines, TotalVoucher: money(t, "270084.99")})
+		if err != nil {
+			t.Fatalf("price: %v", err)
+		}
+		if !result.TotalAmount.IsZero() || !result.FullyPaid {
+			t.Errorf("total = %s, fully paid = %v; want 0.00 and true", result.TotalAmount, result.FullyPaid)
+		}
+	})
+
+	t.Run("paid in full", func(t *testing.T) {
+		result, err := pricing.Price(PricingInput{
+			Lines:        lines,
+			TotalPayment: money(t, "270084.99"),
+			TotalAmount:  money(t, "270084.99"),
+			Outstanding:  money(t, "0"),
+			FullyPaid:    boolPtr(true),
+		})
+		if err != nil {
+			t.Fatalf("price: %v", err)
+		}
+		if !result.Outstanding.IsZero() || !result.FullyPaid {
+			t.Errorf("outstanding = %s, fully paid = %v; want 0.00 and true", result.Outstanding, result.FullyPaid)
+		}
+	})
+
+	rejected := []struct {
+		name  string
+		input PricingInput
+		field string
+	}{
+		{"voucher above subtotal", PricingInput{Lines: lines, TotalVoucher: money(t, "270085.00")}, "total_voucher"},
+		{"negative voucher", PricingInput{Lines: lines, TotalVoucher: money(t, "-1")}, "total_voucher"},
+		{"negative delivery cost", PricingInput{Lines: lines, DeliveryCost: money(t, "-1")}, "delivery_cost"},
+		{"negative additional cost", PricingInput{Lines: lines, AdditionalCost: money(t, "-1")}, "additional_cost"},
+		{"overpayment", PricingInput{Lines: lines, TotalPayment: money(t, "270085.00")}, "total_payment"},
+		{"total off by a cent", PricingInput{Lines: lines, TotalAmount: money(t, "270085.00")}, "total_amount"},
+		{"outstanding off by a cent", PricingInput{Lines: lines, Outstanding: money(t, "270084.98")}, "outstanding"},
+		{"claimed fully paid", PricingInput{Lines: lines, FullyPaid: boolPtr(true)}, "fully_paid"},
+		{"invalid line", PricingInput{Lines: []PricingLine{lines[0], {Quantity: intPtr(1)}}}, "details[1].price"},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pricing.Price(tt.input)
+			got := fields(err)
+			for _, field := range got {
+				if field == tt.field {
+					return
+				}
+			}
+			t.Errorf("error fields = %v (%v), want one on %s", got, err, tt.field)
+		})
+	}
+}
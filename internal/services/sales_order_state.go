@@ -0,0 +1,274 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// SalesOrderState is a lifecycle state of a sales order. Each state maps to
+// the sales_order_status row with the same name (case-insensitive).
+type SalesOrderState string
+
+const (
+	SalesOrderDraft  SalesOrderState = "draft"
+	SalesOrderPosted SalesOrderState = "posted"
+	SalesOrderPaid   SalesOrderState = "paid"
+	SalesOrderVoid   SalesOrderState = "void"
+)
+
+// SalesOrderEvent triggers a transition between sales order states
+type SalesOrderEvent string
+
+const (
+	SalesOrderEventPost   SalesOrderEvent = "post"
+	SalesOrderEventPay    SalesOrderEvent = "pay"
+	SalesOrderEventUnpay  SalesOrderEvent = "unpay"
+	SalesOrderEventVoid   SalesOrderEvent = "void"
+	SalesOrderEventReopen SalesOrderEvent = "reopen"
+)
+
+type salesOrderTransition struct {
+	from []SalesOrderState
+	to   SalesOrderState
+}
+
+var salesOrderTransitions = map[SalesOrderEvent]salesOrderTransition{
+	SalesOrderEventPost:   {from: []SalesOrderState{SalesOrderDraft}, to: SalesOrderPosted},
+	SalesOrderEventPay:    {from: []SalesOrderState{SalesOrderPosted}, to: SalesOrderPaid},
+	SalesOrderEventUnpay:  {from: []SalesOrderState{SalesOrderPaid}, to: SalesOrderPosted},
+	SalesOrderEventVoid:   {from: []SalesOrderState{SalesOrderDraft, SalesOrderPosted}, to: SalesOrderVoid},
+	SalesOrderEventReopen: {from: []SalesOrderState{SalesOrderPosted}, to: SalesOrderDraft},
+}
+
+var (
+	ErrSalesOrderNotFound = errors.New("sales order not found")
+	ErrStatusNotSeeded    = errors.New("sales order status table is missing a lifecycle status")
+	ErrSalesOrderNotDraft = errors.New("only draft sales orders can be changed")
+)
+
+// TransitionError reports a transition that is not allowed from the
+// order's current state or whose precondition failed
+type TransitionError struct {
+	Event  SalesOrderEvent
+	From   SalesOrderState
+	Reason string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot %s a %s sales order: %s", e.Event, e.From, e.Reason)
+}
+
+// SalesOrderStateMachine guards sales order status changes
+type SalesOrderStateMachine struct{}
+
+func NewSalesOrderStateMachine() *SalesOrderStateMachine {
+	return &SalesOrderStateMachine{}
+}
+
+// statusIDs loads the sales_order_status IDs for every lifecycle state
+func (m *SalesOrderStateMachine) statusIDs(tx *gorm.DB) (map[SalesOrderState]int, error) {
+	var statuses []models.SalesOrderStatus
+	if err := tx.Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make(map[SalesOrderState]int, len(statuses))
+	for _, status := range statuses {
+		if status.Name != nil {
+			ids[SalesOrderState(strings.ToLower(strings.TrimSpace(*status.Name)))] = status.ID
+		}
+	}
+
+	for _, state := range []SalesOrderState{SalesOrderDraft, SalesOrderPosted, SalesOrderPaid, SalesOrderVoid} {
+		if _, exists := ids[state]; !exists {
+			return nil, fmt.Errorf("%w: %s", ErrStatusNotSeeded, state)
+		}
+	}
+	return ids, nil
+}
+
+// DraftStatusID returns the status ID new sales orders are created with
+func (m *SalesOrderStateMachine) DraftStatusID(tx *gorm.DB) (int, error) {
+	ids, err := m.statusIDs(tx)
+	if err != nil {
+		return 0, err
+	}
+	return ids[SalesOrderDraft], nil
+}
+
+// StateOf returns the lifecycle state of an order. Orders without a status
+// are treated as drafts.
+func (m *SalesOrderStateMachine) StateOf(tx *gorm.DB, order *models.SalesOrder) (SalesOrderState, error) {
+	if order.StatusID == nil {
+		return SalesOrderDraft, nil
+	}
+
+	ids, err := m.statusIDs(tx)
+	if err != nil {
+		return "", err
+	}
+	return stateOf(ids, order)
+}
+
+// LockDraft loads and locks the sales order with the given ID for the rest
+// of tx and returns ErrSalesOrderNotDraft unless it is a draft, so its lines
+// and totals can be changed without racing a post; scopes are applied to the
+// lookup
+func (m *SalesOrderStateMachine) LockDraft(tx *gorm.DB, orderID interface{}, scopes ...func(*gorm.DB) *gorm.DB) (*models.SalesOrder, error) {
+	var order models.SalesOrder
+	if err := tx.Scopes(scopes...).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&order, "id = ?", orderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSalesOrderNotFound
+		}
+		return nil, err
+	}
+
+	state, err := m.StateOf(tx, &order)
+	if err != nil {
+		return nil, err
+	}
+	if state != SalesOrderDraft {
+		return nil, ErrSalesOrderNotDraft
+	}
+	return &order, nil
+}
+
+func stateOf(ids map[SalesOrderState]int, order *models.SalesOrder) (SalesOrderState, error) {
+	if order.StatusID == nil {
+		return SalesOrderDraft, nil
+	}
+	for state, id := range ids {
+		if id == *order.StatusID {
+			return state, nil
+		}
+	}
+	return "", fmt.Errorf("sales order has unknown status_id %d", *order.StatusID)
+}
+
+// Fire applies an event to the sales order with the given ID inside tx and
+// records it in the status log. today is the current date in the tenant's
+// timezone; it stamps PostedDate and dates the log entry.
+// The order row is locked for the duration of the transaction; scopes are
+// applied to the lookup so callers can restrict it (e.g. by location).
+func (m *SalesOrderStateMachine) Fire(tx *gorm.DB, orderID interface{}, event SalesOrderEvent, userID int64, today time.Time, scopes ...func(*gorm.DB) *gorm.DB) (*models.SalesOrder, error) {
+	transition, exists := salesOrderTransitions[event]
+	if !exists {
+		return nil, fmt.Errorf("unknown sales order event %q", event)
+	}
+
+	var order models.SalesOrder
+	if err := tx.Scopes(scopes...).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&order, "id = ?", orderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSalesOrderNotFound
+		}
+		return nil, err
+	}
+
+	ids, err := m.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := stateOf(ids, &order)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	for _, state := range transition.from {
+		if state == from {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, &TransitionError{Event: event, From: from, Reason: "transition not allowed"}
+	}
+
+	if err := m.checkPreconditions(tx, &order, event, from); err != nil {
+		return nil, err
+	}
+
+	m.applySideEffects(&order, event, today)
+
+	fromStatusID := order.StatusID
+	statusID := ids[transition.to]
+	order.StatusID = &statusID
+	order.UpdatedBy = &userID
+
+	if err := tx.Save(&order).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&models.SalesOrderStatusLog{
+		SalesOrderID:  order.ID,
+		Event:         string(event),
+		FromStatusID:  fromStatusID,
+		StatusID:      statusID,
+		EffectiveDate: today,
+		CreatedBy:     &userID,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (m *SalesOrderStateMachine) checkPreconditions(tx *gorm.DB, order *models.SalesOrder, event SalesOrderEvent, from SalesOrderState) error {
+	switch event {
+	case SalesOrderEventPost:
+		var details int64
+		if err := tx.Model(&models.SalesOrderDetail{}).Where("salesorder_id = ?", order.ID).Count(&details).Error; err != nil {
+			return err
+		}
+		if details == 0 {
+			return &TransitionError{Event: event, From: from, Reason: "sales order has no details"}
+		}
+
+	case SalesOrderEventVoid:
+		var treated int64
+		if err := tx.Model(&models.SalesOrderService{}).
+			Where("salesorder_id = ? AND treated = ?", order.ID, true).
+			Count(&treated).Error; err != nil {
+			return err
+		}
+		if treated > 0 {
+			return &TransitionError{Event: event, From: from, Reason: "a treatment has already been performed"}
+		}
+		if from == SalesOrderPosted && order.TotalPayment != nil && order.TotalPayment.IsPositive() {
+			return &TransitionError{Event: event, From: from, Reason: "payments have been received; void the receipts first"}
+		}
+
+	case SalesOrderEventPay:
+		if order.Outstanding != nil && order.Outstanding.IsPositive() {
+			return &TransitionError{Event: event, From: from, Reason: "an outstanding balance remains"}
+		}
+
+	case SalesOrderEventReopen:
+		if order.TotalPayment != nil && order.TotalPayment.IsPositive() {
+			return &TransitionError{Event: event, From: from, Reason: "payments have been received"}
+		}
+	}
+	return nil
+}
+
+func (m *SalesOrderStateMachine) applySideEffects(order *models.SalesOrder, event SalesOrderEvent, today time.Time) {
+	switch event {
+	case SalesOrderEventPost:
+		order.PostedDate = &today
+	case SalesOrderEventReopen:
+		order.PostedDate = nil
+	case SalesOrderEventPay:
+		fullyPaid := true
+		order.FullyPaid = &fullyPaid
+	case SalesOrderEventUnpay:
+		fullyPaid := false
+		order.FullyPaid = &fullyPaid
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+var ErrSalesOrderDetailNotFound = errors.New("sales order detail not found")
+
+// SessionError reports a redemption the package line cannot honour
+type SessionError struct {
+	DetailID int
+	Reason   string
+}
+
+func (e *SessionError) Error() string {
+	return fmt.Sprintf("cannot redeem a session of sales order detail %d: %s", e.DetailID, e.Reason)
+}
+
+// Redemption is a session consumed from a package line
+type Redemption struct {
+	Detail            models.SalesOrderDetail
+	Order             models.SalesOrder
+	SessionNumber     int
+	RemainingSessions int
+	// ExpiryOverridden is set when the package had expired and the caller
+	// overrode the expiry
+	ExpiryOverridden bool
+}
+
+// SessionRedemption consumes and returns the sessions of package lines.
+// A package line is a sales order detail with at least one service linked
+// to it; its quantity is the number of sessions sold.
+type SessionRedemption struct {
+	states *SalesOrderStateMachine
+}
+
+func NewSessionRedemption(states *SalesOrderStateMachine) *SessionRedemption {
+	return &SessionRedemption{states: states}
+}
+
+// Redeem consumes the next session of the package line inside tx. The line
+// is locked until the transaction ends, so concurrent redemptions of the
+// same package queue up and can never use more sessions than were sold.
+// customerID, when set, must be the customer the package was sold to.
+// A package whose expiry date is before today is refused unless
+// overrideExpiry is set. scopes are applied to the sales order so callers can
+// restrict redemption (e.g. to packages sold at their location); a line whose
+// order they exclude is reported as not found.
+func (r *SessionRedemption) Redeem(tx *gorm.DB, detailID int, customerID *int, userID int64, today time.Time, overrideExpiry bool, scopes ...func(*gorm.DB) *gorm.DB) (*Redemption, error) {
+	var detail models.SalesOrderDetail
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&detail, detailID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrSalesOrderDetailNotFound
+		}
+		return nil, err
+	}
+	if detail.SalesOrderID == nil {
+		return nil, &SessionError{DetailID: detailID, Reason: "line is not linked to a sales order"}
+	}
+
+	var order models.SalesOrder
+	if err := tx.First(&order, "id = ?", *detail.SalesOrderID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, &SessionError{DetailID: detailID, Reason: "sales order no longer exists"}
+		}
+		return nil, err
+	}
+	if len(scopes) > 0 {
+		var visible int64
+		if err := tx.Model(&models.SalesOrder{}).Scopes(scopes...).Where("id = ?", order.ID).
+			Count(&visible).Error; err != nil {
+			return nil, err
+		}
+		if visible == 0 {
+			return nil, ErrSalesOrderDetailNotFound
+		}
+	}
+	state, err := r.states.StateOf(tx, &order)
+	if err != nil {
+		return nil, err
+	}
+	if state != SalesOrderPosted && state != SalesOrderPaid {
+		return nil, &SessionError{DetailID: detailID, Reason: fmt.Sprintf("sales order is %s", state)}
+	}
+
+	if customerID != nil && order.CustomerID != nil && *customerID != *order.CustomerID {
+		return nil, ValidationErrors{{Field: "customer_id", Message: "Package was sold to another customer"}}
+	}
+
+	var services int64
+	if err := tx.Model(&models.SalesOrderService{}).Where("salesorderdetail_id = ?", detail.ID).
+		Count(&services).Error; err != nil {
+		return nil, err
+	}
+	if services == 0 {
+		return nil, &SessionError{DetailID: detailID, Reason: "line is not a package"}
+	}
+
+	sessions := intOrZero(detail.Quantity)
+	used := intOrZero(detail.UsedSessions)
+	if used >= sessions {
+		return nil, &SessionError{DetailID: detailID, Reason: fmt.Sprintf("all %d sessions have been used", sessions)}
+	}
+
+	expired := packageExpired(&detail, today)
+	if expired && !overrideExpiry {
+		return nil, &SessionError{
+			DetailID: detailID,
+			Reason:   fmt.Sprintf("package expired on %s; a manager can override the expiry", detail.ExpiryDate.Format("2006-01-02")),
+		}
+	}
+
+	sessionNumber, err := r.freeSessionNumber(tx, detail.ID, sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	used++
+	columns := map[string]interface{}{
+		"usedsessions": used,
+		"updated_by":   userID,
+	}
+	if detail.ForfeitedAt != nil {
+		// The session redeemed under override is no longer forfeited
+		forfeited := sessions - used
+		columns["forfeitedsessions"] = forfeited
+		detail.ForfeitedSessions = &forfeited
+	}
+	if err := tx.Model(&detail).UpdateColumns(columns).Error; err != nil {
+		return nil, err
+	}
+	detail.UsedSessions = &used
+
+	return &Redemption{
+		Detail:            detail,
+		Order:             order,
+		SessionNumber:     sessionNumber,
+		RemainingSessions: sessions - used,
+		ExpiryOverridden:  expired,
+	}, nil
+}
+
+// Release returns the session a treatment redeemed to its package line.
+// On a line whose sessions were forfeited the returned session is forfeited
+// too. The treatment and then the line are locked as Redeem does, and the
+// session is only returned while the treatment is still live in tx, so a
+// treatment deleted by a concurrent request is never credited twice.
+// Treatments that did not redeem a session are ignored.
+func (r *SessionRedemption) Release(tx *gorm.DB, treatment *models.Treatment, userID int64) error {
+	if treatment.SalesOrderDetailID == nil || treatment.SessionNumber == nil {
+		return nil
+	}
+
+	var live []models.Treatment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		Where("id = ? AND salesorderdetail_id = ? AND sessionnumber = ?", treatment.ID, *treatment.SalesOrderDetailID, *treatment.SessionNumber).
+		Limit(1).Find(&live).Error; err != nil {
+		return err
+	}
+	if len(live) == 0 {
+		return nil
+	}
+
+	var detail models.SalesOrderDetail
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&detail, *treatment.SalesOrderDetailID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		return err
+	}
+	if intOrZero(detail.UsedSessions) == 0 {
+		return nil
+	}
+	return tx.Model(&detail).
+		UpdateColumns(map[string]interface{}{
+			"usedsessions":      gorm.Expr("usedsessions - 1"),
+			"forfeitedsessions": gorm.Expr("CASE WHEN forfeited_at IS NULL THEN forfeitedsessions ELSE COALESCE(forfeitedsessions, 0) + 1 END"),
+			"updated_by":        userID,
+		}).Error
+}
+
+// freeSessionNumber returns the lowest session number of the line that no
+// live treatment holds, so a session released by a voided treatment is
+// handed out again
+func (r *SessionRedemption) freeSessionNumber(tx *gorm.DB, detailID, sessions int) (int, error) {
+	var taken []int
+	if err := tx.Model(&models.Treatment{}).
+		Where("salesorderdetail_id = ? AND sessionnumber IS NOT NULL", detailID).
+		Pluck("sessionnumber", &taken).Error; err != nil {
+		return 0, err
+	}
+	held := make(map[int]bool, len(taken))
+	for _, number := range taken {
+		held[number] = true
+	}
+	for number := 1; number <= sessions; number++ {
+		if !held[number] {
+			return number, nil
+		}
+	}
+	return 0, &SessionError{DetailID: detailID, Reason: fmt.Sprintf("all %d sessions are held by treatments", sessions)}
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// Commission sources
+const (
+	CommissionSourceSale      = "sale"
+	CommissionSourceTreatment = "treatment"
+)
+
+// CommissionEntry is what one staff member earns on one promoted sales
+// order line or one completed treatment. Base is the amount a percentage
+// applies to: the line total, or the value of one session of the sales
+// order line a treatment performs.
+type CommissionEntry struct {
+	Role       string       `json:"role"`
+	StaffID    int          `json:"staff_id"`
+	Source     string       `json:"source"`
+	DocumentID uuid.UUID    `json:"document_id"`
+	DocNumber  *string      `json:"doc_number"`
+	Date       time.Time    `json:"date"`
+	LocationID *int         `json:"location_id"`
+	ItemID     *int         `json:"item_id"`
+	ServiceID  *int         `json:"service_id"`
+	Quantity   int          `json:"quantity"`
+	Base       models.Money `json:"base"`
+	RuleID     int          `json:"rule_id"`
+	Type       string       `json:"type"`
+	Value      models.Money `json:"value"`
+	Commission models.Money `json:"commission"`
+}
+
+// StaffCommission is what one staff member earns in a role over the period
+type StaffCommission struct {
+	Role       string            `json:"role"`
+	StaffID    int               `json:"staff_id"`
+	Base       models.Money      `json:"base"`
+	Commission models.Money      `json:"commission"`
+	Entries    []CommissionEntry `json:"entries"`
+}
+
+// CommissionReport is the commission of every staff member over a period
+type CommissionReport struct {
+	Period          StatementPeriod   `json:"period"`
+	TotalBase       models.Money      `json:"total_base"`
+	TotalCommission models.Money      `json:"total_commission"`
+	Staff           []StaffCommission `json:"staff"`
+}
+
+// CommissionFilter narrows a commission report; empty fields match anything
+type CommissionFilter struct {
+	LocationID *int
+	Role       string
+	StaffID    *int
+}
+
+// StaffCommissions calculates staff commissions from the commission rules:
+// promoters earn on the lines of posted and paid orders, doctors, nurses
+// and beauticians on the treatments they completed
+type StaffCommissions struct {
+	states *SalesOrderStateMachine
+}
+
+func NewStaffCommissions(states *SalesOrderStateMachine) *StaffCommissions {
+	return &StaffCommissions{states: states}
+}
+
+// Calculate returns the commissions earned within the period: on orders
+// posted within it and treatments completed within it, in the period's
+// timezone. Lines and treatments no rule matches earn nothing and are left
+// out.
+func (s *StaffCommissions) Calculate(tx *gorm.DB, period StatementPeriod, filter CommissionFilter) (*CommissionReport, error) {
+	var rules []models.CommissionRule
+	if err := tx.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	var entries []CommissionEntry
+	if filter.Role == "" || filter.Role == models.CommissionRolePromoter {
+		sales, err := s.saleEntries(tx, period, filter, rules)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, sales...)
+	}
+	if filter.Role != models.CommissionRolePromoter {
+		treatments, err := s.treatmentEntries(tx, period, filter, rules)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, treatments...)
+	}
+
+	return buildCommissionReport(period, entries), nil
+}
+
+// saleEntries calculates what promoters earn on the lines of orders posted
+// within the period
+func (s *StaffCommissions) saleEntries(tx *gorm.DB, period StatementPeriod, filter CommissionFilter, rules []models.CommissionRule) ([]CommissionEntry, error) {
+	ids, err := s.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	type saleRow struct {
+		models.SalesOrderDetail
+		InvNumber  *string    `gorm:"column:invnumber"`
+		PostedDate *time.Time `gorm:"column:posteddate"`
+		LocationID *int       `gorm:"column:location_id"`
+	}
+	query := tx.Model(&models.SalesOrderDetail{}).
+		Select("sales_order_detail.*, sales_order.invnumber, sales_order.posteddate, sales_order.location_id").
+		Joins("JOIN sales_order ON sales_order.id = sales_order_detail.salesorder_id AND sales_order.deleted_at IS NULL").
+		Where("sales_order.status_id IN ?", []int{ids[SalesOrderPosted], ids[SalesOrderPaid]}).
+		Where("sales_order_detail.promoter_id IS NOT NULL").
+		Where("sales_order.posteddate >= ? AND sales_order.posteddate <= ?",
+			period.From.Format("2006-01-02"), period.To.Format("2006-01-02"))
+	if filter.LocationID != nil {
+		query = query.Where("sales_order.location_id = ?", *filter.LocationID)
+	}
+	if filter.StaffID != nil {
+		query = query.Where("sales_order_detail.promoter_id = ?", *filter.StaffID)
+	}
+
+	var rows []saleRow
+	if err := query.Order("sales_order.posteddate, sales_order_detail.id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var entries []CommissionEntry
+	for _, row := range rows {
+		rule := matchCommissionRule(rules, models.CommissionRolePromoter, row.ItemID, nil, row.LocationID)
+		if rule == nil {
+			continue
+		}
+		quantity := intOrZero(row.Quantity)
+		base := amountOrZero(row.ItemTotal)
+		commission, err := commissionOf(rule, base, quantity)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, CommissionEntry{
+			Role:       models.CommissionRolePromoter,
+			StaffID:    *row.PromoterID,
+			Source:     CommissionSourceSale,
+			DocumentID: *row.SalesOrderID,
+			DocNumber:  row.InvNumber,
+			Date:       *row.PostedDate,
+			LocationID: row.LocationID,
+			ItemID:     row.ItemID,
+			Quantity:   quantity,
+			Base:       base,
+			RuleID:     rule.ID,
+			Type:       rule.CalcType,
+			Value:      rule.CalcValue,
+			Commission: commission,
+		})
+	}
+	return entries, nil
+}
+
+// treatmentEntries calculates what the doctor, nurse and beautician of each
+// treatment completed within the period earn on it
+func (s *StaffCommissions) treatmentEntries(tx *gorm.DB, period StatementPeriod, filter CommissionFilter, rules []models.CommissionRule) ([]CommissionEntry, error) {
+	type treatmentRow struct {
+		models.Treatment
+		LineServiceID *int          `gorm:"column:lineservice_id"`
+		LineItemID    *int          `gorm:"column:lineitem_id"`
+		LineQuantity  *int          `gorm:"column:linequantity"`
+		LineItemTotal *models.Money `gorm:"column:lineitemtotal"`
+	}
+	query := tx.Model(&models.Treatment{}).
+		Select(`treatment.*, sales_order_service.service_id AS lineservice_id,
+			sales_order_detail.item_id AS lineitem_id, sales_order_detail.quantity AS linequantity,
+			sales_order_detail.itemtotal AS lineitemtotal`).
+		Joins("LEFT JOIN sales_order_service ON sales_order_service.id = treatment.salesorderservice_id AND sales_order_service.deleted_at IS NULL").
+		Joins(`LEFT JOIN sales_order_detail ON sales_order_detail.id = COALESCE(treatment.salesorderdetail_id, sales_order_service.salesorderdetail_id)
+			AND sales_order_detail.deleted_at IS NULL`).
+		Where("treatment.completed_at >= ? AND treatment.completed_at < ?", *period.From, period.To.AddDate(0, 0, 1))
+	if filter.LocationID != nil {
+		query = query.Where("treatment.location_id = ?", *filter.LocationID)
+	}
+
+	var rows []treatmentRow
+	if err := query.Order("treatment.completed_at, treatment.id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var entries []CommissionEntry
+	for _, row := range rows {
+		serviceID := row.ServiceID
+		if serviceID == nil {
+			serviceID = row.LineServiceID
+		}
+		// A treatment performs one session of the line it was sold on
+		base := models.Money{}
+		if sessions := intOrZero(row.LineQuantity); sessions > 0 {
+			var err error
+			if base, err = amountOrZero(row.LineItemTotal).Ratio(1, int64(sessions)); err != nil {
+				return nil, err
+			}
+		}
+
+		staff := []struct {
+			role    string
+			staffID *int
+		}{
+			{models.CommissionRoleDoctor, row.DoctorID},
+			{models.CommissionRoleNurse, row.NurseID},
+			{models.CommissionRoleBeautician, row.BeauticianID},
+		}
+		for _, member := range staff {
+			if member.staffID == nil || (filter.Role != "" && filter.Role != member.role) ||
+				(filter.StaffID != nil && *filter.StaffID != *member.staffID) {
+				continue
+			}
+			rule := matchCommissionRule(rules, member.role, row.LineItemID, serviceID, row.LocationID)
+			if rule == nil {
+				continue
+			}
+			commission, err := commissionOf(rule, base, 1)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, CommissionEntry{
+				Role:       member.role,
+				StaffID:    *member.staffID,
+				Source:     CommissionSourceTreatment,
+				DocumentID: row.ID,
+				DocNumber:  row.DocNumber,
+				Date:       row.CompletedAt.In(period.From.Location()),
+				LocationID: row.LocationID,
+				ItemID:     row.LineItemID,
+				ServiceID:  serviceID,
+				Quantity:   1,
+				Base:       base,
+				RuleID:     rule.ID,
+				Type:       rule.CalcType,
+				Value:      rule.CalcValue,
+				Commission: commission,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// matchCommissionRule returns the most specific rule for the role that the
+// item, service and location match. An item outranks a service, which
+// outranks a location.
+func matchCommissionRule(rules []models.CommissionRule, role string, itemID, serviceID, locationID *int) *models.CommissionRule {
+	var best *models.CommissionRule
+	bestRank := -1
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Role != role ||
+			!commissionScopeMatches(rule.ItemID, itemID) ||
+			!commissionScopeMatches(rule.ServiceID, serviceID) ||
+			!commissionScopeMatches(rule.LocationID, locationID) {
+			continue
+		}
+		rank := 0
+		if rule.ItemID != nil {
+			rank += 4
+		}
+		if rule.ServiceID != nil {
+			rank += 2
+		}
+		if rule.LocationID != nil {
+			rank++
+		}
+		if rank > bestRank {
+			best, bestRank = rule, rank
+		}
+	}
+	return best
+}
+
+// commissionScopeMatches reports whether a rule's scope covers a value; an
+// empty scope covers anything
+func commissionScopeMatches(scope, value *int) bool {
+	return scope == nil || (value != nil && *scope == *value)
+}
+
+// commissionOf applies a rule: a percentage of the base, or the fixed
+// amount per unit
+func commissionOf(rule *models.CommissionRule, base models.Money, quantity int) (models.Money, error) {
+	if rule.CalcType == models.CommissionPercentage {
+		return base.Ratio(rule.CalcValue.Cents(), 10000)
+	}
+	return rule.CalcValue.Mul(int64(quantity))
+}
+
+// buildCommissionReport groups entries per staff member and role
+func buildCommissionReport(period StatementPeriod, entries []CommissionEntry) *CommissionReport {
+	type staffKey struct {
+		role    string
+		staffID int
+	}
+	report := &CommissionReport{Period: period, Staff: []StaffCommission{}}
+	index := make(map[staffKey]int)
+	for _, entry := range entries {
+		key := staffKey{entry.Role, entry.StaffID}
+		i, exists := index[key]
+		if !exists {
+			i = len(report.Staff)
+			index[key] = i
+			report.Staff = append(report.Staff, StaffCommission{Role: entry.Role, StaffID: entry.StaffID})
+		}
+		staff := &report.Staff[i]
+		staff.Entries = append(staff.Entries, entry)
+		staff.Base = staff.Base.Add(entry.Base)
+		staff.Commission = staff.Commission.Add(entry.Commission)
+		report.TotalBase = report.TotalBase.Add(entry.Base)
+		report.TotalCommission = report.TotalCommission.Add(entry.Commission)
+	}
+
+	sort.Slice(report.Staff, func(i, j int) bool {
+		if report.Staff[i].Role != report.Staff[j].Role {
+			return report.Staff[i].Role < report.Staff[j].Role
+		}
+		return report.Staff[i].StaffID < report.Staff[j].StaffID
+	})
+	for i := range report.Staff {
+		staffEntries := report.Staff[i].Entries
+		sort.SliceStable(staffEntries, func(a, b int) bool {
+			return staffEntries[a].Date.Before(staffEntries[b].Date)
+		})
+	}
+	return report
+}
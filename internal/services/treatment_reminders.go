@@ -0,0 +1,480 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"gorm.io/gorm"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/models"
+	"pos-mojosoft-so-service/internal/notify"
+)
+
+var ErrRemindersRunning = errors.New("reminders are already being sent for this tenant")
+
+// ReminderData is what reminder templates are rendered with. Dates are
+// YYYY-MM-DD and times HH:MM in the tenant's timezone; fields that do not
+// apply to a kind are empty.
+type ReminderData struct {
+	Kind              string
+	CustomerID        int
+	LocationID        int
+	InvNumber         string
+	ServiceName       string
+	Date              string
+	Time              string
+	ItemName          string
+	RemainingSessions int
+	ExpiryDate        string
+}
+
+// defaultReminderTemplates are sent for kinds without a reminder_template row
+var defaultReminderTemplates = map[string]models.ReminderTemplate{
+	models.ReminderAppointment: {
+		Kind:    models.ReminderAppointment,
+		Subject: stringPtr("Your treatment on {{.Date}}"),
+		Body:    "This is a reminder of your {{.ServiceName}} on {{.Date}}{{if .Time}} at {{.Time}}{{end}}. We look forward to seeing you.",
+	},
+	models.ReminderPackage: {
+		Kind:    models.ReminderPackage,
+		Subject: stringPtr("Sessions left on your {{.ItemName}}"),
+		Body:    "You have {{.RemainingSessions}} session(s) left on your {{.ItemName}}{{if .ExpiryDate}}, valid until {{.ExpiryDate}}{{end}}. Book your next treatment with us.",
+	},
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+func stringOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+// ReminderResult is one reminder sent or attempted
+type ReminderResult struct {
+	Kind                 string  `json:"kind"`
+	CustomerID           *int    `json:"customer_id"`
+	SalesOrderServiceIDs []int   `json:"sales_order_service_ids"`
+	Status               string  `json:"status"`
+	MessageID            *string `json:"message_id"`
+	Error                *string `json:"error"`
+}
+
+// ReminderRun summarises a run of the reminder scheduler
+type ReminderRun struct {
+	Sent    int              `json:"sent"`
+	Failed  int              `json:"failed"`
+	Results []ReminderResult `json:"results"`
+}
+
+// reminderJob is a reminder due for one or more services of a customer.
+// target is the schedule date an appointment reminder is for.
+type reminderJob struct {
+	kind     string
+	services []models.SalesOrderService
+	retry    []bool
+	target   *time.Time
+	customer *int
+	data     ReminderData
+}
+
+// parsedReminderTemplate is a reminder template ready to render
+type parsedReminderTemplate struct {
+	remindedID *int
+	subject    *template.Template
+	body       *template.Template
+}
+
+func parseReminderTemplate(t models.ReminderTemplate) (*parsedReminderTemplate, error) {
+	parsed := &parsedReminderTemplate{remindedID: t.RemindedID}
+	var err error
+	if parsed.body, err = template.New("body").Parse(t.Body); err != nil {
+		return nil, err
+	}
+	if t.Subject != nil && *t.Subject != "" {
+		if parsed.subject, err = template.New("subject").Parse(*t.Subject); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+func (t *parsedReminderTemplate) render(data ReminderData) (subject, body string, err error) {
+	var buf bytes.Buffer
+	if t.subject != nil {
+		if err := t.subject.Execute(&buf, data); err != nil {
+			return "", "", err
+		}
+		subject = buf.String()
+		buf.Reset()
+	}
+	if err := t.body.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	return subject, strings.TrimSpace(buf.String()), nil
+}
+
+// ValidateReminderTemplate checks a template's kind and that its subject
+// and body render
+func ValidateReminderTemplate(t *models.ReminderTemplate) ValidationErrors {
+	var errs ValidationErrors
+	if _, exists := defaultReminderTemplates[t.Kind]; !exists {
+		errs = append(errs, models.ErrorDetail{Field: "kind", Message: "Kind must be appointment or package"})
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return append(errs, models.ErrorDetail{Field: "body", Message: "Body is required"})
+	}
+
+	sample := ReminderData{
+		Kind: t.Kind, CustomerID: 1, LocationID: 1, InvNumber: "SO/JKT/2026/000001",
+		ServiceName: "Facial", Date: "2026-01-31", Time: "10:00",
+		ItemName: "Facial Package x10", RemainingSessions: 3, ExpiryDate: "2026-12-31",
+	}
+	for _, part := range []struct {
+		field string
+		text  *string
+	}{{"subject", t.Subject}, {"body", &t.Body}} {
+		if part.text == nil {
+			continue
+		}
+		parsed, err := template.New(part.field).Parse(*part.text)
+		if err == nil {
+			err = parsed.Execute(&bytes.Buffer{}, sample)
+		}
+		if err != nil {
+			errs = append(errs, models.ErrorDetail{Field: part.field, Message: "Template is invalid: " + err.Error()})
+		}
+	}
+	return errs
+}
+
+// TreatmentReminders reminds customers of their upcoming scheduled services
+// and of unused package sessions, and records the delivery on the services
+type TreatmentReminders struct {
+	states   *SalesOrderStateMachine
+	notifier notify.Notifier
+	cfg      config.ReminderConfig
+}
+
+func NewTreatmentReminders(states *SalesOrderStateMachine, notifier notify.Notifier, cfg config.ReminderConfig) *TreatmentReminders {
+	return &TreatmentReminders{states: states, notifier: notifier, cfg: cfg}
+}
+
+// Run sends the reminders due in a tenant. Only one run per tenant proceeds
+// at a time; a concurrent run fails with ErrRemindersRunning. A failed
+// delivery is recorded on its services and retried by a later run.
+func (r *TreatmentReminders) Run(ctx context.Context, db *gorm.DB, tenantCode string, today time.Time) (*ReminderRun, error) {
+	run := &ReminderRun{Results: make([]ReminderResult, 0)}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(hashtext(?))", "treatment-reminders").
+			Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return ErrRemindersRunning
+		}
+
+		templates, err := r.templates(tx)
+		if err != nil {
+			return err
+		}
+		appointments, err := r.dueAppointments(tx, today)
+		if err != nil {
+			return err
+		}
+		packages, err := r.duePackages(tx, today)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range append(appointments, packages...) {
+			result, err := r.send(ctx, tx, tenantCode, templates[job.kind], job)
+			if err != nil {
+				return err
+			}
+			if result.Status == models.ReminderSent {
+				run.Sent++
+			} else {
+				run.Failed++
+			}
+			run.Results = append(run.Results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// templates returns the tenant's template of every kind, or the default
+func (r *TreatmentReminders) templates(tx *gorm.DB) (map[string]*parsedReminderTemplate, error) {
+	var stored []models.ReminderTemplate
+	if err := tx.Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	byKind := make(map[string]models.ReminderTemplate, len(defaultReminderTemplates))
+	for kind, t := range defaultReminderTemplates {
+		byKind[kind] = t
+	}
+	for _, t := range stored {
+		byKind[t.Kind] = t
+	}
+
+	parsed := make(map[string]*parsedReminderTemplate, len(byKind))
+	for kind, t := range byKind {
+		p, err := parseReminderTemplate(t)
+		if err != nil {
+			return nil, fmt.Errorf("reminder template %s: %w", kind, err)
+		}
+		parsed[kind] = p
+	}
+	return parsed, nil
+}
+
+// due reports whether a service needs a reminder for target, and whether it
+// is a retry of a failed one. Appointment reminders are sent once per
+// schedule date; package reminders (no target) once per interval.
+func (r *TreatmentReminders) due(service models.SalesOrderService, target *time.Time, now time.Time) (due, retry bool) {
+	if service.ReminderStatus == nil {
+		return true, false
+	}
+	sameTarget := sameDay(target, service.ReminderFor)
+	if target != nil && !sameTarget {
+		return true, false
+	}
+	if target == nil && (service.RemindedAt == nil ||
+		now.Sub(*service.RemindedAt) >= time.Duration(r.cfg.PackageIntervalDays)*24*time.Hour) {
+		return true, false
+	}
+	if sameTarget && *service.ReminderStatus == models.ReminderFailed && service.ReminderAttempts < r.cfg.MaxAttempts {
+		return true, true
+	}
+	return false, false
+}
+
+// dueAppointments finds the untreated services scheduled from today to
+// LeadDays ahead on orders that are not void
+func (r *TreatmentReminders) dueAppointments(tx *gorm.DB, today time.Time) ([]reminderJob, error) {
+	if r.cfg.LeadDays < 0 {
+		return nil, nil
+	}
+	ids, err := r.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	type appointmentRow struct {
+		models.SalesOrderService
+		InvNumber  *string    `gorm:"column:invnumber"`
+		CustomerID *int       `gorm:"column:costumer_id"`
+		LocationID *int       `gorm:"column:location_id"`
+		StartsAt   *time.Time `gorm:"column:starts_at"`
+	}
+	var rows []appointmentRow
+	if err := tx.Model(&models.SalesOrderService{}).
+		Select("sales_order_service.*, sales_order.invnumber, sales_order.costumer_id, "+
+			"COALESCE(appointment.location_id, sales_order.location_id) AS location_id, appointment.starts_at").
+		Joins("JOIN sales_order ON sales_order.id = sales_order_service.salesorder_id AND sales_order.deleted_at IS NULL").
+		Joins("LEFT JOIN appointment ON appointment.salesorderservice_id = sales_order_service.id "+
+			"AND appointment.status = ? AND appointment.deleted_at IS NULL", models.AppointmentBooked).
+		Where("sales_order.status_id <> ?", ids[SalesOrderVoid]).
+		Where("sales_order_service.schedule BETWEEN ? AND ?",
+			today.Format("2006-01-02"), today.AddDate(0, 0, r.cfg.LeadDays).Format("2006-01-02")).
+		Where("sales_order_service.treated IS NOT TRUE").
+		Order("sales_order_service.schedule, sales_order_service.id").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	loc := today.Location()
+	var jobs []reminderJob
+	for _, row := range rows {
+		due, retry := r.due(row.SalesOrderService, row.Schedule, now)
+		if !due {
+			continue
+		}
+		data := ReminderData{
+			Kind:        models.ReminderAppointment,
+			CustomerID:  intOrZero(row.CustomerID),
+			LocationID:  intOrZero(row.LocationID),
+			InvNumber:   stringOrEmpty(row.InvNumber),
+			ServiceName: stringOrEmpty(row.ServiceName),
+			Date:        row.Schedule.Format("2006-01-02"),
+		}
+		if row.StartsAt != nil {
+			data.Time = row.StartsAt.In(loc).Format("15:04")
+		}
+		jobs = append(jobs, reminderJob{
+			kind:     models.ReminderAppointment,
+			services: []models.SalesOrderService{row.SalesOrderService},
+			retry:    []bool{retry},
+			target:   row.Schedule,
+			customer: row.CustomerID,
+			data:     data,
+		})
+	}
+	return jobs, nil
+}
+
+// duePackages finds package lines of posted and paid orders, posted at least
+// PackageIntervalDays ago, that have sessions left and have not expired. The
+// reminder is recorded on the line's untreated services without a schedule.
+func (r *TreatmentReminders) duePackages(tx *gorm.DB, today time.Time) ([]reminderJob, error) {
+	if r.cfg.PackageIntervalDays <= 0 {
+		return nil, nil
+	}
+	ids, err := r.states.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	type packageRow struct {
+		models.SalesOrderDetail
+		InvNumber  *string `gorm:"column:invnumber"`
+		CustomerID *int    `gorm:"column:costumer_id"`
+		LocationID *int    `gorm:"column:location_id"`
+	}
+	var rows []packageRow
+	if err := tx.Model(&models.SalesOrderDetail{}).
+		Select("sales_order_detail.*, sales_order.invnumber, sales_order.costumer_id, sales_order.location_id").
+		Joins("JOIN sales_order ON sales_order.id = sales_order_detail.salesorder_id AND sales_order.deleted_at IS NULL").
+		Where("sales_order.status_id IN ?", []int{ids[SalesOrderPosted], ids[SalesOrderPaid]}).
+		Where("sales_order.posteddate <= ?", today.AddDate(0, 0, -r.cfg.PackageIntervalDays).Format("2006-01-02")).
+		Where("COALESCE(sales_order_detail.quantity, 0) > COALESCE(sales_order_detail.usedsessions, 0)").
+		Where("(sales_order_detail.expirydate IS NULL OR sales_order_detail.expirydate >= ?)", today.Format("2006-01-02")).
+		Order("sales_order_detail.id").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	detailIDs := make([]int, 0, len(rows))
+	for _, row := range rows {
+		detailIDs = append(detailIDs, row.ID)
+	}
+	var services []models.SalesOrderService
+	if err := tx.Where("salesorderdetail_id IN ? AND schedule IS NULL AND treated IS NOT TRUE", detailIDs).
+		Order("id").Find(&services).Error; err != nil {
+		return nil, err
+	}
+	servicesByDetail := make(map[int][]models.SalesOrderService)
+	for _, service := range services {
+		servicesByDetail[*service.SalesOrderDetailID] = append(servicesByDetail[*service.SalesOrderDetailID], service)
+	}
+
+	now := time.Now()
+	var jobs []reminderJob
+	for _, row := range rows {
+		candidates := servicesByDetail[row.ID]
+		anyDue := false
+		retry := make([]bool, len(candidates))
+		for i, service := range candidates {
+			var due bool
+			due, retry[i] = r.due(service, nil, now)
+			anyDue = anyDue || due
+		}
+		if !anyDue {
+			continue
+		}
+
+		data := ReminderData{
+			Kind:              models.ReminderPackage,
+			CustomerID:        intOrZero(row.CustomerID),
+			LocationID:        intOrZero(row.LocationID),
+			InvNumber:         stringOrEmpty(row.InvNumber),
+			ItemName:          stringOrEmpty(row.ItemName),
+			RemainingSessions: intOrZero(row.Quantity) - intOrZero(row.UsedSessions),
+		}
+		if row.ExpiryDate != nil {
+			data.ExpiryDate = row.ExpiryDate.Format("2006-01-02")
+		}
+		jobs = append(jobs, reminderJob{
+			kind:     models.ReminderPackage,
+			services: candidates,
+			retry:    retry,
+			customer: row.CustomerID,
+			data:     data,
+		})
+	}
+	return jobs, nil
+}
+
+// send renders and delivers a reminder and records the outcome on its
+// services. Rendering and delivery failures are recorded, not returned.
+func (r *TreatmentReminders) send(ctx context.Context, tx *gorm.DB, tenantCode string, t *parsedReminderTemplate, job reminderJob) (ReminderResult, error) {
+	result := ReminderResult{Kind: job.kind, CustomerID: job.customer, SalesOrderServiceIDs: make([]int, 0, len(job.services))}
+	for _, service := range job.services {
+		result.SalesOrderServiceIDs = append(result.SalesOrderServiceIDs, service.ID)
+	}
+
+	var messageID string
+	subject, body, err := t.render(job.data)
+	if err == nil && job.customer == nil {
+		err = errors.New("sales order has no customer")
+	}
+	if err == nil {
+		messageID, err = r.notifier.Send(ctx, notify.Message{
+			Tenant:     tenantCode,
+			Kind:       job.kind,
+			CustomerID: job.customer,
+			Subject:    subject,
+			Body:       body,
+			Reference:  fmt.Sprintf("sales_order_service:%d", job.services[0].ID),
+		})
+	}
+
+	now := time.Now()
+	var reminderFor interface{}
+	if job.target != nil {
+		reminderFor = job.target.Format("2006-01-02")
+	}
+	for i, service := range job.services {
+		attempts := 1
+		if job.retry[i] {
+			attempts = service.ReminderAttempts + 1
+		}
+		updates := map[string]interface{}{
+			"reminded_at":      now,
+			"reminderfor":      reminderFor,
+			"reminderattempts": attempts,
+		}
+		if err == nil {
+			updates["reminderstatus"] = models.ReminderSent
+			updates["remindererror"] = nil
+			updates["messagelogdetail_id"] = messageID
+			if t.remindedID != nil {
+				updates["reminded_id"] = *t.remindedID
+			}
+		} else {
+			updates["reminderstatus"] = models.ReminderFailed
+			updates["remindererror"] = err.Error()
+		}
+		if dbErr := tx.Model(&models.SalesOrderService{}).Where("id = ?", service.ID).
+			UpdateColumns(updates).Error; dbErr != nil {
+			return result, dbErr
+		}
+	}
+
+	if err != nil {
+		message := err.Error()
+		result.Status = models.ReminderFailed
+		result.Error = &message
+	} else {
+		result.Status = models.ReminderSent
+		result.MessageID = &messageID
+	}
+	return result, nil
+}
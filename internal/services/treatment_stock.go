@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/config"
+	"pos-mojosoft-so-service/internal/inventory"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+var ErrStockRelayRunning = errors.New("stock movements are already being relayed for this tenant")
+
+// StockRelayRun summarises a run of the stock movement relay. Pending is
+// what is left in the outbox; Error is why the run stopped early.
+type StockRelayRun struct {
+	Sent    int     `json:"sent"`
+	Pending int64   `json:"pending"`
+	Error   *string `json:"error"`
+}
+
+// ConsumableStock turns the consumables recorded on treatment details into
+// stock movements. Posting a treatment writes a stock-out per detail and
+// voiding it writes the reversals, both into an outbox in the same
+// transaction; Relay delivers the outbox to the inventory port in order.
+type ConsumableStock struct {
+	port      inventory.Port
+	batchSize int
+}
+
+func NewConsumableStock(port inventory.Port, cfg config.InventoryConfig) *ConsumableStock {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	return &ConsumableStock{port: port, batchSize: batchSize}
+}
+
+// Issue writes the stock-out movements of a posted treatment's details.
+// Details must name an item and a positive quantity. Details already
+// stocked out are skipped, so issuing twice is harmless.
+func (s *ConsumableStock) Issue(tx *gorm.DB, treatment *models.Treatment, userID int64) error {
+	if treatment.PostedDate == nil {
+		return nil
+	}
+	var details []models.TreatmentDetail
+	if err := tx.Where("treatment_id = ?", treatment.ID).Order("id").Find(&details).Error; err != nil {
+		return err
+	}
+
+	var errs ValidationErrors
+	for i, detail := range details {
+		if detail.ItemID == nil {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("details[%d].item_id", i), Message: "Item is required to post the treatment"})
+		}
+		if intOrZero(detail.Quantity) <= 0 {
+			errs = append(errs, models.ErrorDetail{Field: fmt.Sprintf("details[%d].quantity", i), Message: "Quantity must be greater than zero to post the treatment"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if len(details) == 0 {
+		return nil
+	}
+
+	conversions, err := s.conversions(tx, details)
+	if err != nil {
+		return err
+	}
+
+	movements := make([]models.StockMovement, 0, len(details))
+	for _, detail := range details {
+		baseUnitID, factor := convertUnit(conversions, *detail.ItemID, detail.UnitID)
+		movements = append(movements, models.StockMovement{
+			Direction:         models.StockOut,
+			TreatmentID:       treatment.ID,
+			TreatmentDetailID: detail.ID,
+			LocationID:        treatment.LocationID,
+			ItemID:            *detail.ItemID,
+			UnitID:            detail.UnitID,
+			Quantity:          *detail.Quantity,
+			BaseUnitID:        baseUnitID,
+			BaseQuantity:      *detail.Quantity * factor,
+			MovementDate:      *treatment.PostedDate,
+			Status:            models.StockMovementPending,
+			CreatedBy:         &userID,
+		})
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&movements).Error
+}
+
+// Reverse writes a stock-in for every stock-out of a treatment not reversed
+// yet. The reversal carries the quantities of the movement it reverses, so
+// later changes to unit conversions do not skew it.
+func (s *ConsumableStock) Reverse(tx *gorm.DB, treatment *models.Treatment, userID int64, today time.Time) error {
+	var issued []models.StockMovement
+	if err := tx.Where("treatment_id = ? AND direction = ?", treatment.ID, models.StockOut).
+		Where("NOT EXISTS (SELECT 1 FROM stock_movement_outbox r WHERE r.reverses_id = stock_movement_outbox.id)").
+		Order("seq").Find(&issued).Error; err != nil {
+		return err
+	}
+	if len(issued) == 0 {
+		return nil
+	}
+
+	reversals := make([]models.StockMovement, 0, len(issued))
+	for _, out := range issued {
+		reverses := out.ID
+		reversals = append(reversals, models.StockMovement{
+			Direction:         models.StockIn,
+			TreatmentID:       out.TreatmentID,
+			TreatmentDetailID: out.TreatmentDetailID,
+			ReversesID:        &reverses,
+			LocationID:        out.LocationID,
+			ItemID:            out.ItemID,
+			UnitID:            out.UnitID,
+			Quantity:          out.Quantity,
+			BaseUnitID:        out.BaseUnitID,
+			BaseQuantity:      out.BaseQuantity,
+			MovementDate:      today,
+			Status:            models.StockMovementPending,
+			CreatedBy:         &userID,
+		})
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reversals).Error
+}
+
+// conversionKey identifies a unit conversion; item 0 is the rule for every item
+type conversionKey struct {
+	itemID int
+	unitID int
+}
+
+// conversions loads the unit conversions of the details' units
+func (s *ConsumableStock) conversions(tx *gorm.DB, details []models.TreatmentDetail) (map[conversionKey]models.UnitConversion, error) {
+	unitIDs := make([]int, 0, len(details))
+	for _, detail := range details {
+		if detail.UnitID != nil {
+			unitIDs = append(unitIDs, *detail.UnitID)
+		}
+	}
+	conversions := make(map[conversionKey]models.UnitConversion)
+	if len(unitIDs) == 0 {
+		return conversions, nil
+	}
+
+	var rules []models.UnitConversion
+	if err := tx.Where("unit_id IN ?", unitIDs).Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		conversions[conversionKey{itemID: intOrZero(rule.ItemID), unitID: rule.UnitID}] = rule
+	}
+	return conversions, nil
+}
+
+// convertUnit returns the base unit of an item's unit and how many base
+// units one unit holds. The item's own rule wins over the rule for every
+// item; a unit without a rule is its own base unit.
+func convertUnit(conversions map[conversionKey]models.UnitConversion, itemID int, unitID *int) (*int, int) {
+	if unitID == nil {
+		return nil, 1
+	}
+	for _, key := range []conversionKey{{itemID, *unitID}, {0, *unitID}} {
+		if rule, exists := conversions[key]; exists {
+			baseUnitID := rule.BaseUnitID
+			return &baseUnitID, rule.Factor
+		}
+	}
+	return unitID, 1
+}
+
+// Relay delivers the tenant's pending stock movements to the inventory port
+// in the order they were written. It stops at the first failure so that a
+// reversal never overtakes its stock-out; the failed movement is retried by
+// the next run. Only one relay per tenant proceeds at a time; the lock key
+// carries the tenant code because tenants may share one database.
+//
+// A movement is marked sent in the transaction that delivered it. Should
+// that commit fail after delivery, the movement is delivered again under
+// the same ID, which the inventory service ignores.
+func (s *ConsumableStock) Relay(ctx context.Context, db *gorm.DB, tenantCode string) (*StockRelayRun, error) {
+	run := &StockRelayRun{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(hashtext(?))", "stock-movement-relay:"+tenantCode).
+			Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return ErrStockRelayRunning
+		}
+
+		var pending []models.StockMovement
+		if err := tx.Where("status = ?", models.StockMovementPending).
+			Order("seq").Limit(s.batchSize).Find(&pending).Error; err != nil {
+			return err
+		}
+
+		for _, movement := range pending {
+			publishErr := s.port.Publish(ctx, toInventoryMovement(tenantCode, movement))
+			updates := map[string]interface{}{"attempts": gorm.Expr("attempts + 1")}
+			if publishErr == nil {
+				updates["status"] = models.StockMovementSent
+				updates["sent_at"] = time.Now()
+				updates["lasterror"] = nil
+			} else {
+				updates["lasterror"] = publishErr.Error()
+			}
+			if err := tx.Model(&models.StockMovement{}).Where("id = ?", movement.ID).
+				UpdateColumns(updates).Error; err != nil {
+				return err
+			}
+			if publishErr != nil {
+				message := publishErr.Error()
+				run.Error = &message
+				break
+			}
+			run.Sent++
+		}
+
+		return tx.Model(&models.StockMovement{}).Where("status = ?", models.StockMovementPending).
+			Count(&run.Pending).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// toInventoryMovement is what the inventory port receives for an outbox row
+func toInventoryMovement(tenantCode string, m models.StockMovement) inventory.Movement {
+	movement := inventory.Movement{
+		ID:             m.ID.String(),
+		Tenant:         tenantCode,
+		Direction:      m.Direction,
+		LocationID:     m.LocationID,
+		ItemID:         m.ItemID,
+		UnitID:         m.BaseUnitID,
+		Quantity:       m.BaseQuantity,
+		SourceUnitID:   m.UnitID,
+		SourceQuantity: m.Quantity,
+		Date:           m.MovementDate.Format("2006-01-02"),
+		Reference:      "treatment:" + m.TreatmentID.String(),
+	}
+	if m.ReversesID != nil {
+		reverses := m.ReversesID.String()
+		movement.ReversesID = &reverses
+	}
+	return movement
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"pos-mojosoft-so-service/internal/models"
+)
+
+// TreatmentState is a clinical state of a treatment. Each state maps to the
+// treatment_status row with the same name (case-insensitive).
+type TreatmentState string
+
+const (
+	TreatmentScheduled  TreatmentState = "scheduled"
+	TreatmentInProgress TreatmentState = "in progress"
+	TreatmentCompleted  TreatmentState = "completed"
+	TreatmentSignedOff  TreatmentState = "signed off"
+)
+
+// TreatmentEvent triggers a transition between treatment states
+type TreatmentEvent string
+
+const (
+	TreatmentEventStart    TreatmentEvent = "start"
+	TreatmentEventComplete TreatmentEvent = "complete"
+	TreatmentEventSignOff  TreatmentEvent = "sign off"
+)
+
+var treatmentTransitions = map[TreatmentEvent]struct {
+	from TreatmentState
+	to   TreatmentState
+}{
+	TreatmentEventStart:    {from: TreatmentScheduled, to: TreatmentInProgress},
+	TreatmentEventComplete: {from: TreatmentInProgress, to: TreatmentCompleted},
+	TreatmentEventSignOff:  {from: TreatmentCompleted, to: TreatmentSignedOff},
+}
+
+var (
+	ErrTreatmentNotFound        = errors.New("treatment not found")
+	ErrTreatmentStatusNotSeeded = errors.New("treatment status table is missing a clinical status")
+	ErrLinkedServiceNotFound    = errors.New("sales order service of the treatment not found")
+	ErrTreatmentCompleted       = errors.New("treatment has been completed")
+)
+
+// WorkflowError reports a treatment transition or correction that is not
+// allowed from the treatment's current state
+type WorkflowError struct {
+	Event  TreatmentEvent
+	From   TreatmentState
+	Reason string
+}
+
+func (e *WorkflowError) Error() string {
+	return fmt.Sprintf("cannot %s a %s treatment: %s", e.Event, e.From, e.Reason)
+}
+
+// TreatmentStaff assigns staff to a treatment as it moves through the
+// workflow; nil fields keep the staff already assigned
+type TreatmentStaff struct {
+	DoctorID     *int
+	NurseID      *int
+	BeauticianID *int
+}
+
+// TreatmentChange is what a correction may change on a completed treatment
+type TreatmentChange struct {
+	PatientID    *int
+	ServiceID    *int
+	DoctorID     *int
+	NurseID      *int
+	BeauticianID *int
+	ServiceText  *string
+	Note         *string
+}
+
+// TreatmentWorkflow guards the clinical status of treatments:
+// Scheduled → In Progress → Completed → Signed Off. Completed and signed
+// off treatments only change through Correct, which keeps the original.
+type TreatmentWorkflow struct{}
+
+func NewTreatmentWorkflow() *TreatmentWorkflow {
+	return &TreatmentWorkflow{}
+}
+
+// statusIDs loads the treatment_status IDs for every clinical state
+func (w *TreatmentWorkflow) statusIDs(tx *gorm.DB) (map[TreatmentState]int, error) {
+	var statuses []models.TreatmentStatus
+	if err := tx.Find(&statuses).Error; err != nil {
+		return nil, err
+	}
+
+	ids := make(map[TreatmentState]int, len(statuses))
+	for _, status := range statuses {
+		if status.Name != nil {
+			ids[TreatmentState(strings.ToLower(strings.TrimSpace(*status.Name)))] = status.ID
+		}
+	}
+
+	for _, state := range []TreatmentState{TreatmentScheduled, TreatmentInProgress, TreatmentCompleted, TreatmentSignedOff} {
+		if _, exists := ids[state]; !exists {
+			return nil, fmt.Errorf("%w: %s", ErrTreatmentStatusNotSeeded, state)
+		}
+	}
+	return ids, nil
+}
+
+// ScheduledStatusID returns the status ID new treatments are created with
+func (w *TreatmentWorkflow) ScheduledStatusID(tx *gorm.DB) (int, error) {
+	ids, err := w.statusIDs(tx)
+	if err != nil {
+		return 0, err
+	}
+	return ids[TreatmentScheduled], nil
+}
+
+// treatmentStateOf returns the clinical state of a treatment. Treatments
+// without a status are treated as scheduled.
+func treatmentStateOf(ids map[TreatmentState]int, treatment *models.Treatment) (TreatmentState, error) {
+	if treatment.StatusID == nil {
+		return TreatmentScheduled, nil
+	}
+	for state, id := range ids {
+		if id == *treatment.StatusID {
+			return state, nil
+		}
+	}
+	return "", fmt.Errorf("treatment has unknown status_id %d", *treatment.StatusID)
+}
+
+// lock loads and locks the treatment with the given ID for the rest of tx
+func (w *TreatmentWorkflow) lock(tx *gorm.DB, treatmentID uuid.UUID, scopes ...func(*gorm.DB) *gorm.DB) (*models.Treatment, error) {
+	var treatment models.Treatment
+	if err := tx.Scopes(scopes...).Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&treatment, "id = ?", treatmentID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrTreatmentNotFound
+		}
+		return nil, err
+	}
+	return &treatment, nil
+}
+
+// LockEditable loads and locks the treatment with the given ID for the rest
+// of tx and returns ErrTreatmentCompleted once it has been completed, so an
+// edit or delete cannot race a Complete or SignOff; scopes are applied to the
+// lookup
+func (w *TreatmentWorkflow) LockEditable(tx *gorm.DB, treatmentID uuid.UUID, scopes ...func(*gorm.DB) *gorm.DB) (*models.Treatment, error) {
+	treatment, err := w.lock(tx, treatmentID, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	if treatment.CompletedAt != nil {
+		return nil, ErrTreatmentCompleted
+	}
+
+	ids, err := w.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+	state, err := treatmentStateOf(ids, treatment)
+	if err != nil {
+		return nil, err
+	}
+	if state == TreatmentCompleted || state == TreatmentSignedOff {
+		return nil, ErrTreatmentCompleted
+	}
+	return treatment, nil
+}
+
+// Fire applies an event to the treatment with the given ID inside tx,
+// first assigning the staff given. now stamps the step. The treatment row
+// is locked for the duration of the transaction; scopes are applied to the
+// lookup so callers can restrict it (e.g. by location).
+func (w *TreatmentWorkflow) Fire(tx *gorm.DB, treatmentID uuid.UUID, event TreatmentEvent, staff TreatmentStaff, userID int64, now time.Time, scopes ...func(*gorm.DB) *gorm.DB) (*models.Treatment, error) {
+	transition, exists := treatmentTransitions[event]
+	if !exists {
+		return nil, fmt.Errorf("unknown treatment event %q", event)
+	}
+
+	treatment, err := w.lock(tx, treatmentID, scopes...)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := w.statusIDs(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	from, err := treatmentStateOf(ids, treatment)
+	if err != nil {
+		return nil, err
+	}
+	if from != transition.from {
+		return nil, &WorkflowError{Event: event, From: from, Reason: "transition not allowed"}
+	}
+
+	if staff.DoctorID != nil {
+		treatment.DoctorID = staff.DoctorID
+	}
+	if staff.NurseID != nil {
+		treatment.NurseID = staff.NurseID
+	}
+	if staff.BeauticianID != nil {
+		treatment.BeauticianID = staff.BeauticianID
+	}
+	if err := checkTreatmentStaff(treatment, event); err != nil {
+		return nil, err
+	}
+
+	switch event {
+	case TreatmentEventStart:
+		treatment.StartedAt = &now
+	case TreatmentEventComplete:
+		treatment.CompletedAt = &now
+		if err := w.markServiceTreated(tx, treatment, userID, now); err != nil {
+			return nil, err
+		}
+	case TreatmentEventSignOff:
+		treatment.SignedOffAt = &now
+		treatment.SignedOffBy = &userID
+	}
+
+	statusID := ids[transition.to]
+	treatment.StatusID = &statusID
+	treatment.UpdatedBy = &userID
+
+	if err := tx.Save(treatment).Error; err != nil {
+		return nil, err
+	}
+	return treatment, nil
+}
+
+// checkTreatmentStaff requires a doctor or beautician to perform the
+// treatment and a doctor to sign it off
+func checkTreatmentStaff(treatment *models.Treatment, event TreatmentEvent) error {
+	switch event {
+	case TreatmentEventStart, TreatmentEventComplete:
+		if treatment.DoctorID == nil && treatment.BeauticianID == nil {
+			return ValidationErrors{{Field: "doctor_id", Message: fmt.Sprintf("A doctor or beautician is required to %s the treatment", event)}}
+		}
+	case TreatmentEventSignOff:
+		if treatment.DoctorID == nil {
+			return ValidationErrors{{Field: "doctor_id", Message: "A doctor is required to sign off the treatment"}}
+		}
+	}
+	return nil
+}
+
+// markServiceTreated marks the sales order service the treatment performs
+// as treated, keeping the time of an earlier treatment
+func (w *TreatmentWorkflow) markServiceTreated(tx *gorm.DB, treatment *models.Treatment, userID int64, now time.Time) error {
+	if treatment.SalesOrderServiceID == nil {
+		return nil
+	}
+
+	var service models.SalesOrderService
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(&service, *treatment.SalesOrderServiceID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return ErrLinkedServiceNotFound
+		}
+		return err
+	}
+
+	treated := true
+	service.Treated = &treated
+	if service.TreatedAt == nil {
+		service.TreatedAt = &now
+	}
+	service.UpdatedBy = &userID
+	return tx.Save(&service).Error
+}
+
+// Correct changes a completed or signed off treatment and records the
+// treatment as it was and as it became, so the original is never lost.
+// The clinical state and its timestamps are kept.
+func (w *TreatmentWorkflow) Correct(tx *gorm.DB, treatmentID uuid.UUID, change TreatmentChange, reason string, userID int64, scopes ...func(*gorm.DB) *gorm.DB) (*models.Treatment, *models.TreatmentCorrection, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, nil, ValidationErrors{{Field: "reason", Message: "Reason is required"}}
+	}
+
+	treatment, err := w.lock(tx, treatmentID, scopes...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids, err := w.statusIDs(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	state, err := treatmentStateOf(ids, treatment)
+	if err != nil {
+		return nil, nil, err
+	}
+	if state != TreatmentCompleted && state != TreatmentSignedOff {
+		return nil, nil, &WorkflowError{Event: "correct", From: state, Reason: "only completed treatments are corrected; edit it instead"}
+	}
+
+	original, err := json.Marshal(treatment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	treatment.PatientID = change.PatientID
+	treatment.ServiceID = change.ServiceID
+	treatment.DoctorID = change.DoctorID
+	treatment.NurseID = change.NurseID
+	treatment.BeauticianID = change.BeauticianID
+	treatment.ServiceText = change.ServiceText
+	treatment.Note = change.Note
+
+	event := TreatmentEventComplete
+	if state == TreatmentSignedOff {
+		event = TreatmentEventSignOff
+	}
+	if err := checkTreatmentStaff(treatment, event); err != nil {
+		return nil, nil, err
+	}
+
+	corrected, err := json.Marshal(treatment)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(corrected) == string(original) {
+		return nil, nil, ValidationErrors{{Field: "reason", Message: "Correction changes nothing"}}
+	}
+
+	treatment.UpdatedBy = &userID
+	if err := tx.Save(treatment).Error; err != nil {
+		return nil, nil, err
+	}
+
+	correction := models.TreatmentCorrection{
+		TreatmentID: treatment.ID,
+		Reason:      strings.TrimSpace(reason),
+		Original:    models.TreatmentSnapshot(original),
+		Corrected:   models.TreatmentSnapshot(corrected),
+		CreatedBy:   &userID,
+	}
+	if err := tx.Create(&correction).Error; err != nil {
+		return nil, nil, err
+	}
+	return treatment, &correction, nil
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"time"
+
+	"pos-mojosoft-so-service/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DateLayout is the only accepted format for business dates
+const DateLayout = "2006-01-02"
+
+// Today returns the current date at midnight in loc
+func Today(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+}
+
+// DateParser parses request dates strictly in a tenant's timezone and
+// collects a field error for every value that is not a valid YYYY-MM-DD date
+type DateParser struct {
+	Location *time.Location
+	Errors   []models.ErrorDetail
+}
+
+func NewDateParser(loc *time.Location) *DateParser {
+	return &DateParser{Location: loc}
+}
+
+// Optional parses value, returning nil when it is nil or blank
+func (p *DateParser) Optional(field string, value *string) *time.Time {
+	if value == nil || *value == "" {
+		return nil
+	}
+	date, err := time.ParseInLocation(DateLayout, *value, p.Location)
+	if err != nil {
+		p.Errors = append(p.Errors, models.ErrorDetail{
+			Field:   field,
+			Message: "Date must be a valid date in YYYY-MM-DD format",
+		})
+		return nil
+	}
+	return &date
+}
+
+// Query parses the named query parameter
+func (p *DateParser) Query(c *gin.Context, name string) *time.Time {
+	value := c.Query(name)
+	return p.Optional(name, &value)
+}
+
+// Range parses <prefix>_from and <prefix>_to query parameters and reports
+// a reversed range as an error
+func (p *DateParser) Range(c *gin.Context, prefix string) (from, to *time.Time) {
+	from = p.Query(c, prefix+"_from")
+	to = p.Query(c, prefix+"_to")
+	if from != nil && to != nil && to.Before(*from) {
+		p.Errors = append(p.Errors, models.ErrorDetail{
+			Field:   prefix + "_to",
+			Message: "End date must not be before start date",
+		})
+	}
+	return from, to
+}
+
+// Failed writes the collected errors as a validation response and reports
+// whether there were any
+func (p *DateParser) Failed(c *gin.Context) bool {
+	if len(p.Errors) == 0 {
+		return false
+	}
+	ValidationErrorResponse(c, p.Errors)
+	return true
+}
+
+// DateRangeScope limits a query to rows whose date column falls within
+// from and to, both inclusive; nil bounds are open
+func DateRangeScope(column string, from, to *time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if from != nil {
+			db = db.Where(column+" >= ?", from.Format(DateLayout))
+		}
+		if to != nil {
+			db = db.Where(column+" <= ?", to.Format(DateLayout))
+		}
+		return db
+	}
+}
+
+// ClockLayout is the only accepted format for times of day
+const ClockLayout = "15:04"
+
+// At parses value as an HH:MM time of day on date, returning nil when date
+// is nil or value is blank
+func (p *DateParser) At(field string, date *time.Time, value *string) *time.Time {
+	if date == nil || value == nil || *value == "" {
+		return nil
+	}
+	clock, err := time.Parse(ClockLayout, *value)
+	if err != nil {
+		p.Errors = append(p.Errors, models.ErrorDetail{
+			Field:   field,
+			Message: "Time must be a valid time in HH:MM format",
+		})
+		return nil
+	}
+	at := time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, p.Location)
+	return &at
+}
+
+// MonthLayout is the only accepted format for months
+const MonthLayout = "2006-01"
+
+// Month parses value as a YYYY-MM month and returns its first and last
+// day, or nils when value is blank
+func (p *DateParser) Month(field string, value string) (from, to *time.Time) {
+	if value == "" {
+		return nil, nil
+	}
+	month, err := time.ParseInLocation(MonthLayout, value, p.Location)
+	if err != nil {
+		p.Errors = append(p.Errors, models.ErrorDetail{
+			Field:   field,
+			Message: "Month must be a valid month in YYYY-MM format",
+		})
+		return nil, nil
+	}
+	last := month.AddDate(0, 1, -1)
+	return &month, &last
+}
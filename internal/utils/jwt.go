@@ -48,6 +48,34 @@ func (j *JWTUtil) GenerateAccessToken(userID uint, name string, roleID int, tena
 	return tokenString, expiresAt, nil
 }
 
+// GeneratePlatformAccessToken issues a platform operator token. It is bound
+// to no tenant and is the only kind accepted by the /so/admin endpoints.
+func (j *JWTUtil) GeneratePlatformAccessToken(userID uint, name string, permissions []string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(j.config.AccessTokenTTL)
+
+	claims := models.Claims{
+		UserID:      userID,
+		Name:        name,
+		Permissions: permissions,
+		Platform:    true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    j.config.Issuer,
+			Subject:   fmt.Sprintf("%d", userID),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(j.config.Secret))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate platform access token: %w", err)
+	}
+
+	return tokenString, expiresAt, nil
+}
+
 func (j *JWTUtil) GenerateRefreshToken(userID uint, tenantCode string) (string, error) {
 	expiresAt := time.Now().Add(j.config.RefreshTokenTTL)
 
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pos-mojosoft-so-service/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ListSpec describes what a list endpoint lets clients sort, search and
+// filter by date on. Keys of Sorts and DateRanges are the names used in the
+// query string; values are the table columns they map to. "id" is always
+// sortable.
+type ListSpec struct {
+	Sorts       map[string]string
+	DefaultSort string
+	Search      []string
+	DateRanges  map[string]string
+}
+
+// ListQuery is a parsed page/page_size or cursor request with sort, search
+// and date-range filters. Build it with ParseListQuery and run it with Find.
+type ListQuery struct {
+	Page     int
+	PageSize int
+
+	cursorMode bool
+	cursor     interface{}
+	sortColumn string
+	sortDesc   bool
+	search     string
+	columns    []string
+	scopes     []func(*gorm.DB) *gorm.DB
+}
+
+// ParseListQuery reads page, page_size (or limit), cursor, sort, search and
+// the <prefix>_from/<prefix>_to date ranges of spec, parsing dates in loc.
+// It writes a validation response and returns false when any is invalid.
+func ParseListQuery(c *gin.Context, loc *time.Location, spec ListSpec) (*ListQuery, bool) {
+	var errs []models.ErrorDetail
+	q := &ListQuery{Page: 1, PageSize: DefaultPageSize, columns: spec.Search}
+
+	if page := c.Query("page"); page != "" {
+		value, err := strconv.Atoi(page)
+		if err != nil || value < 1 {
+			errs = append(errs, models.ErrorDetail{Field: "page", Message: "Page must be a positive integer"})
+		} else {
+			q.Page = value
+		}
+	}
+
+	pageSizeField, pageSize := "page_size", c.Query("page_size")
+	if pageSize == "" {
+		pageSizeField, pageSize = "limit", c.Query("limit")
+	}
+	if pageSize != "" {
+		value, err := strconv.Atoi(pageSize)
+		if err != nil || value < 1 || value > MaxPageSize {
+			errs = append(errs, models.ErrorDetail{
+				Field:   pageSizeField,
+				Message: fmt.Sprintf("Page size must be between 1 and %d", MaxPageSize),
+			})
+		} else {
+			q.PageSize = value
+		}
+	}
+
+	sortKey := c.Query("sort")
+	if cursor, exists := c.GetQuery("cursor"); exists {
+		q.cursorMode = true
+		q.Page = 0
+		if sortKey == "" {
+			sortKey = "id"
+		}
+		if cursor != "" {
+			value, err := decodeCursor(cursor)
+			if err != nil {
+				errs = append(errs, models.ErrorDetail{Field: "cursor", Message: "Cursor is invalid"})
+			} else {
+				q.cursor = value
+			}
+		}
+	}
+	if sortKey == "" {
+		sortKey = spec.DefaultSort
+	}
+	if sortKey == "" {
+		sortKey = "-id"
+	}
+
+	key := strings.TrimPrefix(sortKey, "-")
+	q.sortDesc = key != sortKey
+	column, exists := spec.Sorts[key]
+	if key == "id" {
+		column, exists = "id", true
+	}
+	switch {
+	case !exists:
+		errs = append(errs, models.ErrorDetail{
+			Field:   "sort",
+			Message: "Sort must be one of: " + strings.Join(sortKeys(spec), ", ") + " (prefix with - for descending)",
+		})
+	case q.cursorMode && column != "id":
+		errs = append(errs, models.ErrorDetail{Field: "sort", Message: "Cursor pagination only supports sorting by id"})
+	default:
+		q.sortColumn = column
+	}
+
+	q.search = strings.TrimSpace(c.Query("search"))
+
+	dates := NewDateParser(loc)
+	prefixes := make([]string, 0, len(spec.DateRanges))
+	for prefix := range spec.DateRanges {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		from, to := dates.Range(c, prefix)
+		q.scopes = append(q.scopes, DateRangeScope(spec.DateRanges[prefix], from, to))
+	}
+	errs = append(errs, dates.Errors...)
+
+	if len(errs) > 0 {
+		ValidationErrorResponse(c, errs)
+		return nil, false
+	}
+	return q, true
+}
+
+// Find counts the rows matched by query and loads the requested page into
+// dest, a pointer to a slice of models with an ID field. The preloads are
+// applied to the page query only.
+func (q *ListQuery) Find(query *gorm.DB, dest interface{}, preloads ...string) (models.PaginationMeta, error) {
+	query = query.Scopes(q.filter)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return models.PaginationMeta{}, err
+	}
+
+	meta := models.PaginationMeta{
+		Page:       q.Page,
+		PageSize:   q.PageSize,
+		TotalItems: total,
+		TotalPages: int(math.Ceil(float64(total) / float64(q.PageSize))),
+	}
+
+	direction := "ASC"
+	if q.sortDesc {
+		direction = "DESC"
+	}
+	page := query.Session(&gorm.Session{})
+	for _, preload := range preloads {
+		page = page.Preload(preload)
+	}
+	page = page.Order(q.sortColumn + " " + direction)
+	if q.sortColumn != "id" {
+		page = page.Order("id " + direction)
+	}
+
+	if !q.cursorMode {
+		err := page.Offset((q.Page - 1) * q.PageSize).Limit(q.PageSize).Find(dest).Error
+		return meta, err
+	}
+
+	if q.cursor != nil {
+		operator := ">"
+		if q.sortDesc {
+			operator = "<"
+		}
+		page = page.Where("id "+operator+" ?", q.cursor)
+	}
+	// Load one row past the page to learn whether another page follows
+	if err := page.Limit(q.PageSize + 1).Find(dest).Error; err != nil {
+		return meta, err
+	}
+	rows := reflect.ValueOf(dest).Elem()
+	if rows.Len() > q.PageSize {
+		rows.SetLen(q.PageSize)
+		last := rows.Index(q.PageSize - 1).FieldByName("ID").Interface()
+		meta.NextCursor = encodeCursor(fmt.Sprint(last))
+	}
+	return meta, nil
+}
+
+// filter applies the search term and date ranges
+func (q *ListQuery) filter(db *gorm.DB) *gorm.DB {
+	db = db.Scopes(q.scopes...)
+	if q.search == "" || len(q.columns) == 0 {
+		return db
+	}
+	conditions := make([]string, len(q.columns))
+	args := make([]interface{}, len(q.columns))
+	for i, column := range q.columns {
+		conditions[i] = column + " ILIKE ?"
+		args[i] = "%" + q.search + "%"
+	}
+	return db.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// sortKeys lists the accepted sort keys in a stable order
+func sortKeys(spec ListSpec) []string {
+	keys := []string{"id"}
+	for key := range spec.Sorts {
+		if key != "id" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys[1:])
+	return keys
+}
+
+// encodeCursor makes an opaque cursor from the last ID of a page
+func encodeCursor(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// decodeCursor returns the ID a cursor was made from; integer IDs come back
+// as int64 so they compare numerically
+func decodeCursor(cursor string) (interface{}, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if id, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+		return id, nil
+	}
+	return string(raw), nil
+}
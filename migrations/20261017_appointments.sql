@@ -0,0 +1,49 @@
+-- Appointment scheduling. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_appointments.sql
+
+-- A booked time of a room and staff for a customer, usually for a sold
+-- service. Cancelled appointments are kept with status 'cancelled'.
+CREATE TABLE IF NOT EXISTS appointment (
+    id                   uuid        PRIMARY KEY,
+    location_id          integer     NOT NULL,
+    customer_id          integer,
+    salesorder_id        uuid,
+    salesorderservice_id integer,
+    room_id              integer,
+    doctor_id            integer,
+    nurse_id             integer,
+    beautician_id        integer,
+    starts_at            timestamptz NOT NULL,
+    ends_at              timestamptz NOT NULL,
+    status               varchar(20) NOT NULL DEFAULT 'booked',
+    reschedulecount      integer     NOT NULL DEFAULT 0,
+    note                 text,
+    cancelreason         text,
+    cancelled_at         timestamp,
+    cancelled_by         bigint,
+    created_by           bigint,
+    updated_by           bigint,
+    deleted_by           bigint,
+    deleted_at           timestamp,
+    created_at           timestamp   DEFAULT CURRENT_TIMESTAMP,
+    updated_at           timestamp   DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT appointment_time_check CHECK (ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_appointment_location_starts ON appointment (location_id, starts_at);
+-- A sold service has at most one booked appointment
+CREATE UNIQUE INDEX IF NOT EXISTS uq_appointment_service_booked ON appointment (salesorderservice_id)
+    WHERE status = 'booked' AND deleted_at IS NULL;
+
+-- Opening hours and slot length per location. Locations without a row use
+-- the APPOINTMENT_* defaults.
+CREATE TABLE IF NOT EXISTS appointment_hours (
+    location_id integer PRIMARY KEY,
+    opens_at    time    NOT NULL,
+    closes_at   time    NOT NULL,
+    slotminutes integer NOT NULL,
+    updated_by  bigint,
+    updated_at  timestamp DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT appointment_hours_check CHECK (closes_at > opens_at AND slotminutes > 0)
+);
@@ -0,0 +1,36 @@
+-- Staff commission rules. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_commissions.sql
+
+-- What a staff role earns: calcvalue percent of the amount sold, or
+-- calcvalue per unit sold or per treatment. Empty item, service and
+-- location match anything; the most specific live rule wins.
+CREATE TABLE IF NOT EXISTS commission_rule (
+    id          serial        PRIMARY KEY,
+    role        varchar(20)   NOT NULL,
+    item_id     integer,
+    service_id  integer,
+    location_id integer,
+    calctype    varchar(20)   NOT NULL,
+    calcvalue   numeric(18,2) NOT NULL,
+    note        text,
+    created_by  bigint,
+    updated_by  bigint,
+    deleted_by  bigint,
+    deleted_at  timestamp,
+    created_at  timestamp     DEFAULT CURRENT_TIMESTAMP,
+    updated_at  timestamp     DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT commission_rule_role_check CHECK (role IN ('promoter', 'doctor', 'nurse', 'beautician')),
+    CONSTRAINT commission_rule_calc_check CHECK (
+        calcvalue > 0 AND (calctype = 'fixed' OR (calctype = 'percentage' AND calcvalue <= 100))
+    )
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_commission_rule_scope ON commission_rule
+    (role, COALESCE(item_id, 0), COALESCE(service_id, 0), COALESCE(location_id, 0))
+    WHERE deleted_at IS NULL;
+
+-- Promoted lines and completed treatments are read by period
+CREATE INDEX IF NOT EXISTS idx_sales_order_detail_promoter ON sales_order_detail (promoter_id)
+    WHERE promoter_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_treatment_completed ON treatment (completed_at);
@@ -0,0 +1,33 @@
+-- Document numbering tables. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_document_numbering.sql
+
+-- Last number issued per document type, location and year. Location 0 holds
+-- documents created without a location.
+CREATE TABLE IF NOT EXISTS document_sequence (
+    document_type varchar(30) NOT NULL,
+    location_id   integer     NOT NULL DEFAULT 0,
+    year          integer     NOT NULL,
+    last_number   bigint      NOT NULL DEFAULT 0,
+    updated_at    timestamp   DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_type, location_id, year)
+);
+
+-- Optional per-tenant overrides of the DOC_NUMBER_FORMAT_* defaults
+CREATE TABLE IF NOT EXISTS document_format (
+    document_type varchar(30)  PRIMARY KEY,
+    format        varchar(100) NOT NULL
+);
+
+-- Short location codes used by the {location} placeholder
+CREATE TABLE IF NOT EXISTS document_location_code (
+    location_id integer     PRIMARY KEY,
+    code        varchar(10) NOT NULL
+);
+
+-- AR receipts had no text column for a formatted number
+ALTER TABLE ar_receipt ADD COLUMN IF NOT EXISTS invnumber varchar(50);
+
+CREATE INDEX IF NOT EXISTS idx_sales_order_invnumber ON sales_order (invnumber);
+CREATE INDEX IF NOT EXISTS idx_treatment_docnumber ON treatment (docnumber);
+CREATE INDEX IF NOT EXISTS idx_ar_receipt_invnumber ON ar_receipt (invnumber);
@@ -0,0 +1,39 @@
+-- Package expiry and forfeiture. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_package_expiry.sql
+
+-- How long the sessions of a package stay redeemable after the order is
+-- posted. A rule names either an item or a service; item rules win.
+CREATE TABLE IF NOT EXISTS package_validity (
+    id              serial    PRIMARY KEY,
+    item_id         integer,
+    service_id      integer,
+    validitymonths  integer   NOT NULL DEFAULT 0,
+    validitydays    integer   NOT NULL DEFAULT 0,
+    note            text,
+    created_by      bigint,
+    updated_by      bigint,
+    deleted_by      bigint,
+    deleted_at      timestamp,
+    created_at      timestamp DEFAULT CURRENT_TIMESTAMP,
+    updated_at      timestamp DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT package_validity_target_check CHECK ((item_id IS NULL) <> (service_id IS NULL)),
+    CONSTRAINT package_validity_length_check CHECK (validitymonths >= 0 AND validitydays >= 0 AND validitymonths + validitydays > 0)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS package_validity_item_uniq
+    ON package_validity (item_id) WHERE item_id IS NOT NULL AND deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS package_validity_service_uniq
+    ON package_validity (service_id) WHERE service_id IS NOT NULL AND deleted_at IS NULL;
+
+-- Last day a package line can be redeemed, and the sessions it lost when
+-- it expired unused
+ALTER TABLE sales_order_detail ADD COLUMN IF NOT EXISTS expirydate date;
+ALTER TABLE sales_order_detail ADD COLUMN IF NOT EXISTS forfeitedsessions integer;
+ALTER TABLE sales_order_detail ADD COLUMN IF NOT EXISTS forfeited_at timestamp;
+
+CREATE INDEX IF NOT EXISTS idx_sales_order_detail_expirydate
+    ON sales_order_detail (expirydate) WHERE expirydate IS NOT NULL;
+
+-- Manager who let a treatment redeem a session of an expired package
+ALTER TABLE treatment ADD COLUMN IF NOT EXISTS expiryoverride_by bigint;
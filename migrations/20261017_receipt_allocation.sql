@@ -0,0 +1,25 @@
+-- AR receipt allocation. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_receipt_allocation.sql
+
+-- ar_receipt_detail.arreceipt_id was an integer and could never reference a
+-- receipt (uuid ids), so existing values are cleared by the conversion
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'ar_receipt_detail'
+          AND column_name = 'arreceipt_id') <> 'uuid' THEN
+        ALTER TABLE ar_receipt_detail ALTER COLUMN arreceipt_id TYPE uuid USING NULL;
+    END IF;
+END $$;
+
+-- Allocations are read per receipt when it is voided and per order when
+-- its balance is explained
+CREATE INDEX IF NOT EXISTS idx_ar_receipt_detail_receipt ON ar_receipt_detail (arreceipt_id)
+    WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_ar_receipt_detail_sales_order ON ar_receipt_detail (salesorder_id)
+    WHERE deleted_at IS NULL;
+
+-- Auto-allocation looks up a customer's open orders oldest first
+CREATE INDEX IF NOT EXISTS idx_sales_order_customer_posted ON sales_order (costumer_id, posteddate)
+    WHERE deleted_at IS NULL;
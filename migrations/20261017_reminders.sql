@@ -0,0 +1,36 @@
+-- Treatment reminders. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_reminders.sql
+
+-- Message templates per reminder kind. Kinds without an active template use
+-- the built-in defaults.
+CREATE TABLE IF NOT EXISTS reminder_template (
+    id          serial      PRIMARY KEY,
+    kind        varchar(20) NOT NULL,
+    reminded_id integer,
+    subject     text,
+    body        text        NOT NULL,
+    created_by  bigint,
+    updated_by  bigint,
+    deleted_by  bigint,
+    deleted_at  timestamp,
+    created_at  timestamp   DEFAULT CURRENT_TIMESTAMP,
+    updated_at  timestamp   DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT reminder_template_kind_check CHECK (kind IN ('appointment', 'package'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS uq_reminder_template_kind ON reminder_template (kind)
+    WHERE deleted_at IS NULL;
+
+-- Delivery status of the last reminder sent for a service.
+-- reminderfor is the schedule date an appointment reminder was for, so a
+-- rescheduled service is reminded again.
+ALTER TABLE sales_order_service
+    ADD COLUMN IF NOT EXISTS reminderstatus   varchar(20),
+    ADD COLUMN IF NOT EXISTS reminded_at      timestamp,
+    ADD COLUMN IF NOT EXISTS reminderfor      date,
+    ADD COLUMN IF NOT EXISTS reminderattempts integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS remindererror    text;
+
+CREATE INDEX IF NOT EXISTS idx_sales_order_service_schedule ON sales_order_service (schedule)
+    WHERE deleted_at IS NULL;
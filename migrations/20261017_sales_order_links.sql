@@ -0,0 +1,53 @@
+-- Sales order links. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_sales_order_links.sql
+
+-- salesorder_id was an integer in every table linking to a sales order,
+-- while sales orders are keyed by uuid. Existing links hold the legacy order
+-- number, sales_order.docnumber, and are moved to the uuid of the order with
+-- that number. The migration fails, changing nothing, if a link matches no
+-- order or more than one; fix those rows first. The integer is kept in
+-- salesorder_legacy_id.
+DO $$
+DECLARE
+    link_table text;
+    link_type text;
+    unmapped bigint;
+BEGIN
+    FOREACH link_table IN ARRAY ARRAY['sales_order_detail', 'sales_order_service', 'ar_receipt_detail', 'treatment'] LOOP
+        SELECT data_type INTO link_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = link_table
+          AND column_name = 'salesorder_id';
+
+        IF link_type IN ('smallint', 'integer', 'bigint') THEN
+            EXECUTE format('ALTER TABLE %I ADD COLUMN salesorder_uuid uuid', link_table);
+            EXECUTE format(
+                'UPDATE %I link SET salesorder_uuid = so.id
+                   FROM sales_order so
+                  WHERE so.docnumber = link.salesorder_id
+                    AND (SELECT count(*) FROM sales_order dup WHERE dup.docnumber = so.docnumber) = 1',
+                link_table);
+
+            EXECUTE format('SELECT count(*) FROM %I WHERE salesorder_id IS NOT NULL AND salesorder_uuid IS NULL', link_table)
+                INTO unmapped;
+            IF unmapped > 0 THEN
+                RAISE EXCEPTION '% row(s) of % have a salesorder_id that matches no single sales_order.docnumber; fix them and run the migration again',
+                    unmapped, link_table;
+            END IF;
+
+            EXECUTE format('ALTER TABLE %I RENAME COLUMN salesorder_id TO salesorder_legacy_id', link_table);
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN salesorder_legacy_id DROP NOT NULL', link_table);
+            EXECUTE format('ALTER TABLE %I RENAME COLUMN salesorder_uuid TO salesorder_id', link_table);
+        ELSIF link_type <> 'uuid' THEN
+            -- A text column holding order uuids is cast; any other value fails the cast
+            EXECUTE format('ALTER TABLE %I ALTER COLUMN salesorder_id TYPE uuid USING NULLIF(salesorder_id::text, %L)::uuid', link_table, '');
+        END IF;
+    END LOOP;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_sales_order_detail_sales_order ON sales_order_detail (salesorder_id)
+    WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_sales_order_service_sales_order ON sales_order_service (salesorder_id)
+    WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_treatment_sales_order ON treatment (salesorder_id)
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,21 @@
+-- Sales order status history. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_sales_order_status_log.sql
+
+-- Every status change of a sales order, dated in the tenant's timezone, so
+-- reports can tell which status an order had on a past date. from_status_id
+-- is the status before the change, NULL for an order without one (a draft).
+-- Orders not changed since this table was created have no rows; reports use
+-- their current status and posted date.
+CREATE TABLE IF NOT EXISTS sales_order_status_log (
+    id             serial      PRIMARY KEY,
+    salesorder_id  uuid        NOT NULL REFERENCES sales_order (id),
+    event          varchar(20) NOT NULL,
+    from_status_id integer,
+    status_id      integer     NOT NULL,
+    effective_date date        NOT NULL,
+    created_by     bigint,
+    created_at     timestamp   DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sales_order_status_log_order ON sales_order_status_log (salesorder_id, effective_date, id);
@@ -0,0 +1,17 @@
+-- Package session redemption. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_treatment_sessions.sql
+
+-- Which session of the package line a treatment used
+ALTER TABLE treatment ADD COLUMN IF NOT EXISTS sessionnumber integer;
+
+-- A session can only be redeemed by one live treatment
+CREATE UNIQUE INDEX IF NOT EXISTS treatment_session_uniq
+    ON treatment (salesorderdetail_id, sessionnumber)
+    WHERE sessionnumber IS NOT NULL AND deleted_at IS NULL;
+
+-- Never use more sessions than were sold. NOT VALID skips rows written
+-- before redemption was tracked.
+ALTER TABLE sales_order_detail DROP CONSTRAINT IF EXISTS sales_order_detail_sessions_check;
+ALTER TABLE sales_order_detail ADD CONSTRAINT sales_order_detail_sessions_check
+    CHECK (COALESCE(usedsessions, 0) <= COALESCE(quantity, 0)) NOT VALID;
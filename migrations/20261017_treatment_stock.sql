@@ -0,0 +1,74 @@
+-- Treatment consumables stock-out. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_treatment_stock.sql
+
+-- treatment_detail.treatment_id was an integer and could never reference a
+-- treatment (uuid ids), so existing values are cleared by the conversion
+DO $$
+BEGIN
+    IF (SELECT data_type FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'treatment_detail'
+          AND column_name = 'treatment_id') <> 'uuid' THEN
+        ALTER TABLE treatment_detail ALTER COLUMN treatment_id TYPE uuid USING NULL;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_treatment_detail_treatment ON treatment_detail (treatment_id)
+    WHERE deleted_at IS NULL;
+
+-- How many base units of an item one unit holds, e.g. a box of 10 ampoules.
+-- Rules without item_id apply to every item; item rules win.
+CREATE TABLE IF NOT EXISTS unit_conversion (
+    id          serial    PRIMARY KEY,
+    item_id     integer,
+    unit_id     integer   NOT NULL,
+    baseunit_id integer   NOT NULL,
+    factor      integer   NOT NULL,
+    note        text,
+    created_by  bigint,
+    updated_by  bigint,
+    deleted_by  bigint,
+    deleted_at  timestamp,
+    created_at  timestamp DEFAULT CURRENT_TIMESTAMP,
+    updated_at  timestamp DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unit_conversion_factor_check CHECK (factor > 0),
+    CONSTRAINT unit_conversion_units_check CHECK (unit_id <> baseunit_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS unit_conversion_uniq
+    ON unit_conversion (COALESCE(item_id, 0), unit_id) WHERE deleted_at IS NULL;
+
+-- Outbox of stock movements for the inventory service. Rows are written in
+-- the transaction that posts or voids a treatment and relayed in seq order;
+-- id is the idempotency key the inventory service deduplicates on.
+CREATE TABLE IF NOT EXISTS stock_movement_outbox (
+    id                 uuid        PRIMARY KEY,
+    seq                bigserial   NOT NULL UNIQUE,
+    direction          varchar(3)  NOT NULL,
+    treatment_id       uuid        NOT NULL,
+    treatmentdetail_id integer     NOT NULL,
+    reverses_id        uuid        REFERENCES stock_movement_outbox (id),
+    location_id        integer,
+    item_id            integer     NOT NULL,
+    unit_id            integer,
+    quantity           integer     NOT NULL,
+    baseunit_id        integer,
+    basequantity       integer     NOT NULL,
+    movementdate       date        NOT NULL,
+    status             varchar(10) NOT NULL DEFAULT 'pending',
+    attempts           integer     NOT NULL DEFAULT 0,
+    lasterror          text,
+    sent_at            timestamp,
+    created_by         bigint,
+    created_at         timestamp   DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT stock_movement_direction_check CHECK (direction IN ('out', 'in')),
+    CONSTRAINT stock_movement_status_check CHECK (status IN ('pending', 'sent')),
+    CONSTRAINT stock_movement_quantity_check CHECK (quantity > 0 AND basequantity > 0)
+);
+
+-- A detail is stocked out once and reversed once
+CREATE UNIQUE INDEX IF NOT EXISTS stock_movement_detail_uniq
+    ON stock_movement_outbox (treatmentdetail_id, direction);
+CREATE INDEX IF NOT EXISTS idx_stock_movement_pending
+    ON stock_movement_outbox (seq) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_stock_movement_treatment ON stock_movement_outbox (treatment_id);
@@ -0,0 +1,47 @@
+-- Treatment workflow. Run once in every tenant schema, e.g.
+--   SET search_path TO alana;
+--   \i migrations/20261017_treatment_workflow.sql
+
+-- Clinical statuses of a treatment, matched to the workflow by name
+CREATE TABLE IF NOT EXISTS treatment_status (
+    id         serial       PRIMARY KEY,
+    name       varchar(50)  NOT NULL,
+    created_by bigint,
+    updated_by bigint,
+    deleted_by bigint,
+    deleted_at timestamp,
+    created_at timestamp    DEFAULT CURRENT_TIMESTAMP,
+    updated_at timestamp    DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO treatment_status (name)
+SELECT v.name
+FROM (VALUES (1, 'Scheduled'), (2, 'In Progress'), (3, 'Completed'), (4, 'Signed Off')) AS v(position, name)
+WHERE NOT EXISTS (
+    SELECT 1 FROM treatment_status s WHERE lower(s.name) = lower(v.name) AND s.deleted_at IS NULL
+)
+ORDER BY v.position;
+
+-- Treatments without a status are scheduled; status IDs that were set
+-- before the table existed are left as they are
+ALTER TABLE treatment ADD COLUMN IF NOT EXISTS started_at   timestamp;
+ALTER TABLE treatment ADD COLUMN IF NOT EXISTS completed_at timestamp;
+ALTER TABLE treatment ADD COLUMN IF NOT EXISTS signedoff_at timestamp;
+ALTER TABLE treatment ADD COLUMN IF NOT EXISTS signedoff_by bigint;
+
+CREATE INDEX IF NOT EXISTS idx_treatment_status ON treatment (status_id);
+
+ALTER TABLE sales_order_service ADD COLUMN IF NOT EXISTS treated_at timestamp;
+
+-- Changes to completed treatments, with the treatment before and after
+CREATE TABLE IF NOT EXISTS treatment_correction (
+    id           serial    PRIMARY KEY,
+    treatment_id uuid      NOT NULL REFERENCES treatment (id),
+    reason       text      NOT NULL,
+    original     jsonb     NOT NULL,
+    corrected    jsonb     NOT NULL,
+    created_by   bigint,
+    created_at   timestamp DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_treatment_correction_treatment ON treatment_correction (treatment_id);